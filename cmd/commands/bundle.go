@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/postgres"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"go.uber.org/zap"
+)
+
+// Export writes the project bundle into the file.
+// Usage: export <project> <file>
+func Export() error {
+	cfg := struct {
+		Gisquick struct {
+			ProjectsRoot    string `conf:"default:/publish"`
+			ProjectsStorage string `conf:"default:disk"`
+		}
+		S3   S3Config
+		Args conf.Args
+	}{}
+
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	if len(cfg.Args) != 2 {
+		return fmt.Errorf("expected arguments: <project> <file>")
+	}
+	projectName, filename := cfg.Args.Num(0), cfg.Args.Num(1)
+
+	log, err := createLogger(zap.InfoLevel)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	defer log.Sync()
+
+	diskStorage := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	projectsRepo, err := createProjectsRepository(log, cfg.Gisquick.ProjectsStorage, diskStorage, cfg.S3)
+	if err != nil {
+		return fmt.Errorf("creating projects storage: %w", err)
+	}
+	defer projectsRepo.Close()
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating bundle file: %w", err)
+	}
+	if err := projectsRepo.Export(projectName, f); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return fmt.Errorf("exporting project: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing bundle file: %w", err)
+	}
+	fmt.Printf("Project %s was exported into %s\n", projectName, filename)
+	return nil
+}
+
+// Import creates new project from the project bundle.
+// Usage: import <file> <project>
+func Import() error {
+	cfg := struct {
+		Gisquick struct {
+			ProjectsRoot         string   `conf:"default:/publish"`
+			ProjectsStorage      string   `conf:"default:disk"`
+			ProjectsIndex        bool     `conf:"default:false"`
+			ProjectSizeLimit     ByteSize `conf:"default:-1"`
+			AccountStorageLimit  ByteSize `conf:"default:-1"`
+			AccountProjectsLimit int      `conf:"default:-1"`
+			AccountLimiterConfig string
+		}
+		S3       S3Config
+		Postgres struct {
+			User               string `conf:"default:postgres"`
+			Password           string `conf:"default:nexus,mask"`
+			Host               string `conf:"default:localhost"`
+			Name               string `conf:"default:postgres,env:POSTGRES_DB"`
+			Port               int    `conf:"default:5433"`
+			SSLMode            string `conf:"default:prefer"`
+			StatementCacheMode string `conf:"default:prepare"`
+		}
+		Args conf.Args
+	}{}
+
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	if len(cfg.Args) != 2 {
+		return fmt.Errorf("expected arguments: <file> <project>")
+	}
+	filename, projectName := cfg.Args.Num(0), cfg.Args.Num(1)
+
+	log, err := createLogger(zap.InfoLevel)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	defer log.Sync()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("opening bundle file: %w", err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("opening bundle file: %w", err)
+	}
+
+	dbConn, err := server.OpenDB(server.DBConfig{
+		User:               cfg.Postgres.User,
+		Password:           cfg.Postgres.Password,
+		Host:               cfg.Postgres.Host,
+		Port:               cfg.Postgres.Port,
+		Name:               cfg.Postgres.Name,
+		MaxIdleConns:       1,
+		MaxOpenConns:       1,
+		SSLMode:            cfg.Postgres.SSLMode,
+		StatementCacheMode: cfg.Postgres.StatementCacheMode,
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to db: %w", err)
+	}
+	defer dbConn.Close()
+
+	username := strings.Split(projectName, "/")[0]
+	exists, err := postgres.NewAccountsRepository(dbConn).UsernameExists(username)
+	if err != nil {
+		return fmt.Errorf("checking target account: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("account does not exists: %s", username)
+	}
+
+	diskStorage := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	projectsRepo, err := createProjectsRepository(log, cfg.Gisquick.ProjectsStorage, diskStorage, cfg.S3)
+	if err != nil {
+		return fmt.Errorf("creating projects storage: %w", err)
+	}
+	defaultAccountConfig := domain.AccountConfig{
+		ProjectsCountLimit: cfg.Gisquick.AccountProjectsLimit,
+		ProjectSizeLimit:   domain.ByteSize(cfg.Gisquick.ProjectSizeLimit),
+		StorageLimit:       domain.ByteSize(cfg.Gisquick.AccountStorageLimit),
+	}
+	var limiter application.AccountsLimiter
+	if cfg.Gisquick.AccountLimiterConfig != "" {
+		limiter = project.NewConfigurableProjectsLimiter(log, cfg.Gisquick.AccountLimiterConfig, defaultAccountConfig)
+	} else {
+		limiter = project.NewSimpleProjectsLimiter(defaultAccountConfig)
+	}
+	projectsServ := application.NewProjectsService(log, projectsRepo, limiter)
+	defer projectsServ.Close()
+	projectsServ.SetRedirects(postgres.NewProjectRedirects(dbConn))
+	if cfg.Gisquick.ProjectsIndex {
+		projectsServ.SetIndex(postgres.NewProjectsIndex(dbConn))
+	}
+
+	info, err := projectsServ.Import(projectName, f, stat.Size())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Project %s was imported (%d bytes)\n", info.Name, info.Size)
+	return nil
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/postgres"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"go.uber.org/zap"
+)
+
+// saveIntegrityReport writes JSON report of the integrity check into the file (stdout when
+// filename is empty)
+func saveIntegrityReport(filename string, report domain.IntegrityReport) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+	if filename == "" {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	tmpPath := filename + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filename)
+}
+
+// Fsck checks integrity of the projects files indexes and optionally repairs them.
+// Usage: fsck [--repair] [--report <file>] [project...]
+func Fsck() error {
+	cfg := struct {
+		Gisquick struct {
+			ProjectsRoot    string `conf:"default:/publish"`
+			ProjectsStorage string `conf:"default:disk"`
+			ProjectsIndex   bool   `conf:"default:false"`
+		}
+		S3       S3Config
+		Postgres struct {
+			User               string `conf:"default:postgres"`
+			Password           string `conf:"default:nexus,mask"`
+			Host               string `conf:"default:localhost"`
+			Name               string `conf:"default:postgres,env:POSTGRES_DB"`
+			Port               int    `conf:"default:5433"`
+			SSLMode            string `conf:"default:prefer"`
+			StatementCacheMode string `conf:"default:prepare"`
+		}
+		Repair bool   `conf:"help:fix files indexes and projects sizes"`
+		Report string `conf:"help:output file of the JSON report (defaults to stdout)"`
+		Args   conf.Args
+	}{}
+
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+
+	// report can be written to stdout, so only warnings are logged
+	log, err := createLogger(zap.WarnLevel)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	defer log.Sync()
+
+	diskStorage := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	projectsRepo, err := createProjectsRepository(log, cfg.Gisquick.ProjectsStorage, diskStorage, cfg.S3)
+	if err != nil {
+		return fmt.Errorf("creating projects storage: %w", err)
+	}
+	unlimited := domain.AccountConfig{ProjectsCountLimit: -1, ProjectSizeLimit: -1, StorageLimit: -1}
+	projectsServ := application.NewProjectsService(log, projectsRepo, project.NewSimpleProjectsLimiter(unlimited))
+	defer projectsServ.Close()
+	if cfg.Gisquick.ProjectsIndex && cfg.Repair {
+		dbConn, err := server.OpenDB(server.DBConfig{
+			User:               cfg.Postgres.User,
+			Password:           cfg.Postgres.Password,
+			Host:               cfg.Postgres.Host,
+			Port:               cfg.Postgres.Port,
+			Name:               cfg.Postgres.Name,
+			MaxIdleConns:       1,
+			MaxOpenConns:       1,
+			SSLMode:            cfg.Postgres.SSLMode,
+			StatementCacheMode: cfg.Postgres.StatementCacheMode,
+		})
+		if err != nil {
+			return fmt.Errorf("connecting to db: %w", err)
+		}
+		defer dbConn.Close()
+		// sizes of repaired projects are updated in the index
+		projectsServ.SetIndex(postgres.NewProjectsIndex(dbConn))
+	}
+
+	projects := make([]string, len(cfg.Args))
+	for i := range cfg.Args {
+		projects[i] = cfg.Args.Num(i)
+	}
+	report, err := projectsServ.CheckIntegrity(cfg.Repair, projects...)
+	if err != nil {
+		return err
+	}
+	if err := saveIntegrityReport(cfg.Report, report); err != nil {
+		return fmt.Errorf("saving report: %w", err)
+	}
+	if report.Issues > report.Repaired {
+		return fmt.Errorf("found issues in %d projects", report.Issues-report.Repaired)
+	}
+	return nil
+}
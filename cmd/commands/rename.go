@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/postgres"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/mapcache"
+	"github.com/gisquick/gisquick-server/internal/server"
+	"go.uber.org/zap"
+)
+
+// Rename renames the project or transfers it into other user's account.
+// Usage: rename <project> <new name>
+func Rename() error {
+	cfg := struct {
+		Gisquick struct {
+			ProjectsRoot         string `conf:"default:/publish"`
+			ProjectsStorage      string `conf:"default:disk"`
+			ProjectsIndex        bool   `conf:"default:false"`
+			MapCacheRoot         string
+			MapCacheStorage      string   `conf:"default:fs"`
+			ProjectSizeLimit     ByteSize `conf:"default:-1"`
+			AccountStorageLimit  ByteSize `conf:"default:-1"`
+			AccountProjectsLimit int      `conf:"default:-1"`
+			AccountLimiterConfig string
+		}
+		S3       S3Config
+		Postgres struct {
+			User               string `conf:"default:postgres"`
+			Password           string `conf:"default:nexus,mask"`
+			Host               string `conf:"default:localhost"`
+			Name               string `conf:"default:postgres,env:POSTGRES_DB"`
+			Port               int    `conf:"default:5433"`
+			SSLMode            string `conf:"default:prefer"`
+			StatementCacheMode string `conf:"default:prepare"`
+		}
+		Args conf.Args
+	}{}
+
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	if len(cfg.Args) != 2 {
+		return fmt.Errorf("expected arguments: <project> <new name>")
+	}
+	projectName, newName := cfg.Args.Num(0), cfg.Args.Num(1)
+
+	// running server would keep serving (and caching) the project under the old name
+	unlockRoot, err := project.LockOffline(cfg.Gisquick.ProjectsRoot)
+	if errors.Is(err, project.ErrServerRunning) {
+		return fmt.Errorf("server is running, stop it or rename the project through the API (/api/project/rename)")
+	} else if err != nil {
+		return fmt.Errorf("locking projects directory: %w", err)
+	}
+	defer unlockRoot()
+
+	log, err := createLogger(zap.InfoLevel)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	defer log.Sync()
+
+	dbConn, err := server.OpenDB(server.DBConfig{
+		User:               cfg.Postgres.User,
+		Password:           cfg.Postgres.Password,
+		Host:               cfg.Postgres.Host,
+		Port:               cfg.Postgres.Port,
+		Name:               cfg.Postgres.Name,
+		MaxIdleConns:       1,
+		MaxOpenConns:       1,
+		SSLMode:            cfg.Postgres.SSLMode,
+		StatementCacheMode: cfg.Postgres.StatementCacheMode,
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to db: %w", err)
+	}
+	defer dbConn.Close()
+
+	username := strings.Split(newName, "/")[0]
+	exists, err := postgres.NewAccountsRepository(dbConn).UsernameExists(username)
+	if err != nil {
+		return fmt.Errorf("checking target account: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("account does not exists: %s", username)
+	}
+
+	diskStorage := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	projectsRepo, err := createProjectsRepository(log, cfg.Gisquick.ProjectsStorage, diskStorage, cfg.S3)
+	if err != nil {
+		return fmt.Errorf("creating projects storage: %w", err)
+	}
+	defaultAccountConfig := domain.AccountConfig{
+		ProjectsCountLimit: cfg.Gisquick.AccountProjectsLimit,
+		ProjectSizeLimit:   domain.ByteSize(cfg.Gisquick.ProjectSizeLimit),
+		StorageLimit:       domain.ByteSize(cfg.Gisquick.AccountStorageLimit),
+	}
+	var limiter application.AccountsLimiter
+	if cfg.Gisquick.AccountLimiterConfig != "" {
+		limiter = project.NewConfigurableProjectsLimiter(log, cfg.Gisquick.AccountLimiterConfig, defaultAccountConfig)
+	} else {
+		limiter = project.NewSimpleProjectsLimiter(defaultAccountConfig)
+	}
+	projectsServ := application.NewProjectsService(log, projectsRepo, limiter)
+	defer projectsServ.Close()
+	projectsServ.SetRedirects(postgres.NewProjectRedirects(dbConn))
+	if cfg.Gisquick.ProjectsIndex {
+		// index is only updated, so it's not required to be synchronized
+		projectsServ.SetIndex(postgres.NewProjectsIndex(dbConn))
+	}
+
+	if cfg.Gisquick.MapCacheRoot != "" {
+		store, err := createTileStore(log, cfg.Gisquick.MapCacheStorage, cfg.Gisquick.MapCacheRoot, cfg.S3)
+		if err != nil {
+			return fmt.Errorf("creating mapcache storage: %w", err)
+		}
+		mc := mapcache.NewMapcache(log, cfg.Gisquick.MapCacheRoot, "", store)
+		defer mc.Close()
+		projectsServ.OnChange(func(e domain.ProjectEvent) {
+			if e.Type == domain.ProjectRenamedEvent {
+				if err := mc.Clear(e.Project); err != nil {
+					log.Errorw("clearing mapcache", "project", e.Project, zap.Error(err))
+				}
+			}
+		})
+	}
+
+	if err := projectsServ.Rename(projectName, newName); err != nil {
+		return err
+	}
+	fmt.Printf("Project %s was renamed to %s\n", projectName, newName)
+	return nil
+}
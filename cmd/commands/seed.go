@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ardanlabs/conf/v2"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/mapcache"
+	"go.uber.org/zap"
+)
+
+// Seed pre-renders mapcache tiles of the project's layers.
+// Usage: seed [--min-zoom] [--max-zoom] [--extent] [--force] <project> <layers>
+func Seed() error {
+	cfg := struct {
+		Gisquick struct {
+			ProjectsRoot    string `conf:"default:/publish"`
+			MapCacheRoot    string
+			MapCacheStorage string `conf:"default:fs"`
+			MapserverURL    string
+		}
+		S3      S3Config
+		MinZoom int    `conf:"default:0"`
+		MaxZoom int    `conf:"default:-1,help:defaults to the last zoom level"`
+		Extent  string `conf:"help:minx,miny,maxx,maxy"`
+		Force   bool
+		Args    conf.Args
+	}{}
+
+	help, err := conf.Parse("", &cfg)
+	if err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			fmt.Println(help)
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+	if len(cfg.Args) != 2 {
+		return fmt.Errorf("expected arguments: <project> <layers>")
+	}
+	if cfg.Gisquick.MapCacheRoot == "" {
+		return fmt.Errorf("mapcache root is not configured")
+	}
+	projectName, layers := cfg.Args.Num(0), cfg.Args.Num(1)
+
+	log, err := createLogger(zap.InfoLevel)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	defer log.Sync()
+
+	projects := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	defer projects.Close()
+	pInfo, err := projects.GetProjectInfo(projectName)
+	if err != nil {
+		return fmt.Errorf("reading project info: %w", err)
+	}
+	settings, err := projects.GetSettings(projectName)
+	if err != nil {
+		return fmt.Errorf("reading project settings: %w", err)
+	}
+	if len(settings.TileResolutions) == 0 || len(settings.Extent) != 4 {
+		return fmt.Errorf("project is not configured for map tiling")
+	}
+	var meta domain.QgisMeta
+	if err := projects.ParseQgisMetadata(projectName, &meta); err != nil {
+		return fmt.Errorf("reading qgis metadata: %w", err)
+	}
+	names := make(map[string]bool, len(meta.Layers))
+	for _, l := range meta.Layers {
+		names[l.Name] = true
+	}
+	for _, l := range strings.Split(layers, ",") {
+		if !names[l] {
+			return fmt.Errorf("unknown layer: %s", l)
+		}
+	}
+
+	params := mapcache.SeedParams{MinZoom: cfg.MinZoom, MaxZoom: cfg.MaxZoom, Force: cfg.Force}
+	if params.MaxZoom < 0 {
+		params.MaxZoom = len(settings.TileResolutions) - 1
+	}
+	if cfg.Extent != "" {
+		if params.Extent, err = mapcache.ParseExtent(cfg.Extent); err != nil {
+			return err
+		}
+	}
+
+	store, err := createTileStore(log, cfg.Gisquick.MapCacheStorage, cfg.Gisquick.MapCacheRoot, cfg.S3)
+	if err != nil {
+		return fmt.Errorf("creating mapcache storage: %w", err)
+	}
+	mc := mapcache.NewMapcache(log, cfg.Gisquick.MapCacheRoot, cfg.Gisquick.MapserverURL, store)
+	defer mc.Close()
+	seeder := mapcache.NewSeeder(log, mc, 1)
+	seeder.OnProgress = func(job mapcache.SeedJob) {
+		fmt.Printf("\r%s: %d/%d metatiles (%d failed)", job.Status, job.Done, job.Total, job.Failed)
+	}
+	layer := mc.GetLayer(pInfo, meta, settings, layers)
+	job, err := seeder.Seed(projectName, layer, params)
+	if err != nil {
+		return err
+	}
+
+	// on interrupt, job is stopped and can be resumed by the server
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-quit
+		seeder.Close()
+	}()
+
+	job, err = seeder.Wait(job.ID)
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	if job.Status == mapcache.SeedFailed {
+		return fmt.Errorf("seeding failed: %s", job.Error)
+	}
+	return nil
+}
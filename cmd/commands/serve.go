@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -20,6 +21,7 @@ import (
 	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/security"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/ws"
+	"github.com/gisquick/gisquick-server/internal/mapcache"
 	"github.com/gisquick/gisquick-server/internal/server"
 	"github.com/gisquick/gisquick-server/internal/server/auth"
 	"github.com/go-redis/redis/v8"
@@ -67,18 +69,39 @@ func Serve() error {
 			Debug                bool   `conf:"default:true"`
 			Language             string `conf:"default:en-us"`
 			ProjectsRoot         string `conf:"default:/publish"`
+			ProjectsStorage      string `conf:"default:disk,help:Projects storage [disk|s3] (projects root is used as local cache of s3 storage)"`
+			ProjectsIndex        bool   `conf:"default:false,help:Index projects info in database for fast listings (requires migration)"`
 			MapCacheRoot         string
+			MapCacheSeedWorkers  int      `conf:"default:2"`
+			MapCacheStorage      string   `conf:"default:fs,help:Tiles storage [fs|mbtiles|s3]"`
+			MapCacheMaxSize      ByteSize `conf:"default:-1"`
+			MapCacheProjectSize  ByteSize `conf:"default:-1"`
 			MapserverURL         string
+			ProjectVersions      int           `conf:"default:10,help:Number of kept project versions (0 is unlimited)"`
+			ProjectVersionDelay  time.Duration `conf:"default:30s,help:Period in which changes of the project are recorded as a single version"`
+			TrashRetention       time.Duration `conf:"default:168h,help:Period for which deleted projects and files are kept in the trash (0 disables the trash)"`
+			SeedJobsRetention    time.Duration `conf:"default:168h,help:Period for which records of finished mapcache seeding jobs are kept"`
+			ChecksumWorkers      int           `conf:"default:4,help:Number of files hashed in parallel"`
+			IntegrityCheck       time.Duration `conf:"default:0s,help:Interval of the projects storage integrity check (0 disables the check)"`
+			IntegrityRepair      bool          `conf:"default:false,help:Repair files indexes in the periodic integrity check"`
+			IntegrityReport      string        `conf:"help:File of the JSON integrity check report (defaults to .integrity.json in projects root)"`
+			WatchFiles           bool          `conf:"default:false,help:Watch projects directory for changes of files made outside of the API (disk storage only)"`
+			WatchDelay           time.Duration `conf:"default:5s,help:Delay after the last change of the project files before they are processed"`
+			UploadsRoot          string        `conf:"help:Directory for resumable uploads (defaults to .uploads in projects root)"`
+			FilesDeduplication   bool          `conf:"default:false,help:Store identical project files only once (hard links)"`
+			DedupExclude         string        `conf:"help:Regex of files excluded from deduplication (defaults to editable data formats)"`
 			PluginsURL           string
 			SignupAPI            bool
 			ProjectSizeLimit     ByteSize `conf:"default:-1"`
 			AccountStorageLimit  ByteSize `conf:"default:-1"`
 			AccountProjectsLimit int      `conf:"default:-1"`
+			AccountTrashCounted  bool     `conf:"default:false,help:Include items in the trash into the account storage usage"`
 			AccountLimiterConfig string
 			LandingProject       string
 			ProjectCustomization bool
 			Extensions           string
 		}
+		S3   S3Config
 		Auth struct {
 			SessionExpiration    time.Duration `conf:"default:24h"`
 			EmailTokenExpiration time.Duration `conf:"default:72h"`
@@ -230,12 +253,37 @@ func Serve() error {
 
 	sessionStore := auth.NewRedisStore(rdb)
 	authServ := auth.NewAuthService(log, cfg.Auth.SessionExpiration, accountsRepo, sessionStore)
+	authServ.SetTokens(postgres.NewAPITokens(dbConn))
 
-	projectsRepo := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	unlockRoot, err := project.LockServer(cfg.Gisquick.ProjectsRoot)
+	if err != nil {
+		return fmt.Errorf("locking projects directory: %w", err)
+	}
+	defer unlockRoot()
+
+	diskStorage := project.NewDiskStorage(log, cfg.Gisquick.ProjectsRoot)
+	diskStorage.MaxVersions = cfg.Gisquick.ProjectVersions
+	diskStorage.VersionDelay = cfg.Gisquick.ProjectVersionDelay
+	diskStorage.TrashRetention = cfg.Gisquick.TrashRetention
+	diskStorage.ChecksumWorkers = cfg.Gisquick.ChecksumWorkers
+	if cfg.Gisquick.FilesDeduplication {
+		exclude := cfg.Gisquick.DedupExclude
+		if exclude == "" {
+			exclude = project.DefaultDedupExclude
+		}
+		if err := diskStorage.EnableDeduplication(exclude); err != nil {
+			return fmt.Errorf("enabling files deduplication: %w", err)
+		}
+	}
+	projectsRepo, err := createProjectsRepository(log, cfg.Gisquick.ProjectsStorage, diskStorage, cfg.S3)
+	if err != nil {
+		return fmt.Errorf("creating projects storage: %w", err)
+	}
 	defaultAccountConfig := domain.AccountConfig{
 		ProjectsCountLimit: cfg.Gisquick.AccountProjectsLimit,
 		ProjectSizeLimit:   domain.ByteSize(cfg.Gisquick.ProjectSizeLimit),
 		StorageLimit:       domain.ByteSize(cfg.Gisquick.AccountStorageLimit),
+		CountTrash:         cfg.Gisquick.AccountTrashCounted,
 	}
 	var limiter application.AccountsLimiter
 	if cfg.Gisquick.AccountLimiterConfig != "" {
@@ -244,9 +292,118 @@ func Serve() error {
 		limiter = project.NewSimpleProjectsLimiter(defaultAccountConfig)
 	}
 	projectsServ := application.NewProjectsService(log, projectsRepo, limiter)
+	projectsServ.SetRedirects(postgres.NewProjectRedirects(dbConn))
+	if cfg.Gisquick.ProjectsIndex {
+		projectsServ.SetIndex(postgres.NewProjectsIndex(dbConn))
+		// projects are listed from the repository until the index is synchronized
+		go func() {
+			count, err := projectsServ.Reindex()
+			if err != nil {
+				log.Errorw("indexing projects", zap.Error(err))
+				return
+			}
+			log.Infow("projects index synchronized", "count", count)
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			count, err := projectsServ.PurgeExpiredTrash()
+			if err != nil {
+				log.Errorw("purging expired trash items", zap.Error(err))
+			} else if count > 0 {
+				log.Infow("purged expired trash items", "count", count)
+			}
+		}
+	}()
+
+	if cfg.Gisquick.IntegrityCheck > 0 {
+		reportFile := cfg.Gisquick.IntegrityReport
+		if reportFile == "" {
+			reportFile = filepath.Join(cfg.Gisquick.ProjectsRoot, ".integrity.json")
+		}
+		go func() {
+			ticker := time.NewTicker(cfg.Gisquick.IntegrityCheck)
+			defer ticker.Stop()
+			for range ticker.C {
+				report, err := projectsServ.CheckIntegrity(cfg.Gisquick.IntegrityRepair)
+				if err != nil {
+					log.Errorw("checking projects integrity", zap.Error(err))
+					continue
+				}
+				log.Infow("projects integrity check", "checked", report.Checked, "issues", report.Issues, "repaired", report.Repaired)
+				if err := saveIntegrityReport(reportFile, report); err != nil {
+					log.Errorw("saving integrity check report", zap.Error(err))
+				}
+			}
+		}()
+	}
+
+	if cfg.Gisquick.WatchFiles {
+		if cfg.Gisquick.ProjectsStorage != "disk" {
+			log.Warnw("files watcher is supported only with disk storage", "storage", cfg.Gisquick.ProjectsStorage)
+		} else {
+			watcher, err := project.NewWatcher(log, diskStorage, cfg.Gisquick.WatchDelay)
+			if err != nil {
+				return fmt.Errorf("creating files watcher: %w", err)
+			}
+			// files index, project's size and caches are updated by the repair of the project
+			watcher.OnFilesChanged = func(projectName string) {
+				report, err := projectsServ.CheckIntegrity(true, projectName)
+				if err != nil {
+					log.Errorw("updating changed project", "project", projectName, zap.Error(err))
+					return
+				}
+				if report.Repaired > 0 {
+					log.Infow("updated files index of changed project", "project", projectName)
+				} else {
+					// project.json could be changed even when the files are consistent with the index
+					projectsServ.RefreshIndex(projectName)
+				}
+			}
+			watcher.OnConfigChanged = projectsServ.RefreshIndex
+			if err := watcher.Start(); err != nil {
+				watcher.Close()
+				return fmt.Errorf("starting files watcher: %w", err)
+			}
+			defer watcher.Close()
+		}
+	}
+
+	var mc *mapcache.Cache
+	var seeder *mapcache.Seeder
+	if cfg.Gisquick.MapCacheRoot != "" {
+		store, err := createTileStore(log, cfg.Gisquick.MapCacheStorage, cfg.Gisquick.MapCacheRoot, cfg.S3)
+		if err != nil {
+			return fmt.Errorf("creating mapcache storage: %w", err)
+		}
+		mc = mapcache.NewMapcache(log, cfg.Gisquick.MapCacheRoot, cfg.Gisquick.MapserverURL, store)
+		mc.SetQuota(int64(cfg.Gisquick.MapCacheMaxSize), int64(cfg.Gisquick.MapCacheProjectSize))
+		go func() {
+			if err := mc.LoadUsage(); err != nil {
+				log.Errorw("loading mapcache usage", zap.Error(err))
+			}
+		}()
+		seeder = mapcache.NewSeeder(log, mc, cfg.Gisquick.MapCacheSeedWorkers)
+		seeder.Retention = cfg.Gisquick.SeedJobsRetention
+	}
 
 	sws := ws.NewSettingsWS(log)
-	s := server.NewServer(log, conf, authServ, accountsService, projectsServ, sws, limiter, notifications)
+	uploadsRoot := cfg.Gisquick.UploadsRoot
+	if uploadsRoot == "" {
+		uploadsRoot = filepath.Join(cfg.Gisquick.ProjectsRoot, ".uploads")
+	}
+	uploads := application.NewUploadsService(log, uploadsRoot, projectsServ)
+	go uploads.Start()
+
+	s := server.NewServer(log, conf, authServ, accountsService, projectsServ, sws, limiter, notifications, mc, seeder, uploads)
+	if seeder != nil {
+		if err := seeder.Resume(); err != nil {
+			log.Errorw("resuming mapcache seed jobs", zap.Error(err))
+		}
+	}
 
 	extensionsList := strings.Split(cfg.Gisquick.Extensions, ",")
 	for _, e := range extensionsList {
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/s3"
+	"github.com/gisquick/gisquick-server/internal/mapcache"
+	"go.uber.org/zap"
+)
+
+// Connection settings of S3 compatible object storage
+type S3Config struct {
+	Endpoint       string
+	Region         string `conf:"default:us-east-1"`
+	AccessKey      string
+	SecretKey      string `conf:"mask"`
+	MapCacheBucket string
+	MapCachePrefix string `conf:"default:mapcache"`
+	ProjectsBucket string
+	ProjectsPrefix string        `conf:"default:projects"`
+	ProjectsSync   time.Duration `conf:"default:30s,help:Interval of checking remote changes of cached projects"`
+}
+
+func (c S3Config) client(bucket string) (*s3.Client, error) {
+	return s3.NewClient(s3.Config{
+		Endpoint:  c.Endpoint,
+		Region:    c.Region,
+		AccessKey: c.AccessKey,
+		SecretKey: c.SecretKey,
+		Bucket:    bucket,
+	})
+}
+
+// createTileStore creates mapcache tiles storage of the given type (fs, mbtiles or s3)
+func createTileStore(log *zap.SugaredLogger, storage, root string, s3cfg S3Config) (mapcache.TileStore, error) {
+	switch storage {
+	case "", "fs":
+		return mapcache.NewFileStore(log, root), nil
+	case "mbtiles":
+		return mapcache.NewMBTilesStore(log, root)
+	case "s3":
+		client, err := s3cfg.client(s3cfg.MapCacheBucket)
+		if err != nil {
+			return nil, err
+		}
+		return mapcache.NewS3Store(log, client, s3cfg.MapCachePrefix), nil
+	}
+	return nil, fmt.Errorf("unknown mapcache storage: %s", storage)
+}
+
+// createProjectsRepository creates projects storage of the given type (disk or s3), disk storage
+// serves as the local cache of the s3 storage
+func createProjectsRepository(log *zap.SugaredLogger, storage string, disk *project.DiskStorage, s3cfg S3Config) (domain.ProjectsRepository, error) {
+	switch storage {
+	case "", "disk":
+		return disk, nil
+	case "s3":
+		client, err := s3cfg.client(s3cfg.ProjectsBucket)
+		if err != nil {
+			return nil, err
+		}
+		repo := project.NewObjectStorage(log, disk, client, s3cfg.ProjectsPrefix)
+		repo.RefreshInterval = s3cfg.ProjectsSync
+		go func() {
+			count, err := repo.Import()
+			if err != nil {
+				log.Errorw("uploading local projects to object storage", zap.Error(err))
+			} else if count > 0 {
+				log.Infow("uploaded local projects to object storage", "count", count)
+			}
+		}()
+		return repo, nil
+	}
+	return nil, fmt.Errorf("unknown projects storage: %s", storage)
+}
@@ -16,6 +16,11 @@ func printCommandsList() {
 	fmt.Println("  loadusers")
 	fmt.Println("  deleteuser")
 	fmt.Println("  migrate")
+	fmt.Println("  seed")
+	fmt.Println("  rename")
+	fmt.Println("  export")
+	fmt.Println("  import")
+	fmt.Println("  fsck")
 }
 
 func main() {
@@ -42,6 +47,16 @@ func main() {
 		runCommand(commands.Serve)
 	case "migrate":
 		runCommand(commands.Migrate)
+	case "seed":
+		runCommand(commands.Seed)
+	case "rename":
+		runCommand(commands.Rename)
+	case "export":
+		runCommand(commands.Export)
+	case "import":
+		runCommand(commands.Import)
+	case "fsck":
+		runCommand(commands.Fsck)
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n", cmd)
 		printCommandsList()
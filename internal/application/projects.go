@@ -1,12 +1,14 @@
 package application
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
 	"go.uber.org/zap"
@@ -21,13 +23,30 @@ var (
 type ProjectService interface {
 	Create(projectName string, meta json.RawMessage) (*domain.ProjectInfo, error)
 	Delete(projectName string) error
+	// Rename moves the project under the new name, possibly into other user's account
+	Rename(projectName, newName string) error
+	// GetRedirect returns current name of the renamed project
+	GetRedirect(projectName string) (string, error)
+	// Clone creates copy of the project, possibly in other user's account
+	Clone(projectName, newName string) (*domain.ProjectInfo, error)
+	SetTemplate(projectName string, template bool) error
+	// Templates returns user's and accessible projects marked as templates
+	Templates(username string) ([]domain.ProjectInfo, error)
+	// Export writes the project bundle into the writer
+	Export(projectName string, w io.Writer) error
+	// Import creates new project from the project bundle
+	Import(projectName string, r io.ReaderAt, size int64) (*domain.ProjectInfo, error)
 	GetProjectInfo(projectName string) (domain.ProjectInfo, error)
-	GetUserProjects(username string) ([]domain.ProjectInfo, error)
-	AccessibleProjects(username string, skipErrors bool) ([]domain.ProjectInfo, error)
+	// GetUserProjects returns page of the user's projects and total number of matching projects
+	GetUserProjects(username string, query domain.ProjectsQuery) ([]domain.ProjectInfo, int, error)
+	AccessibleProjects(username string, query domain.ProjectsQuery, skipErrors bool) ([]domain.ProjectInfo, int, error)
+	SearchCatalog(user domain.User, text string, limit, offset int) ([]domain.CatalogResult, int, error)
 	// SaveFile(projectName, filename string, r io.Reader) (string, error)
 	SaveFile(projectName, dir, pattern string, r io.Reader, size int64) (domain.ProjectFile, error)
 	DeleteFile(projectName, path string) error
 	ListProjectFiles(projectName string, checksum bool) ([]domain.ProjectFile, []domain.ProjectFile, error)
+	ListProjectFilesContext(ctx context.Context, projectName string, checksum bool, progress func(domain.ChecksumProgress)) ([]domain.ProjectFile, []domain.ProjectFile, error)
+	GetFileInfo(projectName, path string) (domain.FileInfo, error)
 
 	GetQgisMetadata(projectName string, data interface{}) error
 	UpdateMeta(projectName string, meta json.RawMessage) error
@@ -36,9 +55,13 @@ type ProjectService interface {
 	UpdateSettings(projectName string, data json.RawMessage) error
 
 	GetThumbnailPath(projectName string) string
+	GetFilePath(projectName, path string) string
 	SaveThumbnail(projectName string, r io.Reader) error
 
 	UpdateFiles(projectName string, info domain.FilesChanges, next func() (string, io.ReadCloser, error)) ([]domain.ProjectFile, error)
+	UpdateFileDelta(projectName string, finfo domain.ProjectFile, blockSize int, delta io.Reader) ([]domain.ProjectFile, error)
+	CheckFilesChanges(projectName string, info domain.FilesChanges) error
+	AccountUsage(username string) (int64, error)
 
 	GetLayersData(projectName string) (LayersData, error)
 	GetMapConfig(projectName string, user domain.User) (map[string]interface{}, error)
@@ -48,6 +71,18 @@ type ProjectService interface {
 	RemoveScripts(projectName string, modules ...string) (domain.Scripts, error)
 
 	GetProjectCustomizations(projectName string) (json.RawMessage, error)
+	ListVersions(projectName string) ([]domain.ProjectVersion, error)
+	RestoreVersion(projectName string, id int) error
+
+	ListTrash(username string) ([]domain.TrashItem, error)
+	// RestoreTrash moves deleted project or files from the user's trash back
+	RestoreTrash(username, id string) (domain.TrashItem, error)
+	// PurgeTrash permanently removes items from the user's trash (all items when no ID is given)
+	PurgeTrash(username string, ids ...string) error
+	PurgeExpiredTrash() (int, error)
+	// CheckIntegrity checks storage integrity of the projects (all projects when none is given)
+	CheckIntegrity(repair bool, projects ...string) (domain.IntegrityReport, error)
+	OnChange(handler domain.ProjectEventHandler)
 	Close()
 }
 
@@ -60,6 +95,9 @@ type projectService struct {
 	repo    domain.ProjectsRepository
 	limiter AccountsLimiter
 	// cache *ttlcache.Cache
+	index      domain.ProjectsIndex
+	indexReady atomic.Bool
+	redirects  domain.ProjectRedirects
 }
 
 func NewProjectsService(log *zap.SugaredLogger, repo domain.ProjectsRepository, limiter AccountsLimiter) *projectService {
@@ -72,19 +110,39 @@ func NewProjectsService(log *zap.SugaredLogger, repo domain.ProjectsRepository,
 
 func (s *projectService) Create(name string, meta json.RawMessage) (*domain.ProjectInfo, error) {
 	username := strings.Split(name, "/")[0]
-	projects, err := s.repo.UserProjects(username)
+	projectsCount, err := s.userProjectsCount(username)
 	if err != nil {
-		return nil, fmt.Errorf("getting user's projects: %w", err)
+		return nil, err
 	}
 	accountConfig, err := s.limiter.GetAccountLimits(username)
 	if err != nil {
 		return nil, fmt.Errorf("getting user account limits config: %w", err)
 	}
-	canCreate := accountConfig.CheckProjectsLimit(len(projects) + 1)
+	canCreate := accountConfig.CheckProjectsLimit(projectsCount + 1)
 	if !canCreate {
 		return nil, ErrAccountProjectsLimit
 	}
-	return s.repo.Create(name, meta)
+	info, err := s.repo.Create(name, meta)
+	if err == nil {
+		s.updateIndex(name)
+		s.removeRedirects(name)
+	}
+	return info, err
+}
+
+func (s *projectService) userProjectsCount(username string) (int, error) {
+	if s.useIndex() {
+		_, total, err := s.index.UserProjects(username, domain.ProjectsQuery{Limit: 1})
+		if err != nil {
+			return 0, fmt.Errorf("getting user's projects: %w", err)
+		}
+		return total, nil
+	}
+	projects, err := s.repo.UserProjects(username)
+	if err != nil {
+		return 0, fmt.Errorf("getting user's projects: %w", err)
+	}
+	return len(projects), nil
 }
 
 func (s *projectService) GetProjectInfo(name string) (domain.ProjectInfo, error) {
@@ -92,28 +150,45 @@ func (s *projectService) GetProjectInfo(name string) (domain.ProjectInfo, error)
 }
 
 func (s *projectService) Delete(name string) error {
-	return s.repo.Delete(name)
+	if err := s.repo.Delete(name); err != nil {
+		return err
+	}
+	s.updateIndex(name)
+	s.removeRedirects(name)
+	return nil
 }
 
 func (s *projectService) ListProjectFiles(project string, checksum bool) ([]domain.ProjectFile, []domain.ProjectFile, error) {
 	return s.repo.ListProjectFiles(project, checksum)
 }
 
-func (s *projectService) GetUserProjects(username string) ([]domain.ProjectInfo, error) {
+func (s *projectService) ListProjectFilesContext(ctx context.Context, project string, checksum bool, progress func(domain.ChecksumProgress)) ([]domain.ProjectFile, []domain.ProjectFile, error) {
+	return s.repo.ListProjectFilesContext(ctx, project, checksum, progress)
+}
+
+func (s *projectService) GetFileInfo(project, path string) (domain.FileInfo, error) {
+	return s.repo.GetFileInfo(project, path)
+}
+
+func (s *projectService) GetUserProjects(username string, query domain.ProjectsQuery) ([]domain.ProjectInfo, int, error) {
+	if s.useIndex() {
+		return s.index.UserProjects(username, query)
+	}
 	projects, err := s.repo.UserProjects(username)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	data := make([]domain.ProjectInfo, len(projects))
 	for i, name := range projects {
 		info, err := s.repo.GetProjectInfo(name)
 		if err != nil {
 			// TODO: skip or fail?
-			return nil, err
+			return nil, 0, err
 		}
 		data[i] = info
 	}
-	return data, nil
+	page, total := query.Apply(data)
+	return page, total, nil
 }
 
 func (s *projectService) SaveFile(projectName, directory, pattern string, r io.Reader, size int64) (domain.ProjectFile, error) {
@@ -126,31 +201,22 @@ func (s *projectService) SaveFile(projectName, directory, pattern string, r io.R
 	checkProjectSizeLimit := accountConfig.HasProjectSizeLimit()
 	checkStorageLimit := accountConfig.HasStorageLimit()
 
-	var projectsSizes map[string]int64
 	if checkStorageLimit {
-		var err error
-		projectsSizes, err = s.getProjectsSize(username)
+		totalSize, err := s.storageUsage(username, accountConfig)
 		if err != nil {
 			return finfo, fmt.Errorf("checking user storage limit: %w", err)
 		}
-		var totalSize int64 = 0
-		for _, pSize := range projectsSizes {
-			totalSize += pSize
-		}
 		canSave := accountConfig.CheckStorageLimit(totalSize + size)
 		if !canSave {
 			return finfo, ErrAccountStorageLimit
 		}
 	}
 	if checkProjectSizeLimit {
-		projectSize, ok := projectsSizes[projectName]
-		if !ok {
-			pi, err := s.GetProjectInfo(projectName)
-			if err != nil {
-				return finfo, fmt.Errorf("getting project size: %w", err)
-			}
-			projectSize = pi.Size
+		pi, err := s.GetProjectInfo(projectName)
+		if err != nil {
+			return finfo, fmt.Errorf("getting project size: %w", err)
 		}
+		projectSize := pi.Size
 		canSave := accountConfig.CheckProjectSizeLimit(projectSize + size)
 		if !canSave {
 			return finfo, ErrProjectSizeLimit
@@ -161,6 +227,7 @@ func (s *projectService) SaveFile(projectName, directory, pattern string, r io.R
 	if err != nil {
 		return finfo, fmt.Errorf("saving project file: %w", err)
 	}
+	s.updateIndex(projectName)
 	return finfo, nil
 }
 
@@ -178,7 +245,11 @@ func (s *projectService) GetQgisMetadata(projectName string, data interface{}) e
 }
 
 func (s *projectService) UpdateMeta(projectName string, meta json.RawMessage) error {
-	return s.repo.UpdateMeta(projectName, meta)
+	if err := s.repo.UpdateMeta(projectName, meta); err != nil {
+		return err
+	}
+	s.updateIndex(projectName)
+	return nil
 }
 
 func (s *projectService) GetSettings(projectName string) (domain.ProjectSettings, error) {
@@ -186,45 +257,51 @@ func (s *projectService) GetSettings(projectName string) (domain.ProjectSettings
 }
 
 func (s *projectService) UpdateSettings(projectName string, data json.RawMessage) error {
-	return s.repo.UpdateSettings(projectName, data)
+	if err := s.repo.UpdateSettings(projectName, data); err != nil {
+		return err
+	}
+	s.updateIndex(projectName)
+	return nil
 }
 
 func (s *projectService) SaveThumbnail(projectName string, r io.Reader) error {
-	return s.repo.SaveThumbnail(projectName, r)
+	if err := s.repo.SaveThumbnail(projectName, r); err != nil {
+		return err
+	}
+	s.updateIndex(projectName)
+	return nil
 }
 
 func (s *projectService) GetThumbnailPath(projectName string) string {
 	return s.repo.GetThumbnailPath(projectName)
 }
 
-func (s *projectService) getProjectsSize(username string) (map[string]int64, error) {
-	projNames, err := s.repo.UserProjects(username)
+func (s *projectService) GetFilePath(projectName, path string) string {
+	return s.repo.GetFilePath(projectName, path)
+}
+
+func (s *projectService) AccountUsage(username string) (int64, error) {
+	accountConfig, err := s.limiter.GetAccountLimits(username)
 	if err != nil {
-		return nil, fmt.Errorf("listing user projects: %w", err)
+		return 0, fmt.Errorf("getting user account limits config: %w", err)
 	}
-	data := make(map[string]int64, len(projNames))
-	for _, projName := range projNames {
-		pInfo, err := s.repo.GetProjectInfo(projName)
-		if err != nil {
-			return nil, fmt.Errorf("getting project info: %w", err)
-		}
-		data[projName] = pInfo.Size
-	}
-	return data, nil
+	return s.storageUsage(username, accountConfig)
 }
 
-func (s *projectService) UpdateFiles(projectName string, info domain.FilesChanges, next func() (string, io.ReadCloser, error)) ([]domain.ProjectFile, error) {
+// CheckFilesChanges checks whether the project after applying the changes will be within
+// account's size limits
+func (s *projectService) CheckFilesChanges(projectName string, info domain.FilesChanges) error {
 	username := strings.Split(projectName, "/")[0]
 	accountConfig, err := s.limiter.GetAccountLimits(username)
 	if err != nil {
-		return nil, fmt.Errorf("getting user account limits config: %w", err)
+		return fmt.Errorf("getting user account limits config: %w", err)
 	}
 	checkProjectSizeLimit := accountConfig.HasProjectSizeLimit()
 	checkStorageLimit := accountConfig.HasStorageLimit()
 	if len(info.Updates) > 0 && (checkProjectSizeLimit || checkStorageLimit) {
 		p, err := s.GetProjectInfo(projectName)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		// v1
 		/*
@@ -271,24 +348,46 @@ func (s *projectService) UpdateFiles(projectName string, info domain.FilesChange
 
 		// s.log.Infow("UpdateFiles", "currentSize", p.Size, "expected size", size)
 		if !accountConfig.CheckProjectSizeLimit(size) {
-			return nil, ErrProjectSizeLimit
+			return ErrProjectSizeLimit
 		}
 		if checkStorageLimit {
-			sizes, err := s.getProjectsSize(username)
+			totalSize, err := s.storageUsage(username, accountConfig)
 			if err != nil {
-				return nil, fmt.Errorf("checking user storage limit: %w", err)
-			}
-			var totalSize int64 = 0
-			for _, pSize := range sizes {
-				totalSize += pSize
+				return fmt.Errorf("checking user storage limit: %w", err)
 			}
 			totalSize += (-p.Size + size)
 			if !accountConfig.CheckStorageLimit(totalSize) {
-				return nil, ErrAccountStorageLimit
+				return ErrAccountStorageLimit
 			}
 		}
 	}
-	return s.repo.UpdateFiles(projectName, info, next)
+	return nil
+}
+
+func (s *projectService) UpdateFiles(projectName string, info domain.FilesChanges, next func() (string, io.ReadCloser, error)) ([]domain.ProjectFile, error) {
+	if err := s.CheckFilesChanges(projectName, info); err != nil {
+		return nil, err
+	}
+	files, err := s.repo.UpdateFiles(projectName, info, next)
+	if err != nil {
+		return nil, err
+	}
+	s.updateIndex(projectName)
+	return files, nil
+}
+
+// UpdateFileDelta updates the project file with its new version reconstructed from the uploaded
+// block delta, limits are checked before the file is reconstructed
+func (s *projectService) UpdateFileDelta(projectName string, finfo domain.ProjectFile, blockSize int, delta io.Reader) ([]domain.ProjectFile, error) {
+	if err := s.CheckFilesChanges(projectName, domain.FilesChanges{Updates: []domain.ProjectFile{finfo}}); err != nil {
+		return nil, err
+	}
+	files, err := s.repo.UpdateFileDelta(projectName, finfo, blockSize, delta)
+	if err != nil {
+		return nil, err
+	}
+	s.updateIndex(projectName)
+	return files, nil
 }
 
 func (s *projectService) GetScripts(projectName string) (domain.Scripts, error) {
@@ -810,18 +909,21 @@ func (s *projectService) GetMapConfig(projectName string, user domain.User) (map
 	return data, nil
 }
 
-func (s *projectService) AccessibleProjects(username string, skipErrors bool) ([]domain.ProjectInfo, error) {
+func (s *projectService) AccessibleProjects(username string, query domain.ProjectsQuery, skipErrors bool) ([]domain.ProjectInfo, int, error) {
+	if s.useIndex() {
+		return s.index.AccessibleProjects(username, query)
+	}
 	projects := make([]domain.ProjectInfo, 0)
 	list, err := s.repo.AllProjects(skipErrors)
 	if err != nil {
-		return projects, err
+		return projects, 0, err
 	}
 	for _, projectName := range list {
 		pi, err := s.repo.GetProjectInfo(projectName)
 		if err != nil {
 			s.log.Errorw("getting project info", "project", projectName, zap.Error(err))
 			if !skipErrors {
-				return nil, err
+				return nil, 0, err
 			}
 		} else {
 			if pi.Authentication == "public" || pi.Authentication == "authenticated" {
@@ -831,7 +933,7 @@ func (s *projectService) AccessibleProjects(username string, skipErrors bool) ([
 				if err != nil {
 					s.log.Errorw("getting project settings", "project", projectName, zap.Error(err))
 					if !skipErrors {
-						return nil, err
+						return nil, 0, err
 					}
 				}
 				if domain.StringArray(settings.Auth.Users).Has(username) {
@@ -840,7 +942,24 @@ func (s *projectService) AccessibleProjects(username string, skipErrors bool) ([
 			}
 		}
 	}
-	return projects, nil
+	page, total := query.Apply(projects)
+	return page, total, nil
+}
+
+func (s *projectService) ListVersions(projectName string) ([]domain.ProjectVersion, error) {
+	return s.repo.ListVersions(projectName)
+}
+
+func (s *projectService) RestoreVersion(projectName string, id int) error {
+	if err := s.repo.RestoreVersion(projectName, id); err != nil {
+		return err
+	}
+	s.updateIndex(projectName)
+	return nil
+}
+
+func (s *projectService) OnChange(handler domain.ProjectEventHandler) {
+	s.repo.OnChange(handler)
 }
 
 func (s *projectService) Close() {
@@ -0,0 +1,146 @@
+package application
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// MaxBundleConfigSize is the max size of the manifest and configuration files in the project bundle
+var MaxBundleConfigSize int64 = 20 * 1024 * 1024
+
+func (s *projectService) Export(projectName string, w io.Writer) error {
+	return s.repo.Export(projectName, w)
+}
+
+func readBundleFile(f *zip.File, maxSize int64) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: %s is too large", domain.ErrInvalidBundle, f.Name)
+	}
+	return data, nil
+}
+
+// Import creates new project from the project bundle. Account limits are checked in the same way
+// as for published projects, the project is removed when the import fails.
+func (s *projectService) Import(projectName string, r io.ReaderAt, size int64) (*domain.ProjectInfo, error) {
+	if err := domain.ValidateProjectName(projectName); err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidBundle, err)
+	}
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	var manifest domain.BundleManifest
+	mf, ok := entries[domain.BundleManifestFile]
+	if !ok {
+		return nil, domain.ErrInvalidBundle
+	}
+	content, err := readBundleFile(mf, MaxBundleConfigSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle manifest: %w", err)
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidBundle, err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	meta := make(map[string][]byte, len(manifest.Meta))
+	for _, name := range manifest.Meta {
+		f, ok := entries[domain.BundleMetaPath(name)]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing %s", domain.ErrInvalidBundle, name)
+		}
+		if meta[name], err = readBundleFile(f, MaxBundleConfigSize); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+	}
+	for _, pf := range manifest.Files {
+		if _, ok := entries[domain.BundleFilePath(pf.Path)]; !ok {
+			return nil, fmt.Errorf("%w: missing file %s", domain.ErrInvalidBundle, pf.Path)
+		}
+	}
+
+	info, err := s.Create(projectName, meta["qgis.json"])
+	if err != nil {
+		return nil, err
+	}
+	if err := s.importBundleData(projectName, manifest, meta, entries); err != nil {
+		// incomplete project is not moved into the trash
+		if err := s.repo.Purge(projectName); err != nil {
+			s.log.Errorw("removing incomplete imported project", "project", projectName, zap.Error(err))
+		}
+		s.updateIndex(projectName)
+		return nil, err
+	}
+	if pInfo, err := s.GetProjectInfo(projectName); err == nil {
+		info = &pInfo
+	}
+	return info, nil
+}
+
+func (s *projectService) importBundleData(projectName string, manifest domain.BundleManifest, meta map[string][]byte, entries map[string]*zip.File) error {
+	if len(manifest.Files) > 0 {
+		i := 0
+		next := func() (string, io.ReadCloser, error) {
+			if i >= len(manifest.Files) {
+				return "", nil, io.EOF
+			}
+			pf := manifest.Files[i]
+			i++
+			rc, err := entries[domain.BundleFilePath(pf.Path)].Open()
+			if err != nil {
+				return "", nil, err
+			}
+			// data beyond the declared size are not read, the file will not match its declared info
+			return pf.Path, readCloser{io.LimitReader(rc, pf.Size+1), rc}, nil
+		}
+		changes := domain.FilesChanges{Updates: manifest.Files}
+		if _, err := s.UpdateFiles(projectName, changes, next); err != nil {
+			return fmt.Errorf("importing project files: %w", err)
+		}
+	}
+	if data, ok := meta["settings.json"]; ok {
+		if err := s.UpdateSettings(projectName, data); err != nil {
+			return fmt.Errorf("importing project settings: %w", err)
+		}
+	}
+	if data, ok := meta["scripts.json"]; ok {
+		var scripts domain.Scripts
+		if err := json.Unmarshal(data, &scripts); err != nil {
+			return fmt.Errorf("%w: %v", domain.ErrInvalidBundle, err)
+		}
+		if err := s.UpdateScripts(projectName, scripts); err != nil {
+			return fmt.Errorf("importing project scripts: %w", err)
+		}
+	}
+	if data, ok := meta["thumbnail"]; ok {
+		if err := s.SaveThumbnail(projectName, bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("importing project thumbnail: %w", err)
+		}
+	}
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
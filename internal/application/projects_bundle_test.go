@@ -0,0 +1,85 @@
+package application
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+func testBundle(t *testing.T, manifest interface{}, entries ...string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if manifest != nil {
+		w, err := zw.Create(domain.BundleManifestFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewEncoder(w).Encode(manifest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("{}"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestImportInvalidBundle(t *testing.T) {
+	manifest := func(paths ...string) domain.BundleManifest {
+		m := domain.BundleManifest{Format: domain.BundleFormat, Version: domain.BundleVersion, Meta: []string{"qgis.json"}}
+		for _, p := range paths {
+			m.Files = append(m.Files, domain.ProjectFile{Path: p, Size: 2})
+		}
+		return m
+	}
+	qgisMeta := domain.BundleMetaPath("qgis.json")
+	tests := []struct {
+		name   string
+		bundle func(t *testing.T) *bytes.Reader
+	}{
+		{"not a zip archive", func(t *testing.T) *bytes.Reader {
+			return bytes.NewReader([]byte("data"))
+		}},
+		{"missing manifest", func(t *testing.T) *bytes.Reader {
+			return testBundle(t, nil, qgisMeta)
+		}},
+		{"invalid manifest", func(t *testing.T) *bytes.Reader {
+			return testBundle(t, "manifest", qgisMeta)
+		}},
+		{"path outside of the project", func(t *testing.T) *bytes.Reader {
+			return testBundle(t, manifest("../other/project.qgs"), qgisMeta, "files/../other/project.qgs")
+		}},
+		{"internal file", func(t *testing.T) *bytes.Reader {
+			return testBundle(t, manifest(".gisquick/settings.json"), qgisMeta, "files/.gisquick/settings.json")
+		}},
+		{"missing meta file", func(t *testing.T) *bytes.Reader {
+			return testBundle(t, manifest())
+		}},
+		{"missing project file", func(t *testing.T) *bytes.Reader {
+			return testBundle(t, manifest("project.qgs"), qgisMeta)
+		}},
+	}
+	// repository is not used, invalid bundles must be rejected before the project is created
+	s := NewProjectsService(zap.NewNop().Sugar(), &renameTestRepo{}, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.bundle(t)
+			if _, err := s.Import("user1/imported", r, r.Size()); !errors.Is(err, domain.ErrInvalidBundle) {
+				t.Errorf("expected ErrInvalidBundle, got %v", err)
+			}
+		})
+	}
+}
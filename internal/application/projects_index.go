@@ -0,0 +1,166 @@
+package application
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// SetIndex enables listing of projects from the projects index. Index is used after it's
+// synchronized with the repository by Reindex.
+func (s *projectService) SetIndex(index domain.ProjectsIndex) {
+	s.index = index
+}
+
+func (s *projectService) useIndex() bool {
+	return s.index != nil && s.indexReady.Load()
+}
+
+func (s *projectService) indexProject(projectName string) error {
+	if !s.repo.CheckProjectExists(projectName) {
+		return s.index.Delete(projectName)
+	}
+	info, err := s.repo.GetProjectInfo(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project info: %w", err)
+	}
+	var users []string
+	if info.Authentication == "users" {
+		settings, err := s.repo.GetSettings(projectName)
+		if err != nil {
+			return fmt.Errorf("getting project settings: %w", err)
+		}
+		users = settings.Auth.Users
+	}
+	if err := s.index.Save(info, users); err != nil {
+		return err
+	}
+	doc, err := s.catalogDocument(info)
+	if err != nil {
+		return fmt.Errorf("creating catalog document: %w", err)
+	}
+	return s.index.SaveCatalog(projectName, doc)
+}
+
+// catalogDocument creates searchable document of the project, layers and topics are included only
+// in published projects (map of other projects is not available)
+func (s *projectService) catalogDocument(info domain.ProjectInfo) (domain.CatalogDocument, error) {
+	if info.State != "published" {
+		return domain.CatalogDocument{Title: info.Title}, nil
+	}
+	var meta domain.QgisMeta
+	if err := s.repo.ParseQgisMetadata(info.Name, &meta); err != nil {
+		return domain.CatalogDocument{}, err
+	}
+	settings, err := s.repo.GetSettings(info.Name)
+	if err != nil {
+		return domain.CatalogDocument{}, err
+	}
+	return domain.NewCatalogDocument(info, meta, settings), nil
+}
+
+// SearchCatalog searches projects accessible by the user in projects titles, layers titles
+// and metadata, and topics. Results are ordered by relevance.
+func (s *projectService) SearchCatalog(user domain.User, text string, limit, offset int) ([]domain.CatalogResult, int, error) {
+	if s.useIndex() {
+		return s.index.SearchCatalog(user, text, limit, offset)
+	}
+	terms := domain.SearchTerms(text)
+	results := make([]domain.CatalogResult, 0)
+	if len(terms) == 0 {
+		return results, 0, nil
+	}
+	projects, err := s.repo.AllProjects(true)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, projectName := range projects {
+		info, err := s.repo.GetProjectInfo(projectName)
+		if err != nil {
+			s.log.Errorw("getting project info", "project", projectName, zap.Error(err))
+			continue
+		}
+		var allowedUsers []string
+		if info.Authentication == "users" {
+			if settings, err := s.repo.GetSettings(projectName); err == nil {
+				allowedUsers = settings.Auth.Users
+			}
+		}
+		if !domain.CanAccessProject(user, info, allowedUsers) {
+			continue
+		}
+		doc, err := s.catalogDocument(info)
+		if err != nil {
+			s.log.Errorw("creating catalog document", "project", projectName, zap.Error(err))
+			continue
+		}
+		if rank := doc.Rank(terms); rank > 0 {
+			results = append(results, domain.CatalogResult{ProjectInfo: info, Rank: rank})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Name < results[j].Name
+	})
+	total := len(results)
+	if offset >= total {
+		return []domain.CatalogResult{}, total, nil
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results, total, nil
+}
+
+// updateIndex updates project's record in the projects index after the project was modified
+func (s *projectService) updateIndex(projectName string) {
+	if s.index == nil {
+		return
+	}
+	if err := s.indexProject(projectName); err != nil {
+		s.log.Errorw("updating projects index", "project", projectName, zap.Error(err))
+	}
+}
+
+// RefreshIndex updates project's record in the projects index after the project was modified
+// outside of the API
+func (s *projectService) RefreshIndex(projectName string) {
+	s.updateIndex(projectName)
+}
+
+// Reindex synchronizes the projects index with all projects in the repository,
+// returns number of indexed projects
+func (s *projectService) Reindex() (int, error) {
+	if s.index == nil {
+		return 0, nil
+	}
+	projects, err := s.repo.AllProjects(true)
+	if err != nil {
+		return 0, err
+	}
+	exists := make(map[string]bool, len(projects))
+	for _, projectName := range projects {
+		exists[projectName] = true
+		if err := s.indexProject(projectName); err != nil {
+			s.log.Errorw("indexing project", "project", projectName, zap.Error(err))
+		}
+	}
+	indexed, err := s.index.Names()
+	if err != nil {
+		return 0, err
+	}
+	for _, projectName := range indexed {
+		if !exists[projectName] {
+			if err := s.index.Delete(projectName); err != nil {
+				return 0, err
+			}
+		}
+	}
+	s.indexReady.Store(true)
+	return len(projects), nil
+}
@@ -0,0 +1,47 @@
+package application
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// CheckIntegrity checks storage integrity of the given projects (all projects when no project
+// is given). Report contains only projects with issues or temporary files.
+func (s *projectService) CheckIntegrity(repair bool, projects ...string) (domain.IntegrityReport, error) {
+	report := domain.IntegrityReport{
+		Started:  time.Now().UTC(),
+		Repair:   repair,
+		Projects: []domain.ProjectCheck{},
+	}
+	if len(projects) == 0 {
+		var err error
+		projects, err = s.repo.AllProjects(true)
+		if err != nil {
+			return report, fmt.Errorf("listing projects: %w", err)
+		}
+	}
+	for _, projectName := range projects {
+		check, err := s.repo.CheckIntegrity(projectName, repair)
+		if err != nil {
+			s.log.Errorw("checking project integrity", "project", projectName, zap.Error(err))
+			check.Project = projectName
+			check.Error = err.Error()
+		}
+		report.Checked++
+		if check.HasIssues() {
+			report.Issues++
+		}
+		if check.Repaired {
+			report.Repaired++
+			s.updateIndex(projectName)
+		}
+		if check.HasIssues() || len(check.TemporaryFiles) > 0 {
+			report.Projects = append(report.Projects, check)
+		}
+	}
+	report.Finished = time.Now().UTC()
+	return report, nil
+}
@@ -0,0 +1,95 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// SetRedirects enables redirects from former names of renamed projects
+func (s *projectService) SetRedirects(redirects domain.ProjectRedirects) {
+	s.redirects = redirects
+}
+
+func (s *projectService) removeRedirects(projectName string) {
+	if s.redirects == nil {
+		return
+	}
+	if err := s.redirects.Delete(projectName); err != nil {
+		s.log.Errorw("removing project redirects", "project", projectName, zap.Error(err))
+	}
+}
+
+// checkAccountLimits checks whether the project can be added into the user's account
+func (s *projectService) checkAccountLimits(projectName, username string) error {
+	accountConfig, err := s.limiter.GetAccountLimits(username)
+	if err != nil {
+		return fmt.Errorf("getting user account limits config: %w", err)
+	}
+	projectsCount, err := s.userProjectsCount(username)
+	if err != nil {
+		return err
+	}
+	if !accountConfig.CheckProjectsLimit(projectsCount + 1) {
+		return ErrAccountProjectsLimit
+	}
+	pInfo, err := s.repo.GetProjectInfo(projectName)
+	if err != nil {
+		return fmt.Errorf("getting project size: %w", err)
+	}
+	if !accountConfig.CheckProjectSizeLimit(pInfo.Size) {
+		return ErrProjectSizeLimit
+	}
+	if accountConfig.HasStorageLimit() {
+		totalSize, err := s.storageUsage(username, accountConfig)
+		if err != nil {
+			return fmt.Errorf("checking user storage limit: %w", err)
+		}
+		if !accountConfig.CheckStorageLimit(totalSize + pInfo.Size) {
+			return ErrAccountStorageLimit
+		}
+	}
+	return nil
+}
+
+// Rename moves the project under the new name. When the project is transferred into other
+// user's account, limits of the target account are checked. Redirect from the former name
+// is created when redirects are enabled.
+func (s *projectService) Rename(projectName, newName string) error {
+	if err := domain.ValidateProjectName(newName); err != nil {
+		return err
+	}
+	if !s.repo.CheckProjectExists(projectName) {
+		return domain.ErrProjectNotExists
+	}
+	if projectName == newName || s.repo.CheckProjectExists(newName) {
+		return domain.ErrProjectAlreadyExists
+	}
+	owner := strings.Split(projectName, "/")[0]
+	username := strings.Split(newName, "/")[0]
+	if username != owner {
+		if err := s.checkAccountLimits(projectName, username); err != nil {
+			return err
+		}
+	}
+	if err := s.repo.Rename(projectName, newName); err != nil {
+		return err
+	}
+	s.updateIndex(projectName)
+	s.updateIndex(newName)
+	if s.redirects != nil {
+		if err := s.redirects.Add(projectName, newName); err != nil {
+			s.log.Errorw("creating project redirect", "project", projectName, "new_name", newName, zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (s *projectService) GetRedirect(projectName string) (string, error) {
+	if s.redirects == nil {
+		return "", domain.ErrProjectNotExists
+	}
+	return s.redirects.Get(projectName)
+}
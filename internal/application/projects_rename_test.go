@@ -0,0 +1,201 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// renameTestRepo is a projects repository with projects sizes
+type renameTestRepo struct {
+	domain.ProjectsRepository
+	projects map[string]int64
+}
+
+func (r *renameTestRepo) CheckProjectExists(name string) bool {
+	_, ok := r.projects[name]
+	return ok
+}
+
+func (r *renameTestRepo) GetProjectInfo(name string) (domain.ProjectInfo, error) {
+	size, ok := r.projects[name]
+	if !ok {
+		return domain.ProjectInfo{}, domain.ErrProjectNotExists
+	}
+	return domain.ProjectInfo{Name: name, Size: size}, nil
+}
+
+func (r *renameTestRepo) UserProjects(username string) ([]string, error) {
+	var names []string
+	for name := range r.projects {
+		if strings.HasPrefix(name, username+"/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (r *renameTestRepo) AccountUsage(username string) (int64, error) {
+	var size int64
+	for name, s := range r.projects {
+		if strings.HasPrefix(name, username+"/") {
+			size += s
+		}
+	}
+	return size, nil
+}
+
+func (r *renameTestRepo) Rename(projectName, newName string) error {
+	r.projects[newName] = r.projects[projectName]
+	delete(r.projects, projectName)
+	return nil
+}
+
+func (r *renameTestRepo) Create(name string, meta json.RawMessage) (*domain.ProjectInfo, error) {
+	r.projects[name] = 0
+	return &domain.ProjectInfo{Name: name}, nil
+}
+
+func (r *renameTestRepo) Delete(name string) error {
+	delete(r.projects, name)
+	return nil
+}
+
+// testRedirects is an in-memory redirects store
+type testRedirects map[string]string
+
+func (r testRedirects) Add(oldName, newName string) error {
+	for name, target := range r {
+		if target == oldName {
+			r[name] = newName
+		}
+	}
+	delete(r, newName)
+	r[oldName] = newName
+	return nil
+}
+
+func (r testRedirects) Get(oldName string) (string, error) {
+	newName, ok := r[oldName]
+	if !ok {
+		return "", domain.ErrProjectNotExists
+	}
+	return newName, nil
+}
+
+func (r testRedirects) Delete(name string) error {
+	for oldName, newName := range r {
+		if oldName == name || newName == name {
+			delete(r, oldName)
+		}
+	}
+	return nil
+}
+
+// testLimiter returns the same limits for all accounts
+type testLimiter struct {
+	config domain.AccountConfig
+}
+
+func (l testLimiter) GetAccountLimits(username string) (domain.AccountConfig, error) {
+	return l.config, nil
+}
+
+func newRenameTestService() (*projectService, *renameTestRepo, testRedirects) {
+	repo := &renameTestRepo{projects: map[string]int64{
+		"user1/roads":   100,
+		"user1/rivers":  100,
+		"user1/parcels": 300,
+		"user2/forests": 100,
+	}}
+	limiter := testLimiter{domain.AccountConfig{ProjectsCountLimit: 2, ProjectSizeLimit: 200, StorageLimit: 250}}
+	s := NewProjectsService(zap.NewNop().Sugar(), repo, limiter)
+	redirects := make(testRedirects)
+	s.SetRedirects(redirects)
+	return s, repo, redirects
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+		newName string
+		err     error
+	}{
+		{"same account", "user1/roads", "user1/streets", nil},
+		{"other account", "user1/roads", "user2/roads", nil},
+		{"missing project", "user1/lakes", "user1/ponds", domain.ErrProjectNotExists},
+		{"existing project", "user1/roads", "user1/rivers", domain.ErrProjectAlreadyExists},
+		{"same name", "user1/roads", "user1/roads", domain.ErrProjectAlreadyExists},
+		{"project size limit", "user1/parcels", "user2/parcels", ErrProjectSizeLimit},
+		{"invalid name", "user1/roads", "user1/../roads", domain.ErrInvalidProjectName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo, redirects := newRenameTestService()
+			err := s.Rename(tt.project, tt.newName)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			newName, redirectErr := s.GetRedirect(tt.project)
+			if tt.err != nil {
+				if len(redirects) != 0 {
+					t.Errorf("redirect created: %v", redirects)
+				}
+				return
+			}
+			if !repo.CheckProjectExists(tt.newName) || repo.CheckProjectExists(tt.project) {
+				t.Error("project wasn't renamed")
+			}
+			if redirectErr != nil || newName != tt.newName {
+				t.Errorf("redirect to %q (%v), expected %q", newName, redirectErr, tt.newName)
+			}
+		})
+	}
+}
+
+func TestRenameLimits(t *testing.T) {
+	s, repo, _ := newRenameTestService()
+	repo.projects["user2/lakes"] = 100
+	if err := s.Rename("user1/roads", "user2/roads"); !errors.Is(err, ErrAccountProjectsLimit) {
+		t.Errorf("expected ErrAccountProjectsLimit, got %v", err)
+	}
+	delete(repo.projects, "user2/lakes")
+	repo.projects["user2/forests"] = 200
+	if err := s.Rename("user1/roads", "user2/roads"); !errors.Is(err, ErrAccountStorageLimit) {
+		t.Errorf("expected ErrAccountStorageLimit, got %v", err)
+	}
+}
+
+func TestRenameRedirects(t *testing.T) {
+	s, _, _ := newRenameTestService()
+	s.limiter = testLimiter{domain.AccountConfig{ProjectsCountLimit: -1, ProjectSizeLimit: -1, StorageLimit: -1}}
+	if err := s.Rename("user1/roads", "user1/streets"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rename("user1/streets", "user2/streets"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"user1/roads", "user1/streets"} {
+		if newName, err := s.GetRedirect(name); err != nil || newName != "user2/streets" {
+			t.Errorf("%s: redirect to %q (%v)", name, newName, err)
+		}
+	}
+	// former name is taken by a new project
+	if _, err := s.Create("user1/roads", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetRedirect("user1/roads"); !errors.Is(err, domain.ErrProjectNotExists) {
+		t.Errorf("redirect of the new project: %v", err)
+	}
+	if err := s.Delete("user2/streets"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetRedirect("user1/streets"); !errors.Is(err, domain.ErrProjectNotExists) {
+		t.Errorf("redirect to the deleted project: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package application
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// Clone creates new project with copy of the project's files and configuration. Limits of the
+// target account are checked.
+func (s *projectService) Clone(projectName, newName string) (*domain.ProjectInfo, error) {
+	if err := domain.ValidateProjectName(newName); err != nil {
+		return nil, err
+	}
+	if !s.repo.CheckProjectExists(projectName) {
+		return nil, domain.ErrProjectNotExists
+	}
+	if s.repo.CheckProjectExists(newName) {
+		return nil, domain.ErrProjectAlreadyExists
+	}
+	username := strings.Split(newName, "/")[0]
+	if err := s.checkAccountLimits(projectName, username); err != nil {
+		return nil, err
+	}
+	info, err := s.repo.Clone(projectName, newName)
+	if err != nil {
+		return nil, err
+	}
+	s.updateIndex(newName)
+	s.removeRedirects(newName)
+	return info, nil
+}
+
+func (s *projectService) SetTemplate(projectName string, template bool) error {
+	if err := s.repo.SetTemplate(projectName, template); err != nil {
+		return err
+	}
+	s.updateIndex(projectName)
+	return nil
+}
+
+func (s *projectService) Templates(username string) ([]domain.ProjectInfo, error) {
+	query := domain.ProjectsQuery{Template: true}
+	own, _, err := s.GetUserProjects(username, query)
+	if err != nil {
+		return nil, err
+	}
+	accessible, _, err := s.AccessibleProjects(username, query, true)
+	if err != nil {
+		return nil, err
+	}
+	templates := own
+	for _, p := range accessible {
+		if !strings.HasPrefix(p.Name, username+"/") {
+			templates = append(templates, p)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
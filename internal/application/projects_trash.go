@@ -0,0 +1,101 @@
+package application
+
+import (
+	"fmt"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// storageUsage returns size of the storage used by the user, items in the trash are included
+// when required by the account's policy
+func (s *projectService) storageUsage(username string, accountConfig domain.AccountConfig) (int64, error) {
+	size, err := s.repo.AccountUsage(username)
+	if err != nil {
+		return 0, err
+	}
+	if accountConfig.CountTrash {
+		trashSize, err := s.repo.TrashUsage(username)
+		if err != nil {
+			return 0, fmt.Errorf("getting trash size: %w", err)
+		}
+		size += trashSize
+	}
+	return size, nil
+}
+
+func (s *projectService) ListTrash(username string) ([]domain.TrashItem, error) {
+	return s.repo.ListTrash(username)
+}
+
+// checkTrashLimits checks whether the trash item can be restored within the account limits
+func (s *projectService) checkTrashLimits(username string, item domain.TrashItem) error {
+	accountConfig, err := s.limiter.GetAccountLimits(username)
+	if err != nil {
+		return fmt.Errorf("getting user account limits config: %w", err)
+	}
+	projectSize := item.Size
+	if item.Type == domain.TrashProject {
+		projectsCount, err := s.userProjectsCount(username)
+		if err != nil {
+			return err
+		}
+		if !accountConfig.CheckProjectsLimit(projectsCount + 1) {
+			return ErrAccountProjectsLimit
+		}
+	} else {
+		pInfo, err := s.repo.GetProjectInfo(item.Project)
+		if err != nil {
+			return fmt.Errorf("getting project size: %w", err)
+		}
+		projectSize += pInfo.Size
+	}
+	if !accountConfig.CheckProjectSizeLimit(projectSize) {
+		return ErrProjectSizeLimit
+	}
+	// restored items are already counted when the trash is included in the storage usage
+	if accountConfig.HasStorageLimit() && !accountConfig.CountTrash {
+		totalSize, err := s.repo.AccountUsage(username)
+		if err != nil {
+			return fmt.Errorf("checking user storage limit: %w", err)
+		}
+		if !accountConfig.CheckStorageLimit(totalSize + item.Size) {
+			return ErrAccountStorageLimit
+		}
+	}
+	return nil
+}
+
+// RestoreTrash moves deleted project or files from the user's trash back into the project
+func (s *projectService) RestoreTrash(username, id string) (domain.TrashItem, error) {
+	item, err := s.repo.GetTrashItem(username, id)
+	if err != nil {
+		return item, err
+	}
+	if item.Type == domain.TrashFiles && !s.repo.CheckProjectExists(item.Project) {
+		return item, domain.ErrProjectNotExists
+	}
+	if item.Type == domain.TrashProject && s.repo.CheckProjectExists(item.Project) {
+		return item, domain.ErrProjectAlreadyExists
+	}
+	if err := s.checkTrashLimits(username, item); err != nil {
+		return item, err
+	}
+	item, err = s.repo.RestoreTrash(username, id)
+	if err != nil {
+		return item, err
+	}
+	s.updateIndex(item.Project)
+	if item.Type == domain.TrashProject {
+		s.removeRedirects(item.Project)
+	}
+	return item, nil
+}
+
+// PurgeTrash permanently removes items from the user's trash (all items when no ID is given)
+func (s *projectService) PurgeTrash(username string, ids ...string) error {
+	return s.repo.PurgeTrash(username, ids...)
+}
+
+func (s *projectService) PurgeExpiredTrash() (int, error) {
+	return s.repo.PurgeExpiredTrash()
+}
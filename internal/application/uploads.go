@@ -0,0 +1,347 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUploadNotExists      = errors.New("upload does not exists")
+	ErrUploadFileNotExists  = errors.New("file is not declared in the upload")
+	ErrUploadOffsetMismatch = errors.New("upload offset doesn't match")
+	ErrUploadSizeExceeded   = errors.New("upload exceeds declared file size")
+	ErrUploadIncomplete     = errors.New("upload is not complete")
+	ErrUploadLocked         = errors.New("upload is in progress")
+)
+
+// Upload is a resumable upload of project files. Files are uploaded in chunks (possibly
+// in multiple requests) and applied to the project when the upload is finalized.
+type Upload struct {
+	ID      string               `json:"id"`
+	Project string               `json:"project"`
+	User    string               `json:"user"`
+	Created time.Time            `json:"created"`
+	Files   []domain.ProjectFile `json:"files"`
+	Removes []string             `json:"removes"`
+	// number of already received bytes of each file
+	Offsets map[string]int64 `json:"offsets"`
+}
+
+func (u Upload) file(path string) (domain.ProjectFile, bool) {
+	for _, f := range u.Files {
+		if f.Path == path {
+			return f, true
+		}
+	}
+	return domain.ProjectFile{}, false
+}
+
+// Complete checks whether all declared files were received
+func (u Upload) Complete() bool {
+	for _, f := range u.Files {
+		if u.Offsets[f.Path] != f.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// UploadsService manages resumable uploads. Received data are stored in the upload's directory
+// (<root>/<id>/files), so the upload can be resumed also after restart of the server.
+type UploadsService struct {
+	log      *zap.SugaredLogger
+	root     string
+	projects ProjectService
+	// uploads are removed after this period of inactivity
+	Expiration time.Duration
+	locks      sync.Map
+	done       chan struct{}
+}
+
+func NewUploadsService(log *zap.SugaredLogger, root string, projects ProjectService) *UploadsService {
+	return &UploadsService{
+		log:        log,
+		root:       root,
+		projects:   projects,
+		Expiration: 24 * time.Hour,
+		done:       make(chan struct{}),
+	}
+}
+
+func (s *UploadsService) uploadPath(id string, elem ...string) string {
+	return filepath.Join(append([]string{s.root, id}, elem...)...)
+}
+
+// lock returns exclusive lock of the upload, so only single request can modify it
+func (s *UploadsService) lock(id string) (func(), error) {
+	l, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := l.(*sync.Mutex)
+	if !mu.TryLock() {
+		return nil, ErrUploadLocked
+	}
+	return mu.Unlock, nil
+}
+
+func (s *UploadsService) Create(user, projectName string, changes domain.FilesChanges) (Upload, error) {
+	for _, f := range changes.Updates {
+		if !filepath.IsLocal(f.Path) {
+			return Upload{}, fmt.Errorf("invalid file path: %s", f.Path)
+		}
+	}
+	if err := s.projects.CheckFilesChanges(projectName, changes); err != nil {
+		return Upload{}, err
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return Upload{}, fmt.Errorf("generating upload id: %w", err)
+	}
+	upload := Upload{
+		ID:      id.String(),
+		Project: projectName,
+		User:    user,
+		Created: time.Now().UTC(),
+		Files:   changes.Updates,
+		Removes: changes.Removes,
+		Offsets: make(map[string]int64, len(changes.Updates)),
+	}
+	if err := os.MkdirAll(s.uploadPath(upload.ID, "files"), 0775); err != nil {
+		return Upload{}, fmt.Errorf("creating upload directory: %w", err)
+	}
+	content, err := json.Marshal(upload)
+	if err != nil {
+		return Upload{}, err
+	}
+	if err := os.WriteFile(s.uploadPath(upload.ID, "upload.json"), content, 0664); err != nil {
+		return Upload{}, fmt.Errorf("saving upload info: %w", err)
+	}
+	return upload, nil
+}
+
+// Get returns upload info with current offsets (sizes of received data)
+func (s *UploadsService) Get(id string) (Upload, error) {
+	var upload Upload
+	if _, err := uuid.FromString(id); err != nil {
+		return upload, ErrUploadNotExists
+	}
+	content, err := os.ReadFile(s.uploadPath(id, "upload.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return upload, ErrUploadNotExists
+		}
+		return upload, err
+	}
+	if err := json.Unmarshal(content, &upload); err != nil {
+		return upload, fmt.Errorf("parsing upload info: %w", err)
+	}
+	upload.Offsets = make(map[string]int64, len(upload.Files))
+	for _, f := range upload.Files {
+		fStat, err := os.Stat(s.uploadPath(id, "files", f.Path))
+		if err == nil {
+			upload.Offsets[f.Path] = fStat.Size()
+		}
+	}
+	return upload, nil
+}
+
+// WriteChunk appends data to the uploaded file at the given offset, which must match the size
+// of already received data. Returns new offset.
+func (s *UploadsService) WriteChunk(id, path string, offset int64, r io.Reader) (int64, error) {
+	unlock, err := s.lock(id)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	upload, err := s.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	finfo, ok := upload.file(path)
+	if !ok {
+		return 0, ErrUploadFileNotExists
+	}
+	current := upload.Offsets[path]
+	if offset != current {
+		return current, ErrUploadOffsetMismatch
+	}
+	// account limits could be changed meanwhile
+	changes := domain.FilesChanges{Updates: upload.Files, Removes: upload.Removes}
+	if err := s.projects.CheckFilesChanges(upload.Project, changes); err != nil {
+		return current, err
+	}
+
+	absPath := s.uploadPath(id, "files", path)
+	if err := os.MkdirAll(filepath.Dir(absPath), 0775); err != nil {
+		return current, err
+	}
+	f, err := os.OpenFile(absPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	if err != nil {
+		return current, fmt.Errorf("opening upload file: %w", err)
+	}
+	defer f.Close()
+	// read one byte more than remaining size to detect oversized chunk
+	remaining := finfo.Size - current
+	n, err := io.Copy(f, io.LimitReader(r, remaining+1))
+	if n > remaining {
+		// discard exceeding data, so the upload can continue with valid chunk
+		if terr := f.Truncate(current + remaining); terr != nil {
+			return current, terr
+		}
+		return current + remaining, ErrUploadSizeExceeded
+	}
+	// received part of the chunk is kept also in case of error (e.g. broken connection),
+	// client can resume from the new offset
+	return current + n, err
+}
+
+// Finalize applies uploaded files to the project and removes the upload. Received files are
+// passed as opened files, so the storage can link them instead of copying.
+func (s *UploadsService) Finalize(id string) ([]domain.ProjectFile, error) {
+	unlock, err := s.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	upload, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !upload.Complete() {
+		return nil, ErrUploadIncomplete
+	}
+	i := 0
+	nextFile := func() (string, io.ReadCloser, error) {
+		if i >= len(upload.Files) {
+			return "", nil, io.EOF
+		}
+		path := upload.Files[i].Path
+		i++
+		f, err := os.Open(s.uploadPath(id, "files", path))
+		if err != nil {
+			return "", nil, err
+		}
+		return path, f, nil
+	}
+	changes := domain.FilesChanges{Updates: upload.Files, Removes: upload.Removes}
+	files, err := s.projects.UpdateFiles(upload.Project, changes, nextFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.remove(id); err != nil {
+		s.log.Errorw("removing finished upload", "id", id, zap.Error(err))
+	}
+	return files, nil
+}
+
+func (s *UploadsService) remove(id string) error {
+	defer s.locks.Delete(id)
+	return os.RemoveAll(s.uploadPath(id))
+}
+
+// Abort cancels the upload and removes received data
+func (s *UploadsService) Abort(id string) error {
+	unlock, err := s.lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.remove(id)
+}
+
+// AbortProjectUploads removes all uploads into the project (e.g. after the project was renamed),
+// returns number of removed uploads
+func (s *UploadsService) AbortProjectUploads(projectName string) int {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			s.log.Errorw("listing uploads", zap.Error(err))
+		}
+		return 0
+	}
+	count := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		upload, err := s.Get(e.Name())
+		if err != nil || upload.Project != projectName {
+			continue
+		}
+		if err := s.Abort(upload.ID); err != nil {
+			s.log.Errorw("aborting project upload", "id", upload.ID, "project", projectName, zap.Error(err))
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// lastActivity returns time of the last received data of the upload
+func (s *UploadsService) lastActivity(id string) time.Time {
+	var last time.Time
+	filepath.WalkDir(s.uploadPath(id), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+		return nil
+	})
+	return last
+}
+
+// removeExpired removes inactive uploads
+func (s *UploadsService) removeExpired() {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			s.log.Errorw("listing uploads", zap.Error(err))
+		}
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() || time.Since(s.lastActivity(e.Name())) < s.Expiration {
+			continue
+		}
+		unlock, err := s.lock(e.Name())
+		if err != nil {
+			continue
+		}
+		if err := s.remove(e.Name()); err != nil {
+			s.log.Errorw("removing expired upload", "id", e.Name(), zap.Error(err))
+		}
+		unlock()
+	}
+}
+
+// Start runs periodic removal of expired uploads
+func (s *UploadsService) Start() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	s.removeExpired()
+	for {
+		select {
+		case <-ticker.C:
+			s.removeExpired()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *UploadsService) Close() {
+	close(s.done)
+}
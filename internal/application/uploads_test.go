@@ -0,0 +1,149 @@
+package application
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// uploadsTestProjects is a projects service which only checks limits and receives updated files
+type uploadsTestProjects struct {
+	ProjectService
+	limitErr error
+	received map[string]string
+}
+
+func (p *uploadsTestProjects) CheckFilesChanges(projectName string, info domain.FilesChanges) error {
+	return p.limitErr
+}
+
+func (p *uploadsTestProjects) UpdateFiles(projectName string, info domain.FilesChanges, next func() (string, io.ReadCloser, error)) ([]domain.ProjectFile, error) {
+	p.received = make(map[string]string)
+	for range info.Updates {
+		path, r, err := next()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		p.received[path] = string(content)
+	}
+	return info.Updates, nil
+}
+
+func newTestUploads(t *testing.T) (*UploadsService, *uploadsTestProjects, Upload) {
+	t.Helper()
+	projects := &uploadsTestProjects{}
+	s := NewUploadsService(zap.NewNop().Sugar(), t.TempDir(), projects)
+	changes := domain.FilesChanges{Updates: []domain.ProjectFile{
+		{Path: "project.qgs", Size: 6},
+		{Path: "data/layer.geojson", Size: 4},
+	}}
+	upload, err := s.Create("user1", "user1/project", changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, projects, upload
+}
+
+func TestWriteChunk(t *testing.T) {
+	s, _, upload := newTestUploads(t)
+	tests := []struct {
+		name   string
+		path   string
+		offset int64
+		data   string
+		result int64
+		err    error
+	}{
+		{"first chunk", "project.qgs", 0, "abc", 3, nil},
+		{"offset behind", "project.qgs", 1, "bcd", 3, ErrUploadOffsetMismatch},
+		{"offset ahead", "project.qgs", 5, "f", 3, ErrUploadOffsetMismatch},
+		{"next chunk", "project.qgs", 3, "de", 5, nil},
+		{"exceeding chunk", "project.qgs", 5, "fgh", 6, ErrUploadSizeExceeded},
+		{"completed file", "project.qgs", 6, "x", 6, ErrUploadSizeExceeded},
+		{"undeclared file", "other.txt", 0, "x", 0, ErrUploadFileNotExists},
+		{"other file", "data/layer.geojson", 0, "{}{}", 4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, err := s.WriteChunk(upload.ID, tt.path, tt.offset, strings.NewReader(tt.data))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if offset != tt.result {
+				t.Errorf("offset %d, expected %d", offset, tt.result)
+			}
+		})
+	}
+	content, err := os.ReadFile(s.uploadPath(upload.ID, "files", "project.qgs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "abcdef" {
+		t.Errorf("uploaded content %q, expected %q", content, "abcdef")
+	}
+	u, err := s.Get(upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.Complete() {
+		t.Errorf("upload is not complete: %v", u.Offsets)
+	}
+}
+
+func TestWriteChunkConflict(t *testing.T) {
+	s, _, upload := newTestUploads(t)
+	unlock, err := s.lock(upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WriteChunk(upload.ID, "project.qgs", 0, strings.NewReader("abc")); !errors.Is(err, ErrUploadLocked) {
+		t.Errorf("expected ErrUploadLocked, got %v", err)
+	}
+	unlock()
+	if _, err := s.WriteChunk(upload.ID, "project.qgs", 0, strings.NewReader("abc")); err != nil {
+		t.Errorf("writing unlocked upload: %v", err)
+	}
+	if _, err := s.WriteChunk("f47ac10b-58cc-4372-a567-0e02b2c3d479", "project.qgs", 0, strings.NewReader("abc")); !errors.Is(err, ErrUploadNotExists) {
+		t.Errorf("expected ErrUploadNotExists, got %v", err)
+	}
+}
+
+func TestWriteChunkLimits(t *testing.T) {
+	s, projects, upload := newTestUploads(t)
+	projects.limitErr = ErrAccountStorageLimit
+	offset, err := s.WriteChunk(upload.ID, "project.qgs", 0, strings.NewReader("abc"))
+	if !errors.Is(err, ErrAccountStorageLimit) || offset != 0 {
+		t.Errorf("expected limit error at offset 0, got %v at %d", err, offset)
+	}
+}
+
+func TestFinalizeUpload(t *testing.T) {
+	s, projects, upload := newTestUploads(t)
+	if _, err := s.Finalize(upload.ID); !errors.Is(err, ErrUploadIncomplete) {
+		t.Fatalf("expected ErrUploadIncomplete, got %v", err)
+	}
+	for path, data := range map[string]string{"project.qgs": "<qgis>", "data/layer.geojson": "{}{}"} {
+		if _, err := s.WriteChunk(upload.ID, path, 0, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Finalize(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+	if projects.received["project.qgs"] != "<qgis>" || projects.received["data/layer.geojson"] != "{}{}" {
+		t.Errorf("unexpected received files: %v", projects.received)
+	}
+	if _, err := s.Get(upload.ID); !errors.Is(err, ErrUploadNotExists) {
+		t.Errorf("finished upload was not removed: %v", err)
+	}
+}
@@ -12,6 +12,8 @@ type AccountConfig struct {
 	ProjectsCountLimit int      `json:"projects_limit"`
 	ProjectSizeLimit   ByteSize `json:"project_size_limit"`
 	StorageLimit       ByteSize `json:"storage_limit"`
+	// CountTrash includes items in the trash into the storage usage
+	CountTrash bool `json:"count_trash"`
 }
 
 func parseByteSize(value string) (int64, error) {
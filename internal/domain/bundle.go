@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidBundle = errors.New("invalid project bundle")
+
+// Project bundle is a zip archive with layout:
+//
+//	manifest.json     BundleManifest
+//	meta/qgis.json    project's metadata
+//	meta/settings.json
+//	meta/scripts.json
+//	meta/thumbnail
+//	files/<path>      project files
+const (
+	BundleFormat       = "gisquick-project"
+	BundleVersion      = 1
+	BundleManifestFile = "manifest.json"
+	BundleMetaDir      = "meta"
+	BundleFilesDir     = "files"
+)
+
+// Configuration files of the project stored in the bundle
+var BundleMetaFiles = []string{"qgis.json", "settings.json", "scripts.json", "thumbnail"}
+
+type BundleManifest struct {
+	Format   string        `json:"format"`
+	Version  int           `json:"version"`
+	Project  string        `json:"project"` // name of the exported project
+	Exported time.Time     `json:"exported"`
+	Info     ProjectInfo   `json:"info"`
+	Meta     []string      `json:"meta"` // included configuration files
+	Files    []ProjectFile `json:"files"`
+}
+
+// BundleFilePath returns path of the project file in the bundle archive
+func BundleFilePath(filePath string) string {
+	return path.Join(BundleFilesDir, filepath.ToSlash(filePath))
+}
+
+// BundleMetaPath returns path of the configuration file in the bundle archive
+func BundleMetaPath(name string) string {
+	return path.Join(BundleMetaDir, name)
+}
+
+func (m BundleManifest) Validate() error {
+	if m.Format != BundleFormat || m.Version < 1 || m.Version > BundleVersion {
+		return ErrInvalidBundle
+	}
+	if !StringArray(m.Meta).Has("qgis.json") {
+		return ErrInvalidBundle
+	}
+	for _, name := range m.Meta {
+		if !StringArray(BundleMetaFiles).Has(name) {
+			return ErrInvalidBundle
+		}
+	}
+	paths := make(map[string]bool, len(m.Files))
+	for _, f := range m.Files {
+		if !filepath.IsLocal(f.Path) || f.Size < 0 {
+			return ErrInvalidBundle
+		}
+		// internal files of the project and duplicate entries are not allowed
+		p := filepath.ToSlash(filepath.Clean(f.Path))
+		if p == ".gisquick" || strings.HasPrefix(p, ".gisquick/") || paths[p] {
+			return ErrInvalidBundle
+		}
+		paths[p] = true
+	}
+	return nil
+}
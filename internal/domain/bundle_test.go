@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBundleManifestValidate(t *testing.T) {
+	manifest := func(paths ...string) BundleManifest {
+		m := BundleManifest{Format: BundleFormat, Version: BundleVersion, Meta: []string{"qgis.json", "settings.json"}}
+		for _, p := range paths {
+			m.Files = append(m.Files, ProjectFile{Path: p, Size: 1})
+		}
+		return m
+	}
+	valid := []BundleManifest{
+		manifest(),
+		manifest("project.qgs", "data/roads.gpkg", "web/.gisquick/style.css", ".gisquickrc"),
+	}
+	for _, m := range valid {
+		if err := m.Validate(); err != nil {
+			t.Errorf("%v: %v", m.Files, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		manifest BundleManifest
+	}{
+		{"parent directory", manifest("../project.qgs")},
+		{"nested parent directory", manifest("data/../../project.qgs")},
+		{"absolute path", manifest("/etc/passwd")},
+		{"empty path", manifest("")},
+		{"internal directory", manifest(".gisquick/settings.json")},
+		{"internal directory itself", manifest(".gisquick")},
+		{"unclean internal path", manifest("./.gisquick/settings.json")},
+		{"internal path with parent directory", manifest("data/../.gisquick/settings.json")},
+		{"duplicate file", manifest("project.qgs", "./project.qgs")},
+		{"negative size", BundleManifest{Format: BundleFormat, Version: BundleVersion, Meta: []string{"qgis.json"}, Files: []ProjectFile{{Path: "project.qgs", Size: -1}}}},
+		{"unknown meta file", BundleManifest{Format: BundleFormat, Version: BundleVersion, Meta: []string{"qgis.json", "../qgis.json"}}},
+		{"missing qgis meta", BundleManifest{Format: BundleFormat, Version: BundleVersion, Meta: []string{"settings.json"}}},
+		{"unknown format", BundleManifest{Format: "zip", Version: BundleVersion, Meta: []string{"qgis.json"}}},
+		{"newer version", BundleManifest{Format: BundleFormat, Version: BundleVersion + 1, Meta: []string{"qgis.json"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.manifest.Validate(); !errors.Is(err, ErrInvalidBundle) {
+				t.Errorf("expected ErrInvalidBundle, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Layer metadata keys included in the catalog
+var catalogMetadataKeys = []string{"abstract", "keywords", "keywordList", "description", "title"}
+
+// CatalogDocument is the searchable text of the project, grouped by relevance
+type CatalogDocument struct {
+	Title  string
+	Layers []string // layers titles
+	Text   []string // topics, abstracts and other layers metadata
+}
+
+// CatalogResult is a project matching the catalog search query
+type CatalogResult struct {
+	ProjectInfo
+	Rank float64 `json:"rank"`
+}
+
+// catalogUsers returns users representing all groups of users with access to the project, users
+// of the same group match the same roles
+func catalogUsers(info ProjectInfo, auth Authentication) []User {
+	owner := strings.Split(info.Name, "/")[0]
+	candidates := []User{
+		{}, // anonymous user
+		{Username: owner, IsAuthenticated: true},
+		{IsAuthenticated: true}, // user not listed in the project's settings
+	}
+	for _, username := range auth.Users {
+		candidates = append(candidates, User{Username: username, IsAuthenticated: true})
+	}
+	for _, role := range auth.Roles {
+		for _, username := range role.Users {
+			candidates = append(candidates, User{Username: username, IsAuthenticated: true})
+		}
+	}
+	users := make([]User, 0, len(candidates))
+	for _, u := range candidates {
+		if CanAccessProject(u, info, auth.Users) {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+// NewCatalogDocument collects searchable text from the project's metadata and settings. Catalog
+// is shared by all users, so only layers and topics visible to every user with access
+// to the project are included.
+func NewCatalogDocument(info ProjectInfo, meta QgisMeta, settings ProjectSettings) CatalogDocument {
+	var perms []*UserRolesPermissions
+	if len(settings.Auth.Roles) > 0 {
+		for _, u := range catalogUsers(info, settings.Auth) {
+			perms = append(perms, NewUserRolesPermissions(u, settings.Auth))
+		}
+	}
+	layerVisible := func(id string) bool {
+		if settings.Layers[id].Flags.Has("excluded") {
+			return false
+		}
+		for _, p := range perms {
+			if !p.LayerFlags(id).Has("view") {
+				return false
+			}
+		}
+		return true
+	}
+	topicVisible := func(topic Topic) bool {
+		for _, p := range perms {
+			if !Flags(p.UserTopics()).Has(topic.ID) {
+				return false
+			}
+		}
+		// topics without visible layers are not displayed
+		for _, id := range topic.Layers {
+			if layerVisible(id) && !settings.Layers[id].Flags.Has("hidden") {
+				return true
+			}
+		}
+		return false
+	}
+
+	doc := CatalogDocument{Title: info.Title}
+	ids := make([]string, 0, len(meta.Layers))
+	for id := range meta.Layers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !layerVisible(id) {
+			continue
+		}
+		layer := meta.Layers[id]
+		title := layer.Title
+		if title == "" {
+			title = layer.Name
+		}
+		doc.Layers = append(doc.Layers, title)
+		for _, key := range catalogMetadataKeys {
+			if value := strings.TrimSpace(layer.Metadata[key]); value != "" {
+				doc.Text = append(doc.Text, value)
+			}
+		}
+	}
+	for _, topic := range settings.Topics {
+		if !topicVisible(topic) {
+			continue
+		}
+		doc.Text = append(doc.Text, topic.Title)
+		if topic.Abstract != "" {
+			doc.Text = append(doc.Text, topic.Abstract)
+		}
+	}
+	return doc
+}
+
+// SearchTerms splits search text into lowercase terms
+func SearchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Weights of matches in the document parts
+const (
+	catalogTitleWeight = 1.0
+	catalogLayerWeight = 0.4
+	catalogTextWeight  = 0.1
+)
+
+// countTerm counts whole words matching the term, like the full-text search of the projects index
+func countTerm(texts []string, term string) int {
+	count := 0
+	for _, t := range texts {
+		for _, word := range SearchTerms(t) {
+			if word == term {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Rank computes relevance of the document for the search terms, returns 0 when any of the terms
+// is not found
+func (d CatalogDocument) Rank(terms []string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	rank := 0.0
+	for _, term := range terms {
+		title := countTerm([]string{d.Title}, term)
+		layers := countTerm(d.Layers, term)
+		text := countTerm(d.Text, term)
+		if title+layers+text == 0 {
+			return 0
+		}
+		score := catalogTitleWeight*float64(title) + catalogLayerWeight*float64(layers) + catalogTextWeight*float64(text)
+		// normalize repeated matches
+		rank += score / (1 + score)
+	}
+	return rank / float64(len(terms))
+}
+
+// CanAccessProject checks whether the user has access to the project by its authentication
+// type (allowedUsers are users of the project with "users" authentication)
+func CanAccessProject(user User, info ProjectInfo, allowedUsers []string) bool {
+	if info.Authentication == "public" {
+		return true
+	}
+	if !user.IsAuthenticated {
+		return false
+	}
+	if info.Authentication == "authenticated" || user.IsSuperuser || strings.HasPrefix(info.Name, user.Username+"/") {
+		return true
+	}
+	return info.Authentication == "users" && StringArray(allowedUsers).Has(user.Username)
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func catalogTestMeta() QgisMeta {
+	return QgisMeta{Layers: map[string]LayerMeta{
+		"roads":     {Name: "roads", Title: "Roads", Metadata: map[string]string{"abstract": "Road network"}},
+		"parcels":   {Name: "parcels", Title: "Parcels", Metadata: map[string]string{"keywords": "cadastre"}},
+		"buildings": {Name: "buildings"},
+	}}
+}
+
+func TestNewCatalogDocument(t *testing.T) {
+	topics := []Topic{
+		{ID: "transport", Title: "Transport", Abstract: "Roads of the city", Layers: []string{"roads"}},
+		{ID: "cadastre", Title: "Cadastre", Layers: []string{"parcels"}},
+	}
+	roles := func(other []string) []ProjectRole {
+		return []ProjectRole{
+			{Auth: "users", Name: "owners", Users: []string{"user2"}, Permissions: RolePermissions{
+				Layers: map[string]Flags{"roads": {"view"}, "parcels": {"view"}, "buildings": {"view"}},
+				Topics: []string{"transport", "cadastre"},
+			}},
+			{Auth: "other", Name: "others", Permissions: RolePermissions{
+				Layers: map[string]Flags{"roads": {"view"}, "buildings": {"view"}},
+				Topics: other,
+			}},
+		}
+	}
+	tests := []struct {
+		name     string
+		auth     string
+		settings ProjectSettings
+		layers   []string
+		text     []string
+	}{
+		{
+			name:   "without settings",
+			auth:   "public",
+			layers: []string{"buildings", "Parcels", "Roads"},
+			text:   []string{"cadastre", "Road network"},
+		},
+		{
+			name: "excluded and hidden layers",
+			auth: "public",
+			settings: ProjectSettings{
+				Layers: map[string]LayerSettings{"parcels": {Flags: Flags{"excluded"}}, "roads": {Flags: Flags{"hidden"}}},
+				Topics: topics,
+			},
+			layers: []string{"buildings", "Roads"},
+			text:   []string{"Road network"},
+		},
+		{
+			name:     "layers not visible to other users",
+			auth:     "public",
+			settings: ProjectSettings{Auth: Authentication{Roles: roles([]string{"transport"})}, Topics: topics},
+			layers:   []string{"buildings", "Roads"},
+			text:     []string{"Road network", "Transport", "Roads of the city"},
+		},
+		{
+			name:     "topics not visible to other users",
+			auth:     "authenticated",
+			settings: ProjectSettings{Auth: Authentication{Roles: roles(nil)}, Topics: topics},
+			layers:   []string{"buildings", "Roads"},
+			text:     []string{"Road network"},
+		},
+		{
+			name: "layers visible to all project's users",
+			auth: "users",
+			settings: ProjectSettings{
+				Auth: Authentication{Type: "users", Users: []string{"user2"}, Roles: []ProjectRole{
+					{Auth: "users", Name: "owners", Users: []string{"user1", "user2"}, Permissions: RolePermissions{
+						Layers: map[string]Flags{"roads": {"view"}, "parcels": {"view"}},
+						Topics: []string{"cadastre"},
+					}},
+				}},
+				Topics: topics,
+			},
+			layers: []string{"Parcels", "Roads"},
+			text:   []string{"cadastre", "Road network", "Cadastre"},
+		},
+		{
+			name: "user without roles",
+			auth: "users",
+			settings: ProjectSettings{
+				Auth: Authentication{Type: "users", Users: []string{"user2", "user3"}, Roles: []ProjectRole{
+					{Auth: "users", Name: "owners", Users: []string{"user1", "user2"}, Permissions: RolePermissions{
+						Layers: map[string]Flags{"roads": {"view"}},
+					}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := ProjectInfo{Name: "user1/project", Title: "Project", Authentication: tt.auth}
+			doc := NewCatalogDocument(info, catalogTestMeta(), tt.settings)
+			if doc.Title != "Project" {
+				t.Errorf("title %q", doc.Title)
+			}
+			if !reflect.DeepEqual(doc.Layers, tt.layers) {
+				t.Errorf("layers %q, expected %q", doc.Layers, tt.layers)
+			}
+			if !reflect.DeepEqual(doc.Text, tt.text) {
+				t.Errorf("text %q, expected %q", doc.Text, tt.text)
+			}
+		})
+	}
+}
+
+func TestCatalogDocumentRank(t *testing.T) {
+	doc := CatalogDocument{
+		Title:  "City roads",
+		Layers: []string{"Roads", "Parcels"},
+		Text:   []string{"Road network of the city", "cadastre"},
+	}
+	tests := []struct {
+		text string
+		rank bool
+	}{
+		{"roads", true},
+		{"City ROADS", true},
+		{"cadastre", true},
+		{"road", true},
+		{"roa", false},
+		{"roads forest", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if rank := doc.Rank(SearchTerms(tt.text)); (rank > 0) != tt.rank {
+				t.Errorf("rank %f", rank)
+			}
+		})
+	}
+	// match in the title is more relevant than in the layers and text
+	if title, text := doc.Rank([]string{"city"}), doc.Rank([]string{"cadastre"}); title <= text {
+		t.Errorf("title rank %f isn't higher than text rank %f", title, text)
+	}
+}
+
+func TestCanAccessProject(t *testing.T) {
+	anonymous := User{}
+	owner := User{Username: "user1", IsAuthenticated: true}
+	user := User{Username: "user2", IsAuthenticated: true}
+	superuser := User{Username: "admin", IsAuthenticated: true, IsSuperuser: true}
+	tests := []struct {
+		auth   string
+		access []bool // anonymous, owner, user, superuser
+	}{
+		{"public", []bool{true, true, true, true}},
+		{"authenticated", []bool{false, true, true, true}},
+		{"users", []bool{false, true, true, true}},
+		{"private", []bool{false, true, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.auth, func(t *testing.T) {
+			info := ProjectInfo{Name: "user1/project", Authentication: tt.auth}
+			for i, u := range []User{anonymous, owner, user, superuser} {
+				if access := CanAccessProject(u, info, []string{"user2"}); access != tt.access[i] {
+					t.Errorf("user %q: access %v", u.Username, access)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+// ProjectCheck is a result of the project's storage integrity check (files index compared
+// with files on the disk)
+type ProjectCheck struct {
+	Project string `json:"project"`
+	// indexed files which don't exist
+	MissingFiles []string `json:"missing_files,omitempty"`
+	// existing files which are not indexed
+	OrphanedFiles []string `json:"orphaned_files,omitempty"`
+	// files with different size or modification time than in the index
+	ChangedFiles []string `json:"changed_files,omitempty"`
+	// indexed files without checksum
+	MissingHashes []string `json:"missing_hashes,omitempty"`
+	// temporary files of the databases (gpkg-wal, gpkg-shm)
+	TemporaryFiles []string `json:"temporary_files,omitempty"`
+	// error of loading of the files index file
+	IndexError   string `json:"index_error,omitempty"`
+	Size         int64  `json:"size"`
+	RecordedSize int64  `json:"recorded_size"`
+	Repaired     bool   `json:"repaired"`
+	Error        string `json:"error,omitempty"`
+}
+
+// HasIssues reports inconsistencies of the project's files index (temporary files are not
+// considered as an issue)
+func (c ProjectCheck) HasIssues() bool {
+	return len(c.MissingFiles) > 0 || len(c.OrphanedFiles) > 0 || len(c.ChangedFiles) > 0 ||
+		len(c.MissingHashes) > 0 || c.IndexError != "" || c.Size != c.RecordedSize || c.Error != ""
+}
+
+type IntegrityReport struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Repair   bool      `json:"repair"`
+	Checked  int       `json:"checked"`
+	Issues   int       `json:"issues"`
+	Repaired int       `json:"repaired"`
+	// checked projects with issues or temporary files
+	Projects []ProjectCheck `json:"projects"`
+}
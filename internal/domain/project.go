@@ -1,39 +1,33 @@
 package domain
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
+	"strings"
+	"time"
 )
 
 var (
 	ErrProjectNotExists     = errors.New("project does not exists")
 	ErrFileNotExists        = errors.New("project file does not exists")
+	ErrFileHashMismatch     = errors.New("calculated file hash doesn't match")
 	ErrProjectAlreadyExists = errors.New("project already exists")
+	ErrVersionNotExists     = errors.New("project version does not exists")
+	ErrInvalidProjectName   = errors.New("invalid project name")
 )
 
-// Old code, currently used in mapcache package
-type ProjectFileInfo struct {
-	User     string
-	Folder   string
-	Name     string
-	FullName string
-	Map      string
-}
-
-// TODO: remove
-type Project struct {
-	Info     ProjectFileInfo
-	Meta     map[string]interface{}
-	Settings ProjectSettings
-}
-
-func (p *Project) ProjectionCode() string {
-	projection, ok := p.Meta["projection"].(map[string]interface{})
-	if !ok {
-		return ""
+// ValidateProjectName checks that the name has form <user>/<project> with valid path elements
+func ValidateProjectName(name string) error {
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 || !isValidUsername(parts[0]) {
+		return ErrInvalidProjectName
+	}
+	if parts[1] == "" || strings.HasPrefix(parts[1], ".") || strings.ContainsAny(parts[1], "\\:*?\"<>|") {
+		return ErrInvalidProjectName
 	}
-	return projection["code"].(string)
+	return nil
 }
 
 type Projection struct {
@@ -152,6 +146,15 @@ type ProjectFile struct {
 	Mtime int64  `json:"mtime"`
 }
 
+// ChecksumProgress is a progress of the project files checksums computation
+type ChecksumProgress struct {
+	Project   string `json:"project"`
+	Files     int    `json:"files"`
+	Total     int    `json:"total"`
+	Size      int64  `json:"size"`
+	TotalSize int64  `json:"total_size"`
+}
+
 func checkUserRole(u User, role ProjectRole) bool {
 	if role.Auth == "all" {
 		return true
@@ -203,6 +206,67 @@ type Scripts map[string]ScriptModule
 
 type FilesReader func() (string, io.ReadCloser, error)
 
+// Types of project change events
+const (
+	FilesChangedEvent    = "files_changed"
+	MetaChangedEvent     = "meta_changed"
+	SettingsChangedEvent = "settings_changed"
+	ProjectDeletedEvent  = "project_deleted"
+	ProjectRenamedEvent  = "project_renamed"
+)
+
+type ProjectEvent struct {
+	Type    string
+	Project string
+	Files   []string // updated or removed files (FilesChangedEvent)
+	NewName string   // new name of the project (ProjectRenamedEvent)
+}
+
+type ProjectEventHandler func(e ProjectEvent)
+
+// Types of changes recorded in project versions
+const (
+	FilesVersionChange    = "files"
+	MetaVersionChange     = "meta"
+	SettingsVersionChange = "settings"
+	ScriptsVersionChange  = "scripts"
+	InitialVersionChange  = "initial"
+	RollbackVersionChange = "rollback"
+)
+
+// ProjectVersion is a snapshot of the published project (files and configuration files)
+type ProjectVersion struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Change  string    `json:"change"` // recorded types of changes, separated by comma
+	Size    int64     `json:"size"`
+	Files   int       `json:"files"`
+}
+
+// ProjectsIndex is a queryable copy of the projects info, kept in sync with the projects repository
+type ProjectsIndex interface {
+	Save(info ProjectInfo, users []string) error
+	Delete(name string) error
+	Names() ([]string, error)
+	// UserProjects returns page of the user's projects and total number of matching projects
+	UserProjects(username string, query ProjectsQuery) ([]ProjectInfo, int, error)
+	// AccessibleProjects returns public projects, projects for authenticated users and projects
+	// shared with the user
+	AccessibleProjects(username string, query ProjectsQuery) ([]ProjectInfo, int, error)
+	SaveCatalog(name string, doc CatalogDocument) error
+	// SearchCatalog returns page of projects accessible by the user, ordered by relevance
+	SearchCatalog(user User, text string, limit, offset int) ([]CatalogResult, int, error)
+}
+
+// ProjectRedirects maps former names of renamed projects to their current names
+type ProjectRedirects interface {
+	Add(oldName, newName string) error
+	// Get returns current name of the renamed project, or ErrProjectNotExists
+	Get(oldName string) (string, error)
+	// Delete removes redirects from and to the project name
+	Delete(name string) error
+}
+
 type ProjectsRepository interface {
 	CheckProjectExists(name string) bool
 	Create(name string, qmeta json.RawMessage) (*ProjectInfo, error)
@@ -210,6 +274,15 @@ type ProjectsRepository interface {
 	UserProjects(user string) ([]string, error) // or should it require User object?
 	GetProjectInfo(name string) (ProjectInfo, error)
 	Delete(name string) error
+	// Purge permanently removes the project (it's not moved into the trash)
+	Purge(name string) error
+	// Rename moves the project under the new name, also updates references in users' dashboards
+	Rename(oldName, newName string) error
+	// Clone copies files and configuration of the project into the new project
+	Clone(srcName, destName string) (*ProjectInfo, error)
+	SetTemplate(projectName string, template bool) error
+	// Export writes the project bundle into the writer
+	Export(projectName string, w io.Writer) error
 	// SaveFile(projectName, filename string, r io.Reader) error
 	CreateFile(projectName, directory, pattern string, r io.Reader) (ProjectFile, error)
 	SaveFile(project string, finfo ProjectFile, path string) error
@@ -217,6 +290,9 @@ type ProjectsRepository interface {
 	GetFileInfo(project, path string) (FileInfo, error)
 	GetFilesInfo(project string, paths ...string) (map[string]FileInfo, error)
 	ListProjectFiles(project string, checksum bool) ([]ProjectFile, []ProjectFile, error)
+	// ListProjectFilesContext is like ListProjectFiles, but computation of checksums can be
+	// cancelled by the context and its progress is reported to the callback (optional)
+	ListProjectFilesContext(ctx context.Context, project string, checksum bool, progress func(ChecksumProgress)) ([]ProjectFile, []ProjectFile, error)
 
 	ParseQgisMetadata(projectName string, data interface{}) error
 	UpdateMeta(projectName string, meta json.RawMessage) error
@@ -225,11 +301,36 @@ type ProjectsRepository interface {
 	UpdateSettings(projectName string, data json.RawMessage) error
 
 	GetThumbnailPath(projectName string) string
+	// GetFilePath returns path of the project file in the local filesystem
+	GetFilePath(projectName, path string) string
 	SaveThumbnail(projectName string, r io.Reader) error
 
 	UpdateFiles(projectName string, info FilesChanges, next FilesReader) ([]ProjectFile, error)
+	// UpdateFileDelta updates the project file with its new version reconstructed from the block
+	// delta against the current version
+	UpdateFileDelta(projectName string, finfo ProjectFile, blockSize int, delta io.Reader) ([]ProjectFile, error)
 	GetScripts(projectName string) (Scripts, error)
 	UpdateScripts(projectName string, scripts Scripts) error
 	GetProjectCustomizations(projectName string) (json.RawMessage, error)
+	ListVersions(projectName string) ([]ProjectVersion, error)
+	// AccountUsage returns size of the storage used by the user's projects
+	AccountUsage(username string) (int64, error)
+	RestoreVersion(projectName string, id int) error
+
+	// ListTrash returns items in the user's trash
+	ListTrash(username string) ([]TrashItem, error)
+	GetTrashItem(username, id string) (TrashItem, error)
+	// RestoreTrash moves deleted project or files from the user's trash back
+	RestoreTrash(username, id string) (TrashItem, error)
+	// PurgeTrash permanently removes items from the user's trash (all items when no ID is given)
+	PurgeTrash(username string, ids ...string) error
+	// PurgeExpiredTrash permanently removes expired items from all trashes
+	PurgeExpiredTrash() (int, error)
+	// TrashUsage returns size of the items in the user's trash
+	TrashUsage(username string) (int64, error)
+	// CheckIntegrity verifies the project's files index against stored files, the index and
+	// project's size are fixed when repair is enabled
+	CheckIntegrity(projectName string, repair bool) (ProjectCheck, error)
+	OnChange(handler ProjectEventHandler)
 	Close()
 }
@@ -3,6 +3,8 @@ package domain
 import (
 	"encoding/json"
 	"errors"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -23,6 +25,8 @@ type ProjectInfo struct {
 	State     string `json:"state"`
 	Size      int64  `json:"size"` // size in bytes
 	Thumbnail bool   `json:"thumbnail"`
+	// project is offered as a template of new projects
+	Template bool `json:"template"`
 }
 
 type LayerNode struct {
@@ -51,6 +55,42 @@ type LayerMeta struct {
 	Relations    json.RawMessage            `json:"relations,omitempty"`
 }
 
+// SourceFile returns path (relative to the project directory) of the layer's data file,
+// or empty string for layers which are not file based.
+func (l LayerMeta) SourceFile(projectName string) string {
+	for _, key := range []string{"path", "file", "dbname"} {
+		path := l.SourceParams.String(key)
+		if path == "" {
+			continue
+		}
+		path = filepath.ToSlash(filepath.Clean(path))
+		if filepath.IsAbs(path) {
+			// absolute path in the publish directory (e.g. /publish/user/project/data.gpkg)
+			prefix := "/" + projectName + "/"
+			i := strings.Index(path, prefix)
+			if i == -1 {
+				return ""
+			}
+			path = path[i+len(prefix):]
+		}
+		return strings.TrimPrefix(path, "./")
+	}
+	return ""
+}
+
+// UsesFile checks whether the given project file belongs to the layer's data source. Files
+// with the same name and different extension (e.g. shapefile's .dbf or .prj) are also matched.
+func (l LayerMeta) UsesFile(projectName, path string) bool {
+	source := l.SourceFile(projectName)
+	if source == "" {
+		return false
+	}
+	if source == path {
+		return true
+	}
+	return strings.TrimSuffix(source, filepath.Ext(source)) == strings.TrimSuffix(path, filepath.Ext(path))
+}
+
 type LayerAttribute struct {
 	Alias      string                 `json:"alias,omitempty"`
 	Name       string                 `json:"name"`
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidProjectsQuery = errors.New("invalid projects query")
+
+// Sort fields of projects listings
+const (
+	SortByName       = "name"
+	SortByTitle      = "title"
+	SortByLastUpdate = "last_update"
+	SortBySize       = "size"
+)
+
+// ProjectsQuery specifies filtering, sorting and pagination of projects listings
+type ProjectsQuery struct {
+	State          []string
+	Authentication []string
+	Projection     []string
+	// only projects marked as templates
+	Template bool
+	// case-insensitive search in the project's title
+	Search string
+	// sort field, descending order with "-" prefix (e.g. -last_update)
+	Sort   string
+	Limit  int // 0 means no limit
+	Offset int
+}
+
+// SortField returns sort field and order
+func (q ProjectsQuery) SortField() (string, bool) {
+	if strings.HasPrefix(q.Sort, "-") {
+		return q.Sort[1:], true
+	}
+	if q.Sort == "" {
+		return SortByName, false
+	}
+	return q.Sort, false
+}
+
+func (q ProjectsQuery) Validate() error {
+	field, _ := q.SortField()
+	switch field {
+	case SortByName, SortByTitle, SortByLastUpdate, SortBySize:
+	default:
+		return ErrInvalidProjectsQuery
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return ErrInvalidProjectsQuery
+	}
+	return nil
+}
+
+func (q ProjectsQuery) Match(p ProjectInfo) bool {
+	if len(q.State) > 0 && !StringArray(q.State).Has(p.State) {
+		return false
+	}
+	if len(q.Authentication) > 0 && !StringArray(q.Authentication).Has(p.Authentication) {
+		return false
+	}
+	if len(q.Projection) > 0 && !StringArray(q.Projection).Has(p.Projection) {
+		return false
+	}
+	if q.Template && !p.Template {
+		return false
+	}
+	if q.Search != "" && !strings.Contains(strings.ToLower(p.Title), strings.ToLower(q.Search)) {
+		return false
+	}
+	return true
+}
+
+func (q ProjectsQuery) less(a, b ProjectInfo) bool {
+	field, desc := q.SortField()
+	if desc {
+		a, b = b, a
+	}
+	switch field {
+	case SortByTitle:
+		if ta, tb := strings.ToLower(a.Title), strings.ToLower(b.Title); ta != tb {
+			return ta < tb
+		}
+	case SortByLastUpdate:
+		if !a.LastUpdate.Equal(b.LastUpdate) {
+			return a.LastUpdate.Before(b.LastUpdate)
+		}
+	case SortBySize:
+		if a.Size != b.Size {
+			return a.Size < b.Size
+		}
+	}
+	return a.Name < b.Name
+}
+
+// Apply filters, sorts and paginates projects, returns selected page and the total number
+// of matching projects
+func (q ProjectsQuery) Apply(projects []ProjectInfo) ([]ProjectInfo, int) {
+	result := make([]ProjectInfo, 0, len(projects))
+	for _, p := range projects {
+		if q.Match(p) {
+			result = append(result, p)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return q.less(result[i], result[j])
+	})
+	total := len(result)
+	if q.Offset >= total {
+		return []ProjectInfo{}, total
+	}
+	result = result[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(result) {
+		result = result[:q.Limit]
+	}
+	return result, total
+}
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func queryTestProjects() []ProjectInfo {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	return []ProjectInfo{
+		{Name: "user1/roads", Title: "Roads", State: "published", Authentication: "public", Projection: "EPSG:3857", Size: 300, LastUpdate: day(3)},
+		{Name: "user1/parcels", Title: "parcels", State: "published", Authentication: "private", Projection: "EPSG:5514", Size: 100, LastUpdate: day(1)},
+		{Name: "user1/empty", Title: "Empty", State: "empty", Authentication: "private", Projection: "EPSG:3857"},
+		{Name: "user2/rivers", Title: "Rivers and roads", State: "published", Authentication: "users", Projection: "EPSG:3857", Size: 200, LastUpdate: day(2), Template: true},
+		{Name: "user2/forests", Title: "Forests", State: "updating", Authentication: "public", Projection: "EPSG:3857", Size: 200, LastUpdate: day(2)},
+	}
+}
+
+func TestProjectsQueryApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		query ProjectsQuery
+		names []string
+		total int
+	}{
+		{"default", ProjectsQuery{}, []string{"user1/empty", "user1/parcels", "user1/roads", "user2/forests", "user2/rivers"}, 5},
+		{"state", ProjectsQuery{State: []string{"published", "updating"}}, []string{"user1/parcels", "user1/roads", "user2/forests", "user2/rivers"}, 4},
+		{"authentication", ProjectsQuery{Authentication: []string{"public"}}, []string{"user1/roads", "user2/forests"}, 2},
+		{"projection", ProjectsQuery{Projection: []string{"EPSG:5514"}}, []string{"user1/parcels"}, 1},
+		{"template", ProjectsQuery{Template: true}, []string{"user2/rivers"}, 1},
+		{"search", ProjectsQuery{Search: "ROAD"}, []string{"user1/roads", "user2/rivers"}, 2},
+		{"sort by title", ProjectsQuery{Sort: SortByTitle}, []string{"user1/empty", "user2/forests", "user1/parcels", "user2/rivers", "user1/roads"}, 5},
+		{"sort by size", ProjectsQuery{Sort: SortBySize}, []string{"user1/empty", "user1/parcels", "user2/forests", "user2/rivers", "user1/roads"}, 5},
+		{"sort by size descending", ProjectsQuery{Sort: "-" + SortBySize}, []string{"user1/roads", "user2/rivers", "user2/forests", "user1/parcels", "user1/empty"}, 5},
+		{"sort by last update", ProjectsQuery{Sort: SortByLastUpdate, State: []string{"published"}}, []string{"user1/parcels", "user2/rivers", "user1/roads"}, 3},
+		{"page", ProjectsQuery{Sort: SortByTitle, Limit: 2, Offset: 1}, []string{"user2/forests", "user1/parcels"}, 5},
+		{"last page", ProjectsQuery{Limit: 2, Offset: 4}, []string{"user2/rivers"}, 5},
+		{"page out of range", ProjectsQuery{Limit: 2, Offset: 10}, []string{}, 5},
+		{"no match", ProjectsQuery{Search: "lakes", Offset: 1}, []string{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.query.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			page, total := tt.query.Apply(queryTestProjects())
+			names := make([]string, len(page))
+			for i, p := range page {
+				names[i] = p.Name
+			}
+			if !reflect.DeepEqual(names, tt.names) {
+				t.Errorf("projects %v, expected %v", names, tt.names)
+			}
+			if total != tt.total {
+				t.Errorf("total %d, expected %d", total, tt.total)
+			}
+		})
+	}
+}
+
+func TestProjectsQueryValidate(t *testing.T) {
+	for _, q := range []ProjectsQuery{{Sort: "state"}, {Sort: "-"}, {Limit: -1}, {Offset: -1}} {
+		if err := q.Validate(); !errors.Is(err, ErrInvalidProjectsQuery) {
+			t.Errorf("%+v: expected ErrInvalidProjectsQuery, got %v", q, err)
+		}
+	}
+}
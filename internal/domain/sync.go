@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+)
+
+// SyncPlan describes operations needed to synchronize project files with the client's files
+type SyncPlan struct {
+	Add       []ProjectFile `json:"add"`
+	Update    []SyncUpdate  `json:"update"`
+	Delete    []string      `json:"delete"`
+	Unchanged int           `json:"unchanged"`
+}
+
+type SyncUpdate struct {
+	ProjectFile
+	// file is large enough to be uploaded as a block delta against the current file
+	Delta bool `json:"delta"`
+}
+
+func hashType(hash string) string {
+	if i := strings.Index(hash, ":"); i != -1 {
+		return hash[:i]
+	}
+	return ""
+}
+
+// SameFile compares file infos by hash when both hashes are of the same type,
+// otherwise by size and modification time
+func SameFile(a, b ProjectFile) bool {
+	if a.Hash != "" && b.Hash != "" && hashType(a.Hash) == hashType(b.Hash) {
+		return a.Hash == b.Hash
+	}
+	return a.Size == b.Size && a.Mtime == b.Mtime
+}
+
+// PlanSync compares the server's and client's files. Server files with any of the keep prefixes
+// (e.g. media files uploaded from the web application) are never deleted.
+func PlanSync(serverFiles, clientFiles []ProjectFile, keep []string, deltaMinSize int64) SyncPlan {
+	plan := SyncPlan{Add: []ProjectFile{}, Update: []SyncUpdate{}, Delete: []string{}}
+	current := make(map[string]ProjectFile, len(serverFiles))
+	for _, f := range serverFiles {
+		current[f.Path] = f
+	}
+	clientPaths := make(map[string]bool, len(clientFiles))
+	for _, f := range clientFiles {
+		clientPaths[f.Path] = true
+		sf, exists := current[f.Path]
+		if !exists {
+			plan.Add = append(plan.Add, f)
+		} else if !SameFile(sf, f) {
+			delta := deltaMinSize > 0 && f.Size >= deltaMinSize && sf.Size > 0
+			plan.Update = append(plan.Update, SyncUpdate{ProjectFile: f, Delta: delta})
+		} else {
+			plan.Unchanged++
+		}
+	}
+	for _, f := range serverFiles {
+		if clientPaths[f.Path] {
+			continue
+		}
+		kept := false
+		for _, prefix := range keep {
+			kept = kept || strings.HasPrefix(f.Path, prefix)
+		}
+		if !kept {
+			plan.Delete = append(plan.Delete, f.Path)
+		}
+	}
+	sort.Slice(plan.Add, func(i, j int) bool { return plan.Add[i].Path < plan.Add[j].Path })
+	sort.Slice(plan.Update, func(i, j int) bool { return plan.Update[i].Path < plan.Update[j].Path })
+	sort.Strings(plan.Delete)
+	return plan
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrTokenNotExists = errors.New("token does not exists")
+)
+
+// Scopes of the API tokens
+const (
+	ScopeMap      = "map"      // reading of the map projects (project config, search, tiles, media)
+	ScopeOWS      = "ows"      // OWS services (WMS, WFS, WMTS) for QGIS or other clients
+	ScopeUpload   = "upload"   // creating projects, uploading and managing of project files
+	ScopeSettings = "settings" // project settings and configuration
+	ScopeAdmin    = "admin"    // projects administration (delete, rename, import etc.) and admin API
+)
+
+var TokenScopes = StringArray{ScopeMap, ScopeOWS, ScopeUpload, ScopeSettings, ScopeAdmin}
+
+// APIToken is personal access token used for programmatic access to the API. Only the hash
+// of the token is stored, so the token's value is known only when it's created.
+type APIToken struct {
+	ID       string      `json:"id"`
+	Username string      `json:"-"`
+	Name     string      `json:"name"`
+	Scopes   StringArray `json:"scopes"`
+	Created  time.Time   `json:"created"`
+	Expires  *time.Time  `json:"expires"`
+	LastUsed *time.Time  `json:"last_used"`
+}
+
+func (t APIToken) HasScope(scope string) bool {
+	return t.Scopes.Has(scope)
+}
+
+func (t APIToken) Expired() bool {
+	return t.Expires != nil && time.Now().After(*t.Expires)
+}
+
+type TokensRepository interface {
+	Create(token APIToken, hash string) error
+	GetByHash(hash string) (APIToken, error)
+	List(username string) ([]APIToken, error)
+	Delete(username, id string) error
+	UpdateLastUsed(id string, t time.Time) error
+}
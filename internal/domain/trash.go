@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrTrashItemNotExists = errors.New("trash item does not exists")
+	// ErrTrashConflict is returned when restored files would overwrite existing project files
+	ErrTrashConflict = errors.New("restored files already exists")
+)
+
+// Types of trash items
+const (
+	TrashProject = "project"
+	TrashFiles   = "files"
+)
+
+// TrashItem is deleted project or a set of project files removed by single change, it is kept
+// in the owner's trash until it expires
+type TrashItem struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Project string    `json:"project"`
+	Files   []string  `json:"files,omitempty"` // removed files or directories (TrashFiles)
+	Size    int64     `json:"size"`
+	Deleted time.Time `json:"deleted"`
+	Expires time.Time `json:"expires"`
+}
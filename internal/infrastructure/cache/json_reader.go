@@ -62,7 +62,8 @@ func (r *JSONFileReader[V]) Get(filename string) (V, error) {
 		return v, err
 	}
 	updated := fStat.ModTime()
-	timestamp := updated.Unix()
+	// files can be changed multiple times within a second
+	timestamp := updated.UnixNano()
 
 	item := r.cache.Get(filename)
 	if item == nil {
@@ -94,6 +95,11 @@ func (r *JSONFileReader[V]) Get(filename string) (V, error) {
 	return rec.Val, nil
 }
 
+// Invalidate removes cached data of the file
+func (r *JSONFileReader[V]) Invalidate(filename string) {
+	r.cache.Delete(filename)
+}
+
 func (r *JSONFileReader[V]) Close() {
 	r.cache.Stop()
 	r.cache.DeleteAll()
@@ -0,0 +1,192 @@
+// Package dbhash computes content hash of the SQLite databases (GeoPackages) with the same
+// result as the dbhash utility of SQLite, without the need of the SQLite library. The hash
+// depends only on the content and schema of the database, so it doesn't change with
+// the pages layout (e.g. after VACUUM).
+// https://www.sqlite.org/src/file/tool/dbhash.c
+package dbhash
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"sort"
+)
+
+// schemaEntry is a row of the sqlite_schema table
+type schemaEntry struct {
+	typ      string
+	name     string
+	tblName  string
+	rootPage int64
+	// text or nil
+	sql interface{}
+}
+
+func readSchema(db *database) ([]schemaEntry, error) {
+	var schema []schemaEntry
+	err := db.scanTable(1, func(rowid int64, payload []byte) error {
+		values, err := decodeRecord(payload)
+		if err != nil {
+			return err
+		}
+		if len(values) < 5 {
+			return ErrCorrupted
+		}
+		typ, ok1 := values[0].(text)
+		name, ok2 := values[1].(text)
+		tblName, ok3 := values[2].(text)
+		if !ok1 || !ok2 || !ok3 {
+			return ErrCorrupted
+		}
+		rootPage, _ := values[3].(int64)
+		schema = append(schema, schemaEntry{
+			typ:      string(typ),
+			name:     string(name),
+			tblName:  string(tblName),
+			rootPage: rootPage,
+			sql:      values[4],
+		})
+		return nil
+	})
+	return schema, err
+}
+
+func lowerASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// compareNocase compares strings the same way as the NOCASE collation
+func compareNocase(a, b string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if ca, cb := lowerASCII(a[i]), lowerASCII(b[i]); ca != cb {
+			return int(ca) - int(cb)
+		}
+	}
+	return len(a) - len(b)
+}
+
+// hasPrefixFold matches the prefix case-insensitively (ASCII only, like the LIKE operator)
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && compareNocase(s[:len(prefix)], prefix) == 0
+}
+
+// hashedTable matches tables selected by the dbhash query
+//
+//	SELECT name FROM sqlite_schema
+//	 WHERE type='table' AND sql NOT LIKE 'CREATE VIRTUAL%' AND name NOT LIKE 'sqlite_%'
+func hashedTable(e schemaEntry) bool {
+	sql, ok := e.sql.(text)
+	if e.typ != "table" || !ok || hasPrefixFold(string(sql), "CREATE VIRTUAL") {
+		return false
+	}
+	return !(len(e.name) > len("sqlite") && hasPrefixFold(e.name, "sqlite"))
+}
+
+func hashValue(h hash.Hash, value interface{}) {
+	var buf [9]byte
+	switch v := value.(type) {
+	case nil:
+		h.Write([]byte("0"))
+	case int64:
+		buf[0] = '1'
+		binary.BigEndian.PutUint64(buf[1:], uint64(v))
+		h.Write(buf[:])
+	case float64:
+		buf[0] = '2'
+		binary.BigEndian.PutUint64(buf[1:], math.Float64bits(v))
+		h.Write(buf[:])
+	case text:
+		h.Write([]byte("3"))
+		h.Write(v)
+	case blob:
+		h.Write([]byte("4"))
+		h.Write(v)
+	}
+}
+
+// hashTable hashes rows of the table, like 'SELECT * FROM <table>' query. SQLite always scans
+// the table b-tree for such query, so rows are hashed in the rowid order.
+func hashTable(db *database, h hash.Hash, e schemaEntry) error {
+	sql := e.sql.(text)
+	tbl, err := parseCreateTable(string(sql))
+	if err != nil {
+		return fmt.Errorf("parsing table %s: %w", e.name, err)
+	}
+	if e.rootPage <= 0 || e.rootPage > math.MaxUint32 {
+		return ErrCorrupted
+	}
+	return db.scanTable(uint32(e.rootPage), func(rowid int64, payload []byte) error {
+		values, err := decodeRecord(payload)
+		if err != nil {
+			return err
+		}
+		for i, col := range tbl.columns {
+			var value interface{}
+			switch {
+			case i == tbl.rowidColumn:
+				value = rowid
+			case i < len(values):
+				value = values[i]
+			default:
+				// row was created before the column was added
+				if col.defaultErr != nil {
+					return col.defaultErr
+				}
+				value = col.defaultValue
+			}
+			// integers are stored in REAL columns to save space
+			if v, ok := value.(int64); ok && col.affinity == affinityReal {
+				value = float64(v)
+			}
+			hashValue(h, value)
+		}
+		return nil
+	})
+}
+
+// Hash computes hash of the database content, the same as 'dbhash <path>' command
+func Hash(path string) (string, error) {
+	return HashContext(context.Background(), path)
+}
+
+// HashContext computes hash of the database content, computation is stopped when the context
+// is cancelled
+func HashContext(ctx context.Context, path string) (string, error) {
+	db, err := openDatabase(path)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	db.ctx = ctx
+
+	schema, err := readSchema(db)
+	if err != nil {
+		return "", fmt.Errorf("reading schema: %w", err)
+	}
+	sort.SliceStable(schema, func(i, j int) bool {
+		return compareNocase(schema[i].name, schema[j].name) < 0
+	})
+
+	h := sha1.New()
+	for _, e := range schema {
+		if hashedTable(e) {
+			if err := hashTable(db, h, e); err != nil {
+				return "", err
+			}
+		}
+	}
+	// SELECT type, name, tbl_name, sql FROM sqlite_schema ORDER BY name COLLATE nocase
+	for _, e := range schema {
+		hashValue(h, text(e.typ))
+		hashValue(h, text(e.name))
+		hashValue(h, text(e.tblName))
+		hashValue(h, e.sql)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,49 @@
+package dbhash
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test databases and reference hashes are created by testdata/generate.py
+func TestHash(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "hashes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// expected hash or null when the database is not supported
+	var hashes map[string]*string
+	if err := json.Unmarshal(content, &hashes); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range hashes {
+		t.Run(name, func(t *testing.T) {
+			hash, err := Hash(filepath.Join("testdata", name))
+			if expected == nil {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Errorf("expected ErrUnsupported, got hash %q, error: %v", hash, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != *expected {
+				t.Errorf("got hash %s, expected %s", hash, *expected)
+			}
+		})
+	}
+}
+
+func TestHashNotDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.gpkg")
+	if err := os.WriteFile(path, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Hash(path); !errors.Is(err, ErrNotDatabase) {
+		t.Errorf("expected ErrNotDatabase, got %v", err)
+	}
+}
@@ -0,0 +1,411 @@
+package dbhash
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenBlob
+	tokenNumber
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// is checks whether the token is an unquoted keyword
+func (t token) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (t token) isPunct(p string) bool {
+	return t.kind == tokenPunct && t.text == p
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// unquote reads quoted text starting at s[i], quotes inside are escaped by doubling
+func unquote(s string, i int, end byte) (string, int, error) {
+	var b strings.Builder
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == end {
+			if end != ']' && j+1 < len(s) && s[j+1] == end {
+				b.WriteByte(end)
+				j++
+				continue
+			}
+			return b.String(), j + 1, nil
+		}
+		b.WriteByte(s[j])
+	}
+	return "", 0, fmt.Errorf("unterminated quoted text")
+}
+
+// tokenize splits SQL statement into tokens (whitespaces and comments are skipped)
+func tokenize(sql string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end == -1 {
+				i = len(sql)
+			} else {
+				i += end + 1
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end == -1 {
+				i = len(sql)
+			} else {
+				i += end + 4
+			}
+		case c == '"' || c == '`' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			value, next, err := unquote(sql, i, end)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenIdent, value})
+			i = next
+		case c == '\'':
+			value, next, err := unquote(sql, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, value})
+			i = next
+		case (c == 'x' || c == 'X') && i+1 < len(sql) && sql[i+1] == '\'':
+			value, next, err := unquote(sql, i+1, '\'')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenBlob, value})
+			i = next
+		case (c >= '0' && c <= '9') || (c == '.' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9'):
+			j := i + 1
+			for j < len(sql) {
+				if isWordChar(sql[j]) || sql[j] == '.' {
+					j++
+				} else if (sql[j] == '+' || sql[j] == '-') && (sql[j-1] == 'e' || sql[j-1] == 'E') && !strings.HasPrefix(strings.ToLower(sql[i:]), "0x") {
+					j++
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, sql[i:j]})
+			i = j
+		case isWordChar(c):
+			j := i + 1
+			for j < len(sql) && isWordChar(sql[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenWord, sql[i:j]})
+			i = j
+		default:
+			tokens = append(tokens, token{tokenPunct, string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// group returns tokens of the parenthesized list starting at tokens[start] ("(" token), split
+// by the top level commas, and the index of the token following the closing parenthesis
+func group(tokens []token, start int) ([][]token, int, error) {
+	if start >= len(tokens) || !tokens[start].isPunct("(") {
+		return nil, 0, fmt.Errorf("expected '('")
+	}
+	var items [][]token
+	depth := 0
+	itemStart := start + 1
+	for i := start; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+			if depth == 0 {
+				items = append(items, tokens[itemStart:i])
+				return items, i + 1, nil
+			}
+		case t.isPunct(",") && depth == 1:
+			items = append(items, tokens[itemStart:i])
+			itemStart = i + 1
+		}
+	}
+	return nil, 0, fmt.Errorf("unterminated list")
+}
+
+// column affinities
+const (
+	affinityBlob = iota
+	affinityText
+	affinityNumeric
+	affinityInteger
+	affinityReal
+)
+
+// columnAffinity determines affinity from the declared type
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity
+func columnAffinity(declType string) int {
+	t := strings.ToUpper(declType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return affinityInteger
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return affinityText
+	case t == "", strings.Contains(t, "BLOB"):
+		return affinityBlob
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return affinityReal
+	}
+	return affinityNumeric
+}
+
+type column struct {
+	name     string
+	declType string
+	affinity int
+	// default value used for rows created before the column was added
+	defaultValue interface{}
+	defaultErr   error
+}
+
+type table struct {
+	columns []column
+	// index of the INTEGER PRIMARY KEY column (alias of the rowid), -1 if there is none
+	rowidColumn int
+}
+
+var columnConstraints = []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT", "COLLATE", "REFERENCES", "GENERATED", "AS"}
+
+func isColumnConstraint(t token) bool {
+	for _, keyword := range columnConstraints {
+		if t.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexedColumns returns names of columns of the indexed-column list, expressions are
+// reported with ok set to false
+func indexedColumns(items [][]token) (names []string, ok bool) {
+	for _, item := range items {
+		if len(item) == 0 || (item[0].kind != tokenWord && item[0].kind != tokenIdent && item[0].kind != tokenString) {
+			return nil, false
+		}
+		for _, t := range item[1:] {
+			if !t.is("ASC") && !t.is("DESC") && !t.is("COLLATE") && t.kind != tokenWord && t.kind != tokenIdent {
+				return nil, false
+			}
+		}
+		names = append(names, item[0].text)
+	}
+	return names, true
+}
+
+// parseCreateTable parses columns definitions of the CREATE TABLE statement
+func parseCreateTable(sql string) (*table, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	start := -1
+	for i, t := range tokens {
+		if t.isPunct("(") {
+			start = i
+			break
+		}
+	}
+	items, end, err := group(tokens, start)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens[end:] {
+		if t.is("WITHOUT") {
+			return nil, fmt.Errorf("%w: WITHOUT ROWID table", ErrUnsupported)
+		}
+	}
+
+	tbl := &table{rowidColumn: -1}
+	var primaryKey []string
+	pkDesc := false
+	for _, item := range items {
+		if len(item) == 0 {
+			return nil, fmt.Errorf("empty column definition")
+		}
+		first := item[0]
+		// table constraints
+		if first.is("CONSTRAINT") || first.is("PRIMARY") || first.is("UNIQUE") || first.is("CHECK") || first.is("FOREIGN") {
+			for i, t := range item {
+				if t.is("PRIMARY") {
+					list, _, err := group(item, i+2)
+					if err != nil {
+						return nil, err
+					}
+					if names, ok := indexedColumns(list); ok {
+						primaryKey = names
+					}
+					break
+				}
+			}
+			continue
+		}
+
+		col := column{name: first.text}
+		i := 1
+		var typeTokens []string
+		for ; i < len(item) && !isColumnConstraint(item[i]); i++ {
+			typeTokens = append(typeTokens, item[i].text)
+		}
+		col.declType = strings.Join(typeTokens, " ")
+		col.affinity = columnAffinity(col.declType)
+
+		depth := 0
+		for ; i < len(item); i++ {
+			t := item[i]
+			// skip expressions of CHECK constraints, DEFAULT values etc.
+			if t.isPunct("(") {
+				depth++
+			} else if t.isPunct(")") {
+				depth--
+			}
+			if depth > 0 {
+				continue
+			}
+			switch {
+			case t.is("PRIMARY"):
+				primaryKey = []string{col.name}
+				pkDesc = i+2 < len(item) && item[i+2].is("DESC")
+			case t.is("GENERATED") || t.is("AS"):
+				return nil, fmt.Errorf("%w: generated column", ErrUnsupported)
+			case t.is("DEFAULT") && i+1 < len(item):
+				var value interface{}
+				value, col.defaultErr = parseDefault(item[i+1:])
+				if col.defaultErr == nil {
+					value, col.defaultErr = applyAffinity(value, col.affinity)
+				}
+				col.defaultValue = value
+			}
+		}
+		tbl.columns = append(tbl.columns, col)
+	}
+
+	// INTEGER PRIMARY KEY column is an alias of the rowid (except the 'INTEGER PRIMARY KEY DESC'
+	// column constraint quirk)
+	if len(primaryKey) == 1 && !pkDesc {
+		for i, col := range tbl.columns {
+			if strings.EqualFold(col.name, primaryKey[0]) && strings.EqualFold(col.declType, "INTEGER") {
+				tbl.rowidColumn = i
+			}
+		}
+	}
+	return tbl, nil
+}
+
+// parseDefault evaluates literal value of the DEFAULT clause
+func parseDefault(tokens []token) (interface{}, error) {
+	t := tokens[0]
+	sign := ""
+	if (t.isPunct("-") || t.isPunct("+")) && len(tokens) > 1 && tokens[1].kind == tokenNumber {
+		sign = t.text
+		t = tokens[1]
+	}
+	switch t.kind {
+	case tokenNumber:
+		return parseNumber(sign + t.text)
+	case tokenString, tokenIdent:
+		return text(t.text), nil
+	case tokenBlob:
+		data, err := hex.DecodeString(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blob literal: %w", err)
+		}
+		return blob(data), nil
+	case tokenWord:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			return nil, nil
+		case "TRUE":
+			return int64(1), nil
+		case "FALSE":
+			return int64(0), nil
+		case "CURRENT_TIME", "CURRENT_DATE", "CURRENT_TIMESTAMP":
+			return nil, fmt.Errorf("%w: default value %s", ErrUnsupported, t.text)
+		}
+		return text(t.text), nil
+	}
+	return nil, fmt.Errorf("%w: default value expression", ErrUnsupported)
+}
+
+func parseNumber(s string) (interface{}, error) {
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(strings.TrimLeft(lower, "+-"), "0x") {
+		v, err := strconv.ParseInt(strings.Replace(lower, "0x", "", 1), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: number %s", ErrUnsupported, s)
+		}
+		return v, nil
+	}
+	if !strings.ContainsAny(lower, ".e") {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return v, nil
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: number %s", ErrUnsupported, s)
+	}
+	return v, nil
+}
+
+// applyAffinity converts the value by the column affinity
+func applyAffinity(value interface{}, affinity int) (interface{}, error) {
+	switch affinity {
+	case affinityText:
+		switch v := value.(type) {
+		case int64:
+			return text(strconv.FormatInt(v, 10)), nil
+		case float64:
+			return nil, fmt.Errorf("%w: conversion of real to text", ErrUnsupported)
+		}
+	case affinityNumeric, affinityInteger, affinityReal:
+		if v, ok := value.(text); ok {
+			if n, err := parseNumber(strings.TrimSpace(string(v))); err == nil {
+				value = n
+			}
+		}
+		switch v := value.(type) {
+		case int64:
+			if affinity == affinityReal {
+				return float64(v), nil
+			}
+		case float64:
+			if affinity != affinityReal && v == float64(int64(v)) && v >= -9.2e18 && v <= 9.2e18 {
+				return int64(v), nil
+			}
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,408 @@
+package dbhash
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+var (
+	ErrNotDatabase = errors.New("file is not a SQLite database")
+	ErrCorrupted   = errors.New("database file is corrupted")
+	// ErrUnsupported is returned for valid databases with features which are not supported
+	// by the built-in reader (e.g. UTF-16 encoding, WITHOUT ROWID tables)
+	ErrUnsupported = errors.New("unsupported database")
+)
+
+const (
+	walMagic      = 0x377f0682
+	walHeaderSize = 32
+	walFrameSize  = 24
+
+	pageInteriorTable = 0x05
+	pageLeafTable     = 0x0d
+
+	// limits protecting from infinite loops on corrupted files
+	maxTreeDepth   = 64
+	maxPayloadSize = 1 << 30
+)
+
+// text and blob values of the record (other values are represented by nil, int64 and float64)
+type text []byte
+type blob []byte
+
+// database is a minimal read-only reader of the SQLite database file format, supporting
+// committed content of the WAL file.
+// https://www.sqlite.org/fileformat.html
+type database struct {
+	// ctx cancels reading of the pages
+	ctx      context.Context
+	file     *os.File
+	walFile  *os.File
+	pageSize int
+	usable   int
+	// page number -> offset of the page in the WAL file
+	walPages map[uint32]int64
+}
+
+func openDatabase(path string) (*database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	db := &database{ctx: context.Background(), file: f}
+	header := make([]byte, 100)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		db.Close()
+		return nil, err
+	}
+	if n == len(header) {
+		if string(header[:16]) != "SQLite format 3\x00" {
+			db.Close()
+			return nil, ErrNotDatabase
+		}
+		db.pageSize = int(binary.BigEndian.Uint16(header[16:18]))
+		if db.pageSize == 1 {
+			db.pageSize = 65536
+		}
+	}
+	if err := db.openWAL(path + "-wal"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if !validPageSize(db.pageSize) {
+		db.Close()
+		return nil, ErrNotDatabase
+	}
+	// header of the database can be also in the WAL file
+	page, err := db.page(1)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if string(page[:16]) != "SQLite format 3\x00" {
+		db.Close()
+		return nil, ErrNotDatabase
+	}
+	if page[19] > 2 {
+		db.Close()
+		return nil, fmt.Errorf("%w: file format version %d", ErrUnsupported, page[19])
+	}
+	if enc := binary.BigEndian.Uint32(page[56:60]); enc > 1 {
+		db.Close()
+		return nil, fmt.Errorf("%w: UTF-16 text encoding", ErrUnsupported)
+	}
+	db.usable = db.pageSize - int(page[20])
+	if db.usable < 480 {
+		db.Close()
+		return nil, ErrCorrupted
+	}
+	return db, nil
+}
+
+func validPageSize(size int) bool {
+	return size >= 512 && size <= 65536 && size&(size-1) == 0
+}
+
+func (db *database) Close() error {
+	if db.walFile != nil {
+		db.walFile.Close()
+	}
+	return db.file.Close()
+}
+
+// walChecksum computes cumulative checksum used in the WAL file
+func walChecksum(bigEndian bool, data []byte, s0, s1 uint32) (uint32, uint32) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	for i := 0; i+8 <= len(data); i += 8 {
+		s0 += order.Uint32(data[i:]) + s1
+		s1 += order.Uint32(data[i+4:]) + s0
+	}
+	return s0, s1
+}
+
+// openWAL reads the WAL file and maps pages of committed transactions. Missing or invalid
+// WAL file is ignored, the same way as SQLite does during the recovery.
+func (db *database) openWAL(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		f.Close()
+		return nil
+	}
+	magic := binary.BigEndian.Uint32(header[0:4])
+	pageSize := int(binary.BigEndian.Uint32(header[8:12]))
+	if magic&^1 != walMagic || !validPageSize(pageSize) {
+		f.Close()
+		return nil
+	}
+	bigEndian := magic&1 == 1
+	s0, s1 := walChecksum(bigEndian, header[:24], 0, 0)
+	if s0 != binary.BigEndian.Uint32(header[24:28]) || s1 != binary.BigEndian.Uint32(header[28:32]) {
+		f.Close()
+		return nil
+	}
+
+	pages := make(map[uint32]int64)
+	uncommitted := make(map[uint32]int64)
+	frame := make([]byte, walFrameSize+pageSize)
+	for offset := int64(walHeaderSize); ; offset += int64(len(frame)) {
+		if _, err := f.ReadAt(frame, offset); err != nil {
+			break
+		}
+		// frames from the previous WAL generations have different salt values
+		if string(frame[8:16]) != string(header[16:24]) {
+			break
+		}
+		s0, s1 = walChecksum(bigEndian, frame[:8], s0, s1)
+		s0, s1 = walChecksum(bigEndian, frame[walFrameSize:], s0, s1)
+		if s0 != binary.BigEndian.Uint32(frame[16:20]) || s1 != binary.BigEndian.Uint32(frame[20:24]) {
+			break
+		}
+		uncommitted[binary.BigEndian.Uint32(frame[0:4])] = offset + walFrameSize
+		// commit frame
+		if binary.BigEndian.Uint32(frame[4:8]) != 0 {
+			for pgno, pageOffset := range uncommitted {
+				pages[pgno] = pageOffset
+			}
+			uncommitted = make(map[uint32]int64)
+		}
+	}
+	if len(pages) == 0 {
+		f.Close()
+		return nil
+	}
+	if db.pageSize != 0 && db.pageSize != pageSize {
+		f.Close()
+		return fmt.Errorf("%w: page size of WAL file", ErrUnsupported)
+	}
+	db.pageSize = pageSize
+	db.walFile = f
+	db.walPages = pages
+	return nil
+}
+
+// page reads the database page (numbered from 1)
+func (db *database) page(pgno uint32) ([]byte, error) {
+	if pgno == 0 {
+		return nil, ErrCorrupted
+	}
+	if err := db.ctx.Err(); err != nil {
+		return nil, err
+	}
+	page := make([]byte, db.pageSize)
+	var err error
+	if offset, ok := db.walPages[pgno]; ok {
+		_, err = db.walFile.ReadAt(page, offset)
+	} else {
+		_, err = db.file.ReadAt(page, int64(pgno-1)*int64(db.pageSize))
+	}
+	if errors.Is(err, io.EOF) {
+		return nil, ErrCorrupted
+	}
+	return page, err
+}
+
+// varint decodes variable-length integer, returns 0 length on invalid data
+func varint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	if len(b) < 9 {
+		return 0, 0
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+// scanTable calls fn for every row of the table b-tree in the rowid order
+func (db *database) scanTable(root uint32, fn func(rowid int64, payload []byte) error) error {
+	return db.scanTablePage(root, 0, fn)
+}
+
+func (db *database) scanTablePage(pgno uint32, depth int, fn func(rowid int64, payload []byte) error) error {
+	if depth > maxTreeDepth {
+		return ErrCorrupted
+	}
+	page, err := db.page(pgno)
+	if err != nil {
+		return err
+	}
+	hdr := 0
+	if pgno == 1 {
+		hdr = 100
+	}
+	pageType := page[hdr]
+	cells := int(binary.BigEndian.Uint16(page[hdr+3:]))
+	switch pageType {
+	case pageLeafTable:
+		if hdr+8+2*cells > db.usable {
+			return ErrCorrupted
+		}
+		for i := 0; i < cells; i++ {
+			offset := int(binary.BigEndian.Uint16(page[hdr+8+2*i:]))
+			if offset >= db.usable {
+				return ErrCorrupted
+			}
+			size, n := varint(page[offset:db.usable])
+			if n == 0 {
+				return ErrCorrupted
+			}
+			offset += n
+			rowid, n := varint(page[offset:db.usable])
+			if n == 0 {
+				return ErrCorrupted
+			}
+			offset += n
+			payload, err := db.payload(page, offset, size)
+			if err != nil {
+				return err
+			}
+			if err := fn(int64(rowid), payload); err != nil {
+				return err
+			}
+		}
+	case pageInteriorTable:
+		if hdr+12+2*cells > db.usable {
+			return ErrCorrupted
+		}
+		for i := 0; i < cells; i++ {
+			offset := int(binary.BigEndian.Uint16(page[hdr+12+2*i:]))
+			if offset+4 > db.usable {
+				return ErrCorrupted
+			}
+			if err := db.scanTablePage(binary.BigEndian.Uint32(page[offset:]), depth+1, fn); err != nil {
+				return err
+			}
+		}
+		return db.scanTablePage(binary.BigEndian.Uint32(page[hdr+8:]), depth+1, fn)
+	default:
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// payload reads payload of the table b-tree leaf cell, including the overflow pages
+func (db *database) payload(page []byte, offset int, size uint64) ([]byte, error) {
+	if size > maxPayloadSize {
+		return nil, ErrCorrupted
+	}
+	u := db.usable
+	maxLocal := u - 35
+	minLocal := (u-12)*32/255 - 23
+	if size <= uint64(maxLocal) {
+		if offset+int(size) > u {
+			return nil, ErrCorrupted
+		}
+		return page[offset : offset+int(size)], nil
+	}
+	local := minLocal + int((size-uint64(minLocal))%uint64(u-4))
+	if local > maxLocal {
+		local = minLocal
+	}
+	if offset+local+4 > u {
+		return nil, ErrCorrupted
+	}
+	data := make([]byte, 0, size)
+	data = append(data, page[offset:offset+local]...)
+	next := binary.BigEndian.Uint32(page[offset+local:])
+	for uint64(len(data)) < size {
+		if next == 0 {
+			return nil, ErrCorrupted
+		}
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = binary.BigEndian.Uint32(overflow)
+		n := u - 4
+		if remaining := size - uint64(len(data)); remaining < uint64(n) {
+			n = int(remaining)
+		}
+		data = append(data, overflow[4:4+n]...)
+	}
+	return data, nil
+}
+
+// decodeRecord decodes values of the record
+func decodeRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := varint(payload)
+	if n == 0 || headerSize > uint64(len(payload)) {
+		return nil, ErrCorrupted
+	}
+	var types []uint64
+	for pos := n; pos < int(headerSize); pos += n {
+		var t uint64
+		t, n = varint(payload[pos:headerSize])
+		if n == 0 {
+			return nil, ErrCorrupted
+		}
+		types = append(types, t)
+	}
+	values := make([]interface{}, len(types))
+	body := payload[headerSize:]
+	for i, t := range types {
+		var size int
+		switch {
+		case t == 0, t == 8, t == 9:
+			size = 0
+		case t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6, t == 7:
+			size = 8
+		case t >= 12:
+			size = int((t - 12) / 2)
+		default:
+			return nil, ErrCorrupted
+		}
+		if size > len(body) {
+			return nil, ErrCorrupted
+		}
+		data := body[:size]
+		body = body[size:]
+		switch {
+		case t == 0:
+			values[i] = nil
+		case t == 8:
+			values[i] = int64(0)
+		case t == 9:
+			values[i] = int64(1)
+		case t <= 6:
+			// big-endian signed integer
+			v := int64(int8(data[0]))
+			for _, b := range data[1:] {
+				v = v<<8 | int64(b)
+			}
+			values[i] = v
+		case t == 7:
+			values[i] = math.Float64frombits(binary.BigEndian.Uint64(data))
+		case t%2 == 0:
+			values[i] = blob(data)
+		default:
+			values[i] = text(data)
+		}
+	}
+	return values, nil
+}
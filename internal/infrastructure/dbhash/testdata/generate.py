@@ -0,0 +1,187 @@
+#!/usr/bin/env python3
+"""Generates SQLite test databases and their reference hashes (hashes.json).
+
+Hashes are computed with the sqlite3 library the same way as the dbhash utility
+(https://www.sqlite.org/src/file/tool/dbhash.c). Run from this directory:
+
+    python3 generate.py
+"""
+
+import glob
+import hashlib
+import json
+import os
+import shutil
+import sqlite3
+import struct
+
+
+def dbhash(conn):
+    h = hashlib.sha1()
+
+    def hash_value(v):
+        if v is None:
+            h.update(b"0")
+        elif isinstance(v, int):
+            h.update(b"1" + struct.pack(">q", v))
+        elif isinstance(v, float):
+            h.update(b"2" + struct.pack(">d", v))
+        elif isinstance(v, str):
+            h.update(b"3" + v.encode("utf-8"))
+        else:
+            h.update(b"4" + bytes(v))
+
+    tables = conn.execute(
+        "SELECT name FROM sqlite_schema WHERE type='table' AND sql NOT LIKE 'CREATE VIRTUAL%'"
+        " AND name NOT LIKE 'sqlite_%' ORDER BY name COLLATE nocase"
+    ).fetchall()
+    for (name,) in tables:
+        for row in conn.execute('SELECT * FROM "%s"' % name.replace('"', '""')):
+            for v in row:
+                hash_value(v)
+    for row in conn.execute("SELECT type, name, tbl_name, sql FROM sqlite_schema ORDER BY name COLLATE nocase"):
+        for v in row:
+            hash_value(v)
+    return h.hexdigest()
+
+
+def create(name, page_size=1024, encoding=None):
+    for f in glob.glob(name + "*"):
+        os.remove(f)
+    conn = sqlite3.connect(name, isolation_level=None)
+    conn.execute("PRAGMA page_size=%d" % page_size)
+    if encoding:
+        conn.execute("PRAGMA encoding='%s'" % encoding)
+    return conn
+
+
+def fill_table(conn, rows):
+    conn.execute(
+        "CREATE TABLE features (fid INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, value REAL,"
+        " count INTEGER, data BLOB, note)"
+    )
+    conn.execute("CREATE INDEX features_name ON features (name)")
+    conn.execute("BEGIN")
+    for i in range(rows):
+        conn.execute(
+            "INSERT INTO features (name, value, count, data, note) VALUES (?, ?, ?, ?, ?)",
+            (
+                "feature %d ěščř" % i,
+                i * 1.5 if i % 3 else i,  # integers are stored in the REAL column
+                -i * 1000003 if i % 2 else None,
+                bytes(range(i % 256)),
+                ["text", 7, 0.25, None, b"\x00\x01"][i % 5],
+            ),
+        )
+    conn.execute("COMMIT")
+
+
+hashes = {}
+
+
+def basic():
+    conn = create("basic.sqlite")
+    fill_table(conn, 500)
+    conn.execute('CREATE TABLE "Mixed ""Case"" name" (a, b)')
+    conn.execute('INSERT INTO "Mixed ""Case"" name" VALUES (1, 2), (NULL, \'x\')')
+    conn.execute("CREATE VIEW features_view AS SELECT name FROM features")
+    hashes["basic.sqlite"] = dbhash(conn)
+    conn.close()
+
+
+def overflow():
+    # values larger than the page, stored in the chains of overflow pages
+    conn = create("overflow.sqlite")
+    conn.execute("CREATE TABLE docs (id INTEGER PRIMARY KEY, title TEXT, body TEXT, image BLOB)")
+    for i in range(8):
+        body = ("Lorem ipsum %d " % i) * (50 * (i + 1))
+        image = bytes((i * j) % 256 for j in range(2000 * (i + 1)))
+        conn.execute("INSERT INTO docs (title, body, image) VALUES (?, ?, ?)", ("doc %d" % i, body, image))
+    hashes["overflow.sqlite"] = dbhash(conn)
+    conn.close()
+
+
+def alter_default():
+    # rows created before the columns were added don't contain their values
+    conn = create("alter_default.sqlite")
+    conn.execute("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT)")
+    conn.executemany("INSERT INTO t (name) VALUES (?)", [("row %d" % i,) for i in range(100)])
+    conn.execute("ALTER TABLE t ADD COLUMN a TEXT DEFAULT 'default text'")
+    conn.execute("ALTER TABLE t ADD COLUMN b INTEGER DEFAULT 42")
+    conn.execute("ALTER TABLE t ADD COLUMN c REAL DEFAULT -1.5")
+    conn.execute("ALTER TABLE t ADD COLUMN d REAL DEFAULT 3")
+    conn.execute("ALTER TABLE t ADD COLUMN e BLOB DEFAULT X'00FF10'")
+    conn.execute("ALTER TABLE t ADD COLUMN f DEFAULT NULL")
+    conn.execute("ALTER TABLE t ADD COLUMN g INTEGER DEFAULT -7")
+    conn.execute("ALTER TABLE t ADD COLUMN h TEXT DEFAULT 12")
+    conn.execute("ALTER TABLE t ADD COLUMN i")
+    conn.executemany("INSERT INTO t (name, a, b) VALUES (?, ?, ?)", [("new %d" % i, "x", i) for i in range(10)])
+    hashes["alter_default.sqlite"] = dbhash(conn)
+    conn.close()
+
+
+def vacuum():
+    # the same content with different pages layout
+    conn = create("vacuum_before.sqlite")
+    fill_table(conn, 800)
+    conn.execute("DELETE FROM features WHERE fid % 3 = 0")
+    conn.execute("UPDATE features SET note = 'updated' WHERE fid % 5 = 0")
+    hashes["vacuum_before.sqlite"] = dbhash(conn)
+    conn.close()
+    shutil.copy("vacuum_before.sqlite", "vacuum_after.sqlite")
+    conn = sqlite3.connect("vacuum_after.sqlite", isolation_level=None)
+    conn.execute("VACUUM")
+    hashes["vacuum_after.sqlite"] = dbhash(conn)
+    conn.close()
+
+
+def wal():
+    # committed transactions are only in the WAL file, last transaction is not committed
+    conn = create("wal.sqlite")
+    conn.execute("PRAGMA journal_mode=WAL")
+    fill_table(conn, 100)
+    conn.execute("PRAGMA wal_checkpoint(TRUNCATE)")
+    conn.execute("PRAGMA wal_autocheckpoint=0")
+    conn.execute("UPDATE features SET name = 'changed' WHERE fid % 2 = 0")
+    conn.execute("CREATE TABLE added (x)")
+    conn.execute("INSERT INTO added VALUES ('in wal')")
+    hashes["wal.sqlite"] = dbhash(conn)
+    conn.execute("BEGIN")
+    conn.execute("DELETE FROM features")
+    # spill the uncommitted changes into the WAL file
+    conn.execute("PRAGMA cache_size=1")
+    conn.execute("INSERT INTO added VALUES (randomblob(20000))")
+    # files are copied while the connection is open, the WAL file is checkpointed and removed
+    # when it's closed
+    shutil.copy("wal.sqlite", "wal.sqlite.tmp")
+    shutil.copy("wal.sqlite-wal", "wal.sqlite.tmp-wal")
+    conn.execute("ROLLBACK")
+    conn.close()
+    os.rename("wal.sqlite.tmp", "wal.sqlite")
+    os.rename("wal.sqlite.tmp-wal", "wal.sqlite-wal")
+
+
+def unsupported():
+    conn = create("without_rowid.sqlite")
+    conn.execute("CREATE TABLE t (key TEXT PRIMARY KEY, value) WITHOUT ROWID")
+    conn.execute("INSERT INTO t VALUES ('a', 1), ('b', 2)")
+    hashes["without_rowid.sqlite"] = None
+    conn.close()
+
+    conn = create("utf16.sqlite", encoding="UTF-16le")
+    conn.execute("CREATE TABLE t (name TEXT)")
+    conn.execute("INSERT INTO t VALUES ('žluťoučký kůň')")
+    hashes["utf16.sqlite"] = None
+    conn.close()
+
+
+if __name__ == "__main__":
+    basic()
+    overflow()
+    alter_default()
+    vacuum()
+    wal()
+    unsupported()
+    with open("hashes.json", "w") as f:
+        json.dump(hashes, f, indent=2, sort_keys=True)
+        f.write("\n")
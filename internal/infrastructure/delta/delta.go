@@ -0,0 +1,315 @@
+// Package delta implements rsync-style block deltas. The receiver computes signature of its
+// version of the file (checksums of fixed-size blocks), the sender finds matching blocks in the
+// new version of the file using rolling checksum, and sends only references to matching blocks
+// and literal data of the changed parts.
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	DefaultBlockSize = 64 * 1024
+	MinBlockSize     = 512
+	MaxBlockSize     = 16 * 1024 * 1024
+)
+
+var (
+	ErrInvalidDelta = errors.New("invalid delta data")
+)
+
+// Delta stream format (big-endian):
+//
+//	"GQD1"                         header
+//	'C' uint64 index, uint32 count  copy count blocks of the base file starting at block index
+//	'L' uint32 length, data         literal data
+//	'E'                            end of delta
+var magic = []byte("GQD1")
+
+const (
+	opCopy    = 'C'
+	opLiteral = 'L'
+	opEnd     = 'E'
+)
+
+// max size of the literal data in a single operation
+const maxLiteral = 1024 * 1024
+
+type Block struct {
+	Weak   uint32 `json:"weak"`
+	Strong string `json:"strong"`
+}
+
+type Signature struct {
+	Size      int64   `json:"size"`
+	BlockSize int     `json:"block_size"`
+	Blocks    []Block `json:"blocks"`
+}
+
+// weakSum is the rolling checksum used by rsync
+func weakSum(data []byte) (a, b uint32) {
+	l := uint32(len(data))
+	for i, c := range data {
+		a += uint32(c)
+		b += (l - uint32(i)) * uint32(c)
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+func strongSum(data []byte) string {
+	h := md5.Sum(data)
+	return hex.EncodeToString(h[:])
+}
+
+// NewSignature computes signature of the data
+func NewSignature(r io.Reader, blockSize int) (Signature, error) {
+	if blockSize < MinBlockSize || blockSize > MaxBlockSize {
+		return Signature{}, fmt.Errorf("invalid block size: %d", blockSize)
+	}
+	sig := Signature{BlockSize: blockSize}
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			a, b := weakSum(buf[:n])
+			sig.Blocks = append(sig.Blocks, Block{Weak: a | b<<16, Strong: strongSum(buf[:n])})
+			sig.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return sig, err
+		}
+	}
+}
+
+type encoder struct {
+	w       *bufio.Writer
+	literal []byte
+	// pending copy operation
+	copyIndex, copyCount uint64
+}
+
+func (e *encoder) flushCopy() error {
+	if e.copyCount == 0 {
+		return nil
+	}
+	var op [13]byte
+	op[0] = opCopy
+	binary.BigEndian.PutUint64(op[1:9], e.copyIndex)
+	binary.BigEndian.PutUint32(op[9:13], uint32(e.copyCount))
+	e.copyCount = 0
+	_, err := e.w.Write(op[:])
+	return err
+}
+
+func (e *encoder) flushLiteral() error {
+	if len(e.literal) == 0 {
+		return nil
+	}
+	var op [5]byte
+	op[0] = opLiteral
+	binary.BigEndian.PutUint32(op[1:5], uint32(len(e.literal)))
+	if _, err := e.w.Write(op[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.literal)
+	e.literal = e.literal[:0]
+	return err
+}
+
+func (e *encoder) copyBlock(index int) error {
+	if err := e.flushLiteral(); err != nil {
+		return err
+	}
+	if e.copyCount > 0 && e.copyIndex+e.copyCount == uint64(index) && e.copyCount < 1<<31 {
+		e.copyCount++
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.copyIndex, e.copyCount = uint64(index), 1
+	return nil
+}
+
+func (e *encoder) addLiteral(data ...byte) error {
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.literal = append(e.literal, data...)
+	if len(e.literal) >= maxLiteral {
+		return e.flushLiteral()
+	}
+	return nil
+}
+
+// WriteDelta computes delta of the new data against the signature of the base data
+// (new data are read into memory)
+func WriteDelta(sig Signature, r io.Reader, w io.Writer) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	blocks := make(map[uint32][]int, len(sig.Blocks))
+	for i, b := range sig.Blocks {
+		blocks[b.Weak] = append(blocks[b.Weak], i)
+	}
+	// size of the last (shorter) block of the base data
+	lastSize := int(sig.Size - int64(sig.BlockSize)*int64(len(sig.Blocks)-1))
+
+	e := &encoder{w: bufio.NewWriter(w)}
+	if _, err := e.w.Write(magic); err != nil {
+		return err
+	}
+	match := func(pos, size int, weak uint32) int {
+		var strong string
+		for _, i := range blocks[weak] {
+			if (i == len(sig.Blocks)-1 && size != lastSize) || (i < len(sig.Blocks)-1 && size != sig.BlockSize) {
+				continue
+			}
+			if strong == "" {
+				strong = strongSum(data[pos : pos+size])
+			}
+			if sig.Blocks[i].Strong == strong {
+				return i
+			}
+		}
+		return -1
+	}
+
+	bs := sig.BlockSize
+	pos := 0
+	var a, b uint32
+	rolling := false
+	for pos < len(data) {
+		size := bs
+		if pos+size > len(data) {
+			size = len(data) - pos
+		}
+		// shorter window at the end of data can match only the last block
+		candidate := size == bs || size == lastSize
+		if size == bs && !rolling {
+			a, b = weakSum(data[pos : pos+size])
+			rolling = true
+		} else if size < bs {
+			rolling = false
+			if candidate {
+				a, b = weakSum(data[pos : pos+size])
+			}
+		}
+		if candidate && len(sig.Blocks) > 0 {
+			if i := match(pos, size, a|b<<16); i != -1 {
+				if err := e.copyBlock(i); err != nil {
+					return err
+				}
+				pos += size
+				rolling = false
+				continue
+			}
+		}
+		if err := e.addLiteral(data[pos]); err != nil {
+			return err
+		}
+		// roll the checksum by one byte
+		if rolling && pos+bs < len(data) {
+			out, in := uint32(data[pos]), uint32(data[pos+bs])
+			a = (a - out + in) & 0xffff
+			b = (b - uint32(bs)*out + a) & 0xffff
+		} else {
+			rolling = false
+		}
+		pos++
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	if err := e.flushLiteral(); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(opEnd); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// Apply reconstructs new data of the expected size from the base data and the delta. Reconstruction
+// is aborted as soon as the output would exceed the expected size.
+func Apply(base io.ReaderAt, baseSize int64, blockSize int, delta io.Reader, w io.Writer, size int64) error {
+	if blockSize < MinBlockSize || blockSize > MaxBlockSize {
+		return fmt.Errorf("invalid block size: %d", blockSize)
+	}
+	var written int64
+	reserve := func(length int64) error {
+		if written+length > size {
+			return fmt.Errorf("%w: output exceeds expected size", ErrInvalidDelta)
+		}
+		written += length
+		return nil
+	}
+	r := bufio.NewReader(delta)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, magic) {
+		return ErrInvalidDelta
+	}
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDelta, err)
+		}
+		switch op {
+		case opCopy:
+			var args [12]byte
+			if _, err := io.ReadFull(r, args[:]); err != nil {
+				return ErrInvalidDelta
+			}
+			index := binary.BigEndian.Uint64(args[0:8])
+			count := uint64(binary.BigEndian.Uint32(args[8:12]))
+			offset := int64(index) * int64(blockSize)
+			length := int64(count) * int64(blockSize)
+			blocksCount := (baseSize + int64(blockSize) - 1) / int64(blockSize)
+			if index >= uint64(blocksCount) {
+				return fmt.Errorf("%w: block out of range", ErrInvalidDelta)
+			}
+			if offset+length > baseSize {
+				length = baseSize - offset
+			}
+			if err := reserve(length); err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, io.NewSectionReader(base, offset, length)); err != nil {
+				return err
+			}
+		case opLiteral:
+			var args [4]byte
+			if _, err := io.ReadFull(r, args[:]); err != nil {
+				return ErrInvalidDelta
+			}
+			length := int64(binary.BigEndian.Uint32(args[:]))
+			if err := reserve(length); err != nil {
+				return err
+			}
+			if n, err := io.CopyN(w, r, length); err != nil {
+				if n < length {
+					return fmt.Errorf("%w: incomplete literal data", ErrInvalidDelta)
+				}
+				return err
+			}
+		case opEnd:
+			if written != size {
+				return fmt.Errorf("%w: output doesn't match expected size", ErrInvalidDelta)
+			}
+			return nil
+		default:
+			return fmt.Errorf("%w: unknown operation", ErrInvalidDelta)
+		}
+	}
+}
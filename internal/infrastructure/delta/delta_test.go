@@ -0,0 +1,171 @@
+package delta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func randomData(r *rand.Rand, size int) []byte {
+	data := make([]byte, size)
+	r.Read(data)
+	return data
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// roundTrip computes delta of the new data against the base data and reconstructs the new data,
+// returns reconstructed data and size of the delta
+func roundTrip(t *testing.T, base, data []byte, blockSize int) ([]byte, int) {
+	t.Helper()
+	sig, err := NewSignature(bytes.NewReader(base), blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Size != int64(len(base)) || len(sig.Blocks) != (len(base)+blockSize-1)/blockSize {
+		t.Fatalf("invalid signature: size %d, %d blocks", sig.Size, len(sig.Blocks))
+	}
+	var delta bytes.Buffer
+	if err := WriteDelta(sig, bytes.NewReader(data), &delta); err != nil {
+		t.Fatal(err)
+	}
+	deltaSize := delta.Len()
+	var out bytes.Buffer
+	if err := Apply(bytes.NewReader(base), int64(len(base)), blockSize, &delta, &out, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes(), deltaSize
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const bs = MinBlockSize
+	base := randomData(r, 10*bs+100)
+	tests := []struct {
+		name string
+		base []byte
+		data []byte
+		// max size of the delta, 0 for no check
+		maxDelta int
+	}{
+		{"identical", base, base, 100},
+		{"appended", base, concat(base, []byte("appended data")), 200}, // shorter last block is sent as literal
+		{"prepended", base, concat([]byte("prepended"), base), 100},
+		{"inserted", base, concat(base[:3*bs+10], randomData(r, 50), base[3*bs+10:]), 2 * bs},
+		{"removed", base, concat(base[:2*bs], base[5*bs:]), 100},
+		{"modified last block", base, concat(base[:10*bs], []byte("end")), 100},
+		{"reordered blocks", base, concat(base[5*bs:], base[:5*bs]), 200},
+		{"truncated", base, base[:4*bs+10], bs},
+		{"empty base", []byte{}, randomData(r, 3*bs), 0},
+		{"empty data", base, []byte{}, 10},
+		{"different data", base, randomData(r, 2*bs), 0},
+		{"repeated block", base[:bs], bytes.Repeat(base[:bs], 5), 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, deltaSize := roundTrip(t, tt.base, tt.data, bs)
+			if !bytes.Equal(out, tt.data) {
+				t.Fatalf("reconstructed data doesn't match (%d bytes, expected %d)", len(out), len(tt.data))
+			}
+			if tt.maxDelta > 0 && deltaSize > tt.maxDelta {
+				t.Errorf("delta size %d exceeds %d bytes", deltaSize, tt.maxDelta)
+			}
+		})
+	}
+}
+
+func TestInvalidBlockSize(t *testing.T) {
+	for _, size := range []int{0, MinBlockSize - 1, MaxBlockSize + 1} {
+		if _, err := NewSignature(bytes.NewReader([]byte("data")), size); err == nil {
+			t.Errorf("signature with block size %d: expected error", size)
+		}
+		var out bytes.Buffer
+		if err := Apply(bytes.NewReader(nil), 0, size, bytes.NewReader(magic), &out, 0); err == nil {
+			t.Errorf("apply with block size %d: expected error", size)
+		}
+	}
+}
+
+// deltaBuilder writes raw delta operations
+type deltaBuilder struct {
+	bytes.Buffer
+}
+
+func (b *deltaBuilder) copyOp(index uint64, count uint32) *deltaBuilder {
+	b.WriteByte(opCopy)
+	binary.Write(b, binary.BigEndian, index)
+	binary.Write(b, binary.BigEndian, count)
+	return b
+}
+
+func (b *deltaBuilder) literalOp(length uint32, data []byte) *deltaBuilder {
+	b.WriteByte(opLiteral)
+	binary.Write(b, binary.BigEndian, length)
+	b.Write(data)
+	return b
+}
+
+func (b *deltaBuilder) raw(data ...byte) *deltaBuilder {
+	b.Write(data)
+	return b
+}
+
+func newDelta() *deltaBuilder {
+	b := &deltaBuilder{}
+	b.Write(magic)
+	return b
+}
+
+func TestApplyMalformedDelta(t *testing.T) {
+	const bs = MinBlockSize
+	base := bytes.Repeat([]byte("0123456789abcdef"), 2*bs/16+2) // 2 full blocks and shorter last block
+	tests := []struct {
+		name  string
+		delta []byte
+		size  int64
+	}{
+		{"empty", nil, 0},
+		{"invalid header", []byte("GQD2E"), 0},
+		{"missing end", newDelta().literalOp(3, []byte("abc")).Bytes(), 3},
+		{"unknown operation", newDelta().raw('X').Bytes(), 0},
+		{"truncated copy", newDelta().raw(opCopy, 0, 0, 0).Bytes(), bs},
+		{"block out of range", newDelta().copyOp(3, 1).raw(opEnd).Bytes(), bs},
+		{"huge block index", newDelta().copyOp(1<<62, 1).raw(opEnd).Bytes(), bs},
+		{"copy exceeds size", newDelta().copyOp(0, 2).raw(opEnd).Bytes(), bs},
+		{"truncated literal header", newDelta().raw(opLiteral, 0).Bytes(), 3},
+		{"incomplete literal", newDelta().literalOp(10, []byte("abc")).Bytes(), 10},
+		{"literal exceeds size", newDelta().literalOp(4, []byte("abcd")).raw(opEnd).Bytes(), 3},
+		{"huge literal", newDelta().literalOp(1<<31, []byte("abcd")).raw(opEnd).Bytes(), 4},
+		{"output smaller than size", newDelta().literalOp(3, []byte("abc")).raw(opEnd).Bytes(), 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Apply(bytes.NewReader(base), int64(len(base)), bs, bytes.NewReader(tt.delta), &out, tt.size)
+			if !errors.Is(err, ErrInvalidDelta) {
+				t.Fatalf("expected ErrInvalidDelta, got %v", err)
+			}
+			if int64(out.Len()) > tt.size {
+				t.Errorf("written %d bytes, more than expected size %d", out.Len(), tt.size)
+			}
+		})
+	}
+}
+
+func TestApplyLastBlock(t *testing.T) {
+	const bs = MinBlockSize
+	base := bytes.Repeat([]byte("x"), 2*bs+10)
+	// copy of the last (shorter) block
+	delta := newDelta().copyOp(2, 1).literalOp(2, []byte("ab")).raw(opEnd).Bytes()
+	var out bytes.Buffer
+	if err := Apply(bytes.NewReader(base), int64(len(base)), bs, bytes.NewReader(delta), &out, 12); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "xxxxxxxxxxab" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
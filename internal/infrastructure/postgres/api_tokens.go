@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+const tokenColumns = "id, username, name, scopes, created_at, expires_at, last_used_at"
+
+type APITokens struct {
+	db *sqlx.DB
+}
+
+func NewAPITokens(db *sqlx.DB) *APITokens {
+	return &APITokens{db}
+}
+
+func toAPIToken(t APIToken) domain.APIToken {
+	var scopes domain.StringArray
+	if t.Scopes != "" {
+		scopes = strings.Split(t.Scopes, ",")
+	}
+	return domain.APIToken{
+		ID:       t.ID,
+		Username: t.Username,
+		Name:     t.Name,
+		Scopes:   scopes,
+		Created:  t.Created,
+		Expires:  t.Expires,
+		LastUsed: t.LastUsed,
+	}
+}
+
+func (r *APITokens) Create(token domain.APIToken, hash string) error {
+	const q = `
+	INSERT INTO api_tokens (id, username, name, token_hash, scopes, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.Exec(q, token.ID, token.Username, token.Name, hash, strings.Join(token.Scopes, ","), token.Created, token.Expires)
+	return err
+}
+
+func (r *APITokens) GetByHash(hash string) (domain.APIToken, error) {
+	var token APIToken
+	err := r.db.Get(&token, "SELECT "+tokenColumns+" FROM api_tokens WHERE token_hash=$1", hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.APIToken{}, domain.ErrTokenNotExists
+		}
+		return domain.APIToken{}, err
+	}
+	return toAPIToken(token), nil
+}
+
+func (r *APITokens) List(username string) ([]domain.APIToken, error) {
+	var rows []APIToken
+	err := r.db.Select(&rows, "SELECT "+tokenColumns+" FROM api_tokens WHERE username=$1 ORDER BY created_at", username)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]domain.APIToken, len(rows))
+	for i, t := range rows {
+		tokens[i] = toAPIToken(t)
+	}
+	return tokens, nil
+}
+
+func (r *APITokens) Delete(username, id string) error {
+	res, err := r.db.Exec("DELETE FROM api_tokens WHERE username=$1 AND id=$2", username, id)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return domain.ErrTokenNotExists
+	}
+	return nil
+}
+
+func (r *APITokens) UpdateLastUsed(id string, t time.Time) error {
+	_, err := r.db.Exec("UPDATE api_tokens SET last_used_at=$2 WHERE id=$1", id, t)
+	return err
+}
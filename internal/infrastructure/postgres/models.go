@@ -14,3 +14,29 @@ type User struct {
 	Confirmed   *time.Time `db:"confirmed_at"`
 	LastLogin   *time.Time `db:"last_login_at"`
 }
+
+type Project struct {
+	Name           string     `db:"name"`
+	Username       string     `db:"username"`
+	Title          string     `db:"title"`
+	QgisFile       string     `db:"qgis_file"`
+	Projection     string     `db:"projection"`
+	Authentication string     `db:"authentication"`
+	State          string     `db:"state"`
+	Size           int64      `db:"size"`
+	Thumbnail      bool       `db:"thumbnail"`
+	Mapcache       bool       `db:"mapcache"`
+	Template       bool       `db:"template"`
+	Created        *time.Time `db:"created_at"`
+	LastUpdate     *time.Time `db:"last_update"`
+}
+
+type APIToken struct {
+	ID       string     `db:"id"`
+	Username string     `db:"username"`
+	Name     string     `db:"name"`
+	Scopes   string     `db:"scopes"`
+	Created  time.Time  `db:"created_at"`
+	Expires  *time.Time `db:"expires_at"`
+	LastUsed *time.Time `db:"last_used_at"`
+}
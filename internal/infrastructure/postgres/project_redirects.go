@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type ProjectRedirects struct {
+	db *sqlx.DB
+}
+
+func NewProjectRedirects(db *sqlx.DB) *ProjectRedirects {
+	return &ProjectRedirects{db}
+}
+
+// Add creates redirect from the old name, existing redirects to the old name are updated
+// to the new name
+func (r *ProjectRedirects) Add(oldName, newName string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE project_redirects SET new_name=$2 WHERE new_name=$1", oldName, newName); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM project_redirects WHERE old_name=$1", newName); err != nil {
+		return err
+	}
+	const q = `
+	INSERT INTO project_redirects (old_name, new_name) VALUES ($1, $2)
+	ON CONFLICT (old_name) DO UPDATE SET new_name = EXCLUDED.new_name, created_at = now()
+	`
+	if _, err := tx.Exec(q, oldName, newName); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *ProjectRedirects) Get(oldName string) (string, error) {
+	var name string
+	err := r.db.Get(&name, "SELECT new_name FROM project_redirects WHERE old_name=$1", oldName)
+	if err == sql.ErrNoRows {
+		return "", domain.ErrProjectNotExists
+	}
+	return name, err
+}
+
+func (r *ProjectRedirects) Delete(name string) error {
+	_, err := r.db.Exec("DELETE FROM project_redirects WHERE old_name=$1 OR new_name=$1", name)
+	return err
+}
@@ -0,0 +1,277 @@
+package postgres
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type ProjectsIndex struct {
+	db *sqlx.DB
+}
+
+func NewProjectsIndex(db *sqlx.DB) *ProjectsIndex {
+	return &ProjectsIndex{db}
+}
+
+func (r *ProjectsIndex) Save(info domain.ProjectInfo, users []string) error {
+	project := toProject(info)
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	const q = `
+	INSERT INTO projects (name, username, title, qgis_file, projection, authentication, state, size, thumbnail, mapcache, template, created_at, last_update)
+	VALUES (:name, :username, :title, :qgis_file, :projection, :authentication, :state, :size, :thumbnail, :mapcache, :template, :created_at, :last_update)
+	ON CONFLICT (name) DO UPDATE SET
+			"title" = EXCLUDED.title,
+			"qgis_file" = EXCLUDED.qgis_file,
+			"projection" = EXCLUDED.projection,
+			"authentication" = EXCLUDED.authentication,
+			"state" = EXCLUDED.state,
+			"size" = EXCLUDED.size,
+			"thumbnail" = EXCLUDED.thumbnail,
+			"mapcache" = EXCLUDED.mapcache,
+			"template" = EXCLUDED.template,
+			"created_at" = EXCLUDED.created_at,
+			"last_update" = EXCLUDED.last_update
+	`
+	if _, err := tx.NamedExec(q, &project); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM project_users WHERE project=$1", info.Name); err != nil {
+		return err
+	}
+	for _, username := range users {
+		_, err := tx.Exec("INSERT INTO project_users (project, username) VALUES ($1, $2) ON CONFLICT DO NOTHING", info.Name, username)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *ProjectsIndex) Delete(name string) error {
+	_, err := r.db.Exec("DELETE FROM projects WHERE name=$1", name)
+	return err
+}
+
+func (r *ProjectsIndex) Names() ([]string, error) {
+	var names []string
+	err := r.db.Select(&names, "SELECT name FROM projects")
+	return names, err
+}
+
+// columns of the Project model
+const projectColumns = "p.name, p.username, p.title, p.qgis_file, p.projection, p.authentication, p.state, p.size, p.thumbnail, p.mapcache, p.template, p.created_at, p.last_update"
+
+var sortColumns = map[string]string{
+	domain.SortByName:       "p.name",
+	domain.SortByTitle:      "lower(p.title)",
+	domain.SortByLastUpdate: "p.last_update",
+	domain.SortBySize:       "p.size",
+}
+
+// queryBuilder collects SQL conditions with positional arguments
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *queryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// list selects page of projects matching the condition and the query filters
+func (r *ProjectsIndex) list(b *queryBuilder, query domain.ProjectsQuery) ([]domain.ProjectInfo, int, error) {
+	if len(query.State) > 0 {
+		b.where("p.state = ANY(" + b.arg(query.State) + ")")
+	}
+	if len(query.Authentication) > 0 {
+		b.where("p.authentication = ANY(" + b.arg(query.Authentication) + ")")
+	}
+	if len(query.Projection) > 0 {
+		b.where("p.projection = ANY(" + b.arg(query.Projection) + ")")
+	}
+	if query.Template {
+		b.where("p.template")
+	}
+	if query.Search != "" {
+		b.where("p.title ILIKE " + b.arg("%"+escapeLike(query.Search)+"%"))
+	}
+	field, desc := query.SortField()
+	column, ok := sortColumns[field]
+	if !ok {
+		return nil, 0, domain.ErrInvalidProjectsQuery
+	}
+	order := "ASC"
+	if desc {
+		order = "DESC"
+	}
+	where := ""
+	if len(b.conditions) > 0 {
+		where = " WHERE (" + strings.Join(b.conditions, ") AND (") + ")"
+	}
+	filterArgs := b.args
+	q := "SELECT " + projectColumns + ", count(*) OVER() AS total FROM projects p" + where
+	q += fmt.Sprintf(" ORDER BY %s %s NULLS LAST, p.name %s", column, order, order)
+	if query.Limit > 0 {
+		q += " LIMIT " + b.arg(query.Limit)
+	}
+	if query.Offset > 0 {
+		q += " OFFSET " + b.arg(query.Offset)
+	}
+
+	var dbProjects []struct {
+		Project
+		Total int `db:"total"`
+	}
+	if err := r.db.Select(&dbProjects, q, b.args...); err != nil {
+		return nil, 0, err
+	}
+	projects := make([]domain.ProjectInfo, len(dbProjects))
+	for i, p := range dbProjects {
+		projects[i] = toProjectInfo(p.Project)
+	}
+	total := 0
+	if len(dbProjects) > 0 {
+		total = dbProjects[0].Total
+	} else if query.Offset > 0 {
+		// page is out of range, total count must be queried separately
+		if err := r.db.Get(&total, "SELECT count(*) FROM projects p"+where, filterArgs...); err != nil {
+			return nil, 0, err
+		}
+	}
+	return projects, total, nil
+}
+
+func (r *ProjectsIndex) UserProjects(username string, query domain.ProjectsQuery) ([]domain.ProjectInfo, int, error) {
+	b := &queryBuilder{}
+	b.where("p.username = " + b.arg(username))
+	return r.list(b, query)
+}
+
+func (r *ProjectsIndex) AccessibleProjects(username string, query domain.ProjectsQuery) ([]domain.ProjectInfo, int, error) {
+	b := &queryBuilder{}
+	b.where(`p.authentication IN ('public', 'authenticated') OR (p.authentication = 'users' AND EXISTS (
+		SELECT 1 FROM project_users u WHERE u.project = p.name AND u.username = ` + b.arg(username) + `
+	))`)
+	return r.list(b, query)
+}
+
+func (r *ProjectsIndex) SaveCatalog(name string, doc domain.CatalogDocument) error {
+	_, err := r.db.Exec(
+		"UPDATE projects SET catalog_layers=$2, catalog_text=$3 WHERE name=$1",
+		name, strings.Join(doc.Layers, "\n"), strings.Join(doc.Text, "\n"),
+	)
+	return err
+}
+
+// SearchCatalog performs full-text search with the same access rules as ProjectAccessMiddleware
+func (r *ProjectsIndex) SearchCatalog(user domain.User, text string, limit, offset int) ([]domain.CatalogResult, int, error) {
+	q := `
+	SELECT
+			` + projectColumns + `,
+			ts_rank_cd(p.search_vector, query) AS rank,
+			count(*) OVER() AS total
+	FROM
+			projects p,
+			websearch_to_tsquery('simple', $1) query
+	WHERE
+			p.search_vector @@ query
+			AND (
+				p.authentication = 'public'
+				OR ($2 AND (p.authentication = 'authenticated' OR $3 OR p.username = $4))
+				OR ($2 AND p.authentication = 'users' AND EXISTS (
+					SELECT 1 FROM project_users u WHERE u.project = p.name AND u.username = $4
+				))
+			)
+	ORDER BY
+			rank DESC, p.name
+	LIMIT $5 OFFSET $6
+	`
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	var rows []struct {
+		Project
+		Rank  float64 `db:"rank"`
+		Total int     `db:"total"`
+	}
+	err := r.db.Select(&rows, q, text, user.IsAuthenticated, user.IsSuperuser, user.Username, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	results := make([]domain.CatalogResult, len(rows))
+	for i, row := range rows {
+		results[i] = domain.CatalogResult{ProjectInfo: toProjectInfo(row.Project), Rank: row.Rank}
+	}
+	total := 0
+	if len(rows) > 0 {
+		total = rows[0].Total
+	}
+	return results, total, nil
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+func toProject(info domain.ProjectInfo) Project {
+	return Project{
+		Name:           info.Name,
+		Username:       strings.Split(info.Name, "/")[0],
+		Title:          info.Title,
+		QgisFile:       info.QgisFile,
+		Projection:     info.Projection,
+		Authentication: info.Authentication,
+		State:          info.State,
+		Size:           info.Size,
+		Thumbnail:      info.Thumbnail,
+		Mapcache:       info.Mapcache,
+		Template:       info.Template,
+		Created:        timePtr(info.Created),
+		LastUpdate:     timePtr(info.LastUpdate),
+	}
+}
+
+func toProjectInfo(p Project) domain.ProjectInfo {
+	return domain.ProjectInfo{
+		Name:           p.Name,
+		Title:          p.Title,
+		QgisFile:       p.QgisFile,
+		Projection:     p.Projection,
+		Authentication: p.Authentication,
+		State:          p.State,
+		Size:           p.Size,
+		Thumbnail:      p.Thumbnail,
+		Mapcache:       p.Mapcache,
+		Template:       p.Template,
+		Created:        timeValue(p.Created),
+		LastUpdate:     timeValue(p.LastUpdate),
+	}
+}
@@ -0,0 +1,216 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Files which can be modified in place by the map server (WFS-T), they must not be shared
+// between projects
+const DefaultDedupExclude = `(?i)\.(gpkg|sqlite|db|shp|shx|dbf|prj|cpg|qix|sbn|sbx|csv|geojson|kml|gml)$`
+
+// blobStore is a content-addressed store of project files (<ProjectsRoot>/.blobs/<hash[:2]>/<hash>).
+// Project files are hard links to the blobs, so identical files are stored only once and the number
+// of links of the blob's inode serves as the reference count. Linked files must never be modified
+// in place, all writers replace project files by rename (see writeFile). Files replaced outside
+// of the server must be replaced in the same way (e.g. cp --remove-destination).
+type blobStore struct {
+	log     *zap.SugaredLogger
+	root    string
+	exclude *regexp.Regexp
+	mu      sync.Mutex
+}
+
+// EnableDeduplication enables storing of identical project files only once. Files matching
+// the exclude pattern are always stored separately.
+func (s *DiskStorage) EnableDeduplication(exclude string) error {
+	b := &blobStore{log: s.log, root: filepath.Join(s.ProjectsRoot, ".blobs")}
+	if exclude != "" {
+		re, err := regexp.Compile(exclude)
+		if err != nil {
+			return fmt.Errorf("invalid deduplication exclude pattern: %w", err)
+		}
+		b.exclude = re
+	}
+	if err := os.MkdirAll(b.root, 0775); err != nil {
+		return err
+	}
+	s.blobs = b
+	return nil
+}
+
+func (b *blobStore) path(hash string) string {
+	return filepath.Join(b.root, hash[:2], hash)
+}
+
+// dedupable checks whether the file can be stored in the blob store (content hash must be SHA-1)
+func (b *blobStore) dedupable(path string, info domain.FileInfo) bool {
+	if len(info.Hash) != 40 || info.Size == 0 {
+		return false
+	}
+	return b.exclude == nil || !b.exclude.MatchString(path)
+}
+
+// place moves the new file into the project (to the destPath), file is replaced by the link
+// to already stored blob with the same content. Linked files share the modification time, so
+// the file is stored separately when the blob's modification time is different.
+func (b *blobStore) place(srcPath, destPath string, info domain.FileInfo) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	blobPath := b.path(info.Hash)
+	if bStat, err := os.Stat(blobPath); err == nil && bStat.Size() == info.Size {
+		if bStat.ModTime().Unix() != info.Mtime {
+			return os.Rename(srcPath, destPath)
+		}
+		tmpPath := destPath + ".link"
+		os.Remove(tmpPath)
+		if err := os.Link(blobPath, tmpPath); err != nil {
+			return fmt.Errorf("linking blob: %w", err)
+		}
+		if err := os.Rename(tmpPath, destPath); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		return os.Remove(srcPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0775); err != nil {
+		return err
+	}
+	os.Remove(blobPath)
+	if err := os.Link(srcPath, blobPath); err != nil {
+		b.log.Errorw("storing blob", "hash", info.Hash, zap.Error(err))
+	}
+	return os.Rename(srcPath, destPath)
+}
+
+// release removes blobs which are not referenced by any project file
+func (b *blobStore) release(hashes ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, hash := range hashes {
+		if len(hash) != 40 {
+			continue
+		}
+		blobPath := b.path(hash)
+		bStat, err := os.Stat(blobPath)
+		if err != nil {
+			continue
+		}
+		if linksCount(bStat) == 1 {
+			if err := os.Remove(blobPath); err != nil {
+				b.log.Errorw("removing blob", "hash", hash, zap.Error(err))
+			}
+		}
+	}
+}
+
+// CollectGarbage removes all unreferenced blobs, returns number of removed blobs and their size
+func (b *blobStore) CollectGarbage() (int, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count, size := 0, int64(0)
+	err := filepath.WalkDir(b.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if linksCount(info) == 1 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			count++
+			size += info.Size()
+		}
+		return nil
+	})
+	return count, size, err
+}
+
+// releaseFiles releases blobs of removed or replaced project files
+func (s *DiskStorage) releaseFiles(files ...domain.FileInfo) {
+	if s.blobs == nil || len(files) == 0 {
+		return
+	}
+	hashes := make([]string, len(files))
+	for i, f := range files {
+		hashes[i] = f.Hash
+	}
+	s.blobs.release(hashes...)
+}
+
+// placeFile moves the new file into the project, identical files are deduplicated when enabled
+func (s *DiskStorage) placeFile(srcPath, destPath, path string, info domain.FileInfo) error {
+	if s.blobs != nil && s.blobs.dedupable(path, info) {
+		return s.blobs.place(srcPath, destPath, info)
+	}
+	return os.Rename(srcPath, destPath)
+}
+
+// CollectGarbageBlobs removes stored content which isn't used by any project
+func (s *DiskStorage) CollectGarbageBlobs() (int, int64, error) {
+	if s.blobs == nil {
+		return 0, 0, nil
+	}
+	return s.blobs.CollectGarbage()
+}
+
+// AccountUsage returns size of the storage used by the user's projects (including versions),
+// deduplicated files are counted only once
+func (s *DiskStorage) AccountUsage(username string) (int64, error) {
+	projects, err := s.UserProjects(username)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	counted := make(map[string]bool)
+	for _, projectName := range projects {
+		if s.blobs == nil {
+			pInfo, err := s.GetProjectInfo(projectName)
+			if err != nil {
+				return 0, fmt.Errorf("getting project info: %w", err)
+			}
+			size += pInfo.Size
+			continue
+		}
+		index, err := s.filesIndex(projectName)
+		if err != nil {
+			return 0, err
+		}
+		index.RLock()
+		for path, info := range index.Index {
+			if s.blobs.dedupable(path, info) {
+				if counted[info.Hash] {
+					continue
+				}
+				counted[info.Hash] = true
+			}
+			size += info.Size
+		}
+		index.RUnlock()
+	}
+	for _, projectName := range projects {
+		versionsSize, err := s.versionsUsage(projectName)
+		if err != nil {
+			return 0, fmt.Errorf("computing versions size: %w", err)
+		}
+		size += versionsSize
+	}
+	return size, nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package project
+
+import "io/fs"
+
+// linksCount is not available on this platform, unused blobs are not released
+func linksCount(info fs.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,170 @@
+//go:build unix
+
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newDedupTestStorage(t *testing.T) *DiskStorage {
+	t.Helper()
+	s := newTestStorage(t)
+	s.TrashRetention = 0
+	if err := s.EnableDeduplication(DefaultDedupExclude); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func projectFileStat(t *testing.T, s *DiskStorage, projectName, path string) os.FileInfo {
+	t.Helper()
+	fStat, err := os.Stat(filepath.Join(s.ProjectsRoot, projectName, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fStat
+}
+
+func TestBlobPlace(t *testing.T) {
+	s := newDedupTestStorage(t)
+	files := map[string]string{
+		"project.qgs": "<qgis/>",
+		"style.qml":   "shared style",
+		"data.gpkg":   "shared data",
+	}
+	createTestProject(t, s, "user1/p1", files)
+	createTestProject(t, s, "user2/p2", files)
+	// same content with different modification time
+	meta := []byte(`{"file": "project.qgs"}`)
+	if _, err := s.Create("user1/p3", meta); err != nil {
+		t.Fatal(err)
+	}
+	uploadFiles(t, s, "user1/p3", 1700000500, map[string]string{"style.qml": "shared style"})
+
+	tests := []struct {
+		name   string
+		p1, p2 string
+		path   string
+		linked bool
+	}{
+		{"same content", "user1/p1", "user2/p2", "style.qml", true},
+		{"excluded file", "user1/p1", "user2/p2", "data.gpkg", false},
+		{"different modification time", "user1/p1", "user1/p3", "style.qml", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f1 := projectFileStat(t, s, tt.p1, tt.path)
+			f2 := projectFileStat(t, s, tt.p2, tt.path)
+			if os.SameFile(f1, f2) != tt.linked {
+				t.Errorf("files linked: %v, expected %v", os.SameFile(f1, f2), tt.linked)
+			}
+		})
+	}
+	hash := testFile("style.qml", "shared style", 0).Hash
+	bStat, err := os.Stat(s.blobs.path(hash))
+	if err != nil {
+		t.Fatalf("blob not stored: %v", err)
+	}
+	if links := linksCount(bStat); links != 3 {
+		t.Errorf("expected 3 links of the blob, got %d", links)
+	}
+	if fileExists(s.blobs.path(testFile("data.gpkg", "shared data", 0).Hash)) {
+		t.Error("excluded file stored in the blob store")
+	}
+}
+
+func TestBlobRelease(t *testing.T) {
+	s := newDedupTestStorage(t)
+	files := map[string]string{"project.qgs": "<qgis/>", "style.qml": "shared style"}
+	createTestProject(t, s, "user1/p1", files)
+	createTestProject(t, s, "user1/p2", files)
+	blobPath := s.blobs.path(testFile("style.qml", "shared style", 0).Hash)
+
+	uploadFiles(t, s, "user1/p1", 1700000100, nil, "style.qml")
+	if !fileExists(blobPath) {
+		t.Fatal("blob removed while it's used by other project")
+	}
+	// replaced file
+	uploadFiles(t, s, "user1/p2", 1700000100, map[string]string{"style.qml": "changed style"})
+	if fileExists(blobPath) {
+		t.Error("unused blob was not removed")
+	}
+	if !fileExists(s.blobs.path(testFile("style.qml", "changed style", 0).Hash)) {
+		t.Error("new blob was not stored")
+	}
+}
+
+func TestBlobCollectGarbage(t *testing.T) {
+	s := newDedupTestStorage(t)
+	createTestProject(t, s, "user1/p1", map[string]string{"project.qgs": "<qgis/>"})
+	usedBlob := s.blobs.path(testFile("project.qgs", "<qgis/>", 0).Hash)
+
+	orphan := testFile("orphan", "orphaned content", 0)
+	orphanPath := s.blobs.path(orphan.Hash)
+	if err := os.MkdirAll(filepath.Dir(orphanPath), 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(orphanPath, []byte("orphaned content"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	count, size, err := s.CollectGarbageBlobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || size != orphan.Size {
+		t.Errorf("removed %d blobs (%d bytes), expected 1 (%d bytes)", count, size, orphan.Size)
+	}
+	if fileExists(orphanPath) {
+		t.Error("orphaned blob was not removed")
+	}
+	if !fileExists(usedBlob) {
+		t.Error("used blob was removed")
+	}
+}
+
+func TestAccountUsage(t *testing.T) {
+	s := newDedupTestStorage(t)
+	files := map[string]string{"style.qml": "shared style", "data.gpkg": "shared data"}
+	createTestProject(t, s, "user1/p1", files)
+	createTestProject(t, s, "user1/p2", files)
+	createTestProject(t, s, "user2/p3", files)
+
+	usage, err := s.AccountUsage("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// style is counted once, excluded data file in each project, versions objects are copies
+	projectsSize := int64(len("shared style") + 2*len("shared data"))
+	versionsSize := int64(2 * (len("shared style") + len("shared data")))
+	if usage != projectsSize+versionsSize {
+		t.Errorf("account usage: %d, expected %d", usage, projectsSize+versionsSize)
+	}
+}
+
+func TestCreateFileReplacesLinkedFile(t *testing.T) {
+	s := newDedupTestStorage(t)
+	files := map[string]string{"project.qgs": "<qgis/>", "web/image.png": "image"}
+	createTestProject(t, s, "user1/p1", files)
+	createTestProject(t, s, "user1/p2", files)
+
+	if _, err := s.CreateFile("user1/p1", "web", "image.png", strings.NewReader("new image")); err != nil {
+		t.Fatal(err)
+	}
+	if content := readProjectFile(t, s, "user1/p1", "web/image.png"); content != "new image" {
+		t.Errorf("file not replaced: %q", content)
+	}
+	if content := readProjectFile(t, s, "user1/p2", "web/image.png"); content != "image" {
+		t.Errorf("linked file of other project was modified: %q", content)
+	}
+	blobPath := s.blobs.path(testFile("web/image.png", "image", 0).Hash)
+	if content, _ := os.ReadFile(blobPath); string(content) != "image" {
+		t.Errorf("blob was modified: %q", content)
+	}
+	entries, _ := os.ReadDir(filepath.Join(s.ProjectsRoot, "user1/p1", "web"))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left in the project: %v", entries)
+	}
+}
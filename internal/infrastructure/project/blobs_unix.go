@@ -0,0 +1,15 @@
+//go:build unix
+
+package project
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func linksCount(info fs.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 0
+}
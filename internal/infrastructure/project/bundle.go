@@ -0,0 +1,86 @@
+package project
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+func writeZipFile(w *zip.Writer, name, path string, mtime time.Time) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime}
+	part, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
+
+// Export writes the project bundle (zip archive with project files, configuration files
+// and manifest) into the writer
+func (s *DiskStorage) Export(projectName string, w io.Writer) error {
+	pInfo, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	// current files with checksums (files could be modified also by the map server)
+	files, _, err := s.ListProjectFiles(projectName, true)
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	manifest := domain.BundleManifest{
+		Format:   domain.BundleFormat,
+		Version:  domain.BundleVersion,
+		Project:  projectName,
+		Exported: time.Now().UTC(),
+		Info:     pInfo,
+		Files:    files,
+	}
+	for _, name := range domain.BundleMetaFiles {
+		if fileExists(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", name)) {
+			manifest.Meta = append(manifest.Meta, name)
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	part, err := zw.Create(domain.BundleManifestFile)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(part).Encode(manifest); err != nil {
+		return err
+	}
+	for _, name := range manifest.Meta {
+		path := filepath.Join(s.ProjectsRoot, projectName, ".gisquick", name)
+		if err := writeZipFile(zw, domain.BundleMetaPath(name), path, manifest.Exported); err != nil {
+			return fmt.Errorf("exporting %s: %w", name, err)
+		}
+	}
+	for _, f := range files {
+		path := filepath.Join(s.ProjectsRoot, projectName, f.Path)
+		err := writeZipFile(zw, domain.BundleFilePath(f.Path), path, time.Unix(f.Mtime, 0))
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("exporting project file %s: %w", f.Path, domain.ErrFileNotExists)
+		}
+		if err != nil {
+			return fmt.Errorf("exporting project file %s: %w", f.Path, err)
+		}
+	}
+	return zw.Close()
+}
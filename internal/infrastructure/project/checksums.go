@@ -0,0 +1,116 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// DefaultChecksumWorkers is the default number of files hashed in parallel
+const DefaultChecksumWorkers = 4
+
+// contextReader stops reading when the context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+type checksumResult struct {
+	path string
+	hash string
+	err  error
+}
+
+// computeChecksums computes checksums of the project files in parallel (at most ChecksumWorkers
+// files at once). Computation is stopped on the first error or when the context is cancelled
+// (also while hashing a file), already computed checksums are returned also with the error.
+func (s *DiskStorage) computeChecksums(ctx context.Context, projectName string, files map[string]domain.FileInfo, progress func(domain.ChecksumProgress)) (map[string]string, error) {
+	state := domain.ChecksumProgress{Project: projectName, Total: len(files)}
+	for _, info := range files {
+		state.TotalSize += info.Size
+	}
+	hashes := make(map[string]string, len(files))
+	if len(files) == 0 {
+		return hashes, nil
+	}
+	workers := s.ChecksumWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan string)
+	results := make(chan checksumResult)
+	go func() {
+		defer close(jobs)
+		for path := range files {
+			select {
+			case jobs <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				hash, err := checksumContext(ctx, filepath.Join(s.ProjectsRoot, projectName, path))
+				select {
+				case results <- checksumResult{path: path, hash: hash, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var err error
+	for res := range results {
+		if res.err != nil {
+			if err == nil {
+				err = fmt.Errorf("computing checksum of %s: %w", res.path, res.err)
+			}
+			cancel()
+			continue
+		}
+		hashes[res.path] = res.hash
+		state.Files++
+		state.Size += files[res.path].Size
+		if progress != nil {
+			progress(state)
+		}
+	}
+	if err != nil {
+		return hashes, err
+	}
+	// cancelled by the parent context
+	if len(hashes) < len(files) {
+		return hashes, ctx.Err()
+	}
+	return hashes, nil
+}
@@ -0,0 +1,158 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+func checksumsTestProject(t *testing.T) (*DiskStorage, map[string]domain.FileInfo) {
+	t.Helper()
+	s := newTestStorage(t)
+	s.ChecksumWorkers = 2
+	content := map[string]string{
+		"project.qgs":   "<qgis/>",
+		"a.txt":         "a",
+		"data/b.txt":    "bb",
+		"data/c.txt":    "ccc",
+		"data/d/e.json": "{}",
+	}
+	createTestProject(t, s, "user1/project", content)
+	files := make(map[string]domain.FileInfo, len(content))
+	for path, c := range content {
+		f := testFile(path, c, 0)
+		files[path] = domain.FileInfo{Hash: f.Hash, Size: f.Size}
+	}
+	return s, files
+}
+
+func TestComputeChecksums(t *testing.T) {
+	s, files := checksumsTestProject(t)
+	var states []domain.ChecksumProgress
+	hashes, err := s.computeChecksums(context.Background(), "user1/project", files, func(p domain.ChecksumProgress) {
+		states = append(states, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, info := range files {
+		if hashes[path] != info.Hash {
+			t.Errorf("%s: %s, expected %s", path, hashes[path], info.Hash)
+		}
+	}
+	if len(states) != len(files) {
+		t.Fatalf("expected %d progress updates, got %d", len(files), len(states))
+	}
+	last := states[len(states)-1]
+	if last.Files != len(files) || last.Total != len(files) || last.Size != last.TotalSize || last.TotalSize != 15 {
+		t.Errorf("unexpected final progress: %+v", last)
+	}
+}
+
+func TestComputeChecksumsError(t *testing.T) {
+	s, files := checksumsTestProject(t)
+	files["missing.txt"] = domain.FileInfo{Size: 10}
+	hashes, err := s.computeChecksums(context.Background(), "user1/project", files, nil)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "missing.txt") {
+		t.Errorf("error doesn't contain the file path: %v", err)
+	}
+	if _, ok := hashes["missing.txt"]; ok || len(hashes) >= len(files) {
+		t.Errorf("unexpected checksums: %v", hashes)
+	}
+}
+
+func TestComputeChecksumsCancelled(t *testing.T) {
+	s, files := checksumsTestProject(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hashes, err := s.computeChecksums(ctx, "user1/project", files, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(hashes) != 0 {
+		t.Errorf("checksums computed after cancellation: %v", hashes)
+	}
+}
+
+// cancellingReader cancels the context after the given number of reads
+type cancellingReader struct {
+	r      io.Reader
+	reads  int
+	cancel context.CancelFunc
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	r.reads--
+	if r.reads == 0 {
+		r.cancel()
+	}
+	return r.r.Read(p[:1])
+}
+
+func TestContextReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		reads int
+		data  string
+		err   error
+	}{
+		{"completed", 10, "abc", nil},
+		{"cancelled during reading", 2, "abcdef", context.Canceled},
+		{"cancelled after first read", 1, "abc", context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := contextReader{ctx: ctx, r: &cancellingReader{r: strings.NewReader(tt.data), reads: tt.reads, cancel: cancel}}
+			data, err := io.ReadAll(r)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if tt.err == nil && string(data) != tt.data {
+				t.Errorf("read %q, expected %q", data, tt.data)
+			}
+			if tt.err != nil && len(data) >= len(tt.data) {
+				t.Errorf("reading wasn't stopped: %q", data)
+			}
+		})
+	}
+}
+
+func TestChecksumContextCancelled(t *testing.T) {
+	dir := t.TempDir()
+	db, err := os.ReadFile(filepath.Join("..", "dbhash", "testdata", "basic.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"data.gpkg": db,
+		"data.txt":  bytes.Repeat([]byte("x"), 1000),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, content, 0664); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := checksumContext(ctx, path); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled, got %v", err)
+			}
+			if _, err := checksumContext(context.Background(), path); err != nil {
+				t.Errorf("computing checksum: %v", err)
+			}
+		})
+	}
+}
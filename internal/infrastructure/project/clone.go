@@ -0,0 +1,159 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+// Configuration files copied into the cloned project
+var cloneConfigFiles = []string{"qgis.json", "settings.json", "scripts.json", "thumbnail"}
+
+// cloneFile copies the project file with its modification time, deduplicated files are only linked
+func (s *DiskStorage) cloneFile(srcPath, destPath, path string, info domain.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0775); err != nil {
+		return err
+	}
+	if s.blobs != nil && s.blobs.dedupable(path, info) {
+		if err := os.Link(srcPath, destPath); err == nil {
+			return nil
+		}
+	}
+	if err := copyFile(srcPath, destPath); err != nil {
+		return err
+	}
+	mtime := time.Unix(info.Mtime, 0)
+	return os.Chtimes(destPath, mtime, mtime)
+}
+
+// resetAuthSettings removes users of the source project from the authentication settings
+// of the cloned project (other keys of the settings are preserved), project becomes private
+func resetAuthSettings(settingsPath string) error {
+	content, err := os.ReadFile(settingsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return fmt.Errorf("parsing settings: %w", err)
+	}
+	auth := make(map[string]json.RawMessage)
+	if data, ok := settings["auth"]; ok && len(data) > 0 && string(data) != "null" {
+		if err := json.Unmarshal(data, &auth); err != nil {
+			return fmt.Errorf("parsing authentication settings: %w", err)
+		}
+	}
+	auth["type"] = json.RawMessage(`"private"`)
+	delete(auth, "users")
+	// roles are kept (permissions), but without assigned users
+	if data, ok := auth["roles"]; ok && len(data) > 0 && string(data) != "null" {
+		var roles []map[string]json.RawMessage
+		if err := json.Unmarshal(data, &roles); err != nil {
+			return fmt.Errorf("parsing authentication roles: %w", err)
+		}
+		for _, role := range roles {
+			role["users"] = json.RawMessage(`[]`)
+		}
+		if auth["roles"], err = json.Marshal(roles); err != nil {
+			return err
+		}
+	}
+	if settings["auth"], err = json.Marshal(auth); err != nil {
+		return err
+	}
+	delete(settings, "settings_auth")
+	return saveJsonFile(settingsPath, settings)
+}
+
+// Clone creates new project with copies of the project's files and configuration (versions
+// are not copied). The project info file is written as the last one, so incomplete project
+// is never listed. When cloned into other user's account, access of the source project's users
+// is removed and the project becomes private.
+func (s *DiskStorage) Clone(srcName, destName string) (*domain.ProjectInfo, error) {
+	if !s.CheckProjectExists(srcName) {
+		return nil, domain.ErrProjectNotExists
+	}
+	if s.CheckProjectExists(destName) {
+		return nil, domain.ErrProjectAlreadyExists
+	}
+	unlock := s.lockProject(destName)
+	defer unlock()
+	pInfo, err := s.GetProjectInfo(srcName)
+	if err != nil {
+		return nil, err
+	}
+	index, err := s.filesIndex(srcName)
+	if err != nil {
+		return nil, err
+	}
+	files := index.GetFiles(indexPaths(index)...)
+
+	ownerChanged := strings.Split(srcName, "/")[0] != strings.Split(destName, "/")[0]
+	destDir := filepath.Join(s.ProjectsRoot, destName)
+	if err := os.MkdirAll(filepath.Join(destDir, ".gisquick"), 0775); err != nil {
+		return nil, err
+	}
+	clone := func() error {
+		for path, info := range files {
+			src := filepath.Join(s.ProjectsRoot, srcName, path)
+			if err := s.cloneFile(src, filepath.Join(destDir, path), path, info); err != nil {
+				return fmt.Errorf("copying project file %s: %w", path, err)
+			}
+		}
+		for _, name := range cloneConfigFiles {
+			src := filepath.Join(s.ProjectsRoot, srcName, ".gisquick", name)
+			err := copyFile(src, filepath.Join(destDir, ".gisquick", name))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("copying %s: %w", name, err)
+			}
+		}
+		if ownerChanged {
+			if err := resetAuthSettings(filepath.Join(destDir, ".gisquick", "settings.json")); err != nil {
+				return fmt.Errorf("resetting authentication settings: %w", err)
+			}
+		}
+		return s.saveConfigFile(destName, "filesmap.json", files)
+	}
+	if err := clone(); err != nil {
+		os.RemoveAll(destDir)
+		return nil, err
+	}
+	s.indexCache.Set(destName, &FilesIndex{Index: files}, ttlcache.DefaultTTL)
+
+	now := time.Now().UTC()
+	pInfo.Name = ""
+	pInfo.Created = now
+	pInfo.LastUpdate = now
+	pInfo.Template = false
+	if ownerChanged {
+		pInfo.Authentication = "private"
+	}
+	if err := s.saveConfigFile(destName, "project.json", pInfo); err != nil {
+		s.indexCache.Delete(destName)
+		os.RemoveAll(destDir)
+		return nil, err
+	}
+	pInfo.Name = destName
+	return &pInfo, nil
+}
+
+func (s *DiskStorage) SetTemplate(projectName string, template bool) error {
+	unlock := s.lockProject(projectName)
+	defer unlock()
+	pInfo, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	pInfo.Template = template
+	return s.saveConfigFile(projectName, "project.json", pInfo)
+}
@@ -20,6 +20,8 @@ import (
 
 	"github.com/gisquick/gisquick-server/internal/domain"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/cache"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/dbhash"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/delta"
 	"github.com/jellydator/ttlcache/v3"
 	"go.uber.org/zap"
 )
@@ -87,9 +89,36 @@ type DiskStorage struct {
 	ProjectsRoot      string
 	log               *zap.SugaredLogger
 	indexCache        *ttlcache.Cache[string, *FilesIndex]
+	stopEviction      func()
 	configCache       *cache.DataCache[string, json.RawMessage]
 	projectInfoReader JsonFilesReader[domain.ProjectInfo]
 	settingsReader    JsonFilesReader[domain.ProjectSettings]
+	listenersLock     sync.RWMutex
+	listeners         []domain.ProjectEventHandler
+	versionsLock      sync.Mutex
+	pendingLock       sync.Mutex
+	pendingVersions   map[string]*pendingVersion
+	projectLocks      sync.Map
+	blobs             *blobStore
+	// MaxVersions is the number of kept project versions (0 means unlimited)
+	MaxVersions int
+	// VersionDelay is the period in which changes of the project are recorded as a single version
+	// (0 records version after each change)
+	VersionDelay time.Duration
+	// TrashRetention is the period for which deleted projects and files are kept in the trash
+	// (0 disables the trash)
+	TrashRetention time.Duration
+	// ChecksumWorkers is the number of files hashed in parallel
+	ChecksumWorkers int
+}
+
+// lockProject serializes modifications of the project's files and configuration, returns
+// the unlock function
+func (s *DiskStorage) lockProject(projectName string) func() {
+	mu, _ := s.projectLocks.LoadOrStore(projectName, &sync.Mutex{})
+	m := mu.(*sync.Mutex)
+	m.Lock()
+	return m.Unlock
 }
 
 type Info struct {
@@ -113,8 +142,33 @@ func fileExists(path string) bool {
 // 	return p.(*domain.Project), err
 // }
 
-func DBHash(path string) (string, error) {
-	cmdOut, err := exec.Command("dbhash", path).Output()
+type dbhashEntry struct {
+	stamp string
+	hash  string
+}
+
+// dbhashCache caches hashes of the databases, entries are valid until the size or modification
+// time of the database (or its WAL file) is changed
+var dbhashCache = ttlcache.New(
+	ttlcache.WithTTL[string, dbhashEntry](24*time.Hour),
+	ttlcache.WithCapacity[string, dbhashEntry](10000),
+)
+
+func databaseStamp(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	stamp := fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+	if walInfo, err := os.Stat(path + "-wal"); err == nil {
+		stamp += fmt.Sprintf(":%d:%d", walInfo.Size(), walInfo.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+// dbhashCommand computes hash of the database with the dbhash utility of SQLite
+func dbhashCommand(ctx context.Context, path string) (string, error) {
+	cmdOut, err := exec.CommandContext(ctx, "dbhash", path).Output()
 	if err != nil {
 		return "", fmt.Errorf("executing dbhash command: %w", err)
 	}
@@ -122,30 +176,77 @@ func DBHash(path string) (string, error) {
 	return hash, nil
 }
 
+// DBHash computes content hash of the SQLite database (GeoPackage), equal to the output of
+// the dbhash utility. The dbhash command is used only for databases which are not supported
+// by the built-in implementation (or can't be read, e.g. during a write).
+func DBHash(path string) (string, error) {
+	return dbhashContext(context.Background(), path)
+}
+
+func dbhashContext(ctx context.Context, path string) (string, error) {
+	stamp, err := databaseStamp(path)
+	if err != nil {
+		return "", err
+	}
+	if item := dbhashCache.Get(path); item != nil && item.Value().stamp == stamp {
+		return item.Value().hash, nil
+	}
+	hash, err := dbhash.HashContext(ctx, path)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil && !errors.Is(err, dbhash.ErrNotDatabase) && !errors.Is(err, fs.ErrNotExist) {
+		hash, err = dbhashCommand(ctx, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	dbhashCache.Set(path, dbhashEntry{stamp: stamp, hash: hash}, ttlcache.DefaultTTL)
+	return hash, nil
+}
+
 // Checksum computes SHA-1 hash of file
 func Sha1(path string) (string, error) {
+	return sha1Context(context.Background(), path)
+}
+
+func sha1Context(ctx context.Context, path string) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 	h := sha1.New()
-	if _, err := io.Copy(h, file); err != nil {
+	if _, err := io.Copy(h, contextReader{ctx: ctx, r: file}); err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
+// Checksum computes content hash of GeoPackage files (SHA-1 hash for other files, or when
+// the content hash can't be computed)
 func Checksum(path string) (string, error) {
+	return checksumContext(context.Background(), path)
+}
+
+// checksumContext computes checksum of the file, computation is stopped when the context
+// is cancelled
+func checksumContext(ctx context.Context, path string) (string, error) {
 	if strings.ToLower(filepath.Ext(path)) == ".gpkg" {
-		dbhash, err := DBHash(path)
-		return "dbhash:" + dbhash, err
+		hash, err := dbhashContext(ctx, path)
+		if err == nil {
+			return "dbhash:" + hash, nil
+		}
+		if errors.Is(err, fs.ErrNotExist) || ctx.Err() != nil {
+			return "", err
+		}
 	}
-	return Sha1(path)
+	return sha1Context(ctx, path)
 }
 
 type JsonFilesReader[T any] interface {
 	Get(filename string) (T, error)
+	Invalidate(filename string)
 	Close()
 }
 
@@ -168,9 +269,13 @@ func NewDiskStorage(log *zap.SugaredLogger, projectsRoot string) *DiskStorage {
 		return config, nil
 	})
 	ds := &DiskStorage{
-		ProjectsRoot: projectsRoot,
-		log:          log,
-		configCache:  cfgCache,
+		ProjectsRoot:    projectsRoot,
+		log:             log,
+		configCache:     cfgCache,
+		MaxVersions:     DefaultMaxVersions,
+		VersionDelay:    DefaultVersionDelay,
+		TrashRetention:  DefaultTrashRetention,
+		ChecksumWorkers: DefaultChecksumWorkers,
 	}
 	loader := ttlcache.LoaderFunc[string, *FilesIndex](
 		func(c *ttlcache.Cache[string, *FilesIndex], project string) *ttlcache.Item[string, *FilesIndex] {
@@ -212,7 +317,7 @@ func NewDiskStorage(log *zap.SugaredLogger, projectsRoot string) *DiskStorage {
 		ttlcache.WithDisableTouchOnHit[string, *FilesIndex](),
 	)
 	ds.indexCache = indexCache
-	indexCache.OnEviction(func(ctx context.Context, er ttlcache.EvictionReason, i *ttlcache.Item[string, *FilesIndex]) {
+	ds.stopEviction = indexCache.OnEviction(func(ctx context.Context, er ttlcache.EvictionReason, i *ttlcache.Item[string, *FilesIndex]) {
 		project := i.Key()
 		index := i.Value()
 		log.Infow("ttlcache.OnEviction.indexCache", "project", project)
@@ -226,17 +331,53 @@ func NewDiskStorage(log *zap.SugaredLogger, projectsRoot string) *DiskStorage {
 	return ds
 }
 
-func saveJsonFile(path string, data interface{}) error {
-	f, err := os.Create(path)
+func (s *DiskStorage) OnChange(handler domain.ProjectEventHandler) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	s.listeners = append(s.listeners, handler)
+}
+
+func (s *DiskStorage) emit(e domain.ProjectEvent) {
+	s.listenersLock.RLock()
+	listeners := s.listeners
+	s.listenersLock.RUnlock()
+	for _, handler := range listeners {
+		handler(e)
+	}
+}
+
+// writeFile writes the file through a temporary file in the same directory, which is renamed
+// over the destination file. Existing file is never modified in place (it can be linked from
+// other projects), and it's kept untouched when writing fails. Temporary files have "~" suffix,
+// so they are never listed as project files.
+func writeFile(filename string, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*~")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	encoder := json.NewEncoder(f)
-	if err := encoder.Encode(data); err != nil {
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	// temporary files are created with 0600 permissions
+	if err = f.Chmod(0664); err != nil {
 		return err
 	}
-	return nil
+	if err = write(f); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+func saveJsonFile(path string, data interface{}) error {
+	return writeFile(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(data)
+	})
 }
 
 func (s *DiskStorage) saveConfigFile(projectName, filename string, data interface{}) error {
@@ -253,6 +394,8 @@ func (s *DiskStorage) Create(fullName string, meta json.RawMessage) (*domain.Pro
 	if s.CheckProjectExists(fullName) {
 		return nil, domain.ErrProjectAlreadyExists
 	}
+	unlock := s.lockProject(fullName)
+	defer unlock()
 	if err := os.MkdirAll(internalDir, 0775); err != nil {
 		return nil, err
 	}
@@ -288,7 +431,8 @@ func (s *DiskStorage) UserProjects(username string) ([]string, error) {
 		return projectsNames, fmt.Errorf("listing projects: %v", err)
 	}
 	for _, entry := range entries {
-		if entry.IsDir() {
+		// hidden directories (e.g. trash) are not projects
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			projectName := filepath.Join(username, entry.Name())
 			projPath := filepath.Join(userDir, entry.Name(), ".gisquick", "project.json")
 			if fileExists(projPath) {
@@ -309,7 +453,8 @@ func (s *DiskStorage) AllProjects(skipErrors bool) ([]string, error) {
 		return projectsNames, fmt.Errorf("listing projects: %v", err)
 	}
 	for _, entry := range entries {
-		if entry.IsDir() {
+		// hidden directories (e.g. blobs, uploads) are not accounts
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			username := entry.Name()
 			userProjects, err := s.UserProjects(username)
 			if err != nil {
@@ -439,6 +584,10 @@ func (s *DiskStorage) ListProjectFiles1(project string, checksum bool) ([]domain
 */
 
 func (s *DiskStorage) ListProjectFiles(project string, checksum bool) ([]domain.ProjectFile, []domain.ProjectFile, error) {
+	return s.ListProjectFilesContext(context.Background(), project, checksum, nil)
+}
+
+func (s *DiskStorage) ListProjectFilesContext(ctx context.Context, project string, checksum bool, progress func(domain.ChecksumProgress)) ([]domain.ProjectFile, []domain.ProjectFile, error) {
 	if !s.CheckProjectExists(project) {
 		return nil, nil, domain.ErrProjectNotExists
 	}
@@ -453,6 +602,7 @@ func (s *DiskStorage) ListProjectFiles(project string, checksum bool) ([]domain.
 	}
 	indexUpdated := false
 	files := make([]domain.ProjectFile, len(filesMap))
+	changedFiles := make(map[string]domain.FileInfo)
 	i := 0
 	for path, info := range filesMap {
 		f := domain.ProjectFile{
@@ -465,21 +615,30 @@ func (s *DiskStorage) ListProjectFiles(project string, checksum bool) ([]domain.
 			if hasCachedInfo && cachedInfo.Mtime == info.Mtime {
 				f.Hash = cachedInfo.Hash
 			} else {
-				absPath := filepath.Join(s.ProjectsRoot, project, path)
-				hash, err := Checksum(absPath)
-				if err != nil {
-					return nil, nil, fmt.Errorf("computing checksum: %w", err)
-				}
-				f.Hash = hash
-				// update file info in the index
-				index.Set(path, domain.FileInfo{Hash: hash, Size: info.Size, Mtime: info.Mtime})
-				indexUpdated = true
-				s.log.Debugw("updating files index", "path", path)
+				changedFiles[path] = info
 			}
 		}
 		files[i] = f
 		i += 1
 	}
+	if len(changedFiles) > 0 {
+		hashes, err := s.computeChecksums(ctx, project, changedFiles, progress)
+		// update file info in the index (also with partial results, so they are not computed again)
+		for path, hash := range hashes {
+			info := changedFiles[path]
+			index.Set(path, domain.FileInfo{Hash: hash, Size: info.Size, Mtime: info.Mtime})
+			s.log.Debugw("updating files index", "path", path)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range files {
+			if hash, ok := hashes[files[i].Path]; ok {
+				files[i].Hash = hash
+			}
+		}
+		indexUpdated = true
+	}
 	// index.RLock()
 	// defer index.RUnlock()
 	for path := range index.Index {
@@ -490,14 +649,17 @@ func (s *DiskStorage) ListProjectFiles(project string, checksum bool) ([]domain.
 		}
 	}
 	if indexUpdated {
+		unlock := s.lockProject(project)
 		projectInfo, err := s.GetProjectInfo(project)
 		if err != nil {
 			s.log.Errorw("updating project size", "project", project, zap.Error(err))
+		} else {
+			projectInfo.Size = index.TotalSize()
+			if err := s.saveConfigFile(project, "project.json", projectInfo); err != nil {
+				s.log.Errorw("updating project size", "project", project, zap.Error(err))
+			}
 		}
-		projectInfo.Size = index.TotalSize()
-		if err := s.saveConfigFile(project, "project.json", projectInfo); err != nil {
-			s.log.Errorw("updating project size", "project", project, zap.Error(err))
-		}
+		unlock()
 	}
 	tempFiles := make([]domain.ProjectFile, len(temporaryFiles))
 	i = 0
@@ -560,14 +722,40 @@ func (s *DiskStorage) GetFilesInfo(project string, paths ...string) (map[string]
 	return data, nil
 }
 
+// Delete moves the project into the owner's trash (when enabled)
 func (s *DiskStorage) Delete(name string) error {
+	return s.removeProject(name, s.trashEnabled())
+}
+
+func (s *DiskStorage) Purge(name string) error {
+	return s.removeProject(name, false)
+}
+
+func (s *DiskStorage) removeProject(name string, trash bool) error {
 	if !s.CheckProjectExists(name) {
 		return domain.ErrProjectNotExists
 	}
-	dest := filepath.Join(s.ProjectsRoot, name)
-	if err := os.RemoveAll(dest); err != nil {
-		return err
+	unlock := s.lockProject(name)
+	defer unlock()
+	s.takePendingVersion(name)
+	var files map[string]domain.FileInfo
+	if index, err := s.filesIndex(name); err == nil {
+		files = index.GetFiles(indexPaths(index)...)
+	}
+	// files index is saved on eviction, so it must be removed from the cache before the project
+	s.indexCache.Delete(name)
+	if trash {
+		if err := s.trashProject(name, files); err != nil {
+			return err
+		}
+	} else {
+		dest := filepath.Join(s.ProjectsRoot, name)
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+		s.releaseFiles(filesList(files)...)
 	}
+	s.emit(domain.ProjectEvent{Type: domain.ProjectDeletedEvent, Project: name})
 	return nil
 }
 
@@ -576,22 +764,10 @@ func saveToFile(src io.Reader, filename string) (err error) {
 	if err != nil {
 		return err
 	}
-	file, err := os.Create(filename)
-	if err != nil {
+	return writeFile(filename, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
 		return err
-	}
-
-	// more verbose but with better errors propagation
-	defer func() {
-		if cerr := file.Close(); cerr != nil && err == nil {
-			err = cerr
-		}
-	}()
-
-	if _, err := io.Copy(file, src); err != nil {
-		return err
-	}
-	return nil
+	})
 }
 
 func saveToFile2(src io.Reader, filename string) (h string, err error) {
@@ -630,6 +806,8 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 		err = domain.ErrProjectNotExists
 		return
 	}
+	unlock := s.lockProject(projectName)
+	defer unlock()
 	destDir := filepath.Join(s.ProjectsRoot, projectName, directory)
 	err = os.MkdirAll(destDir, 0775)
 	if err != nil {
@@ -652,7 +830,9 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 		pattern = filepath.Base(f.Name())
 	}
 	if f == nil {
-		f, err = os.Create(filepath.Join(destDir, pattern))
+		// existing file is replaced by rename, it must not be modified in place (it can be
+		// linked from other projects)
+		f, err = os.CreateTemp(destDir, "."+filepath.Base(pattern)+".*~")
 		if err != nil {
 			err = fmt.Errorf("creating new file: %w", err)
 			return
@@ -665,6 +845,9 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 			os.Remove(f.Name())
 		}
 	}()
+	if err = f.Chmod(0664); err != nil {
+		return
+	}
 	sha := sha1.New()
 	dest := io.MultiWriter(f, sha)
 	if _, err = io.Copy(dest, r); err != nil {
@@ -679,11 +862,12 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 	}
 	finfo.Size = fStat.Size()
 	finfo.Mtime = fStat.ModTime().Unix()
-	finfo.Path = f.Name()
 	finfo.Hash = fmt.Sprintf("%x", sha.Sum(nil))
 
 	if strings.Contains(pattern, "<hash>") {
 		pattern = strings.Replace(pattern, "<hash>", finfo.Hash[:10], 1)
+	}
+	if f.Name() != filepath.Join(destDir, pattern) {
 		if err = os.Rename(f.Name(), filepath.Join(destDir, pattern)); err != nil {
 			return
 		}
@@ -695,19 +879,25 @@ func (s *DiskStorage) CreateFile(projectName, directory, pattern string, r io.Re
 		s.log.Errorw("reading files index", "project", projectName, zap.Error(err))
 		return
 	}
+	if prev, ok := index.Get(finfo.Path); ok {
+		s.releaseFiles(prev)
+	}
 	index.Set(finfo.Path, domain.FileInfo{Hash: finfo.Hash, Size: finfo.Size, Mtime: finfo.Mtime})
 	pInfo, err := s.GetProjectInfo(projectName)
 	if err != nil {
 		s.log.Errorw("getting project info", zap.Error(err))
 	}
-	pInfo.Size += finfo.Size
+	pInfo.Size = index.TotalSize()
 	if err := s.saveConfigFile(projectName, "project.json", pInfo); err != nil {
 		s.log.Errorw("updating project file", zap.Error(err))
 	}
+	s.emit(domain.ProjectEvent{Type: domain.FilesChangedEvent, Project: projectName, Files: []string{finfo.Path}})
 	return
 }
 
 func (s *DiskStorage) SaveFile(project string, finfo domain.ProjectFile, path string) error {
+	unlock := s.lockProject(project)
+	defer unlock()
 	absPath := filepath.Join(s.ProjectsRoot, project, path)
 	if err := os.MkdirAll(filepath.Dir(absPath), 0775); err != nil {
 		return err
@@ -720,15 +910,19 @@ func (s *DiskStorage) SaveFile(project string, finfo domain.ProjectFile, path st
 		s.log.Errorw("reading files index", "project", project, zap.Error(err))
 		return nil
 	}
+	if prev, ok := index.Get(path); ok {
+		s.releaseFiles(prev)
+	}
 	index.Set(path, domain.FileInfo{Hash: finfo.Hash, Size: finfo.Size, Mtime: finfo.Mtime})
 	pInfo, err := s.GetProjectInfo(project)
 	if err != nil {
 		s.log.Errorw("getting project info", zap.Error(err))
 	}
-	pInfo.Size += finfo.Size
+	pInfo.Size = index.TotalSize()
 	if err := s.saveConfigFile(project, "project.json", pInfo); err != nil {
 		s.log.Errorw("updating project file", zap.Error(err))
 	}
+	s.emit(domain.ProjectEvent{Type: domain.FilesChangedEvent, Project: project, Files: []string{path}})
 	return nil
 }
 
@@ -744,7 +938,13 @@ func (s *DiskStorage) GetThumbnailPath(projectName string) string {
 	return filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "thumbnail")
 }
 
+func (s *DiskStorage) GetFilePath(projectName, path string) string {
+	return filepath.Join(s.ProjectsRoot, projectName, path)
+}
+
 func (s *DiskStorage) SaveThumbnail(projectName string, r io.Reader) error {
+	unlock := s.lockProject(projectName)
+	defer unlock()
 	project, err := s.GetProjectInfo(projectName)
 	if err != nil {
 		return err
@@ -836,7 +1036,77 @@ func indexProjectFilesList(index *FilesIndex) []domain.ProjectFile {
 	return listIndex
 }
 
+// UpdateFiles applies files changes atomically. Uploaded files are saved into the staging directory
+// first, and the live project is modified only when all declared files were received and verified.
+// Replaced and removed files are moved into the backup directory (or into the trash), so all
+// changes can be reverted when applying of the changes fails.
 func (s *DiskStorage) UpdateFiles(projectName string, info domain.FilesChanges, next domain.FilesReader) ([]domain.ProjectFile, error) {
+	unlock := s.lockProject(projectName)
+	defer unlock()
+	return s.updateFiles(projectName, info, next)
+}
+
+// UpdateFileDelta updates the project file with its new version reconstructed from the block delta
+// (see delta.Apply). Delta is received before the project is locked, so slow uploads don't block
+// other changes of the project.
+func (s *DiskStorage) UpdateFileDelta(projectName string, finfo domain.ProjectFile, blockSize int, r io.Reader) ([]domain.ProjectFile, error) {
+	if !filepath.IsLocal(finfo.Path) {
+		return nil, fmt.Errorf("invalid file path: %s", finfo.Path)
+	}
+	tmpDir := filepath.Join(s.ProjectsRoot, projectName, ".gisquick")
+	deltaFile, err := os.CreateTemp(tmpDir, "delta-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(deltaFile.Name())
+	defer deltaFile.Close()
+	if _, err := io.Copy(deltaFile, r); err != nil {
+		return nil, fmt.Errorf("receiving delta: %w", err)
+	}
+	if _, err := deltaFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	unlock := s.lockProject(projectName)
+	defer unlock()
+	base, err := os.Open(filepath.Join(s.ProjectsRoot, projectName, finfo.Path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, domain.ErrFileNotExists
+		}
+		return nil, err
+	}
+	defer base.Close()
+	baseInfo, err := base.Stat()
+	if err != nil {
+		return nil, err
+	}
+	newFile, err := os.CreateTemp(tmpDir, "delta-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(newFile.Name())
+	defer newFile.Close()
+	if err := delta.Apply(base, baseInfo.Size(), blockSize, deltaFile, newFile, finfo.Size); err != nil {
+		return nil, fmt.Errorf("applying delta: %w", err)
+	}
+	if _, err := newFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	sent := false
+	next := func() (string, io.ReadCloser, error) {
+		if sent {
+			return "", nil, io.EOF
+		}
+		sent = true
+		// passed as a file, so it's linked into the project
+		return finfo.Path, newFile, nil
+	}
+	return s.updateFiles(projectName, domain.FilesChanges{Updates: []domain.ProjectFile{finfo}}, next)
+}
+
+// updateFiles applies files changes, the project must be locked
+func (s *DiskStorage) updateFiles(projectName string, info domain.FilesChanges, next domain.FilesReader) ([]domain.ProjectFile, error) {
 	project, err := s.GetProjectInfo(projectName)
 	if err != nil {
 		return nil, err
@@ -846,111 +1116,256 @@ func (s *DiskStorage) UpdateFiles(projectName string, info domain.FilesChanges,
 		return nil, err
 	}
 	updateFiles := info.Updates
-
-	// i := 0
-	// for {
-	// 	path, reader, err := next()
-	// 	if err != nil {
-	// 		if err == io.EOF {
-	// 			break
-	// 		}
-	// 		return nil, err
-	// 	}
-	// 	if i >= len(files) {
-	// 		return nil, fmt.Errorf("missing file change metadata: %s", path)
-	// 	}
-	// 	i += 1
-	// }
 	if len(updateFiles) > 0 && next == nil {
 		return nil, fmt.Errorf("required function for reading files")
 	}
-	for i := 0; i < len(updateFiles); i++ {
-		path, reader, err := next()
-		if err != nil {
-			return nil, fmt.Errorf("reading upload files stream: %w", err)
-		}
-		declaredInfo := updateFiles[i]
-		if declaredInfo.Path != path {
-			return nil, err // TODO: more graceful error handling
-		}
-		absPath := filepath.Join(s.ProjectsRoot, projectName, path)
-		// if err := saveToFile(reader, absPath); err != nil {
-		// 	return err
-		// }
-		calcHash, err := saveToFile2(reader, absPath)
+	stagingDir := filepath.Join(s.ProjectsRoot, projectName, ".gisquick", fmt.Sprintf("upload-%d", time.Now().UnixNano()))
+	defer os.RemoveAll(stagingDir)
+
+	received := make([]domain.FileInfo, len(updateFiles))
+	for i, declaredInfo := range updateFiles {
+		finfo, err := s.receiveFile(filepath.Join(stagingDir, "files"), declaredInfo, next)
 		if err != nil {
-			reader.Close() // or move to saveToFile?
 			return nil, err
 		}
-		// lmtime := declaredInfo.Mtime
-		lmtime := time.Unix(declaredInfo.Mtime, 0)
-		if err := os.Chtimes(absPath, lmtime, lmtime); err != nil {
-			s.log.Errorw("updating file's modification time", zap.Error(err))
-		}
-		reader.Close()
+		received[i] = finfo
+	}
 
-		fStat, err := os.Stat(absPath)
-		if err != nil {
-			s.log.Errorw("getting file's stat info", zap.Error(err))
-		} else if declaredInfo.Size != fStat.Size() {
-			return nil, fmt.Errorf("declared file info doesn't match: %s", path)
-		}
-		finfo := domain.FileInfo{Hash: calcHash, Size: declaredInfo.Size, Mtime: declaredInfo.Mtime}
-		if declaredInfo.Hash != "" {
-			if strings.HasPrefix(declaredInfo.Hash, "dbhash:") {
-				finfo.Hash = declaredInfo.Hash
-			} else if declaredInfo.Hash != calcHash {
-				return nil, fmt.Errorf("calculated file hash doesn't match: %s", path)
+	s.initVersions(projectName)
+	current := index.GetFiles(indexPaths(index)...)
+	// operations reverting already applied changes, executed in reverse order on failure
+	var undo []func() error
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				s.log.Errorw("reverting files changes", "project", projectName, zap.Error(err))
 			}
 		}
-		// s.log.Infow("saving file", "path", absPath, "hash", calcHash, "hashMatch", declaredInfo.Hash == calcHash, "cmtime", declaredInfo.Mtime.Local(), "smtime", fStat.ModTime())
-		index.Set(path, finfo)
-	}
-	for _, path := range info.Removes {
-		absPath := filepath.Join(s.ProjectsRoot, projectName, path)
-		info, err := os.Lstat(absPath)
-		if err != nil {
+		// blobs of the new files which are no longer used
+		s.releaseFiles(received...)
+	}
+	backup := filepath.Join(stagingDir, "backup")
+	// moveFile moves the file (if exists) and records the reverse operation
+	moveFile := func(src, dest string) (bool, error) {
+		if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+			return false, err
+		}
+		if err := os.Rename(src, dest); err != nil {
 			if errors.Is(err, os.ErrNotExist) {
-				index.Delete(path)
-				continue
+				return false, nil
 			}
-			return nil, fmt.Errorf("removing file/directory %s: %w", path, err)
+			return false, err
 		}
-		if info.IsDir() {
-			if err := os.RemoveAll(absPath); err != nil {
-				return nil, fmt.Errorf("removing project directory %s: %w", path, err) // TODO: or allow this kind of error?
+		undo = append(undo, func() error { return os.Rename(dest, src) })
+		return true, nil
+	}
+	// removed files are moved into the trash (single trash item for all files)
+	var trash *trashItemData
+	var changedFiles []string
+	// replaced or removed files (indexed)
+	var releasedFiles []domain.FileInfo
+	apply := func() error {
+		for i, declaredInfo := range updateFiles {
+			path := declaredInfo.Path
+			absPath := filepath.Join(s.ProjectsRoot, projectName, path)
+			if _, err := moveFile(absPath, filepath.Join(backup, path)); err != nil {
+				return fmt.Errorf("saving project file %s: %w", path, err)
 			}
-			index.DeleteDir(path)
-		} else {
-			if err := os.Remove(absPath); err != nil && !errors.Is(err, os.ErrNotExist) {
-				return nil, fmt.Errorf("removing project file %s: %w", path, err) // TODO: or allow this kind of error?
+			if err := os.MkdirAll(filepath.Dir(absPath), 0775); err != nil {
+				return fmt.Errorf("creating directory: %w", err)
 			}
-			index.Delete(path)
+			if err := s.placeFile(filepath.Join(stagingDir, "files", path), absPath, path, received[i]); err != nil {
+				return fmt.Errorf("saving project file %s: %w", path, err)
+			}
+			undo = append(undo, func() error { return os.Remove(absPath) })
+			changedFiles = append(changedFiles, path)
+			if prev, ok := current[path]; ok {
+				releasedFiles = append(releasedFiles, prev)
+			}
+		}
+		for _, path := range info.Removes {
+			absPath := filepath.Join(s.ProjectsRoot, projectName, path)
+			fStat, err := os.Lstat(absPath)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return fmt.Errorf("removing file/directory %s: %w", path, err)
+			}
+			files := index.GetFiles(path)
+			if fStat.IsDir() {
+				dirPrefix := strings.TrimSuffix(path, "/") + "/"
+				for p, f := range current {
+					if strings.HasPrefix(p, dirPrefix) {
+						files[p] = f
+					}
+				}
+			}
+			changedFiles = append(changedFiles, path)
+			if s.trashEnabled() {
+				if trash == nil {
+					if trash, err = s.newTrashItem(domain.TrashFiles, projectName); err != nil {
+						return err
+					}
+					item := trash
+					undo = append(undo, func() error {
+						return os.RemoveAll(s.trashPath(strings.Split(projectName, "/")[0], item.ID))
+					})
+				}
+				if err := s.trashFile(trash, path, files); err != nil {
+					return fmt.Errorf("moving file/directory %s into trash: %w", path, err)
+				}
+				trashPath := s.trashPath(strings.Split(projectName, "/")[0], trash.ID, "data", path)
+				undo = append(undo, func() error { return os.Rename(trashPath, absPath) })
+				continue
+			}
+			if _, err := moveFile(absPath, filepath.Join(backup, path)); err != nil {
+				return fmt.Errorf("removing file/directory %s: %w", path, err)
+			}
+			releasedFiles = append(releasedFiles, filesList(files)...)
+		}
+		return nil
+	}
+	if err := apply(); err != nil {
+		rollback()
+		return nil, err
+	}
+
+	for i, declaredInfo := range updateFiles {
+		index.Set(declaredInfo.Path, received[i])
+	}
+	for _, path := range info.Removes {
+		index.Delete(path)
+		index.DeleteDir(path)
+	}
+	revertIndex := func() {
+		index.Lock()
+		index.Index = current
+		index.Unlock()
+		index.RLock()
+		err := saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index.Index)
+		index.RUnlock()
+		if err != nil {
+			s.log.Errorw("reverting files index", "project", projectName, zap.Error(err))
 		}
 	}
-	if err := saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index); err != nil {
+	index.RLock()
+	err = saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index.Index)
+	index.RUnlock()
+	if err != nil {
+		rollback()
+		revertIndex()
 		return nil, fmt.Errorf("saving files index: %w", err)
 	}
 	size := index.TotalSize()
+	prevProject := project
 	project.Size = size
 	if project.State == "empty" && size > 0 {
 		project.State = "staged"
 		project.LastUpdate = time.Now().UTC()
 	}
 	if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
+		rollback()
+		revertIndex()
+		if err := s.saveConfigFile(projectName, "project.json", prevProject); err != nil {
+			s.log.Errorw("reverting project file", "project", projectName, zap.Error(err))
+		}
 		return nil, fmt.Errorf("updating project file: %w", err)
 	}
+	if trash != nil {
+		if err := s.saveTrashItem(trash); err != nil {
+			s.log.Errorw("saving trash item", "project", projectName, zap.Error(err))
+		}
+	}
+	// backup must be removed before releasing of the blobs, it holds links of the replaced files
+	os.RemoveAll(backup)
+	s.releaseFiles(releasedFiles...)
+	if len(changedFiles) > 0 {
+		s.emit(domain.ProjectEvent{Type: domain.FilesChangedEvent, Project: projectName, Files: changedFiles})
+	}
+	s.saveVersion(projectName, domain.FilesVersionChange)
 	return indexProjectFilesList(index), nil
 }
 
+// receiveFile reads next file from the upload stream into the staging directory and verifies it
+// against declared file info
+func (s *DiskStorage) receiveFile(stagingDir string, declaredInfo domain.ProjectFile, next domain.FilesReader) (domain.FileInfo, error) {
+	path, reader, err := next()
+	if err != nil {
+		return domain.FileInfo{}, fmt.Errorf("reading upload files stream: %w", err)
+	}
+	defer reader.Close()
+	if declaredInfo.Path != path {
+		return domain.FileInfo{}, fmt.Errorf("unexpected file in upload stream: %s (expected %s)", path, declaredInfo.Path)
+	}
+	if !filepath.IsLocal(path) {
+		return domain.FileInfo{}, fmt.Errorf("invalid file path: %s", path)
+	}
+	stagedPath := filepath.Join(stagingDir, path)
+	calcHash, err := stageFile(reader, stagedPath)
+	if err != nil {
+		return domain.FileInfo{}, fmt.Errorf("saving uploaded file %s: %w", path, err)
+	}
+	lmtime := time.Unix(declaredInfo.Mtime, 0)
+	if err := os.Chtimes(stagedPath, lmtime, lmtime); err != nil {
+		s.log.Errorw("updating file's modification time", zap.Error(err))
+	}
+	fStat, err := os.Stat(stagedPath)
+	if err != nil {
+		return domain.FileInfo{}, fmt.Errorf("getting file's stat info: %w", err)
+	}
+	if declaredInfo.Size != fStat.Size() {
+		return domain.FileInfo{}, fmt.Errorf("declared file info doesn't match: %s", path)
+	}
+	finfo := domain.FileInfo{Hash: calcHash, Size: declaredInfo.Size, Mtime: declaredInfo.Mtime}
+	if declaredInfo.Hash != "" {
+		if strings.HasPrefix(declaredInfo.Hash, "dbhash:") {
+			hash, err := DBHash(stagedPath)
+			if errors.Is(err, dbhash.ErrNotDatabase) || (err == nil && "dbhash:"+hash != declaredInfo.Hash) {
+				return domain.FileInfo{}, fmt.Errorf("%w: %s", domain.ErrFileHashMismatch, path)
+			}
+			if err != nil {
+				// content hash can't be computed (unsupported database), file is indexed with SHA-1 hash
+				s.log.Warnw("computing database hash", "path", path, zap.Error(err))
+			} else {
+				finfo.Hash = declaredInfo.Hash
+			}
+		} else if declaredInfo.Hash != calcHash {
+			return domain.FileInfo{}, fmt.Errorf("%w: %s", domain.ErrFileHashMismatch, path)
+		}
+	}
+	return finfo, nil
+}
+
+// stageFile saves the received file into the staging directory, returns its SHA-1 hash. Files
+// read from the disk (e.g. finished resumable uploads) are linked instead of copied.
+func stageFile(r io.Reader, stagedPath string) (string, error) {
+	if f, ok := r.(*os.File); ok {
+		if err := os.MkdirAll(filepath.Dir(stagedPath), 0775); err != nil {
+			return "", err
+		}
+		if err := os.Link(f.Name(), stagedPath); err == nil {
+			sha := sha1.New()
+			if _, err := io.Copy(sha, f); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%x", sha.Sum(nil)), nil
+		}
+	}
+	return saveToFile2(r, stagedPath)
+}
+
 type SettingsInfo struct {
 	Title string `json:"title"`
 	Auth  struct {
 		Type string `json:"type"`
 	} `json:"auth"`
+	MapCache bool `json:"use_mapcache"`
 }
 
 func (s *DiskStorage) UpdateSettings(projectName string, data json.RawMessage) error {
+	unlock := s.lockProject(projectName)
+	defer unlock()
 	project, err := s.GetProjectInfo(projectName)
 	if err != nil {
 		return err
@@ -959,6 +1374,7 @@ func (s *DiskStorage) UpdateSettings(projectName string, data json.RawMessage) e
 	if err := json.Unmarshal(data, &sInfo); err != nil {
 		return fmt.Errorf("extracting authentication settings: %w", err)
 	}
+	s.initVersions(projectName)
 	if err := s.saveConfigFile(projectName, "settings.json", data); err != nil {
 		return fmt.Errorf("saving settings file: %w", err)
 	}
@@ -966,9 +1382,12 @@ func (s *DiskStorage) UpdateSettings(projectName string, data json.RawMessage) e
 	project.LastUpdate = time.Now().UTC()
 	project.Authentication = sInfo.Auth.Type
 	project.Title = sInfo.Title
+	project.Mapcache = sInfo.MapCache
 	if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
 		return fmt.Errorf("updating project file: %w", err)
 	}
+	s.saveVersion(projectName, domain.SettingsVersionChange)
+	s.emit(domain.ProjectEvent{Type: domain.SettingsChangedEvent, Project: projectName})
 	return nil
 }
 
@@ -993,6 +1412,8 @@ func (s *DiskStorage) ParseQgisMetadata(projectName string, data interface{}) er
 }
 
 func (s *DiskStorage) UpdateMeta(projectName string, meta json.RawMessage) error {
+	unlock := s.lockProject(projectName)
+	defer unlock()
 	pInfo, err := s.GetProjectInfo(projectName)
 	if err != nil {
 		return err
@@ -1003,6 +1424,7 @@ func (s *DiskStorage) UpdateMeta(projectName string, meta json.RawMessage) error
 		return domain.ErrInvalidQgisMeta
 	}
 
+	s.initVersions(projectName)
 	if err := s.saveConfigFile(projectName, "qgis.json", meta); err != nil {
 		return fmt.Errorf("creating qgis meta file: %w", err)
 	}
@@ -1011,7 +1433,12 @@ func (s *DiskStorage) UpdateMeta(projectName string, meta json.RawMessage) error
 	pInfo.Projection = i.Projection
 	pInfo.Title = i.Title
 	pInfo.LastUpdate = time.Now().UTC()
-	return s.saveConfigFile(projectName, "project.json", pInfo)
+	if err := s.saveConfigFile(projectName, "project.json", pInfo); err != nil {
+		return err
+	}
+	s.saveVersion(projectName, domain.MetaVersionChange)
+	s.emit(domain.ProjectEvent{Type: domain.MetaChangedEvent, Project: projectName})
+	return nil
 }
 
 func (s *DiskStorage) GetScripts(projectName string) (domain.Scripts, error) {
@@ -1029,14 +1456,24 @@ func (s *DiskStorage) GetScripts(projectName string) (domain.Scripts, error) {
 }
 
 func (s *DiskStorage) UpdateScripts(projectName string, scripts domain.Scripts) error {
-	return s.saveConfigFile(projectName, "scripts.json", scripts)
+	unlock := s.lockProject(projectName)
+	defer unlock()
+	s.initVersions(projectName)
+	if err := s.saveConfigFile(projectName, "scripts.json", scripts); err != nil {
+		return err
+	}
+	s.saveVersion(projectName, domain.ScriptsVersionChange)
+	return nil
 }
 
 func (s *DiskStorage) Close() {
+	s.flushVersions()
 	s.settingsReader.Close()
 	s.projectInfoReader.Close()
 	s.indexCache.Stop()
 	s.indexCache.DeleteAll()
+	// waits until files indexes are saved
+	s.stopEviction()
 }
 
 func (s *DiskStorage) GetProjectCustomizations(projectName string) (json.RawMessage, error) {
@@ -0,0 +1,305 @@
+package project
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/delta"
+	"go.uber.org/zap"
+)
+
+func newTestStorage(t *testing.T) *DiskStorage {
+	t.Helper()
+	s := NewDiskStorage(zap.NewNop().Sugar(), t.TempDir())
+	s.VersionDelay = 0
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testFile(path, content string, mtime int64) domain.ProjectFile {
+	return domain.ProjectFile{
+		Path:  path,
+		Hash:  fmt.Sprintf("%x", sha1.Sum([]byte(content))),
+		Size:  int64(len(content)),
+		Mtime: mtime,
+	}
+}
+
+// uploadFiles uploads files (path -> content) into the project and removes given files
+func uploadFiles(t *testing.T, s *DiskStorage, projectName string, mtime int64, files map[string]string, removes ...string) {
+	t.Helper()
+	changes := domain.FilesChanges{Removes: removes}
+	for path, content := range files {
+		changes.Updates = append(changes.Updates, testFile(path, content, mtime))
+	}
+	sort.Slice(changes.Updates, func(i, j int) bool {
+		return changes.Updates[i].Path < changes.Updates[j].Path
+	})
+	i := 0
+	next := func() (string, io.ReadCloser, error) {
+		if i >= len(changes.Updates) {
+			return "", nil, io.EOF
+		}
+		path := changes.Updates[i].Path
+		i++
+		return path, io.NopCloser(strings.NewReader(files[path])), nil
+	}
+	if _, err := s.UpdateFiles(projectName, changes, next); err != nil {
+		t.Fatalf("updating files of %s: %v", projectName, err)
+	}
+}
+
+func createTestProject(t *testing.T, s *DiskStorage, projectName string, files map[string]string) {
+	t.Helper()
+	meta := []byte(`{"file": "project.qgs", "title": "Test project", "projection": "EPSG:3857"}`)
+	if _, err := s.Create(projectName, meta); err != nil {
+		t.Fatalf("creating project %s: %v", projectName, err)
+	}
+	uploadFiles(t, s, projectName, 1700000000, files)
+}
+
+func readProjectFile(t *testing.T, s *DiskStorage, projectName, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(s.ProjectsRoot, projectName, path))
+	if err != nil {
+		t.Fatalf("reading project file %s: %v", path, err)
+	}
+	return string(content)
+}
+
+func TestAllProjectsSkipsHiddenDirectories(t *testing.T) {
+	s := newTestStorage(t)
+	createTestProject(t, s, "user1/project", map[string]string{"project.qgs": "<qgis/>"})
+	// directories with project's configuration files, e.g. uploads or hidden data
+	for _, dir := range []string{".uploads/id", "user1/.hidden"} {
+		path := filepath.Join(s.ProjectsRoot, dir, ".gisquick", "project.json")
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	projects, err := s.AllProjects(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 || projects[0] != "user1/project" {
+		t.Errorf("expected [user1/project], got %v", projects)
+	}
+}
+
+func TestStageFileLinksFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "upload", "file.txt")
+	if err := os.MkdirAll(filepath.Dir(src), 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, []byte("content"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dest := filepath.Join(dir, "staging", "data", "file.txt")
+	hash, err := stageFile(f, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != testFile("file.txt", "content", 0).Hash {
+		t.Errorf("unexpected hash %s", hash)
+	}
+	srcStat, _ := os.Stat(src)
+	destStat, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(srcStat, destStat) {
+		t.Error("file was copied instead of linked")
+	}
+}
+
+func TestUpdateFilesRollback(t *testing.T) {
+	tests := []struct {
+		name    string
+		trash   bool
+		updates map[string]string
+		removes []string
+	}{
+		{"update", false, map[string]string{"a.txt": "new a", "b.txt/c.txt": "c"}, nil},
+		{"remove", false, nil, []string{"a.txt", "b.txt/c.txt"}},
+		{"remove into trash", true, nil, []string{"a.txt", "b.txt/c.txt"}},
+		{"update and remove", true, map[string]string{"a.txt": "new a"}, []string{"dir", "b.txt/c.txt"}},
+	}
+	files := map[string]string{
+		"project.qgs": "<qgis/>",
+		"a.txt":       "a",
+		"b.txt":       "b",
+		"dir/d.txt":   "d",
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			if !tt.trash {
+				s.TrashRetention = 0
+			}
+			createTestProject(t, s, "user1/project", files)
+			index, err := s.filesIndex("user1/project")
+			if err != nil {
+				t.Fatal(err)
+			}
+			indexed := index.GetFiles(indexPaths(index)...)
+
+			changes := domain.FilesChanges{Removes: tt.removes}
+			for path, content := range tt.updates {
+				changes.Updates = append(changes.Updates, testFile(path, content, 1700000100))
+			}
+			// file "b.txt/c.txt" can't be created or removed, changes fail after the first file
+			sort.Slice(changes.Updates, func(i, j int) bool {
+				return changes.Updates[i].Path < changes.Updates[j].Path
+			})
+			i := 0
+			next := func() (string, io.ReadCloser, error) {
+				path := changes.Updates[i].Path
+				i++
+				return path, io.NopCloser(strings.NewReader(tt.updates[path])), nil
+			}
+			if _, err := s.UpdateFiles("user1/project", changes, next); err == nil {
+				t.Fatal("expected error")
+			}
+
+			for path, content := range files {
+				if c := readProjectFile(t, s, "user1/project", path); c != content {
+					t.Errorf("%s: %q, expected %q", path, c, content)
+				}
+			}
+			if current := index.GetFiles(indexPaths(index)...); !reflect.DeepEqual(current, indexed) {
+				t.Errorf("files index was not reverted: %v", current)
+			}
+			if items, _ := s.ListTrash("user1"); len(items) != 0 {
+				t.Errorf("trash item was not removed: %v", items)
+			}
+			if entries, _ := os.ReadDir(s.trashPath("user1")); len(entries) != 0 {
+				t.Errorf("trash is not empty: %v", entries)
+			}
+		})
+	}
+}
+
+func TestUpdateFilesDatabaseHash(t *testing.T) {
+	db, err := os.ReadFile(filepath.Join("..", "dbhash", "testdata", "basic.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf16db, err := os.ReadFile(filepath.Join("..", "dbhash", "testdata", "utf16.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbHash := "dbhash:375b9044449ddf0dcd6b7846037774d3ff30c1ab"
+	tests := []struct {
+		name      string
+		content   []byte
+		hash      string
+		err       bool
+		indexHash string
+	}{
+		{"valid database hash", db, dbHash, false, dbHash},
+		{"invalid database hash", db, "dbhash:0000000000000000000000000000000000000000", true, ""},
+		{"not a database", []byte("text"), dbHash, true, ""},
+		{"unsupported database", utf16db, dbHash, false, testFile("", string(utf16db), 0).Hash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			createTestProject(t, s, "user1/project", map[string]string{"project.qgs": "<qgis/>"})
+			f := domain.ProjectFile{Path: "data.gpkg", Hash: tt.hash, Size: int64(len(tt.content)), Mtime: 1700000100}
+			sent := false
+			next := func() (string, io.ReadCloser, error) {
+				if sent {
+					return "", nil, io.EOF
+				}
+				sent = true
+				return f.Path, io.NopCloser(bytes.NewReader(tt.content)), nil
+			}
+			_, err := s.UpdateFiles("user1/project", domain.FilesChanges{Updates: []domain.ProjectFile{f}}, next)
+			if (err != nil) != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			info, err := s.GetFilesInfo("user1/project", f.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.err {
+				if len(info) != 0 || fileExists(filepath.Join(s.ProjectsRoot, "user1/project", f.Path)) {
+					t.Error("invalid file was saved")
+				}
+				return
+			}
+			if info[f.Path].Hash != tt.indexHash {
+				t.Errorf("indexed hash %q, expected %q", info[f.Path].Hash, tt.indexHash)
+			}
+		})
+	}
+}
+
+func TestUpdateFileDelta(t *testing.T) {
+	base := strings.Repeat("0123456789abcdef", 100)
+	content := base[:800] + "modified" + base[800:]
+	tests := []struct {
+		name  string
+		path  string
+		finfo domain.ProjectFile
+		err   error
+	}{
+		{"updated", "data.csv", testFile("data.csv", content, 1700000100), nil},
+		{"hash mismatch", "data.csv", domain.ProjectFile{Path: "data.csv", Hash: testFile("", "other", 0).Hash, Size: int64(len(content))}, domain.ErrFileHashMismatch},
+		{"invalid size", "data.csv", domain.ProjectFile{Path: "data.csv", Hash: testFile("", content, 0).Hash, Size: 10}, delta.ErrInvalidDelta},
+		{"missing file", "other.csv", testFile("other.csv", content, 1700000100), domain.ErrFileNotExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			createTestProject(t, s, "user1/project", map[string]string{"project.qgs": "<qgis/>", "data.csv": base})
+			sig, err := delta.NewSignature(strings.NewReader(base), delta.MinBlockSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var d bytes.Buffer
+			if err := delta.WriteDelta(sig, strings.NewReader(content), &d); err != nil {
+				t.Fatal(err)
+			}
+			files, err := s.UpdateFileDelta("user1/project", tt.finfo, delta.MinBlockSize, &d)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			expected := content
+			if err != nil {
+				expected = base
+			} else if len(files) != 2 {
+				t.Errorf("unexpected project files: %v", files)
+			}
+			if c := readProjectFile(t, s, "user1/project", "data.csv"); c != expected {
+				t.Errorf("unexpected file content: %q", c)
+			}
+			info, err := s.GetFileInfo("user1/project", "data.csv")
+			if err != nil || info.Size != int64(len(expected)) {
+				t.Errorf("unexpected indexed file: %+v (%v)", info, err)
+			}
+			if matches, _ := filepath.Glob(filepath.Join(s.ProjectsRoot, "user1/project", ".gisquick", "delta-*")); len(matches) != 0 {
+				t.Errorf("temporary files were not removed: %v", matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package project
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// CheckIntegrity compares the project's files index with the files on the disk. Checksums are
+// computed only for files which are not indexed, were changed or are indexed without checksum.
+// When repair is enabled, the files index and the project's size are updated.
+func (s *DiskStorage) CheckIntegrity(projectName string, repair bool) (domain.ProjectCheck, error) {
+	check := domain.ProjectCheck{Project: projectName}
+	if !s.CheckProjectExists(projectName) {
+		return check, domain.ErrProjectNotExists
+	}
+	if repair {
+		// files must not be modified while they are compared with the index
+		unlock := s.lockProject(projectName)
+		defer unlock()
+	}
+	pInfo, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return check, fmt.Errorf("reading project info: %w", err)
+	}
+	check.RecordedSize = pInfo.Size
+	// loader of the index cache silently recreates invalid index, so the index file is always
+	// parsed to detect its corruption
+	if _, err := s.loadFilesIndex(projectName); err != nil {
+		check.IndexError = err.Error()
+	}
+	index, err := s.filesIndex(projectName)
+	if err != nil {
+		return check, err
+	}
+	files, temporaryFiles, err := s.createFilesMap(projectName)
+	if err != nil {
+		return check, err
+	}
+	indexed := index.GetFiles(indexPaths(index)...)
+	updates := make(map[string]domain.FileInfo)
+	for path, info := range files {
+		check.Size += info.Size
+		cached, ok := indexed[path]
+		if !ok {
+			check.OrphanedFiles = append(check.OrphanedFiles, path)
+		} else if cached.Size != info.Size || cached.Mtime != info.Mtime {
+			check.ChangedFiles = append(check.ChangedFiles, path)
+		} else if cached.Hash == "" {
+			check.MissingHashes = append(check.MissingHashes, path)
+		} else {
+			continue
+		}
+		hash, err := Checksum(filepath.Join(s.ProjectsRoot, projectName, path))
+		if err != nil {
+			return check, fmt.Errorf("computing checksum of %s: %w", path, err)
+		}
+		info.Hash = hash
+		updates[path] = info
+	}
+	for path := range indexed {
+		if _, ok := files[path]; !ok {
+			check.MissingFiles = append(check.MissingFiles, path)
+		}
+	}
+	for path := range temporaryFiles {
+		check.TemporaryFiles = append(check.TemporaryFiles, path)
+	}
+	sort.Strings(check.MissingFiles)
+	sort.Strings(check.OrphanedFiles)
+	sort.Strings(check.ChangedFiles)
+	sort.Strings(check.MissingHashes)
+	sort.Strings(check.TemporaryFiles)
+
+	if !repair || !check.HasIssues() {
+		return check, nil
+	}
+	for path, info := range updates {
+		index.Set(path, info)
+	}
+	for _, path := range check.MissingFiles {
+		index.Delete(path)
+	}
+	index.RLock()
+	err = saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index.Index)
+	index.RUnlock()
+	if err != nil {
+		return check, fmt.Errorf("saving files index: %w", err)
+	}
+	// re-read project file, so it's up to date with the latest changes of configuration
+	pInfo, err = s.GetProjectInfo(projectName)
+	if err != nil {
+		return check, fmt.Errorf("reading project info: %w", err)
+	}
+	pInfo.Size = index.TotalSize()
+	if err := s.saveConfigFile(projectName, "project.json", pInfo); err != nil {
+		return check, fmt.Errorf("updating project file: %w", err)
+	}
+	check.Repaired = true
+
+	// files were changed outside of the API, so cached data (e.g. map tiles) can be outdated
+	var changedFiles []string
+	changedFiles = append(changedFiles, check.OrphanedFiles...)
+	changedFiles = append(changedFiles, check.ChangedFiles...)
+	changedFiles = append(changedFiles, check.MissingFiles...)
+	if len(changedFiles) > 0 {
+		s.emit(domain.ProjectEvent{Type: domain.FilesChangedEvent, Project: projectName, Files: changedFiles})
+	}
+	return check, nil
+}
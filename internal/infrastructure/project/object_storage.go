@@ -0,0 +1,749 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/s3"
+	"github.com/jellydator/ttlcache/v3"
+	"go.uber.org/zap"
+)
+
+// Files in the project's .gisquick directory which are stored in the object storage
+// (versions are kept only in the local cache)
+var objectMetaFiles = []string{"project.json", "qgis.json", "settings.json", "scripts.json", "thumbnail"}
+
+// manifestFile is the files index of the project, it is uploaded as the last object after each
+// change, so its ETag identifies the project's revision
+const manifestFile = "filesmap.json"
+
+// revisionFile marks the local copy of the project synchronized with the object storage,
+// it contains the synchronized remote revision
+const revisionFile = "remote_revision"
+
+// dirtyFile marks the local copy of the project with changes which failed to upload
+const dirtyFile = "remote_dirty"
+
+type projectSyncState struct {
+	sync.Mutex
+	etag    string
+	checked time.Time
+	dirty   bool
+}
+
+// ObjectStorage stores projects in S3 compatible object storage. Objects are organized as
+//
+//	<prefix>/meta/<user>/<project>/{project.json,qgis.json,...,filesmap.json}
+//	<prefix>/files/<user>/<project>/<path>
+//	<prefix>/trash/<user>/<id>/{item.json,data/<path>}
+//
+// Projects are also kept in the local directory (read-through cache), which is used by the QGIS
+// server. Local copy is synchronized when the remote revision of the project changes, what is checked
+// at most once per RefreshInterval. Changes of the files made directly in the local cache (e.g. WFS-T
+// edits by the map server) are not uploaded. When the upload of changes fails, the local copy is marked
+// as dirty and the upload is retried on the next synchronization instead of pulling the remote revision
+// (changes made by other servers in the meantime are overwritten).
+type ObjectStorage struct {
+	*DiskStorage
+	log    *zap.SugaredLogger
+	client *s3.Client
+	prefix string
+	states sync.Map
+	// RefreshInterval is the minimal period between checks of the project's remote revision
+	RefreshInterval time.Duration
+}
+
+func NewObjectStorage(log *zap.SugaredLogger, disk *DiskStorage, client *s3.Client, prefix string) *ObjectStorage {
+	return &ObjectStorage{
+		DiskStorage:     disk,
+		log:             log,
+		client:          client,
+		prefix:          strings.Trim(prefix, "/"),
+		RefreshInterval: 30 * time.Second,
+	}
+}
+
+func (s *ObjectStorage) localRevision(projectName string) string {
+	content, err := os.ReadFile(s.localPath(projectName, ".gisquick", revisionFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func (s *ObjectStorage) setRevision(projectName string, st *projectSyncState, etag string) {
+	st.etag = etag
+	st.checked = time.Now()
+	if err := os.WriteFile(s.localPath(projectName, ".gisquick", revisionFile), []byte(etag), 0664); err != nil {
+		s.log.Errorw("saving project revision", "project", projectName, zap.Error(err))
+	}
+}
+
+// setDirty marks the local copy of the project as changed, but not uploaded
+func (s *ObjectStorage) setDirty(projectName string, st *projectSyncState) {
+	st.dirty = true
+	if err := os.WriteFile(s.localPath(projectName, ".gisquick", dirtyFile), nil, 0664); err != nil {
+		s.log.Errorw("marking project as changed", "project", projectName, zap.Error(err))
+	}
+}
+
+func (s *ObjectStorage) isDirty(projectName string, st *projectSyncState) bool {
+	return st.dirty || fileExists(s.localPath(projectName, ".gisquick", dirtyFile))
+}
+
+func (s *ObjectStorage) metaKey(projectName string, elem ...string) string {
+	return path.Join(append([]string{s.prefix, "meta", projectName}, elem...)...)
+}
+
+func (s *ObjectStorage) fileKey(projectName, filePath string) string {
+	return path.Join(s.prefix, "files", projectName, filepath.ToSlash(filePath))
+}
+
+func (s *ObjectStorage) state(projectName string) *projectSyncState {
+	st, _ := s.states.LoadOrStore(projectName, &projectSyncState{})
+	return st.(*projectSyncState)
+}
+
+func (s *ObjectStorage) localPath(projectName string, elem ...string) string {
+	return filepath.Join(append([]string{s.ProjectsRoot, projectName}, elem...)...)
+}
+
+// download saves object into the local file (through temporary file)
+func (s *ObjectStorage) download(key, dest string, mtime time.Time) error {
+	r, _, err := s.client.GetObject(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tmpPath := dest + ".download"
+	if err := saveToFile(r, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if !mtime.IsZero() {
+		if err := os.Chtimes(tmpPath, mtime, mtime); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	return os.Rename(tmpPath, dest)
+}
+
+func (s *ObjectStorage) remoteManifest(projectName string) (map[string]domain.FileInfo, error) {
+	r, _, err := s.client.GetObject(context.Background(), s.metaKey(projectName, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var manifest map[string]domain.FileInfo
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("parsing files manifest: %w", err)
+	}
+	if manifest == nil {
+		manifest = make(map[string]domain.FileInfo)
+	}
+	return manifest, nil
+}
+
+// pull updates the local copy of the project to the remote revision
+func (s *ObjectStorage) pull(projectName string) error {
+	manifest, err := s.remoteManifest(projectName)
+	if err != nil {
+		return fmt.Errorf("reading files manifest: %w", err)
+	}
+	s.log.Infow("synchronizing project from object storage", "project", projectName)
+	if err := os.MkdirAll(s.localPath(projectName, ".gisquick"), 0775); err != nil {
+		return err
+	}
+	for _, name := range objectMetaFiles {
+		err := s.download(s.metaKey(projectName, name), s.localPath(projectName, ".gisquick", name), time.Time{})
+		if errors.Is(err, s3.ErrNotFound) {
+			os.Remove(s.localPath(projectName, ".gisquick", name))
+		} else if err != nil {
+			return fmt.Errorf("downloading %s: %w", name, err)
+		}
+	}
+	local, _, err := s.createFilesMap(projectName)
+	if err != nil {
+		return err
+	}
+	var changedFiles []string
+	for filePath, info := range manifest {
+		if l, ok := local[filePath]; ok && l.Size == info.Size && l.Mtime == info.Mtime {
+			continue
+		}
+		absPath := s.localPath(projectName, filePath)
+		if err := os.MkdirAll(filepath.Dir(absPath), 0775); err != nil {
+			return err
+		}
+		if err := s.download(s.fileKey(projectName, filePath), absPath, time.Unix(info.Mtime, 0)); err != nil {
+			return fmt.Errorf("downloading project file %s: %w", filePath, err)
+		}
+		changedFiles = append(changedFiles, filePath)
+	}
+	for filePath := range local {
+		if _, ok := manifest[filePath]; !ok {
+			if err := os.Remove(s.localPath(projectName, filePath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			changedFiles = append(changedFiles, filePath)
+		}
+	}
+	if err := saveJsonFile(s.localPath(projectName, ".gisquick", manifestFile), manifest); err != nil {
+		return fmt.Errorf("saving files index: %w", err)
+	}
+	s.indexCache.Set(projectName, &FilesIndex{Index: manifest}, ttlcache.DefaultTTL)
+	if len(changedFiles) > 0 {
+		s.emit(domain.ProjectEvent{Type: domain.FilesChangedEvent, Project: projectName, Files: changedFiles})
+	}
+	return nil
+}
+
+// push uploads changes of the local copy of the project, returns new remote revision
+func (s *ObjectStorage) push(projectName string) (string, error) {
+	ctx := context.Background()
+	remote, err := s.remoteManifest(projectName)
+	if errors.Is(err, s3.ErrNotFound) {
+		remote = make(map[string]domain.FileInfo)
+	} else if err != nil {
+		return "", err
+	}
+	index, err := s.filesIndex(projectName)
+	if err != nil {
+		return "", err
+	}
+	files := index.GetFiles(indexPaths(index)...)
+	for filePath, info := range files {
+		if r, ok := remote[filePath]; ok && r.Hash == info.Hash && r.Size == info.Size && r.Mtime == info.Mtime {
+			continue
+		}
+		if err := s.upload(s.fileKey(projectName, filePath), s.localPath(projectName, filePath)); err != nil {
+			return "", fmt.Errorf("uploading project file %s: %w", filePath, err)
+		}
+	}
+	for filePath := range remote {
+		if _, ok := files[filePath]; !ok {
+			if err := s.client.DeleteObject(ctx, s.fileKey(projectName, filePath)); err != nil {
+				return "", fmt.Errorf("deleting project file %s: %w", filePath, err)
+			}
+		}
+	}
+	for _, name := range objectMetaFiles {
+		err := s.upload(s.metaKey(projectName, name), s.localPath(projectName, ".gisquick", name))
+		if errors.Is(err, os.ErrNotExist) {
+			err = s.client.DeleteObject(ctx, s.metaKey(projectName, name))
+		}
+		if err != nil {
+			return "", fmt.Errorf("uploading %s: %w", name, err)
+		}
+	}
+	manifest, err := json.Marshal(files)
+	if err != nil {
+		return "", err
+	}
+	if err := s.client.PutBytes(ctx, s.metaKey(projectName, manifestFile), manifest); err != nil {
+		return "", fmt.Errorf("uploading files manifest: %w", err)
+	}
+	info, err := s.client.HeadObject(ctx, s.metaKey(projectName, manifestFile))
+	if err != nil {
+		return "", err
+	}
+	return info.ETag, nil
+}
+
+func (s *ObjectStorage) upload(key, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fStat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return s.client.PutObject(context.Background(), key, f, fStat.Size())
+}
+
+// refreshLocked synchronizes the local copy of the project when the remote revision has changed
+// (state's lock must be held)
+func (s *ObjectStorage) refreshLocked(projectName string, st *projectSyncState, force bool) error {
+	if !force && time.Since(st.checked) < s.RefreshInterval {
+		return nil
+	}
+	if s.isDirty(projectName, st) && s.DiskStorage.CheckProjectExists(projectName) {
+		// local changes must not be replaced by the remote revision
+		etag, err := s.push(projectName)
+		if err != nil {
+			st.dirty, st.checked = true, time.Now()
+			return fmt.Errorf("uploading local changes: %w", err)
+		}
+		st.dirty = false
+		os.Remove(s.localPath(projectName, ".gisquick", dirtyFile))
+		s.setRevision(projectName, st, etag)
+		return nil
+	}
+	info, err := s.client.HeadObject(context.Background(), s.metaKey(projectName, manifestFile))
+	if errors.Is(err, s3.ErrNotFound) {
+		// project was deleted by other server, local projects which were never uploaded are kept
+		// (local copy isn't moved into the trash, it's kept by the server which deleted the project)
+		if s.DiskStorage.CheckProjectExists(projectName) && s.localRevision(projectName) != "" {
+			if err := s.DiskStorage.removeProject(projectName, false); err != nil {
+				return fmt.Errorf("removing local copy of the project: %w", err)
+			}
+		}
+		st.etag = ""
+		st.checked = time.Now()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking project revision: %w", err)
+	}
+	if st.etag == "" {
+		st.etag = s.localRevision(projectName)
+	}
+	if info.ETag != st.etag {
+		if err := s.pull(projectName); err != nil {
+			return err
+		}
+	}
+	s.setRevision(projectName, st, info.ETag)
+	return nil
+}
+
+// refresh makes sure that the local copy of the project is up to date. When the object storage
+// isn't available, the local copy (if any) is used.
+func (s *ObjectStorage) refresh(projectName string) error {
+	st := s.state(projectName)
+	st.Lock()
+	defer st.Unlock()
+	err := s.refreshLocked(projectName, st, false)
+	if st.etag == "" && !st.dirty {
+		s.states.Delete(projectName)
+	}
+	if err != nil && s.DiskStorage.CheckProjectExists(projectName) {
+		s.log.Warnw("using local copy of the project", "project", projectName, zap.Error(err))
+		return nil
+	}
+	return err
+}
+
+// update applies changes on the up to date local copy of the project and uploads them
+func (s *ObjectStorage) update(projectName string, fn func() error) error {
+	st := s.state(projectName)
+	st.Lock()
+	defer st.Unlock()
+	if err := s.refreshLocked(projectName, st, true); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	// removed files are moved into the trash, which must be uploaded before the files objects are deleted
+	if err := s.pushTrash(strings.Split(projectName, "/")[0]); err != nil {
+		s.log.Errorw("uploading trash", "project", projectName, zap.Error(err))
+	}
+	etag, err := s.push(projectName)
+	if err != nil {
+		// upload is retried on the next synchronization
+		s.setDirty(projectName, st)
+		return fmt.Errorf("uploading project to object storage: %w", err)
+	}
+	s.setRevision(projectName, st, etag)
+	return nil
+}
+
+func (s *ObjectStorage) listProjects(prefix string) ([]string, error) {
+	projectsNames := make([]string, 0)
+	metaPrefix := path.Join(s.prefix, "meta") + "/"
+	err := s.client.ListObjects(context.Background(), metaPrefix+prefix, func(o s3.ObjectInfo) error {
+		name := strings.TrimPrefix(o.Key, metaPrefix)
+		if strings.HasSuffix(name, "/"+manifestFile) {
+			name = strings.TrimSuffix(name, "/"+manifestFile)
+			if strings.Count(name, "/") == 1 {
+				projectsNames = append(projectsNames, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return projectsNames, fmt.Errorf("listing projects: %w", err)
+	}
+	return projectsNames, nil
+}
+
+func (s *ObjectStorage) UserProjects(username string) ([]string, error) {
+	return s.listProjects(username + "/")
+}
+
+func (s *ObjectStorage) AllProjects(skipErrors bool) ([]string, error) {
+	return s.listProjects("")
+}
+
+func (s *ObjectStorage) CheckProjectExists(name string) bool {
+	if err := s.refresh(name); err != nil {
+		s.log.Errorw("checking project in object storage", "project", name, zap.Error(err))
+	}
+	return s.DiskStorage.CheckProjectExists(name)
+}
+
+func (s *ObjectStorage) Create(name string, meta json.RawMessage) (*domain.ProjectInfo, error) {
+	var info *domain.ProjectInfo
+	err := s.update(name, func() (err error) {
+		info, err = s.DiskStorage.Create(name, meta)
+		return err
+	})
+	return info, err
+}
+
+func (s *ObjectStorage) Delete(name string) error {
+	return s.remove(name, s.DiskStorage.Delete)
+}
+
+func (s *ObjectStorage) Purge(name string) error {
+	return s.remove(name, s.DiskStorage.Purge)
+}
+
+// remove removes the project from the object storage, local copy is removed by the given function
+func (s *ObjectStorage) remove(name string, removeLocal func(string) error) error {
+	st := s.state(name)
+	st.Lock()
+	defer st.Unlock()
+	defer s.states.Delete(name)
+	if err := s.refreshLocked(name, st, true); err != nil {
+		return err
+	}
+	if err := removeLocal(name); err != nil {
+		return err
+	}
+	if err := s.pushTrash(strings.Split(name, "/")[0]); err != nil {
+		s.log.Errorw("uploading trash", "project", name, zap.Error(err))
+	}
+	ctx := context.Background()
+	// manifest is removed first, so the project immediately disappears for other servers
+	if err := s.client.DeleteObject(ctx, s.metaKey(name, manifestFile)); err != nil {
+		return fmt.Errorf("deleting project from object storage: %w", err)
+	}
+	if err := s.client.DeletePrefix(ctx, s.metaKey(name)+"/"); err != nil {
+		return fmt.Errorf("deleting project from object storage: %w", err)
+	}
+	if err := s.client.DeletePrefix(ctx, s.fileKey(name, "")+"/"); err != nil {
+		return fmt.Errorf("deleting project from object storage: %w", err)
+	}
+	return nil
+}
+
+// CheckIntegrity checks the local copy of the project, repaired files index is uploaded into
+// the object storage (together with local changes of the files)
+func (s *ObjectStorage) CheckIntegrity(projectName string, repair bool) (domain.ProjectCheck, error) {
+	if !repair {
+		if err := s.refresh(projectName); err != nil {
+			return domain.ProjectCheck{Project: projectName}, err
+		}
+		return s.DiskStorage.CheckIntegrity(projectName, false)
+	}
+	var check domain.ProjectCheck
+	err := s.update(projectName, func() (err error) {
+		check, err = s.DiskStorage.CheckIntegrity(projectName, true)
+		return err
+	})
+	return check, err
+}
+
+// Rename copies objects of the project under the new name (manifest as the last one) and removes
+// the original objects
+func (s *ObjectStorage) Rename(oldName, newName string) error {
+	if s.CheckProjectExists(newName) {
+		return domain.ErrProjectAlreadyExists
+	}
+	st := s.state(oldName)
+	st.Lock()
+	defer st.Unlock()
+	defer s.states.Delete(oldName)
+	if err := s.refreshLocked(oldName, st, true); err != nil {
+		return err
+	}
+	newSt := s.state(newName)
+	newSt.Lock()
+	defer newSt.Unlock()
+
+	ctx := context.Background()
+	manifest, err := s.remoteManifest(oldName)
+	if errors.Is(err, s3.ErrNotFound) {
+		return domain.ErrProjectNotExists
+	} else if err != nil {
+		return fmt.Errorf("reading files manifest: %w", err)
+	}
+	for filePath := range manifest {
+		if err := s.client.CopyObject(ctx, s.fileKey(oldName, filePath), s.fileKey(newName, filePath)); err != nil {
+			return fmt.Errorf("copying project file %s: %w", filePath, err)
+		}
+	}
+	for _, name := range objectMetaFiles {
+		err := s.client.CopyObject(ctx, s.metaKey(oldName, name), s.metaKey(newName, name))
+		if err != nil && !errors.Is(err, s3.ErrNotFound) {
+			return fmt.Errorf("copying %s: %w", name, err)
+		}
+	}
+	if err := s.client.CopyObject(ctx, s.metaKey(oldName, manifestFile), s.metaKey(newName, manifestFile)); err != nil {
+		return fmt.Errorf("copying files manifest: %w", err)
+	}
+	info, err := s.client.HeadObject(ctx, s.metaKey(newName, manifestFile))
+	if err != nil {
+		return err
+	}
+	if err := s.DiskStorage.Rename(oldName, newName); err != nil {
+		return err
+	}
+	s.setRevision(newName, newSt, info.ETag)
+
+	// manifest is removed first, so the project immediately disappears for other servers
+	if err := s.client.DeleteObject(ctx, s.metaKey(oldName, manifestFile)); err != nil {
+		return fmt.Errorf("deleting project from object storage: %w", err)
+	}
+	if err := s.client.DeletePrefix(ctx, s.metaKey(oldName)+"/"); err != nil {
+		return fmt.Errorf("deleting project from object storage: %w", err)
+	}
+	if err := s.client.DeletePrefix(ctx, s.fileKey(oldName, "")+"/"); err != nil {
+		return fmt.Errorf("deleting project from object storage: %w", err)
+	}
+	return nil
+}
+
+func (s *ObjectStorage) Clone(srcName, destName string) (*domain.ProjectInfo, error) {
+	if err := s.refresh(srcName); err != nil {
+		return nil, err
+	}
+	var info *domain.ProjectInfo
+	err := s.update(destName, func() (err error) {
+		info, err = s.DiskStorage.Clone(srcName, destName)
+		return err
+	})
+	return info, err
+}
+
+func (s *ObjectStorage) SetTemplate(projectName string, template bool) error {
+	return s.update(projectName, func() error {
+		return s.DiskStorage.SetTemplate(projectName, template)
+	})
+}
+
+func (s *ObjectStorage) Export(projectName string, w io.Writer) error {
+	if err := s.refresh(projectName); err != nil {
+		return err
+	}
+	return s.DiskStorage.Export(projectName, w)
+}
+
+func (s *ObjectStorage) GetProjectInfo(name string) (domain.ProjectInfo, error) {
+	if err := s.refresh(name); err != nil {
+		return domain.ProjectInfo{}, err
+	}
+	return s.DiskStorage.GetProjectInfo(name)
+}
+
+func (s *ObjectStorage) CreateFile(projectName, directory, pattern string, r io.Reader) (domain.ProjectFile, error) {
+	var finfo domain.ProjectFile
+	err := s.update(projectName, func() (err error) {
+		finfo, err = s.DiskStorage.CreateFile(projectName, directory, pattern, r)
+		return err
+	})
+	return finfo, err
+}
+
+func (s *ObjectStorage) SaveFile(projectName string, finfo domain.ProjectFile, path string) error {
+	return s.update(projectName, func() error {
+		return s.DiskStorage.SaveFile(projectName, finfo, path)
+	})
+}
+
+func (s *ObjectStorage) GetFileInfo(projectName, path string) (domain.FileInfo, error) {
+	if err := s.refresh(projectName); err != nil {
+		return domain.FileInfo{}, err
+	}
+	return s.DiskStorage.GetFileInfo(projectName, path)
+}
+
+func (s *ObjectStorage) GetFilesInfo(projectName string, paths ...string) (map[string]domain.FileInfo, error) {
+	if err := s.refresh(projectName); err != nil {
+		return nil, err
+	}
+	return s.DiskStorage.GetFilesInfo(projectName, paths...)
+}
+
+func (s *ObjectStorage) ListProjectFiles(projectName string, checksum bool) ([]domain.ProjectFile, []domain.ProjectFile, error) {
+	if err := s.refresh(projectName); err != nil {
+		return nil, nil, err
+	}
+	return s.DiskStorage.ListProjectFiles(projectName, checksum)
+}
+
+func (s *ObjectStorage) ListProjectFilesContext(ctx context.Context, projectName string, checksum bool, progress func(domain.ChecksumProgress)) ([]domain.ProjectFile, []domain.ProjectFile, error) {
+	if err := s.refresh(projectName); err != nil {
+		return nil, nil, err
+	}
+	return s.DiskStorage.ListProjectFilesContext(ctx, projectName, checksum, progress)
+}
+
+func (s *ObjectStorage) ParseQgisMetadata(projectName string, data interface{}) error {
+	if err := s.refresh(projectName); err != nil {
+		return err
+	}
+	return s.DiskStorage.ParseQgisMetadata(projectName, data)
+}
+
+func (s *ObjectStorage) UpdateMeta(projectName string, meta json.RawMessage) error {
+	return s.update(projectName, func() error {
+		return s.DiskStorage.UpdateMeta(projectName, meta)
+	})
+}
+
+func (s *ObjectStorage) GetSettings(projectName string) (domain.ProjectSettings, error) {
+	if err := s.refresh(projectName); err != nil {
+		return domain.ProjectSettings{}, err
+	}
+	return s.DiskStorage.GetSettings(projectName)
+}
+
+func (s *ObjectStorage) UpdateSettings(projectName string, data json.RawMessage) error {
+	return s.update(projectName, func() error {
+		return s.DiskStorage.UpdateSettings(projectName, data)
+	})
+}
+
+func (s *ObjectStorage) GetThumbnailPath(projectName string) string {
+	if err := s.refresh(projectName); err != nil {
+		s.log.Errorw("synchronizing project", "project", projectName, zap.Error(err))
+	}
+	return s.DiskStorage.GetThumbnailPath(projectName)
+}
+
+func (s *ObjectStorage) GetFilePath(projectName, path string) string {
+	if err := s.refresh(projectName); err != nil {
+		s.log.Errorw("synchronizing project", "project", projectName, zap.Error(err))
+	}
+	return s.DiskStorage.GetFilePath(projectName, path)
+}
+
+func (s *ObjectStorage) SaveThumbnail(projectName string, r io.Reader) error {
+	return s.update(projectName, func() error {
+		return s.DiskStorage.SaveThumbnail(projectName, r)
+	})
+}
+
+func (s *ObjectStorage) UpdateFiles(projectName string, info domain.FilesChanges, next domain.FilesReader) ([]domain.ProjectFile, error) {
+	var files []domain.ProjectFile
+	err := s.update(projectName, func() (err error) {
+		files, err = s.DiskStorage.UpdateFiles(projectName, info, next)
+		return err
+	})
+	return files, err
+}
+
+func (s *ObjectStorage) UpdateFileDelta(projectName string, finfo domain.ProjectFile, blockSize int, delta io.Reader) ([]domain.ProjectFile, error) {
+	var files []domain.ProjectFile
+	err := s.update(projectName, func() (err error) {
+		files, err = s.DiskStorage.UpdateFileDelta(projectName, finfo, blockSize, delta)
+		return err
+	})
+	return files, err
+}
+
+func (s *ObjectStorage) GetScripts(projectName string) (domain.Scripts, error) {
+	if err := s.refresh(projectName); err != nil {
+		return nil, err
+	}
+	return s.DiskStorage.GetScripts(projectName)
+}
+
+func (s *ObjectStorage) UpdateScripts(projectName string, scripts domain.Scripts) error {
+	return s.update(projectName, func() error {
+		return s.DiskStorage.UpdateScripts(projectName, scripts)
+	})
+}
+
+func (s *ObjectStorage) GetProjectCustomizations(projectName string) (json.RawMessage, error) {
+	if err := s.refresh(projectName); err != nil {
+		return nil, err
+	}
+	return s.DiskStorage.GetProjectCustomizations(projectName)
+}
+
+func (s *ObjectStorage) ListVersions(projectName string) ([]domain.ProjectVersion, error) {
+	if err := s.refresh(projectName); err != nil {
+		return nil, err
+	}
+	return s.DiskStorage.ListVersions(projectName)
+}
+
+func (s *ObjectStorage) RestoreVersion(projectName string, id int) error {
+	return s.update(projectName, func() error {
+		return s.DiskStorage.RestoreVersion(projectName, id)
+	})
+}
+
+// AccountUsage returns total size of the user's projects files (computed from the remote manifests,
+// so the projects don't have to be downloaded)
+func (s *ObjectStorage) AccountUsage(username string) (int64, error) {
+	projects, err := s.UserProjects(username)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, projectName := range projects {
+		manifest, err := s.remoteManifest(projectName)
+		if err != nil {
+			if errors.Is(err, s3.ErrNotFound) {
+				continue
+			}
+			return 0, fmt.Errorf("reading files manifest [%s]: %w", projectName, err)
+		}
+		for _, info := range manifest {
+			size += info.Size
+		}
+	}
+	return size, nil
+}
+
+// Import uploads local projects which were never synchronized with the object storage
+// (e.g. when switching from the disk storage)
+func (s *ObjectStorage) Import() (int, error) {
+	projects, err := s.DiskStorage.AllProjects(true)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, projectName := range projects {
+		if s.localRevision(projectName) != "" {
+			continue
+		}
+		_, err := s.client.HeadObject(context.Background(), s.metaKey(projectName, manifestFile))
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, s3.ErrNotFound) {
+			return count, err
+		}
+		st := s.state(projectName)
+		st.Lock()
+		etag, err := s.push(projectName)
+		if err == nil {
+			s.setRevision(projectName, st, etag)
+		}
+		st.Unlock()
+		if err != nil {
+			return count, fmt.Errorf("uploading project %s: %w", projectName, err)
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,312 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/s3"
+	"go.uber.org/zap"
+)
+
+// Trash items are also stored in the object storage, so they are available on all servers:
+//
+//	<prefix>/trash/<user>/<id>/item.json
+//	<prefix>/trash/<user>/<id>/data/<path>
+//
+// Items are created in the local trash and uploaded before the project's objects are removed
+// (unchanged files are copied from the project's objects), item.json is uploaded as the last
+// object. Uploaded items are marked in the local trash, so items purged or restored by other
+// servers can be recognized and removed from the local trash.
+
+// trashUploadedFile marks the local trash item stored in the object storage
+const trashUploadedFile = "uploaded"
+
+func (s *ObjectStorage) trashKey(username string, elem ...string) string {
+	return path.Join(append([]string{s.prefix, "trash", username}, elem...)...)
+}
+
+// trashItemUploaded checks whether the local trash item is stored in the object storage
+func (s *ObjectStorage) trashItemUploaded(username, id string) bool {
+	return fileExists(s.trashPath(username, id, trashUploadedFile))
+}
+
+// pushTrash uploads local trash items of the user, which are not yet in the object storage
+func (s *ObjectStorage) pushTrash(username string) error {
+	entries, err := os.ReadDir(s.trashPath(username))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("listing trash: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() || s.trashItemUploaded(username, e.Name()) {
+			continue
+		}
+		item, err := s.DiskStorage.readTrashItem(username, e.Name())
+		if errors.Is(err, domain.ErrTrashItemNotExists) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.uploadTrashItem(username, item); err != nil {
+			return fmt.Errorf("uploading trash item %s: %w", item.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *ObjectStorage) uploadTrashItem(username string, item trashItemData) error {
+	ctx := context.Background()
+	remote, err := s.remoteManifest(item.Project)
+	if err != nil && !errors.Is(err, s3.ErrNotFound) {
+		return err
+	}
+	for filePath, info := range item.Index {
+		key := s.trashKey(username, item.ID, "data", filepath.ToSlash(filePath))
+		if r, ok := remote[filePath]; ok && r.Hash == info.Hash && r.Size == info.Size && r.Mtime == info.Mtime {
+			if err := s.client.CopyObject(ctx, s.fileKey(item.Project, filePath), key); err == nil {
+				continue
+			}
+		}
+		if err := s.upload(key, s.trashPath(username, item.ID, "data", filePath)); err != nil {
+			return fmt.Errorf("uploading file %s: %w", filePath, err)
+		}
+	}
+	if item.Type == domain.TrashProject {
+		for _, name := range append(objectMetaFiles, manifestFile) {
+			key := s.trashKey(username, item.ID, "data", ".gisquick", name)
+			err := s.upload(key, s.trashPath(username, item.ID, "data", ".gisquick", name))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("uploading %s: %w", name, err)
+			}
+		}
+	}
+	if err := s.upload(s.trashKey(username, item.ID, "item.json"), s.trashPath(username, item.ID, "item.json")); err != nil {
+		return err
+	}
+	return os.WriteFile(s.trashPath(username, item.ID, trashUploadedFile), nil, 0664)
+}
+
+// remoteTrashItem reads the trash item from the local trash, or from the object storage
+func (s *ObjectStorage) remoteTrashItem(username, id string) (trashItemData, error) {
+	item, err := s.DiskStorage.readTrashItem(username, id)
+	if !errors.Is(err, domain.ErrTrashItemNotExists) {
+		return item, err
+	}
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return item, domain.ErrTrashItemNotExists
+	}
+	r, _, err := s.client.GetObject(context.Background(), s.trashKey(username, id, "item.json"))
+	if errors.Is(err, s3.ErrNotFound) {
+		return item, domain.ErrTrashItemNotExists
+	}
+	if err != nil {
+		return item, err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(&item); err != nil {
+		return item, fmt.Errorf("parsing trash item: %w", err)
+	}
+	item.ID = id
+	item.Expires = item.Deleted.Add(s.TrashRetention)
+	return item, nil
+}
+
+// pullTrashItem downloads the trash item into the local trash (when it's not there)
+func (s *ObjectStorage) pullTrashItem(username, id string) error {
+	if _, err := s.DiskStorage.readTrashItem(username, id); !errors.Is(err, domain.ErrTrashItemNotExists) {
+		return err
+	}
+	item, err := s.remoteTrashItem(username, id)
+	if err != nil {
+		return err
+	}
+	for filePath, info := range item.Index {
+		dest := s.trashPath(username, id, "data", filePath)
+		if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+			return err
+		}
+		key := s.trashKey(username, id, "data", filepath.ToSlash(filePath))
+		if err := s.download(key, dest, time.Unix(info.Mtime, 0)); err != nil {
+			return fmt.Errorf("downloading file %s: %w", filePath, err)
+		}
+	}
+	if item.Type == domain.TrashProject {
+		if err := os.MkdirAll(s.trashPath(username, id, "data", ".gisquick"), 0775); err != nil {
+			return err
+		}
+		for _, name := range append(objectMetaFiles, manifestFile) {
+			key := s.trashKey(username, id, "data", ".gisquick", name)
+			err := s.download(key, s.trashPath(username, id, "data", ".gisquick", name), time.Time{})
+			if err != nil && !errors.Is(err, s3.ErrNotFound) {
+				return fmt.Errorf("downloading %s: %w", name, err)
+			}
+		}
+	}
+	if err := os.WriteFile(s.trashPath(username, id, trashUploadedFile), nil, 0664); err != nil {
+		return err
+	}
+	// item is complete after its info file is saved
+	return s.DiskStorage.saveTrashItem(&item)
+}
+
+// deleteTrashItem removes the trash item from the object storage and from the local trash
+func (s *ObjectStorage) deleteTrashItem(username, id string) error {
+	ctx := context.Background()
+	// info file is removed first, so the item immediately disappears for other servers
+	if err := s.client.DeleteObject(ctx, s.trashKey(username, id, "item.json")); err != nil {
+		return fmt.Errorf("removing trash item: %w", err)
+	}
+	if err := s.client.DeletePrefix(ctx, s.trashKey(username, id)+"/"); err != nil {
+		return fmt.Errorf("removing trash item: %w", err)
+	}
+	if fileExists(s.trashPath(username, id)) {
+		return s.DiskStorage.purgeTrashItem(username, id)
+	}
+	return nil
+}
+
+func (s *ObjectStorage) ListTrash(username string) ([]domain.TrashItem, error) {
+	if err := s.pushTrash(username); err != nil {
+		s.log.Errorw("uploading trash", "user", username, zap.Error(err))
+	}
+	remoteIDs := make(map[string]bool)
+	prefix := s.trashKey(username) + "/"
+	err := s.client.ListObjects(context.Background(), prefix, func(o s3.ObjectInfo) error {
+		if id, name, ok := strings.Cut(strings.TrimPrefix(o.Key, prefix), "/"); ok && name == "item.json" {
+			remoteIDs[id] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing trash: %w", err)
+	}
+	// remove local items which were purged (or restored) by other servers
+	entries, _ := os.ReadDir(s.trashPath(username))
+	for _, e := range entries {
+		if e.IsDir() && !remoteIDs[e.Name()] && s.trashItemUploaded(username, e.Name()) {
+			if err := s.DiskStorage.purgeTrashItem(username, e.Name()); err != nil {
+				s.log.Errorw("removing trash item", "user", username, "id", e.Name(), zap.Error(err))
+			}
+		}
+	}
+	items := make([]domain.TrashItem, 0, len(remoteIDs))
+	for id := range remoteIDs {
+		item, err := s.remoteTrashItem(username, id)
+		if err != nil {
+			if !errors.Is(err, domain.ErrTrashItemNotExists) {
+				s.log.Errorw("reading trash item", "user", username, "id", id, zap.Error(err))
+			}
+			continue
+		}
+		items = append(items, item.TrashItem)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Deleted.After(items[j].Deleted)
+	})
+	return items, nil
+}
+
+func (s *ObjectStorage) GetTrashItem(username, id string) (domain.TrashItem, error) {
+	item, err := s.remoteTrashItem(username, id)
+	return item.TrashItem, err
+}
+
+// RestoreTrash restores the project or files from the trash, item is downloaded from the object
+// storage when it was deleted on other server
+func (s *ObjectStorage) RestoreTrash(username, id string) (domain.TrashItem, error) {
+	item, err := s.GetTrashItem(username, id)
+	if err != nil {
+		return item, err
+	}
+	if err := s.pullTrashItem(username, id); err != nil {
+		return item, fmt.Errorf("downloading trash item: %w", err)
+	}
+	err = s.update(item.Project, func() (err error) {
+		item, err = s.DiskStorage.RestoreTrash(username, id)
+		return err
+	})
+	if err != nil {
+		return item, err
+	}
+	if err := s.deleteTrashItem(username, id); err != nil {
+		s.log.Errorw("removing restored trash item", "user", username, "id", id, zap.Error(err))
+	}
+	return item, nil
+}
+
+func (s *ObjectStorage) PurgeTrash(username string, ids ...string) error {
+	if len(ids) == 0 {
+		if err := s.client.DeletePrefix(context.Background(), s.trashKey(username)+"/"); err != nil {
+			return fmt.Errorf("removing trash: %w", err)
+		}
+		return s.DiskStorage.PurgeTrash(username)
+	}
+	for _, id := range ids {
+		if _, err := s.remoteTrashItem(username, id); err != nil {
+			return err
+		}
+		if err := s.deleteTrashItem(username, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeExpiredTrash removes expired items from the object storage (incomplete items are recognized
+// by the deletion time in the ID) and from the local trash
+func (s *ObjectStorage) PurgeExpiredTrash() (int, error) {
+	type itemKey struct{ username, id string }
+	expired := make(map[itemKey]bool)
+	now := time.Now()
+	prefix := path.Join(s.prefix, "trash") + "/"
+	err := s.client.ListObjects(context.Background(), prefix, func(o s3.ObjectInfo) error {
+		parts := strings.SplitN(strings.TrimPrefix(o.Key, prefix), "/", 3)
+		if len(parts) < 3 {
+			return nil
+		}
+		ts, err := strconv.ParseInt(parts[1], 10, 64)
+		if err == nil && now.Sub(time.Unix(0, ts)) >= s.TrashRetention {
+			expired[itemKey{parts[0], parts[1]}] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("listing trash: %w", err)
+	}
+	count := 0
+	for k := range expired {
+		if err := s.deleteTrashItem(k.username, k.id); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if _, err := s.DiskStorage.PurgeExpiredTrash(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+func (s *ObjectStorage) TrashUsage(username string) (int64, error) {
+	items, err := s.ListTrash(username)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, item := range items {
+		size += item.Size
+	}
+	return size, nil
+}
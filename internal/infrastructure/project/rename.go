@@ -0,0 +1,109 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/jellydator/ttlcache/v3"
+	"go.uber.org/zap"
+)
+
+// dashboardFile is the list of projects on the user's dashboard (<projects root>/<user>/dashboard.json)
+const dashboardFile = "dashboard.json"
+
+func (s *DiskStorage) Rename(oldName, newName string) error {
+	// both projects are locked (in consistent order) to wait for running updates/uploads
+	first, second := oldName, newName
+	if second < first {
+		first, second = second, first
+	}
+	unlockFirst := s.lockProject(first)
+	defer unlockFirst()
+	unlockSecond := s.lockProject(second)
+	defer unlockSecond()
+
+	if !s.CheckProjectExists(oldName) {
+		return domain.ErrProjectNotExists
+	}
+	if s.CheckProjectExists(newName) {
+		return domain.ErrProjectAlreadyExists
+	}
+	// scheduled version would be lost after moving of the project
+	s.flushVersion(oldName)
+	index, err := s.filesIndex(oldName)
+	if err != nil {
+		return err
+	}
+	src := filepath.Join(s.ProjectsRoot, oldName)
+	dest := filepath.Join(s.ProjectsRoot, newName)
+	if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return err
+	}
+	// evicted index is saved into the project directory, so it must be removed before moving
+	s.indexCache.Delete(oldName)
+	if err := os.Rename(src, dest); err != nil {
+		return fmt.Errorf("moving project directory: %w", err)
+	}
+	s.indexCache.Set(newName, index, ttlcache.DefaultTTL)
+	if err := saveJsonFile(filepath.Join(dest, ".gisquick", "filesmap.json"), index.Index); err != nil {
+		s.log.Errorw("saving files index", "project", newName, zap.Error(err))
+	}
+	if err := s.renameInDashboards(oldName, newName); err != nil {
+		s.log.Errorw("updating users dashboards", "project", oldName, zap.Error(err))
+	}
+	s.emit(domain.ProjectEvent{Type: domain.ProjectRenamedEvent, Project: oldName, NewName: newName})
+	return nil
+}
+
+// renameInDashboards replaces the project's name in dashboards of all users
+func (s *DiskStorage) renameInDashboards(oldName, newName string) error {
+	entries, err := os.ReadDir(s.ProjectsRoot)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(s.ProjectsRoot, entry.Name(), dashboardFile)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		var dashboard map[string]json.RawMessage
+		var projects []string
+		if err := json.Unmarshal(content, &dashboard); err != nil {
+			errs = append(errs, fmt.Errorf("parsing %s: %w", path, err))
+			continue
+		}
+		if err := json.Unmarshal(dashboard["projects"], &projects); err != nil {
+			continue
+		}
+		changed := false
+		for i, name := range projects {
+			if name == oldName {
+				projects[i] = newName
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		// other fields of the dashboard are preserved
+		if dashboard["projects"], err = json.Marshal(projects); err != nil {
+			return err
+		}
+		if err := saveJsonFile(path, dashboard); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
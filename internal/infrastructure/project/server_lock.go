@@ -0,0 +1,9 @@
+package project
+
+import "errors"
+
+// serverLockFile is locked by the running server within the projects root directory, so
+// offline commands modifying projects can detect it
+const serverLockFile = ".server.lock"
+
+var ErrServerRunning = errors.New("server is running")
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package project
+
+// LockServer is not supported on this platform
+func LockServer(root string) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+// LockOffline is not supported on this platform, running server is not detected
+func LockOffline(root string) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+func lockRoot(root string, how int) (func() error, error) {
+	if err := os.MkdirAll(root, 0775); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(root, serverLockFile), os.O_RDWR|os.O_CREATE, 0664)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrServerRunning
+		}
+		return nil, fmt.Errorf("locking projects root: %w", err)
+	}
+	// lock is released also when the process exits
+	return f.Close, nil
+}
+
+// LockServer marks the projects root directory as used by the running server. Shared lock is used,
+// so multiple server instances can use the same directory.
+func LockServer(root string) (func() error, error) {
+	return lockRoot(root, syscall.LOCK_SH)
+}
+
+// LockOffline acquires exclusive access to the projects root directory for commands which
+// modify projects outside of the server, fails with ErrServerRunning when the server is running.
+func LockOffline(root string) (func() error, error) {
+	return lockRoot(root, syscall.LOCK_EX)
+}
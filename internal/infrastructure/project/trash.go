@@ -0,0 +1,376 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Deleted projects and removed project files are moved into the owner's trash directory:
+//
+//	<user>/.trash/<id>/item.json  trash item info with the files index (for releasing of blobs)
+//	<user>/.trash/<id>/data       project directory or removed files (with their project paths)
+//
+// Item ID is the deletion time (unix nanoseconds). Items are removed permanently when purged
+// or after the TrashRetention period.
+
+const DefaultTrashRetention = 7 * 24 * time.Hour
+
+type trashItemData struct {
+	domain.TrashItem
+	Index map[string]domain.FileInfo `json:"index"`
+}
+
+func (s *DiskStorage) trashPath(username string, elem ...string) string {
+	return filepath.Join(append([]string{s.ProjectsRoot, username, ".trash"}, elem...)...)
+}
+
+func (s *DiskStorage) trashEnabled() bool {
+	return s.TrashRetention > 0
+}
+
+// newTrashItem creates directory of the new trash item
+func (s *DiskStorage) newTrashItem(itemType, projectName string) (*trashItemData, error) {
+	username := strings.Split(projectName, "/")[0]
+	if err := os.MkdirAll(s.trashPath(username), 0775); err != nil {
+		return nil, fmt.Errorf("creating trash directory: %w", err)
+	}
+	now := time.Now()
+	for {
+		id := strconv.FormatInt(now.UnixNano(), 10)
+		err := os.Mkdir(s.trashPath(username, id), 0775)
+		if err == nil {
+			item := domain.TrashItem{ID: id, Type: itemType, Project: projectName, Deleted: now.UTC()}
+			return &trashItemData{TrashItem: item, Index: make(map[string]domain.FileInfo)}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("creating trash item: %w", err)
+		}
+		now = now.Add(time.Nanosecond)
+	}
+}
+
+func (s *DiskStorage) saveTrashItem(item *trashItemData) error {
+	username := strings.Split(item.Project, "/")[0]
+	return saveJsonFile(s.trashPath(username, item.ID, "item.json"), item)
+}
+
+func (s *DiskStorage) readTrashItem(username, id string) (trashItemData, error) {
+	var item trashItemData
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return item, domain.ErrTrashItemNotExists
+	}
+	content, err := os.ReadFile(s.trashPath(username, id, "item.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return item, domain.ErrTrashItemNotExists
+		}
+		return item, err
+	}
+	if err := json.Unmarshal(content, &item); err != nil {
+		return item, fmt.Errorf("parsing trash item: %w", err)
+	}
+	item.ID = id
+	item.Expires = item.Deleted.Add(s.TrashRetention)
+	return item, nil
+}
+
+// trashProject moves the whole project directory into the trash
+func (s *DiskStorage) trashProject(projectName string, files map[string]domain.FileInfo) error {
+	pInfo, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		s.log.Errorw("reading project info", "project", projectName, zap.Error(err))
+	}
+	item, err := s.newTrashItem(domain.TrashProject, projectName)
+	if err != nil {
+		return err
+	}
+	item.Size = pInfo.Size
+	item.Index = files
+	itemDir := s.trashPath(strings.Split(projectName, "/")[0], item.ID)
+	if err := s.saveTrashItem(item); err != nil {
+		os.RemoveAll(itemDir)
+		return fmt.Errorf("saving trash item: %w", err)
+	}
+	if err := os.Rename(filepath.Join(s.ProjectsRoot, projectName), filepath.Join(itemDir, "data")); err != nil {
+		os.RemoveAll(itemDir)
+		return fmt.Errorf("moving project into trash: %w", err)
+	}
+	return nil
+}
+
+// trashFile moves the project file or directory into the trash item, files are info of
+// the moved files from the files index
+func (s *DiskStorage) trashFile(item *trashItemData, path string, files map[string]domain.FileInfo) error {
+	username := strings.Split(item.Project, "/")[0]
+	dest := s.trashPath(username, item.ID, "data", path)
+	if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(s.ProjectsRoot, item.Project, path), dest); err != nil {
+		return err
+	}
+	item.Files = append(item.Files, path)
+	for p, info := range files {
+		item.Index[p] = info
+		item.Size += info.Size
+	}
+	return nil
+}
+
+func (s *DiskStorage) ListTrash(username string) ([]domain.TrashItem, error) {
+	entries, err := os.ReadDir(s.trashPath(username))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []domain.TrashItem{}, nil
+		}
+		return nil, fmt.Errorf("listing trash: %w", err)
+	}
+	items := make([]domain.TrashItem, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		item, err := s.readTrashItem(username, e.Name())
+		if err != nil {
+			if !errors.Is(err, domain.ErrTrashItemNotExists) {
+				s.log.Errorw("reading trash item", "user", username, "id", e.Name(), zap.Error(err))
+			}
+			continue
+		}
+		items = append(items, item.TrashItem)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Deleted.After(items[j].Deleted)
+	})
+	return items, nil
+}
+
+func (s *DiskStorage) GetTrashItem(username, id string) (domain.TrashItem, error) {
+	item, err := s.readTrashItem(username, id)
+	return item.TrashItem, err
+}
+
+func (s *DiskStorage) RestoreTrash(username, id string) (domain.TrashItem, error) {
+	item, err := s.readTrashItem(username, id)
+	if err != nil {
+		return item.TrashItem, err
+	}
+	if item.Type == domain.TrashProject {
+		err = s.restoreProject(item)
+	} else {
+		err = s.restoreFiles(item)
+	}
+	if err != nil {
+		return item.TrashItem, err
+	}
+	if err := os.RemoveAll(s.trashPath(username, id)); err != nil {
+		s.log.Errorw("removing trash item", "user", username, "id", id, zap.Error(err))
+	}
+	return item.TrashItem, nil
+}
+
+func (s *DiskStorage) restoreProject(item trashItemData) error {
+	unlock := s.lockProject(item.Project)
+	defer unlock()
+	if s.CheckProjectExists(item.Project) {
+		return domain.ErrProjectAlreadyExists
+	}
+	username := strings.Split(item.Project, "/")[0]
+	dest := filepath.Join(s.ProjectsRoot, item.Project)
+	if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return err
+	}
+	// remove (empty) directory which could be left by unsuccessful creation of the project
+	os.Remove(dest)
+	if err := os.Rename(s.trashPath(username, item.ID, "data"), dest); err != nil {
+		return fmt.Errorf("restoring project from trash: %w", err)
+	}
+	// index could be cached for other project with the same name
+	s.indexCache.Delete(item.Project)
+	return nil
+}
+
+// restoreFiles moves files back into the project, already restored files are moved back into
+// the trash when restoring fails
+func (s *DiskStorage) restoreFiles(item trashItemData) error {
+	projectName := item.Project
+	unlock := s.lockProject(projectName)
+	defer unlock()
+	if !s.CheckProjectExists(projectName) {
+		return domain.ErrProjectNotExists
+	}
+	project, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	index, err := s.filesIndex(projectName)
+	if err != nil {
+		return err
+	}
+	for _, path := range item.Files {
+		if fileExists(filepath.Join(s.ProjectsRoot, projectName, path)) {
+			return domain.ErrTrashConflict
+		}
+	}
+	s.initVersions(projectName)
+	username := strings.Split(projectName, "/")[0]
+
+	// operations reverting already applied changes, executed in reverse order on failure
+	var undo []func() error
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				s.log.Errorw("reverting restored files", "project", projectName, zap.Error(err))
+			}
+		}
+	}
+	saveIndex := func() error {
+		index.RLock()
+		defer index.RUnlock()
+		return saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index.Index)
+	}
+	for _, path := range item.Files {
+		src := s.trashPath(username, item.ID, "data", path)
+		dest := filepath.Join(s.ProjectsRoot, projectName, path)
+		if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+			rollback()
+			return fmt.Errorf("creating directory: %w", err)
+		}
+		if err := os.Rename(src, dest); err != nil {
+			rollback()
+			return fmt.Errorf("restoring file %s: %w", path, err)
+		}
+		undo = append(undo, func() error { return os.Rename(dest, src) })
+		dirPrefix := strings.TrimSuffix(path, "/") + "/"
+		for p, info := range item.Index {
+			if p == path || strings.HasPrefix(p, dirPrefix) {
+				p := p
+				prev, indexed := index.Get(p)
+				index.Set(p, info)
+				undo = append(undo, func() error {
+					if indexed {
+						index.Set(p, prev)
+					} else {
+						index.Delete(p)
+					}
+					return nil
+				})
+			}
+		}
+	}
+	if err := saveIndex(); err != nil {
+		rollback()
+		return fmt.Errorf("saving files index: %w", err)
+	}
+	project.Size = index.TotalSize()
+	if err := s.saveConfigFile(projectName, "project.json", project); err != nil {
+		rollback()
+		if err := saveIndex(); err != nil {
+			s.log.Errorw("reverting files index", "project", projectName, zap.Error(err))
+		}
+		return fmt.Errorf("updating project file: %w", err)
+	}
+	s.emit(domain.ProjectEvent{Type: domain.FilesChangedEvent, Project: projectName, Files: item.Files})
+	s.saveVersion(projectName, domain.FilesVersionChange)
+	return nil
+}
+
+// purgeTrashItem permanently removes the trash item and releases blobs of its files
+func (s *DiskStorage) purgeTrashItem(username, id string) error {
+	item, err := s.readTrashItem(username, id)
+	if err != nil && !errors.Is(err, domain.ErrTrashItemNotExists) {
+		s.log.Errorw("reading trash item", "user", username, "id", id, zap.Error(err))
+	}
+	if err := os.RemoveAll(s.trashPath(username, id)); err != nil {
+		return fmt.Errorf("removing trash item: %w", err)
+	}
+	s.releaseFiles(filesList(item.Index)...)
+	return nil
+}
+
+func (s *DiskStorage) PurgeTrash(username string, ids ...string) error {
+	if len(ids) == 0 {
+		entries, err := os.ReadDir(s.trashPath(username))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("listing trash: %w", err)
+		}
+		for _, e := range entries {
+			if err := s.purgeTrashItem(username, e.Name()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, id := range ids {
+		if _, err := s.readTrashItem(username, id); err != nil {
+			return err
+		}
+		if err := s.purgeTrashItem(username, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeExpiredTrash removes trash items older than TrashRetention (all items when the trash
+// is disabled), incomplete items are recognized by the deletion time in the ID.
+func (s *DiskStorage) PurgeExpiredTrash() (int, error) {
+	users, err := os.ReadDir(s.ProjectsRoot)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("listing accounts: %w", err)
+	}
+	count := 0
+	now := time.Now()
+	for _, u := range users {
+		if !u.IsDir() || strings.HasPrefix(u.Name(), ".") {
+			continue
+		}
+		username := u.Name()
+		entries, err := os.ReadDir(s.trashPath(username))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			ts, err := strconv.ParseInt(e.Name(), 10, 64)
+			if err != nil {
+				continue
+			}
+			if now.Sub(time.Unix(0, ts)) < s.TrashRetention {
+				continue
+			}
+			if err := s.purgeTrashItem(username, e.Name()); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *DiskStorage) TrashUsage(username string) (int64, error) {
+	items, err := s.ListTrash(username)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, item := range items {
+		size += item.Size
+	}
+	return size, nil
+}
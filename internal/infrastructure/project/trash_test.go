@@ -0,0 +1,212 @@
+package project
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+func singleTrashItem(t *testing.T, s *DiskStorage, username string) domain.TrashItem {
+	t.Helper()
+	items, err := s.ListTrash(username)
+	if err != nil {
+		t.Fatalf("listing trash: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected 1 trash item, got %d", len(items))
+	}
+	return items[0]
+}
+
+func TestTrashRestoreProject(t *testing.T) {
+	s := newTestStorage(t)
+	files := map[string]string{"project.qgs": "<qgis/>", "data/layer.gpkg": "data"}
+	createTestProject(t, s, "user1/project", files)
+	if err := s.Delete("user1/project"); err != nil {
+		t.Fatal(err)
+	}
+	if s.CheckProjectExists("user1/project") {
+		t.Fatal("deleted project still exists")
+	}
+	item := singleTrashItem(t, s, "user1")
+	if item.Type != domain.TrashProject || item.Project != "user1/project" || item.Size != 11 {
+		t.Errorf("unexpected trash item: %+v", item)
+	}
+
+	if _, err := s.RestoreTrash("user1", item.ID); err != nil {
+		t.Fatalf("restoring project: %v", err)
+	}
+	for path, content := range files {
+		if c := readProjectFile(t, s, "user1/project", path); c != content {
+			t.Errorf("%s: %q, expected %q", path, c, content)
+		}
+	}
+	if items, _ := s.ListTrash("user1"); len(items) != 0 {
+		t.Errorf("restored item is still in the trash: %v", items)
+	}
+}
+
+func TestTrashRestoreProjectConflict(t *testing.T) {
+	s := newTestStorage(t)
+	createTestProject(t, s, "user1/project", map[string]string{"project.qgs": "<qgis/>"})
+	if err := s.Delete("user1/project"); err != nil {
+		t.Fatal(err)
+	}
+	item := singleTrashItem(t, s, "user1")
+	createTestProject(t, s, "user1/project", map[string]string{"project.qgs": "<qgis version='new'/>"})
+
+	if _, err := s.RestoreTrash("user1", item.ID); !errors.Is(err, domain.ErrProjectAlreadyExists) {
+		t.Fatalf("expected ErrProjectAlreadyExists, got %v", err)
+	}
+	if c := readProjectFile(t, s, "user1/project", "project.qgs"); c != "<qgis version='new'/>" {
+		t.Errorf("existing project was modified: %q", c)
+	}
+	singleTrashItem(t, s, "user1")
+}
+
+func TestTrashRestoreFiles(t *testing.T) {
+	s := newTestStorage(t)
+	createTestProject(t, s, "user1/project", map[string]string{
+		"project.qgs":    "<qgis/>",
+		"style.qml":      "style",
+		"data/a.geojson": "a",
+		"data/b.geojson": "b",
+	})
+	uploadFiles(t, s, "user1/project", 1700000100, nil, "style.qml", "data")
+	item := singleTrashItem(t, s, "user1")
+	if item.Type != domain.TrashFiles || len(item.Files) != 2 || item.Size != 7 {
+		t.Errorf("unexpected trash item: %+v", item)
+	}
+
+	tests := []struct {
+		name     string
+		conflict string
+		err      error
+	}{
+		{"conflict", "style.qml", domain.ErrTrashConflict},
+		{"restored", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.conflict != "" {
+				uploadFiles(t, s, "user1/project", 1700000200, map[string]string{tt.conflict: "new"})
+				defer uploadFiles(t, s, "user1/project", 1700000300, nil, tt.conflict)
+			}
+			_, err := s.RestoreTrash("user1", item.ID)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	index, err := s.filesIndex("user1/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{"style.qml": "style", "data/a.geojson": "a", "data/b.geojson": "b"} {
+		if c := readProjectFile(t, s, "user1/project", path); c != content {
+			t.Errorf("%s: %q, expected %q", path, c, content)
+		}
+		if info, ok := index.Get(path); !ok || info.Size != int64(len(content)) {
+			t.Errorf("%s not restored in the files index: %+v", path, info)
+		}
+	}
+	pInfo, err := s.GetProjectInfo("user1/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pInfo.Size != index.TotalSize() {
+		t.Errorf("project size: %d, expected %d", pInfo.Size, index.TotalSize())
+	}
+}
+
+func TestTrashRestoreFilesRollback(t *testing.T) {
+	s := newTestStorage(t)
+	createTestProject(t, s, "user1/project", map[string]string{
+		"project.qgs": "<qgis/>",
+		"a.txt":       "a",
+		"b.txt":       "b",
+	})
+	uploadFiles(t, s, "user1/project", 1700000100, nil, "a.txt", "b.txt")
+	item := singleTrashItem(t, s, "user1")
+	// second file can't be restored
+	if err := os.Remove(s.trashPath("user1", item.ID, "data", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RestoreTrash("user1", item.ID); err == nil {
+		t.Fatal("expected error")
+	}
+	if fileExists(filepath.Join(s.ProjectsRoot, "user1/project", "a.txt")) {
+		t.Error("partially restored file was not moved back into the trash")
+	}
+	if !fileExists(s.trashPath("user1", item.ID, "data", "a.txt")) {
+		t.Error("file is missing in the trash")
+	}
+	index, err := s.filesIndex("user1/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index.Get("a.txt"); ok {
+		t.Error("files index was not reverted")
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s := newTestStorage(t)
+	for _, name := range []string{"user1/p1", "user1/p2", "user1/p3"} {
+		createTestProject(t, s, name, map[string]string{"project.qgs": "<qgis/>"})
+		if err := s.Delete(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := s.ListTrash("user1")
+	if err != nil || len(items) != 3 {
+		t.Fatalf("expected 3 trash items, got %d (%v)", len(items), err)
+	}
+
+	if err := s.PurgeTrash("user1", items[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetTrashItem("user1", items[0].ID); !errors.Is(err, domain.ErrTrashItemNotExists) {
+		t.Errorf("purged item still exists: %v", err)
+	}
+	if err := s.PurgeTrash("user1", "unknown"); !errors.Is(err, domain.ErrTrashItemNotExists) {
+		t.Errorf("expected ErrTrashItemNotExists, got %v", err)
+	}
+
+	count, err := s.PurgeExpiredTrash()
+	if err != nil || count != 0 {
+		t.Errorf("purged %d items before expiration (%v)", count, err)
+	}
+	s.TrashRetention = time.Nanosecond
+	count, err = s.PurgeExpiredTrash()
+	if err != nil || count != 2 {
+		t.Errorf("purged %d expired items, expected 2 (%v)", count, err)
+	}
+	if usage, err := s.TrashUsage("user1"); err != nil || usage != 0 {
+		t.Errorf("trash usage after purge: %d (%v)", usage, err)
+	}
+}
+
+func TestPurgeTrashAll(t *testing.T) {
+	s := newTestStorage(t)
+	createTestProject(t, s, "user1/project", map[string]string{"project.qgs": "<qgis/>", "a.txt": "a"})
+	uploadFiles(t, s, "user1/project", 1700000100, nil, "a.txt")
+	if err := s.Delete("user1/project"); err != nil {
+		t.Fatal(err)
+	}
+	if usage, err := s.TrashUsage("user1"); err != nil || usage != int64(len("<qgis/>")+1) {
+		t.Errorf("trash usage: %d (%v)", usage, err)
+	}
+	if err := s.PurgeTrash("user1"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(s.trashPath("user1")); len(entries) != 0 {
+		t.Errorf("trash is not empty: %v", entries)
+	}
+}
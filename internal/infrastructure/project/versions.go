@@ -0,0 +1,566 @@
+package project
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Project versions are stored in the project's .gisquick/versions directory:
+//
+//	objects/<key>      content of the project files (shared by all versions)
+//	<id>/version.json  version info with the list of files
+//	<id>/*.json        copies of the project's configuration files
+//
+// Objects are copies of the project files. They never share the inode with the live files, which
+// can be modified in place (e.g. data files edited by the map server), so the history can't be
+// changed afterwards. Unchanged files are stored only once, objects are shared by all versions.
+
+const DefaultMaxVersions = 10
+
+// DefaultVersionDelay is the default period in which all changes of the project (e.g. files,
+// settings and metadata of a single publish) are recorded as a single version
+const DefaultVersionDelay = 30 * time.Second
+
+// pendingVersion collects changes of the project, which will be recorded in a single version
+type pendingVersion struct {
+	timer   *time.Timer
+	changes []string
+}
+
+var versionedConfigFiles = []string{"project.json", "qgis.json", "settings.json", "scripts.json"}
+
+type versionFile struct {
+	domain.FileInfo
+	Object string `json:"object"`
+}
+
+type versionData struct {
+	domain.ProjectVersion
+	Manifest map[string]versionFile `json:"manifest"`
+}
+
+func (s *DiskStorage) versionsPath(projectName string, elem ...string) string {
+	return filepath.Join(append([]string{s.ProjectsRoot, projectName, ".gisquick", "versions"}, elem...)...)
+}
+
+func objectKey(hash string, size, mtime int64) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s:%d:%d", hash, size, mtime)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// copyFile copies file through temporary file, so the destination file is never incomplete
+func copyFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmpPath := dest + ".tmp"
+	if err := saveToFile(in, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, dest)
+}
+
+// versionIDs returns sorted IDs of the project's versions
+func (s *DiskStorage) versionIDs(projectName string) ([]int, error) {
+	entries, err := os.ReadDir(s.versionsPath(projectName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []int
+	for _, e := range entries {
+		if id, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *DiskStorage) readVersion(projectName string, id int) (versionData, error) {
+	var v versionData
+	content, err := os.ReadFile(s.versionsPath(projectName, strconv.Itoa(id), "version.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return v, domain.ErrVersionNotExists
+		}
+		return v, err
+	}
+	if err := json.Unmarshal(content, &v); err != nil {
+		return v, fmt.Errorf("parsing version file: %w", err)
+	}
+	return v, nil
+}
+
+func (s *DiskStorage) ListVersions(projectName string) ([]domain.ProjectVersion, error) {
+	if !s.CheckProjectExists(projectName) {
+		return nil, domain.ErrProjectNotExists
+	}
+	ids, err := s.versionIDs(projectName)
+	if err != nil {
+		return nil, fmt.Errorf("listing project versions: %w", err)
+	}
+	versions := make([]domain.ProjectVersion, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		v, err := s.readVersion(projectName, ids[i])
+		if err != nil {
+			s.log.Errorw("reading project version", "project", projectName, "version", ids[i], zap.Error(err))
+			continue
+		}
+		versions = append(versions, v.ProjectVersion)
+	}
+	return versions, nil
+}
+
+// createVersion records the current state of the project (versionsLock must be held)
+func (s *DiskStorage) createVersion(projectName, change string) error {
+	index, err := s.filesIndex(projectName)
+	if err != nil {
+		return err
+	}
+	ids, err := s.versionIDs(projectName)
+	if err != nil {
+		return fmt.Errorf("listing project versions: %w", err)
+	}
+	id := 1
+	if len(ids) > 0 {
+		id = ids[len(ids)-1] + 1
+	}
+	tmpDir := s.versionsPath(projectName, fmt.Sprintf(".new-%d", id))
+	if err := os.MkdirAll(tmpDir, 0775); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	v := versionData{
+		ProjectVersion: domain.ProjectVersion{ID: id, Created: time.Now().UTC(), Change: change},
+		Manifest:       make(map[string]versionFile),
+	}
+	index.RLock()
+	files := make(map[string]domain.FileInfo, len(index.Index))
+	for path, info := range index.Index {
+		files[path] = info
+	}
+	index.RUnlock()
+	for path, info := range files {
+		absPath := filepath.Join(s.ProjectsRoot, projectName, path)
+		fStat, err := os.Stat(absPath)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		key := objectKey(info.Hash, fStat.Size(), fStat.ModTime().Unix())
+		objPath := s.versionsPath(projectName, "objects", key)
+		if !fileExists(objPath) {
+			if err := copyFile(absPath, objPath); err != nil {
+				return fmt.Errorf("saving file %s: %w", path, err)
+			}
+		}
+		v.Manifest[path] = versionFile{FileInfo: info, Object: key}
+		v.Size += info.Size
+		v.Files++
+	}
+	for _, name := range versionedConfigFiles {
+		src := filepath.Join(s.ProjectsRoot, projectName, ".gisquick", name)
+		if !fileExists(src) {
+			continue
+		}
+		if err := copyFile(src, filepath.Join(tmpDir, name)); err != nil {
+			return fmt.Errorf("saving config file %s: %w", name, err)
+		}
+	}
+	if err := saveJsonFile(filepath.Join(tmpDir, "version.json"), v); err != nil {
+		return fmt.Errorf("saving version file: %w", err)
+	}
+	if err := os.Rename(tmpDir, s.versionsPath(projectName, strconv.Itoa(id))); err != nil {
+		return err
+	}
+	return s.pruneVersions(projectName, append(ids, id))
+}
+
+// pruneVersions removes the oldest versions over the limit and unreferenced objects
+func (s *DiskStorage) pruneVersions(projectName string, ids []int) error {
+	if s.MaxVersions <= 0 || len(ids) <= s.MaxVersions {
+		return nil
+	}
+	for _, id := range ids[:len(ids)-s.MaxVersions] {
+		if err := os.RemoveAll(s.versionsPath(projectName, strconv.Itoa(id))); err != nil {
+			return err
+		}
+	}
+	used := make(map[string]bool)
+	for _, id := range ids[len(ids)-s.MaxVersions:] {
+		v, err := s.readVersion(projectName, id)
+		if err != nil {
+			// keep all objects, rather than removing data of the broken version
+			return fmt.Errorf("reading project version %d: %w", id, err)
+		}
+		for _, f := range v.Manifest {
+			used[f.Object] = true
+		}
+	}
+	entries, err := os.ReadDir(s.versionsPath(projectName, "objects"))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !used[e.Name()] {
+			if err := os.Remove(s.versionsPath(projectName, "objects", e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// versionsUsage returns size of the version objects
+func (s *DiskStorage) versionsUsage(projectName string) (int64, error) {
+	entries, err := os.ReadDir(s.versionsPath(projectName, "objects"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var size int64
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size, nil
+}
+
+// initVersions records the current state of the project, when it doesn't have any version yet
+// (projects published before versioning). Project lock must be held.
+func (s *DiskStorage) initVersions(projectName string) {
+	s.pendingLock.Lock()
+	_, pending := s.pendingVersions[projectName]
+	s.pendingLock.Unlock()
+	if pending {
+		return
+	}
+	s.versionsLock.Lock()
+	defer s.versionsLock.Unlock()
+	ids, err := s.versionIDs(projectName)
+	if err != nil || len(ids) > 0 {
+		return
+	}
+	pInfo, err := s.GetProjectInfo(projectName)
+	if err != nil || pInfo.State == "empty" {
+		return
+	}
+	if err := s.createVersion(projectName, domain.InitialVersionChange); err != nil {
+		s.log.Errorw("creating project version", "project", projectName, zap.Error(err))
+	}
+}
+
+// saveVersion schedules recording of the project's change. All changes made within the version
+// delay are recorded as a single version. Project lock must be held.
+func (s *DiskStorage) saveVersion(projectName, change string) {
+	if s.VersionDelay <= 0 {
+		s.versionsLock.Lock()
+		defer s.versionsLock.Unlock()
+		if err := s.createVersion(projectName, change); err != nil {
+			s.log.Errorw("creating project version", "project", projectName, zap.Error(err))
+		}
+		return
+	}
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	if s.pendingVersions == nil {
+		s.pendingVersions = make(map[string]*pendingVersion)
+	}
+	p, ok := s.pendingVersions[projectName]
+	if !ok {
+		p = &pendingVersion{}
+		p.timer = time.AfterFunc(s.VersionDelay, func() {
+			unlock := s.lockProject(projectName)
+			defer unlock()
+			s.flushVersion(projectName)
+		})
+		s.pendingVersions[projectName] = p
+	}
+	for _, c := range p.changes {
+		if c == change {
+			return
+		}
+	}
+	p.changes = append(p.changes, change)
+}
+
+// takePendingVersion removes scheduled version of the project, returns its changes
+func (s *DiskStorage) takePendingVersion(projectName string) ([]string, bool) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	p, ok := s.pendingVersions[projectName]
+	if !ok {
+		return nil, false
+	}
+	p.timer.Stop()
+	delete(s.pendingVersions, projectName)
+	return p.changes, true
+}
+
+// flushVersion immediately records scheduled version of the project. Project lock must be held.
+func (s *DiskStorage) flushVersion(projectName string) {
+	changes, ok := s.takePendingVersion(projectName)
+	if !ok || !s.CheckProjectExists(projectName) {
+		return
+	}
+	s.versionsLock.Lock()
+	defer s.versionsLock.Unlock()
+	if err := s.createVersion(projectName, strings.Join(changes, ",")); err != nil {
+		s.log.Errorw("creating project version", "project", projectName, zap.Error(err))
+	}
+}
+
+// flushVersions records all scheduled versions (e.g. before shutdown)
+func (s *DiskStorage) flushVersions() {
+	s.pendingLock.Lock()
+	projects := make([]string, 0, len(s.pendingVersions))
+	for projectName := range s.pendingVersions {
+		projects = append(projects, projectName)
+	}
+	s.pendingLock.Unlock()
+	for _, projectName := range projects {
+		unlock := s.lockProject(projectName)
+		s.flushVersion(projectName)
+		unlock()
+	}
+}
+
+// RestoreVersion restores project's files and configuration from the given version. All data
+// are prepared in the staging directory first, replaced files are moved into the backup directory,
+// so the project can be reverted into the original state when restoring fails.
+func (s *DiskStorage) RestoreVersion(projectName string, id int) error {
+	unlock := s.lockProject(projectName)
+	defer unlock()
+	// record pending changes, so the current state can be restored again
+	s.flushVersion(projectName)
+	s.versionsLock.Lock()
+	defer s.versionsLock.Unlock()
+	pInfo, err := s.GetProjectInfo(projectName)
+	if err != nil {
+		return err
+	}
+	v, err := s.readVersion(projectName, id)
+	if err != nil {
+		return err
+	}
+	index, err := s.filesIndex(projectName)
+	if err != nil {
+		return err
+	}
+	versionDir := s.versionsPath(projectName, strconv.Itoa(id))
+	staging := s.versionsPath(projectName, fmt.Sprintf(".restore-%d", time.Now().UnixNano()))
+	defer os.RemoveAll(staging)
+
+	current := index.GetFiles(indexPaths(index)...)
+	var updated, removed []string
+	for path, f := range v.Manifest {
+		if cur, ok := current[path]; ok && cur == f.FileInfo {
+			continue
+		}
+		src := s.versionsPath(projectName, "objects", f.Object)
+		dest := filepath.Join(staging, "files", path)
+		// objects are copied, restored files must not share the inode with the history
+		if err := copyFile(src, dest); err != nil {
+			return fmt.Errorf("restoring file %s: %w", path, err)
+		}
+		mtime := time.Unix(f.Mtime, 0)
+		if err := os.Chtimes(dest, mtime, mtime); err != nil {
+			s.log.Errorw("updating file's modification time", zap.Error(err))
+		}
+		updated = append(updated, path)
+	}
+	for path := range current {
+		// media files uploaded from the web application are not managed by publishing
+		if _, ok := v.Manifest[path]; !ok && !strings.HasPrefix(path, "web/") {
+			removed = append(removed, path)
+		}
+	}
+	var versionInfo domain.ProjectInfo
+	for _, name := range versionedConfigFiles {
+		src := filepath.Join(versionDir, name)
+		if !fileExists(src) {
+			continue
+		}
+		if name == "project.json" {
+			content, err := os.ReadFile(src)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(content, &versionInfo); err != nil {
+				return fmt.Errorf("parsing project file of the version: %w", err)
+			}
+			continue
+		}
+		if err := copyFile(src, filepath.Join(staging, name)); err != nil {
+			return fmt.Errorf("restoring config file %s: %w", name, err)
+		}
+	}
+
+	// operations reverting already applied changes, executed in reverse order on failure
+	var undo []func() error
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				s.log.Errorw("reverting restored project version", "project", projectName, zap.Error(err))
+			}
+		}
+	}
+	backup := filepath.Join(staging, "backup")
+	// moveFile moves the file (if exists) and records the reverse operation
+	moveFile := func(src, dest string) error {
+		if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dest); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		undo = append(undo, func() error { return os.Rename(dest, src) })
+		return nil
+	}
+	apply := func() error {
+		for _, path := range updated {
+			absPath := filepath.Join(s.ProjectsRoot, projectName, path)
+			if err := moveFile(absPath, filepath.Join(backup, "files", path)); err != nil {
+				return fmt.Errorf("restoring file %s: %w", path, err)
+			}
+			if err := moveFile(filepath.Join(staging, "files", path), absPath); err != nil {
+				return fmt.Errorf("restoring file %s: %w", path, err)
+			}
+		}
+		for _, path := range removed {
+			absPath := filepath.Join(s.ProjectsRoot, projectName, path)
+			if err := moveFile(absPath, filepath.Join(backup, "files", path)); err != nil {
+				return fmt.Errorf("removing project file %s: %w", path, err)
+			}
+		}
+		for _, name := range versionedConfigFiles[1:] {
+			dest := filepath.Join(s.ProjectsRoot, projectName, ".gisquick", name)
+			if err := moveFile(dest, filepath.Join(backup, name)); err != nil {
+				return fmt.Errorf("restoring config file %s: %w", name, err)
+			}
+			if err := moveFile(filepath.Join(staging, name), dest); err != nil {
+				return fmt.Errorf("restoring config file %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+	if err := apply(); err != nil {
+		rollback()
+		return err
+	}
+	changedFiles := append(append([]string{}, updated...), removed...)
+
+	for _, path := range updated {
+		index.Set(path, v.Manifest[path].FileInfo)
+	}
+	for _, path := range removed {
+		index.Delete(path)
+	}
+	revertIndex := func() {
+		for _, path := range changedFiles {
+			if prev, ok := current[path]; ok {
+				index.Set(path, prev)
+			} else {
+				index.Delete(path)
+			}
+		}
+		index.RLock()
+		err := saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index.Index)
+		index.RUnlock()
+		if err != nil {
+			s.log.Errorw("reverting files index", "project", projectName, zap.Error(err))
+		}
+	}
+	index.RLock()
+	err = saveJsonFile(filepath.Join(s.ProjectsRoot, projectName, ".gisquick", "filesmap.json"), index.Index)
+	index.RUnlock()
+	if err != nil {
+		rollback()
+		revertIndex()
+		return fmt.Errorf("saving files index: %w", err)
+	}
+	prevInfo := pInfo
+	pInfo.QgisFile = versionInfo.QgisFile
+	pInfo.Projection = versionInfo.Projection
+	pInfo.Title = versionInfo.Title
+	pInfo.Authentication = versionInfo.Authentication
+	pInfo.Mapcache = versionInfo.Mapcache
+	pInfo.State = versionInfo.State
+	pInfo.Size = index.TotalSize()
+	pInfo.LastUpdate = time.Now().UTC()
+	if err := s.saveConfigFile(projectName, "project.json", pInfo); err != nil {
+		rollback()
+		revertIndex()
+		if err := s.saveConfigFile(projectName, "project.json", prevInfo); err != nil {
+			s.log.Errorw("reverting project file", "project", projectName, zap.Error(err))
+		}
+		return fmt.Errorf("updating project file: %w", err)
+	}
+
+	var releasedFiles []domain.FileInfo
+	for _, path := range changedFiles {
+		if prev, ok := current[path]; ok {
+			releasedFiles = append(releasedFiles, prev)
+		}
+	}
+	// backup must be removed before releasing of the blobs, it holds links of the replaced files
+	os.RemoveAll(backup)
+	s.releaseFiles(releasedFiles...)
+	if len(changedFiles) > 0 {
+		s.emit(domain.ProjectEvent{Type: domain.FilesChangedEvent, Project: projectName, Files: changedFiles})
+	}
+	s.emit(domain.ProjectEvent{Type: domain.MetaChangedEvent, Project: projectName})
+	s.emit(domain.ProjectEvent{Type: domain.SettingsChangedEvent, Project: projectName})
+	if err := s.createVersion(projectName, domain.RollbackVersionChange); err != nil {
+		s.log.Errorw("creating project version", "project", projectName, zap.Error(err))
+	}
+	return nil
+}
+
+func filesList(files map[string]domain.FileInfo) []domain.FileInfo {
+	list := make([]domain.FileInfo, 0, len(files))
+	for _, f := range files {
+		list = append(list, f)
+	}
+	return list
+}
+
+func indexPaths(index *FilesIndex) []string {
+	index.RLock()
+	defer index.RUnlock()
+	paths := make([]string, 0, len(index.Index))
+	for path := range index.Index {
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -0,0 +1,215 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+func versionIDsList(t *testing.T, s *DiskStorage, projectName string) []int {
+	t.Helper()
+	versions, err := s.ListVersions(projectName)
+	if err != nil {
+		t.Fatalf("listing versions: %v", err)
+	}
+	ids := make([]int, len(versions))
+	for i, v := range versions {
+		ids[i] = v.ID
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestCreateVersion(t *testing.T) {
+	s := newTestStorage(t)
+	createTestProject(t, s, "user1/project", map[string]string{
+		"project.qgs": "<qgis/>",
+		"data.gpkg":   "original data",
+	})
+	v, err := s.readVersion("user1/project", 1)
+	if err != nil {
+		t.Fatalf("reading version: %v", err)
+	}
+	if v.Files != 2 || v.Change != domain.FilesVersionChange {
+		t.Errorf("unexpected version: %+v", v.ProjectVersion)
+	}
+	for path, f := range v.Manifest {
+		objPath := s.versionsPath("user1/project", "objects", f.Object)
+		oStat, err := os.Stat(objPath)
+		if err != nil {
+			t.Fatalf("object of %s: %v", path, err)
+		}
+		fStat, err := os.Stat(filepath.Join(s.ProjectsRoot, "user1/project", path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os.SameFile(oStat, fStat) {
+			t.Errorf("object of %s shares the file with the project", path)
+		}
+	}
+	if !fileExists(s.versionsPath("user1/project", "1", "qgis.json")) {
+		t.Error("configuration file is not stored in the version")
+	}
+
+	// data file modified in place (e.g. by the map server) must not change the history
+	if err := os.WriteFile(filepath.Join(s.ProjectsRoot, "user1/project", "data.gpkg"), []byte("edited data"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(s.versionsPath("user1/project", "objects", v.Manifest["data.gpkg"].Object))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "original data" {
+		t.Errorf("version object was modified: %q", content)
+	}
+}
+
+func TestCreateVersionSharesObjects(t *testing.T) {
+	s := newTestStorage(t)
+	createTestProject(t, s, "user1/project", map[string]string{
+		"project.qgs": "<qgis/>",
+		"data.gpkg":   "data",
+	})
+	uploadFiles(t, s, "user1/project", 1700000100, map[string]string{"project.qgs": "<qgis version='2'/>"})
+
+	if ids := versionIDsList(t, s, "user1/project"); !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Fatalf("expected versions [1 2], got %v", ids)
+	}
+	v1, _ := s.readVersion("user1/project", 1)
+	v2, _ := s.readVersion("user1/project", 2)
+	if v1.Manifest["data.gpkg"].Object != v2.Manifest["data.gpkg"].Object {
+		t.Error("unchanged file is not shared by versions")
+	}
+	if v1.Manifest["project.qgs"].Object == v2.Manifest["project.qgs"].Object {
+		t.Error("changed file has the same object")
+	}
+	entries, err := os.ReadDir(s.versionsPath("user1/project", "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected 3 objects, got %d", len(entries))
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	s := newTestStorage(t)
+	createTestProject(t, s, "user1/project", map[string]string{
+		"project.qgs": "<qgis/>",
+		"data.gpkg":   "data",
+		"web/a.png":   "media",
+	})
+	uploadFiles(t, s, "user1/project", 1700000100,
+		map[string]string{"project.qgs": "<qgis version='2'/>", "new.txt": "new"},
+		"data.gpkg",
+	)
+	if err := s.RestoreVersion("user1/project", 1); err != nil {
+		t.Fatalf("restoring version: %v", err)
+	}
+
+	if content := readProjectFile(t, s, "user1/project", "project.qgs"); content != "<qgis/>" {
+		t.Errorf("project.qgs not restored: %q", content)
+	}
+	if content := readProjectFile(t, s, "user1/project", "data.gpkg"); content != "data" {
+		t.Errorf("data.gpkg not restored: %q", content)
+	}
+	if fileExists(filepath.Join(s.ProjectsRoot, "user1/project", "new.txt")) {
+		t.Error("file added after the version was not removed")
+	}
+
+	v1, _ := s.readVersion("user1/project", 1)
+	index, err := s.filesIndex("user1/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, f := range v1.Manifest {
+		if info, ok := index.Get(path); !ok || info != f.FileInfo {
+			t.Errorf("files index of %s: %+v, expected %+v", path, info, f.FileInfo)
+		}
+		fStat, err := os.Stat(filepath.Join(s.ProjectsRoot, "user1/project", path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fStat.ModTime().Unix() != f.Mtime {
+			t.Errorf("modification time of %s not restored", path)
+		}
+		oStat, _ := os.Stat(s.versionsPath("user1/project", "objects", f.Object))
+		if os.SameFile(oStat, fStat) {
+			t.Errorf("restored file %s shares the file with the version object", path)
+		}
+	}
+	if _, ok := index.Get("new.txt"); ok {
+		t.Error("removed file is still in the files index")
+	}
+
+	versions, err := s.ListVersions("user1/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[0].Change != domain.RollbackVersionChange {
+		t.Errorf("rollback version not recorded: %+v", versions)
+	}
+}
+
+func TestRestoreVersionNotExists(t *testing.T) {
+	s := newTestStorage(t)
+	createTestProject(t, s, "user1/project", map[string]string{"project.qgs": "<qgis/>"})
+	if err := s.RestoreVersion("user1/project", 5); err == nil {
+		t.Error("expected error")
+	}
+	if content := readProjectFile(t, s, "user1/project", "project.qgs"); content != "<qgis/>" {
+		t.Errorf("project was modified: %q", content)
+	}
+}
+
+func TestPruneVersions(t *testing.T) {
+	s := newTestStorage(t)
+	s.MaxVersions = 2
+	createTestProject(t, s, "user1/project", map[string]string{
+		"project.qgs": "<qgis version='1'/>",
+		"data.gpkg":   "data",
+	})
+	for i, content := range []string{"<qgis version='2'/>", "<qgis version='3'/>", "<qgis version='4'/>"} {
+		uploadFiles(t, s, "user1/project", int64(1700000100+i), map[string]string{"project.qgs": content})
+	}
+
+	if ids := versionIDsList(t, s, "user1/project"); !reflect.DeepEqual(ids, []int{3, 4}) {
+		t.Fatalf("expected versions [3 4], got %v", ids)
+	}
+	used := make(map[string]bool)
+	for _, id := range []int{3, 4} {
+		v, err := s.readVersion("user1/project", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range v.Manifest {
+			used[f.Object] = true
+		}
+	}
+	entries, err := os.ReadDir(s.versionsPath("user1/project", "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objects []string
+	for _, e := range entries {
+		objects = append(objects, e.Name())
+		if !used[e.Name()] {
+			t.Errorf("unreferenced object %s was not removed", e.Name())
+		}
+	}
+	if len(objects) != len(used) {
+		t.Errorf("expected %d objects, got %d", len(used), len(objects))
+	}
+	usage, err := s.versionsUsage("user1/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := int64(len("data") + len("<qgis version='3'/>") + len("<qgis version='4'/>"))
+	if usage != expected {
+		t.Errorf("versions usage: %d, expected %d", usage, expected)
+	}
+}
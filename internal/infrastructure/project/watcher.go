@@ -0,0 +1,180 @@
+package project
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultWatchDelay is the default period without any changes of the project files, after which
+// the changes are processed
+const DefaultWatchDelay = 5 * time.Second
+
+type watcherImpl interface {
+	start() error
+	close() error
+}
+
+// Watcher watches the projects directory for changes of files made outside of the API (e.g.
+// files copied directly into the project directory by the admin). Cached project configuration
+// files are invalidated immediately, changes of the project files and configuration files are
+// reported (debounced) to the OnFilesChanged and OnConfigChanged callbacks. Changes made by the API
+// itself are reported too (they can't be reliably distinguished from concurrent external changes),
+// so the callbacks must be idempotent (changes of the files index are not reported).
+type Watcher struct {
+	log     *zap.SugaredLogger
+	storage *DiskStorage
+	delay   time.Duration
+	mu      sync.Mutex
+	timers  map[string]*pendingChange
+	// OnFilesChanged is called when files of the project were changed and no other change
+	// happened for the watch delay
+	OnFilesChanged func(projectName string)
+	// OnConfigChanged is called when only configuration files of the project were changed
+	// and no other change happened for the watch delay
+	OnConfigChanged func(projectName string)
+	// platform specific watcher implementation
+	impl watcherImpl
+}
+
+func NewWatcher(log *zap.SugaredLogger, storage *DiskStorage, delay time.Duration) (*Watcher, error) {
+	if delay <= 0 {
+		delay = DefaultWatchDelay
+	}
+	w := &Watcher{
+		log:     log,
+		storage: storage,
+		delay:   delay,
+		timers:  make(map[string]*pendingChange),
+	}
+	impl, err := newWatcherImpl(w)
+	if err != nil {
+		return nil, err
+	}
+	w.impl = impl
+	return w, nil
+}
+
+// Start starts watching of the projects directory
+func (w *Watcher) Start() error {
+	return w.impl.start()
+}
+
+// Close stops watching and cancels pending notifications
+func (w *Watcher) Close() error {
+	err := w.impl.close()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for projectName, p := range w.timers {
+		p.timer.Stop()
+		delete(w.timers, projectName)
+	}
+	return err
+}
+
+// watchedDir checks whether the directory (relative to the projects root) should be watched.
+// Hidden directories (trash, uploads, versions etc.) are not watched, except the .gisquick
+// directory of the project (without subdirectories).
+func watchedDir(relPath string) bool {
+	if relPath == "." {
+		return true
+	}
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ".") && !(i == 2 && p == ".gisquick" && len(parts) == 3) {
+			return false
+		}
+	}
+	return true
+}
+
+// changed processes the change of the file or directory (absolute path)
+func (w *Watcher) changed(path string) {
+	relPath, err := filepath.Rel(w.storage.ProjectsRoot, path)
+	if err != nil {
+		return
+	}
+	parts := strings.SplitN(filepath.ToSlash(relPath), "/", 3)
+	// changes of the users or projects directories (creating, removing) are handled by the API
+	if len(parts) < 3 || strings.HasPrefix(parts[0], ".") || strings.HasPrefix(parts[1], ".") {
+		return
+	}
+	projectName := parts[0] + "/" + parts[1]
+	filename := parts[2]
+	w.storage.invalidateFile(path)
+	if strings.HasPrefix(filename, ".gisquick/") {
+		if filename != ".gisquick/filesmap.json" {
+			w.schedule(projectName, false)
+		}
+		return
+	}
+	if strings.HasSuffix(filename, "~") || excludeExtRegex.MatchString(filename) {
+		return
+	}
+	w.schedule(projectName, true)
+}
+
+// changedAll schedules check of all projects (used when some changes could be missed)
+func (w *Watcher) changedAll() {
+	projects, err := w.storage.AllProjects(true)
+	if err != nil {
+		w.log.Errorw("listing projects", zap.Error(err))
+		return
+	}
+	for _, projectName := range projects {
+		w.schedule(projectName, true)
+	}
+}
+
+// pendingChange is the scheduled notification about the project's changes
+type pendingChange struct {
+	timer *time.Timer
+	// files are set when project files were changed, not only configuration files
+	files bool
+}
+
+// schedule (re)starts the project's notification timer
+func (w *Watcher) schedule(projectName string, files bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// timer which already fired is replaced by a new one
+	if p, ok := w.timers[projectName]; ok && p.timer.Stop() {
+		p.files = p.files || files
+		p.timer.Reset(w.delay)
+		return
+	}
+	p := &pendingChange{files: files}
+	p.timer = time.AfterFunc(w.delay, func() {
+		w.mu.Lock()
+		if w.timers[projectName] == p {
+			delete(w.timers, projectName)
+		}
+		files := p.files
+		w.mu.Unlock()
+		if !w.storage.CheckProjectExists(projectName) {
+			return
+		}
+		if files {
+			w.log.Infow("project files changed on the disk", "project", projectName)
+			if w.OnFilesChanged != nil {
+				w.OnFilesChanged(projectName)
+			}
+		} else {
+			w.log.Infow("project configuration changed on the disk", "project", projectName)
+			if w.OnConfigChanged != nil {
+				w.OnConfigChanged(projectName)
+			}
+		}
+	})
+	w.timers[projectName] = p
+}
+
+// invalidateFile removes cached content of the project's configuration file
+func (s *DiskStorage) invalidateFile(path string) {
+	s.projectInfoReader.Invalidate(path)
+	s.settingsReader.Invalidate(path)
+	s.configCache.Remove(path)
+}
@@ -0,0 +1,156 @@
+//go:build linux
+
+package project
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_ATTRIB | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DONT_FOLLOW | syscall.IN_EXCL_UNLINK
+
+// inotifyWatcher is inotify based watcher, watches are created for all (not hidden) directories
+// in the projects root, since inotify doesn't support recursive watching
+type inotifyWatcher struct {
+	w       *Watcher
+	fd      int
+	file    *os.File
+	mu      sync.Mutex
+	watches map[int32]string
+	started bool
+	done    chan struct{}
+}
+
+func newWatcherImpl(w *Watcher) (watcherImpl, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("initializing inotify: %w", err)
+	}
+	// non-blocking descriptor uses the runtime poller, so reading can be interrupted by Close
+	return &inotifyWatcher{
+		w:       w,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int32]string),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// addWatches adds watches of the directory and its subdirectories
+func (iw *inotifyWatcher) addWatches(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// directory could be removed in the meantime
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(iw.w.storage.ProjectsRoot, path)
+		if err != nil {
+			return err
+		}
+		if !watchedDir(relPath) {
+			return fs.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(iw.fd, path, inotifyMask)
+		if err != nil {
+			if errors.Is(err, syscall.ENOENT) {
+				return nil
+			}
+			if errors.Is(err, syscall.ENOSPC) {
+				return fmt.Errorf("reached limit of inotify watches (fs.inotify.max_user_watches): %w", err)
+			}
+			return fmt.Errorf("watching directory %s: %w", path, err)
+		}
+		iw.mu.Lock()
+		iw.watches[int32(wd)] = path
+		iw.mu.Unlock()
+		return nil
+	})
+}
+
+func (iw *inotifyWatcher) start() error {
+	if err := iw.addWatches(iw.w.storage.ProjectsRoot); err != nil {
+		return err
+	}
+	iw.mu.Lock()
+	count := len(iw.watches)
+	iw.started = true
+	iw.mu.Unlock()
+	iw.w.log.Infow("watching projects directory", "root", iw.w.storage.ProjectsRoot, "directories", count)
+	go iw.run()
+	return nil
+}
+
+func (iw *inotifyWatcher) run() {
+	defer close(iw.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := iw.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				iw.w.log.Errorw("reading inotify events", zap.Error(err))
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			iw.handle(event.Wd, event.Mask, name)
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+	}
+}
+
+func (iw *inotifyWatcher) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// some events were lost, so all watched projects are checked
+		iw.w.log.Warnw("inotify events queue overflow")
+		iw.w.changedAll()
+		return
+	}
+	iw.mu.Lock()
+	dir, ok := iw.watches[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		// watched directory was removed
+		delete(iw.watches, wd)
+	}
+	iw.mu.Unlock()
+	if !ok || name == "" {
+		return
+	}
+	path := filepath.Join(dir, name)
+	if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		// files created in the directory before the watch was added are found by the project check
+		if err := iw.addWatches(path); err != nil {
+			iw.w.log.Errorw("watching new directory", "path", path, zap.Error(err))
+		}
+	}
+	iw.w.changed(path)
+}
+
+func (iw *inotifyWatcher) close() error {
+	err := iw.file.Close()
+	iw.mu.Lock()
+	started := iw.started
+	iw.mu.Unlock()
+	if started {
+		<-iw.done
+	}
+	return err
+}
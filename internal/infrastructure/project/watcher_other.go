@@ -0,0 +1,9 @@
+//go:build !linux
+
+package project
+
+import "errors"
+
+func newWatcherImpl(w *Watcher) (watcherImpl, error) {
+	return nil, errors.New("files watcher is supported only on Linux")
+}
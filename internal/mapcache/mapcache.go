@@ -7,6 +7,7 @@ import (
 	"image/png"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
@@ -116,6 +117,15 @@ func (l Layer) Grid(z int) ([]float64, error) {
 	return []float64{width, height}, nil
 }
 
+// ContainsTile checks whether tile coordinates are within the layer's grid
+func (l Layer) ContainsTile(t Tile) bool {
+	grid, err := l.Grid(t.Z)
+	if err != nil || t.Z < 0 {
+		return false
+	}
+	return t.X >= 0 && t.Y >= 0 && t.X < int(math.Ceil(grid[0])) && t.Y < int(math.Ceil(grid[1]))
+}
+
 func (l Layer) Format() string {
 	format := strings.ToLower(l.ImageFormat)
 	if format == "jpg" {
@@ -125,8 +135,8 @@ func (l Layer) Format() string {
 }
 
 func (l Layer) GetMetaSize(z int) (int, int) {
-	grid, _ := l.Grid(z)
-	return minInt(l.MetaSize[0], int(grid[0])+1), minInt(l.MetaSize[1], int(grid[1]+1))
+	cols, rows := l.MatrixSize(z)
+	return minInt(l.MetaSize[0], cols), minInt(l.MetaSize[1], rows)
 }
 
 func (l Layer) GetMetaTile(tile Tile) MetaTile {
@@ -0,0 +1,516 @@
+package mapcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSeedJobNotFound = errors.New("seed job not found")
+	ErrInvalidSeedArea = errors.New("invalid seeding zoom range or extent")
+)
+
+const (
+	SeedPending   = "pending"
+	SeedRunning   = "running"
+	SeedFinished  = "finished"
+	SeedFailed    = "failed"
+	SeedCancelled = "cancelled"
+)
+
+// number of consecutive metatile failures after which the job is stopped
+const maxSeedErrors = 20
+
+// minimal interval between saving of job's state and progress notifications
+const seedUpdateInterval = time.Second
+
+// DefaultSeedJobsRetention is the default period for which records of finished jobs are kept
+const DefaultSeedJobsRetention = 7 * 24 * time.Hour
+
+type SeedParams struct {
+	MinZoom int       `json:"min_zoom"`
+	MaxZoom int       `json:"max_zoom"`
+	Extent  []float64 `json:"extent,omitempty"`
+	// render also already cached metatiles
+	Force bool `json:"force"`
+}
+
+type SeedJob struct {
+	ID      string `json:"id"`
+	Project string `json:"project"`
+	Layers  string `json:"layers"`
+	SeedParams
+	Status  string    `json:"status"`
+	Total   int       `json:"total"`
+	Done    int       `json:"done"`
+	Failed  int       `json:"failed"`
+	Error   string    `json:"error,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+func (j SeedJob) active() bool {
+	return j.Status == SeedPending || j.Status == SeedRunning
+}
+
+// persisted state of the seeding job
+type seedState struct {
+	Job   SeedJob `json:"job"`
+	Layer Layer   `json:"layer"`
+}
+
+type seedTask struct {
+	job       SeedJob
+	layer     Layer
+	cancel    context.CancelFunc
+	done      chan struct{}
+	lastSaved time.Time
+	// removed job's state is no longer saved
+	removed bool
+}
+
+// range of metatiles on a single zoom level
+type metaRange struct {
+	z, minX, minY, maxX, maxY int
+}
+
+func (r metaRange) count() int {
+	return (r.maxX - r.minX + 1) * (r.maxY - r.minY + 1)
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// seedRanges computes metatiles covering the extent for each zoom level
+func seedRanges(layer Layer, params SeedParams) ([]metaRange, error) {
+	if params.MinZoom < 0 || params.MinZoom > params.MaxZoom || params.MaxZoom >= len(layer.Resolutions) {
+		return nil, ErrInvalidSeedArea
+	}
+	extent := params.Extent
+	if len(extent) == 0 {
+		extent = layer.Extent
+	}
+	if len(extent) != 4 || extent[0] > layer.Extent[2] || extent[2] < layer.Extent[0] || extent[1] > layer.Extent[3] || extent[3] < layer.Extent[1] {
+		return nil, ErrInvalidSeedArea
+	}
+	ranges := make([]metaRange, 0, params.MaxZoom-params.MinZoom+1)
+	for z := params.MinZoom; z <= params.MaxZoom; z++ {
+		grid, err := layer.Grid(z)
+		if err != nil {
+			return nil, err
+		}
+		tileSpan := layer.Resolutions[z] * float64(layer.TileSize)
+		col := func(x float64) int {
+			return clampInt(int(math.Floor((x-layer.Extent[0])/tileSpan)), 0, int(math.Ceil(grid[0]))-1)
+		}
+		row := func(y float64) int {
+			return clampInt(int(math.Floor((y-layer.Extent[1])/tileSpan)), 0, int(math.Ceil(grid[1]))-1)
+		}
+		ranges = append(ranges, metaRange{
+			z:    z,
+			minX: col(extent[0]) / layer.MetaSize[0],
+			minY: row(extent[1]) / layer.MetaSize[1],
+			maxX: col(extent[2]) / layer.MetaSize[0],
+			maxY: row(extent[3]) / layer.MetaSize[1],
+		})
+	}
+	return ranges, nil
+}
+
+// Seeder pre-renders tiles of the map layers in background jobs. State of the jobs is persisted,
+// so unfinished jobs can be resumed after restart.
+type Seeder struct {
+	cache *Cache
+	log   *zap.SugaredLogger
+	dir   string
+	sem   chan struct{}
+	ctx   context.Context
+	stop  context.CancelFunc
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	tasks map[string]*seedTask
+	// OnProgress is called (from the worker goroutine) when the job's state changes
+	OnProgress func(job SeedJob)
+	// Retention is the period for which records of finished (failed, cancelled) jobs are kept
+	// (0 keeps them forever)
+	Retention time.Duration
+}
+
+func NewSeeder(log *zap.SugaredLogger, cache *Cache, workers int) *Seeder {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &Seeder{
+		cache:     cache,
+		log:       log,
+		dir:       filepath.Join(cache.Root, ".seed"),
+		sem:       make(chan struct{}, workers),
+		ctx:       ctx,
+		stop:      stop,
+		tasks:     make(map[string]*seedTask),
+		Retention: DefaultSeedJobsRetention,
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *Seeder) jobPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *Seeder) save(t *seedTask) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.Marshal(seedState{Job: t.job, Layer: t.layer})
+	if err != nil {
+		return err
+	}
+	tmpPath := s.jobPath(t.job.ID) + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.jobPath(t.job.ID))
+}
+
+// Resume loads persisted jobs and starts unfinished ones
+func (s *Seeder) Resume() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading seed jobs directory: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("reading seed job: %w", err)
+		}
+		var state seedState
+		if err := json.Unmarshal(content, &state); err != nil {
+			s.log.Errorw("invalid seed job file", "file", e.Name(), zap.Error(err))
+			continue
+		}
+		state.Layer.ServerURL = s.cache.ServerURL
+		t := &seedTask{job: state.Job, layer: state.Layer, done: make(chan struct{})}
+		s.mu.Lock()
+		s.tasks[t.job.ID] = t
+		s.mu.Unlock()
+		if t.job.active() {
+			s.log.Infow("resuming seed job", "id", t.job.ID, "project", t.job.Project, "done", t.job.Done, "total", t.job.Total)
+			s.start(t)
+		} else {
+			close(t.done)
+		}
+	}
+	s.prune()
+	return nil
+}
+
+// prune removes records of jobs finished before the retention period
+func (s *Seeder) prune() {
+	if s.Retention <= 0 {
+		return
+	}
+	limit := time.Now().Add(-s.Retention)
+	s.mu.Lock()
+	var expired []string
+	for id, t := range s.tasks {
+		if !t.job.active() && t.job.Updated.Before(limit) {
+			expired = append(expired, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range expired {
+		if err := s.Remove(id); err != nil {
+			s.log.Errorw("removing expired seed job", "id", id, zap.Error(err))
+		}
+	}
+}
+
+// Seed creates a new seeding job for the layer
+func (s *Seeder) Seed(projectName string, layer Layer, params SeedParams) (SeedJob, error) {
+	ranges, err := seedRanges(layer, params)
+	if err != nil {
+		return SeedJob{}, err
+	}
+	total := 0
+	for _, r := range ranges {
+		total += r.count()
+	}
+	now := time.Now().UTC()
+	t := &seedTask{
+		job: SeedJob{
+			ID:         newJobID(),
+			Project:    projectName,
+			Layers:     layer.WMSLayer,
+			SeedParams: params,
+			Status:     SeedPending,
+			Total:      total,
+			Created:    now,
+			Updated:    now,
+		},
+		layer: layer,
+		done:  make(chan struct{}),
+	}
+	s.prune()
+	if err := s.save(t); err != nil {
+		return SeedJob{}, fmt.Errorf("saving seed job: %w", err)
+	}
+	s.mu.Lock()
+	s.tasks[t.job.ID] = t
+	s.mu.Unlock()
+	s.start(t)
+	return t.job, nil
+}
+
+func (s *Seeder) start(t *seedTask) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	t.cancel = cancel
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(t.done)
+		defer cancel()
+		s.run(ctx, t)
+	}()
+}
+
+// update modifies job's state, saves it and notifies about the progress (at most once per
+// seedUpdateInterval, unless force is set)
+func (s *Seeder) update(t *seedTask, force bool, fn func(j *SeedJob)) {
+	s.mu.Lock()
+	fn(&t.job)
+	t.job.Updated = time.Now().UTC()
+	if t.removed || (!force && t.job.Updated.Sub(t.lastSaved) < seedUpdateInterval) {
+		s.mu.Unlock()
+		return
+	}
+	t.lastSaved = t.job.Updated
+	job := t.job
+	err := s.save(t)
+	s.mu.Unlock()
+
+	if err != nil {
+		s.log.Errorw("saving seed job", "id", job.ID, zap.Error(err))
+	}
+	if s.OnProgress != nil {
+		s.OnProgress(job)
+	}
+}
+
+func (s *Seeder) run(ctx context.Context, t *seedTask) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		s.update(t, true, func(j *SeedJob) {})
+		return
+	}
+	defer func() { <-s.sem }()
+
+	s.mu.Lock()
+	layer := t.layer
+	params := t.job.SeedParams
+	skip := t.job.Done
+	s.mu.Unlock()
+
+	ranges, err := seedRanges(layer, params)
+	if err != nil {
+		s.update(t, true, func(j *SeedJob) {
+			j.Status = SeedFailed
+			j.Error = err.Error()
+		})
+		return
+	}
+	s.update(t, true, func(j *SeedJob) {
+		if j.Status == SeedPending {
+			j.Status = SeedRunning
+		}
+	})
+
+	index := 0
+	errorsCount := 0
+	for _, r := range ranges {
+		for y := r.minY; y <= r.maxY; y++ {
+			for x := r.minX; x <= r.maxX; x++ {
+				index++
+				if index <= skip {
+					continue
+				}
+				if ctx.Err() != nil {
+					// cancelled or stopped, state of stopped job is kept for resuming
+					s.update(t, true, func(j *SeedJob) {})
+					return
+				}
+				metatile := MetaTile{Tile{layer, x, y, r.z}}
+				err := s.seedMetaTile(t.job.Project, metatile, params.Force)
+				if err != nil {
+					errorsCount++
+				} else {
+					errorsCount = 0
+				}
+				s.update(t, false, func(j *SeedJob) {
+					j.Done = index
+					if err != nil {
+						j.Failed++
+					}
+				})
+				if errorsCount >= maxSeedErrors {
+					s.update(t, true, func(j *SeedJob) {
+						j.Status = SeedFailed
+						j.Error = "too many map server errors"
+					})
+					return
+				}
+			}
+		}
+	}
+	s.update(t, true, func(j *SeedJob) { j.Status = SeedFinished })
+}
+
+func (s *Seeder) seedMetaTile(projectName string, metatile MetaTile, force bool) error {
+	layer := metatile.Layer
+	if !force {
+		firstTile := Tile{layer, metatile.X * layer.MetaSize[0], metatile.Y * layer.MetaSize[1], metatile.Z}
+		if s.cache.store.Has(firstTile) {
+			return nil
+		}
+	}
+	if err := s.cache.saveLayerInfo(layer); err != nil {
+		return err
+	}
+	return s.cache.RenderMetaTile(projectName, metatile)
+}
+
+// Jobs returns seeding jobs of the project, or all jobs when projectName is empty
+func (s *Seeder) Jobs(projectName string) []SeedJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]SeedJob, 0)
+	for _, t := range s.tasks {
+		if projectName == "" || t.job.Project == projectName {
+			jobs = append(jobs, t.job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.Before(jobs[j].Created)
+	})
+	return jobs
+}
+
+func (s *Seeder) GetJob(id string) (SeedJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return SeedJob{}, ErrSeedJobNotFound
+	}
+	return t.job, nil
+}
+
+// Wait blocks until the job is finished (or stopped)
+func (s *Seeder) Wait(id string) (SeedJob, error) {
+	s.mu.Lock()
+	t, ok := s.tasks[id]
+	s.mu.Unlock()
+	if !ok {
+		return SeedJob{}, ErrSeedJobNotFound
+	}
+	<-t.done
+	return s.GetJob(id)
+}
+
+// Cancel stops the job, but keeps its record. It doesn't wait for the job's worker to finish
+// (current metatile is rendered), use Wait if needed.
+func (s *Seeder) Cancel(id string) error {
+	s.mu.Lock()
+	t, ok := s.tasks[id]
+	s.mu.Unlock()
+	if !ok {
+		return ErrSeedJobNotFound
+	}
+	s.mu.Lock()
+	active := t.job.active()
+	if active {
+		t.job.Status = SeedCancelled
+	}
+	cancel := t.cancel
+	s.mu.Unlock()
+	if active && cancel != nil {
+		cancel()
+	}
+	return nil
+}
+
+// Remove cancels the job and deletes its record
+func (s *Seeder) Remove(id string) error {
+	if err := s.Cancel(id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if t, ok := s.tasks[id]; ok {
+		t.removed = true
+	}
+	delete(s.tasks, id)
+	s.mu.Unlock()
+	if err := os.Remove(s.jobPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveProjectJobs removes all jobs of the project
+func (s *Seeder) RemoveProjectJobs(projectName string) error {
+	for _, job := range s.Jobs(projectName) {
+		if err := s.Remove(job.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops all running jobs, unfinished jobs will be resumed on next start
+func (s *Seeder) Close() {
+	s.stop()
+	s.wg.Wait()
+}
+
+// ParseExtent parses comma separated list of extent coordinates (minx,miny,maxx,maxy)
+func ParseExtent(value string) ([]float64, error) {
+	var extent []float64
+	if err := json.Unmarshal([]byte("["+strings.TrimSpace(value)+"]"), &extent); err != nil || len(extent) != 4 {
+		return nil, fmt.Errorf("invalid extent: %s", value)
+	}
+	return extent, nil
+}
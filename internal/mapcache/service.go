@@ -1,6 +1,7 @@
 package mapcache
 
 import (
+	"bytes"
 	"crypto/md5"
 	"errors"
 	"fmt"
@@ -14,6 +15,8 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gisquick/gisquick-server/internal/domain"
 	"github.com/prometheus/client_golang/prometheus"
@@ -25,8 +28,12 @@ var (
 	ErrMapServer = errors.New("mapserver error")
 )
 
+// size of metatiles (in tiles)
+const defaultMetaSize = 5
+
 type metrics struct {
-	counter prometheus.Counter
+	counter  *prometheus.CounterVec
+	requests *prometheus.CounterVec
 }
 
 func cacheMetrics() *metrics {
@@ -35,15 +42,22 @@ func cacheMetrics() *metrics {
 	// 	Help:        "Counts executions of my handler function.",
 	// 	ConstLabels: prometheus.Labels{"version": "1234"},
 	// })
-	counter := prometheus.NewCounter(prometheus.CounterOpts{
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "mapcache_metatile_rendering_count",
 		Help: "Counts executions of metatile rendering.",
 		// ConstLabels: prometheus.Labels{"version": "1234"},
-	})
+	}, []string{"project", "status"})
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mapcache_tile_requests_count",
+		Help: "Counts tile requests by cache result (hit or miss).",
+	}, []string{"project", "result"})
 	if err := prometheus.Register(counter); err != nil {
 		log.Fatal(err)
 	}
-	return &metrics{counter: counter}
+	if err := prometheus.Register(requests); err != nil {
+		log.Fatal(err)
+	}
+	return &metrics{counter: counter, requests: requests}
 }
 
 type Cache struct {
@@ -53,9 +67,16 @@ type Cache struct {
 	client    *http.Client
 	tileLock  singleflight.Group
 	metrics   *metrics
+	store     TileStore
+	usage     *usageTracker
 }
 
-func NewMapcache(log *zap.SugaredLogger, root string, mapserverURL string) *Cache {
+// NewMapcache creates map cache with the given tiles storage, when store is nil, tiles are stored
+// as files in the root directory (which is used also for legends and other data)
+func NewMapcache(log *zap.SugaredLogger, root string, mapserverURL string, store TileStore) *Cache {
+	if store == nil {
+		store = NewFileStore(log, root)
+	}
 	return &Cache{
 		Root:      root,
 		ServerURL: mapserverURL,
@@ -63,45 +84,185 @@ func NewMapcache(log *zap.SugaredLogger, root string, mapserverURL string) *Cach
 		client:    &http.Client{},
 		tileLock:  singleflight.Group{},
 		metrics:   cacheMetrics(),
+		store:     store,
+		usage:     newUsageTracker(),
 	}
 }
 
-func (c *Cache) Clear(project *domain.Project) error {
-	projectHash := fmt.Sprintf("%x", md5.Sum([]byte(project.Info.FullName)))
-	dir := filepath.Join(c.Root, projectHash)
-	c.log.Infof("clearing project mapcache: %s", project.Info.FullName)
-	return os.RemoveAll(dir)
+// SetQuota sets maximal size of the cached tiles (in bytes) globally and per project,
+// least recently used metatiles are evicted when the limit is exceeded (negative value means no limit)
+func (c *Cache) SetQuota(maxSize, maxProjectSize int64) {
+	c.usage.setLimits(maxSize, maxProjectSize)
 }
 
-func (c *Cache) GetLayer(p *domain.Project, layers string) Layer {
-	projectHash := fmt.Sprintf("%x", md5.Sum([]byte(p.Info.FullName)))
-	layersHash := fmt.Sprintf("%x", md5.Sum([]byte(layers)))
+// LoadUsage scans the tiles storage to get size of already cached data (can take a long time)
+func (c *Cache) LoadUsage() error {
+	metatiles := make(map[metatileKey]*usageEntry)
+	err := c.store.Walk(func(t TileInfo) error {
+		key := metatileKey{project: t.Project, layer: t.Layer, z: t.Z, x: t.X / defaultMetaSize, y: t.Y / defaultMetaSize}
+		e, ok := metatiles[key]
+		if !ok {
+			e = &usageEntry{key: key}
+			metatiles[key] = e
+		}
+		e.size += t.Size
+		if t.Modified.After(e.lastUsed) {
+			e.lastUsed = t.Modified
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("scanning mapcache storage: %w", err)
+	}
+	entries := make([]*usageEntry, 0, len(metatiles))
+	for _, e := range metatiles {
+		entries = append(entries, e)
+	}
+	c.evict(c.usage.load(entries))
+	return nil
+}
+
+// Stats returns cache usage statistics
+func (c *Cache) Stats() CacheStats {
+	return c.usage.stats()
+}
+
+func tileMetatileKey(tile Tile) metatileKey {
+	return metatileKey{
+		project: tile.Layer.Project,
+		layer:   tile.Layer.Name,
+		z:       tile.Z,
+		x:       tile.X / tile.Layer.MetaSize[0],
+		y:       tile.Y / tile.Layer.MetaSize[1],
+	}
+}
 
+// evict deletes tiles of the metatiles in the background
+func (c *Cache) evict(metatiles []metatileKey) {
+	if len(metatiles) == 0 {
+		return
+	}
+	go func() {
+		for _, key := range metatiles {
+			layer := Layer{Project: key.project, Name: key.layer}
+			for i := 0; i < defaultMetaSize; i++ {
+				for j := 0; j < defaultMetaSize; j++ {
+					tile := Tile{layer, key.x*defaultMetaSize + i, key.y*defaultMetaSize + j, key.z}
+					if err := c.store.Delete(tile); err != nil {
+						c.log.Errorw("evicting mapcache tile", "path", layer.Path(tile), zap.Error(err))
+					}
+				}
+			}
+		}
+	}()
+}
+
+func projectHash(projectName string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(projectName)))
+}
+
+// Clear removes all cached data of the project
+func (c *Cache) Clear(projectName string) error {
+	c.log.Infof("clearing project mapcache: %s", projectName)
+	if err := c.store.Clear(projectHash(projectName)); err != nil {
+		return err
+	}
+	c.usage.removeProject(projectHash(projectName))
+	return removeDir(c.log, filepath.Join(c.Root, projectHash(projectName)))
+}
+
+func (c *Cache) Close() error {
+	return c.store.Close()
+}
+
+// ClearLayers removes cached tiles and legends of all layer sets containing any of given WMS layers
+func (c *Cache) ClearLayers(projectName string, layers []string) error {
+	projectDir := filepath.Join(c.Root, projectHash(projectName))
+	entries, err := os.ReadDir(filepath.Join(projectDir, "layers"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		content, err := os.ReadFile(filepath.Join(projectDir, "layers", e.Name()))
+		if err != nil {
+			return err
+		}
+		if !containsAny(strings.Split(string(content), ","), layers) {
+			continue
+		}
+		c.log.Infow("clearing mapcache layers", "project", projectName, "layers", string(content))
+		if err := c.store.ClearLayer(projectHash(projectName), e.Name()); err != nil {
+			return err
+		}
+		c.usage.removeLayer(projectHash(projectName), e.Name())
+		if err := removeDir(c.log, filepath.Join(projectDir, "legend", e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsAny(values []string, items []string) bool {
+	for _, v := range values {
+		for _, i := range items {
+			if v == i {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// saveLayerInfo stores list of WMS layers of the layer set, so it can be found when some
+// of the layers are changed
+func (c *Cache) saveLayerInfo(layer Layer) error {
+	path := filepath.Join(c.Root, layer.Project, "layers", layer.Name)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(layer.WMSLayer), 0644)
+}
+
+// GetLayer creates mapcache layer for given (comma separated) list of WMS layers
+func (c *Cache) GetLayer(pInfo domain.ProjectInfo, meta domain.QgisMeta, settings domain.ProjectSettings, layers string) Layer {
+	layersHash := fmt.Sprintf("%x", md5.Sum([]byte(layers)))
+	projection := meta.Projection
+	if projection == "" {
+		projection = pInfo.Projection
+	}
 	return Layer{
-		Map:         filepath.Join("/publish", p.Info.Map),
-		Project:     projectHash,
+		Map:         filepath.Join("/publish", pInfo.Name, pInfo.QgisFile),
+		Project:     projectHash(pInfo.Name),
 		Publish:     "",
 		Name:        layersHash,
 		ServerURL:   c.ServerURL,
 		WMSLayer:    layers,
-		Extent:      p.Settings.Extent,
-		Resolutions: p.Settings.TileResolutions,
-		Projection:  p.ProjectionCode(),
+		Extent:      settings.Extent,
+		Resolutions: settings.TileResolutions,
+		Projection:  projection,
 		ImageFormat: "png",
 		TileSize:    256,
-		MetaSize:    []int{5, 5},
+		MetaSize:    []int{defaultMetaSize, defaultMetaSize},
 		MetaBuffer:  []int{50, 50},
 	}
 }
 
-func (c *Cache) ProcessMetaTile(layer Layer, metatile MetaTile, data io.Reader, dir string) error {
+// ProcessMetaTile splits metatile image into tiles and saves them into the tiles storage,
+// returns total size of the saved tiles
+func (c *Cache) ProcessMetaTile(layer Layer, metatile MetaTile, data io.Reader) (int64, error) {
 	img, format, err := image.Decode(data)
 	if err != nil {
-		return fmt.Errorf("decoding metatile: %v", err)
+		return 0, fmt.Errorf("decoding metatile: %v", err)
 	}
 	simg, ok := img.(subImager)
 	if !ok {
-		return fmt.Errorf("Image does not support cropping: %s", format)
+		return 0, fmt.Errorf("Image does not support cropping: %s", format)
 	}
 	var encodeImage func(io.Writer, image.Image) error
 	if format == "png" {
@@ -112,6 +273,7 @@ func (c *Cache) ProcessMetaTile(layer Layer, metatile MetaTile, data io.Reader,
 		}
 	}
 
+	var size int64
 	metaCols, metaRows := layer.GetMetaSize(metatile.Z)
 	metaHeight := metaRows*layer.TileSize + 2*layer.MetaBuffer[1]
 	for i := 0; i < metaCols; i++ {
@@ -127,45 +289,58 @@ func (c *Cache) ProcessMetaTile(layer Layer, metatile MetaTile, data io.Reader,
 			tile := Tile{layer, x, y, metatile.Z}
 
 			tileImg := simg.SubImage(image.Rect(minx, miny, maxx, maxy))
-			tilePath := filepath.Join(dir, layer.Path(tile))
-			// log.Println("saving tile to:", tilePath)
-			if err := os.MkdirAll(filepath.Dir(tilePath), os.ModePerm); err != nil {
-				return err
-			}
-			f, err := os.Create(tilePath)
-			if err != nil {
-				return fmt.Errorf("creating tile file: %v", err)
+			var buf bytes.Buffer
+			if err := encodeImage(&buf, tileImg); err != nil {
+				return size, fmt.Errorf("encoding tile image: %v", err)
 			}
-			if err := encodeImage(f, tileImg); err != nil {
-				return fmt.Errorf("encoding tile image: %v", err)
+			if err := c.store.Put(tile, buf.Bytes()); err != nil {
+				return size, fmt.Errorf("saving tile: %v", err)
 			}
+			size += int64(buf.Len())
 		}
 	}
-	return nil
+	return size, nil
 }
 
-func (c *Cache) GetTileFile(p *domain.Project, tile Tile) (string, error) {
-	layer := tile.Layer
-	// tile := mapcache.Tile{Layer: layer, X: params.X, Y: params.Y, Z: params.Z}
-	tilePath := filepath.Join(c.Root, layer.Path(tile))
-	_, err := os.Stat(tilePath)
+// GetTile returns tile image data and its modification time, tile is rendered when it's not cached yet
+func (c *Cache) GetTile(projectName string, tile Tile) ([]byte, time.Time, error) {
+	hash := tile.Layer.Project
+	data, mtime, err := c.store.Get(tile)
 	if err == nil {
-		return tilePath, nil
+		c.metrics.requests.WithLabelValues(projectName, "hit").Inc()
+		c.usage.count(hash, projectName, true)
+		c.usage.touch(tileMetatileKey(tile))
+		return data, mtime, nil
+	}
+	c.metrics.requests.WithLabelValues(projectName, "miss").Inc()
+	c.usage.count(hash, projectName, false)
+	if !errors.Is(err, ErrTileNotFound) {
+		c.log.Errorw("reading tile from mapcache storage", "project", projectName, zap.Error(err))
 	}
+	if err := c.RenderMetaTile(projectName, tile.Layer.GetMetaTile(tile)); err != nil {
+		return nil, time.Time{}, err
+	}
+	return c.store.Get(tile)
+}
 
-	metatile := layer.GetMetaTile(tile)
-	metatileKey := layer.Path(metatile.Tile)
+// RenderMetaTile requests metatile image from the map server and saves all its tiles into the cache
+func (c *Cache) RenderMetaTile(projectName string, metatile MetaTile) error {
+	layer := metatile.Layer
+	lockKey := layer.Path(metatile.Tile)
 	var metatileUrl *url.URL
-	_, err, _ = c.tileLock.Do(metatileKey, func() (interface{}, error) {
-		c.metrics.counter.Inc()
+	_, err, _ := c.tileLock.Do(lockKey, func() (_ interface{}, err error) {
+		defer func() {
+			status := "ok"
+			if err != nil {
+				status = "error"
+			}
+			c.metrics.counter.WithLabelValues(projectName, status).Inc()
+		}()
+		c.usage.rendered(layer.Project)
 		metatileUrl = layer.GetMetaTileURL(metatile)
-		q := metatileUrl.Query()
-		q.Set("MAP", filepath.Join("/publish", p.Info.Map))
-		metatileUrl.RawQuery = q.Encode()
 		c.log.Infow("fetching metatile", "service", "mapcache", "url", metatileUrl.String())
 
 		req, _ := http.NewRequest(http.MethodGet, metatileUrl.String(), nil)
-		// req = req.WithContext(c.Request().Context())
 		resp, err := c.client.Do(req)
 		if err != nil {
 			// gateway error
@@ -175,19 +350,97 @@ func (c *Cache) GetTileFile(p *domain.Project, tile Tile) (string, error) {
 		if resp.StatusCode != 200 {
 			msg, _ := ioutil.ReadAll(resp.Body)
 			// mapserver error
-			// http.newer
-			// resp.Header.Get("Content-Type")
-			// return nil, echo.NewHTTPError(resp.StatusCode, )
 			return nil, fmt.Errorf(string(msg))
 		}
-		if err := c.ProcessMetaTile(layer, metatile, resp.Body, c.Root); err != nil {
+		if err := c.saveLayerInfo(layer); err != nil {
+			return nil, fmt.Errorf("saving layer info: %w", err)
+		}
+		size, err := c.ProcessMetaTile(layer, metatile, resp.Body)
+		if size > 0 {
+			key := metatileKey{project: layer.Project, layer: layer.Name, z: metatile.Z, x: metatile.X, y: metatile.Y}
+			c.evict(c.usage.add(key, size, projectName))
+		}
+		if err != nil {
 			return nil, fmt.Errorf("processing metatile: %w", err)
 		}
 		return nil, nil
 	})
 	if err != nil {
-		c.log.Errorw("mapcache metatile request", "project", p.Info.FullName, "url", metatileUrl, zap.Error(err))
+		c.log.Errorw("mapcache metatile request", "project", projectName, "url", metatileUrl, zap.Error(err))
+		return ErrMapServer
+	}
+	return nil
+}
+
+// Parameters of GetLegendGraphic request which are passed to the map server (and make the cache key)
+var legendParams = []string{
+	"FORMAT", "SCALE", "BBOX", "SRS", "CRS", "WIDTH", "HEIGHT", "STYLE", "RULE",
+	"LAYERTITLE", "LAYERFONTSIZE", "ITEMFONTSIZE", "SYMBOLWIDTH", "SYMBOLHEIGHT",
+	"SHOWFEATURECOUNT", "TRANSPARENT", "DPI",
+}
+
+func (c *Cache) GetLegendFile(projectName string, layer Layer, params url.Values) (string, error) {
+	query := url.Values{}
+	for name, values := range params {
+		for _, p := range legendParams {
+			if strings.EqualFold(name, p) && len(values) > 0 {
+				query.Set(p, values[0])
+			}
+		}
+	}
+	if query.Get("FORMAT") == "" {
+		query.Set("FORMAT", "image/png")
+	}
+	paramsHash := fmt.Sprintf("%x", md5.Sum([]byte(query.Encode())))
+	legendPath := filepath.Join(c.Root, layer.Project, "legend", layer.Name, paramsHash)
+	if _, err := os.Stat(legendPath); err == nil {
+		return legendPath, nil
+	}
+
+	query.Set("SERVICE", "WMS")
+	query.Set("REQUEST", "GetLegendGraphic")
+	query.Set("MAP", layer.Map)
+	query.Set("LAYER", layer.WMSLayer)
+	u, err := url.Parse(c.ServerURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing map server url: %w", err)
+	}
+	u.RawQuery = query.Encode()
+	_, err, _ = c.tileLock.Do(legendPath, func() (interface{}, error) {
+		resp, err := c.client.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			msg, _ := ioutil.ReadAll(resp.Body)
+			return nil, fmt.Errorf(string(msg))
+		}
+		if err := c.saveLayerInfo(layer); err != nil {
+			return nil, fmt.Errorf("saving layer info: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(legendPath), os.ModePerm); err != nil {
+			return nil, err
+		}
+		// write into temporary file first, so concurrent readers never get incomplete image
+		tmpPath := legendPath + ".tmp"
+		f, err := os.Create(tmpPath)
+		if err != nil {
+			return nil, fmt.Errorf("creating legend file: %w", err)
+		}
+		_, err = io.Copy(f, resp.Body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+			return nil, fmt.Errorf("saving legend file: %w", err)
+		}
+		return nil, os.Rename(tmpPath, legendPath)
+	})
+	if err != nil {
+		c.log.Errorw("mapcache legend request", "project", projectName, "url", u.String(), zap.Error(err))
 		return "", ErrMapServer
 	}
-	return tilePath, nil
+	return legendPath, nil
 }
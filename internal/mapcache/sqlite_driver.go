@@ -0,0 +1,6 @@
+//go:build mbtiles
+
+package mapcache
+
+// pure Go SQLite driver for the MBTiles tile storage (requires modernc.org/sqlite module)
+import _ "modernc.org/sqlite"
@@ -0,0 +1,173 @@
+package mapcache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrTileNotFound = errors.New("tile not found")
+)
+
+// TileInfo describes stored tile
+type TileInfo struct {
+	Project  string
+	Layer    string
+	Z, X, Y  int
+	Size     int64
+	Modified time.Time
+}
+
+// TileStore is a storage of rendered tiles. Tiles are organized by projects (Layer.Project)
+// and layers (Layer.Name).
+type TileStore interface {
+	// Get returns tile's image data and time of its last modification, or ErrTileNotFound
+	Get(tile Tile) ([]byte, time.Time, error)
+	Has(tile Tile) bool
+	Put(tile Tile, data []byte) error
+	Delete(tile Tile) error
+	// Walk calls fn for every stored tile
+	Walk(fn func(TileInfo) error) error
+	// Clear removes all tiles of the project
+	Clear(project string) error
+	// ClearLayer removes all tiles of the project's layer
+	ClearLayer(project, layer string) error
+	Close() error
+}
+
+// removeDir moves directory out of the way, so it can be deleted in the background
+// without blocking or affecting newly rendered tiles
+func removeDir(log *zap.SugaredLogger, dir string) error {
+	trashDir := fmt.Sprintf("%s.deleted-%d", dir, time.Now().UnixNano())
+	if err := os.Rename(dir, trashDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	go func() {
+		if err := os.RemoveAll(trashDir); err != nil {
+			log.Errorw("removing mapcache directory", "path", trashDir, zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// fileStore stores tiles as individual files in the directory tree (project/tile/layer/z/x/y)
+type fileStore struct {
+	log  *zap.SugaredLogger
+	root string
+}
+
+func NewFileStore(log *zap.SugaredLogger, root string) TileStore {
+	return &fileStore{log: log, root: root}
+}
+
+func (s *fileStore) tilePath(tile Tile) string {
+	return filepath.Join(s.root, tile.Layer.Path(tile))
+}
+
+func (s *fileStore) Get(tile Tile) ([]byte, time.Time, error) {
+	path := s.tilePath(tile)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, time.Time{}, ErrTileNotFound
+		}
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, info.ModTime(), nil
+}
+
+func (s *fileStore) Has(tile Tile) bool {
+	_, err := os.Stat(s.tilePath(tile))
+	return err == nil
+}
+
+func (s *fileStore) Put(tile Tile, data []byte) error {
+	path := s.tilePath(tile)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	// write into temporary file first, so concurrent readers never get incomplete image
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("creating tile file: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (s *fileStore) Delete(tile Tile) error {
+	if err := os.Remove(s.tilePath(tile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// parseTilePath parses tile info from the path in format project/tile/layer/z/x/y
+func parseTilePath(path string) (TileInfo, bool) {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) != 6 || parts[1] != "tile" {
+		return TileInfo{}, false
+	}
+	z, errZ := strconv.Atoi(parts[3])
+	x, errX := strconv.Atoi(parts[4])
+	y, errY := strconv.Atoi(parts[5])
+	if errZ != nil || errX != nil || errY != nil {
+		return TileInfo{}, false
+	}
+	return TileInfo{Project: parts[0], Layer: parts[2], Z: z, X: x, Y: y}, true
+}
+
+func (s *fileStore) Walk(fn func(TileInfo) error) error {
+	return filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if strings.Contains(d.Name(), ".deleted-") || (path != s.root && strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, _ := filepath.Rel(s.root, path)
+		tile, ok := parseTilePath(relPath)
+		if !ok {
+			return nil
+		}
+		finfo, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		tile.Size = finfo.Size()
+		tile.Modified = finfo.ModTime()
+		return fn(tile)
+	})
+}
+
+func (s *fileStore) Clear(project string) error {
+	return removeDir(s.log, filepath.Join(s.root, project, "tile"))
+}
+
+func (s *fileStore) ClearLayer(project, layer string) error {
+	return removeDir(s.log, filepath.Join(s.root, project, "tile", layer))
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
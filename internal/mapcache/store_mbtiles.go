@@ -0,0 +1,288 @@
+package mapcache
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Name of the database/sql driver used for MBTiles files. Driver is not linked by default,
+// build with 'mbtiles' tag to include pure Go SQLite driver (modernc.org/sqlite).
+var MBTilesDriver = "sqlite"
+
+// Standard MBTiles tables, modification times of tiles are stored in the extra table
+// (additional tables are allowed by the specification)
+const mbtilesSchema = `
+CREATE TABLE IF NOT EXISTS metadata (name TEXT, value TEXT);
+CREATE UNIQUE INDEX IF NOT EXISTS name ON metadata (name);
+CREATE TABLE IF NOT EXISTS tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+CREATE UNIQUE INDEX IF NOT EXISTS tile_index ON tiles (zoom_level, tile_column, tile_row);
+CREATE TABLE IF NOT EXISTS tiles_updated (
+	zoom_level INTEGER NOT NULL,
+	tile_column INTEGER NOT NULL,
+	tile_row INTEGER NOT NULL,
+	updated INTEGER NOT NULL,
+	PRIMARY KEY (zoom_level, tile_column, tile_row)
+);
+`
+
+// mbtilesStore stores tiles of each layer (set of WMS layers) in a standard MBTiles (SQLite) file
+// (project/tile/layer.mbtiles). Tile rows use the TMS scheme (origin in the bottom left corner) as
+// the mapcache grid.
+type mbtilesStore struct {
+	log  *zap.SugaredLogger
+	root string
+	mu   sync.Mutex
+	dbs  map[string]*sql.DB
+}
+
+func NewMBTilesStore(log *zap.SugaredLogger, root string) (TileStore, error) {
+	registered := false
+	for _, d := range sql.Drivers() {
+		registered = registered || d == MBTilesDriver
+	}
+	if !registered {
+		return nil, fmt.Errorf("sql driver '%s' for mbtiles storage is not available", MBTilesDriver)
+	}
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &mbtilesStore{log: log, root: root, dbs: make(map[string]*sql.DB)}, nil
+}
+
+func (s *mbtilesStore) dbPath(project, layer string) string {
+	return filepath.Join(s.root, project, "tile", layer+".mbtiles")
+}
+
+// db returns opened MBTiles file of the layer, new file is created only when layer info
+// is given (with metadata of the layer)
+func (s *mbtilesStore) db(project, layer string, info *Layer) (*sql.DB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := s.dbPath(project, layer)
+	if db, ok := s.dbs[path]; ok {
+		return db, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		if !errors.Is(err, os.ErrNotExist) || info == nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open(MBTilesDriver, path)
+	if err != nil {
+		return nil, fmt.Errorf("opening mbtiles file: %w", err)
+	}
+	// sqlite doesn't support concurrent writes
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("setting mbtiles journal mode: %w", err)
+	}
+	if _, err := db.Exec(mbtilesSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating mbtiles schema: %w", err)
+	}
+	if info != nil {
+		format := strings.TrimPrefix(strings.ToLower(info.ImageFormat), "image/")
+		if format == "" {
+			format = "png"
+		}
+		_, err := db.Exec(
+			"INSERT OR IGNORE INTO metadata (name, value) VALUES ('name', ?), ('format', ?), ('type', 'overlay'), ('version', '1.0')",
+			layer, format,
+		)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("saving mbtiles metadata: %w", err)
+		}
+	}
+	s.dbs[path] = db
+	return db, nil
+}
+
+func (s *mbtilesStore) Get(tile Tile) ([]byte, time.Time, error) {
+	db, err := s.db(tile.Layer.Project, tile.Layer.Name, nil)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, time.Time{}, ErrTileNotFound
+		}
+		return nil, time.Time{}, err
+	}
+	var data []byte
+	var updated sql.NullInt64
+	row := db.QueryRow(
+		`SELECT t.tile_data, u.updated FROM tiles t LEFT JOIN tiles_updated u
+		ON t.zoom_level=u.zoom_level AND t.tile_column=u.tile_column AND t.tile_row=u.tile_row
+		WHERE t.zoom_level=? AND t.tile_column=? AND t.tile_row=?`,
+		tile.Z, tile.X, tile.Y,
+	)
+	if err := row.Scan(&data, &updated); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, time.Time{}, ErrTileNotFound
+		}
+		return nil, time.Time{}, err
+	}
+	return data, time.Unix(updated.Int64, 0), nil
+}
+
+func (s *mbtilesStore) Has(tile Tile) bool {
+	_, _, err := s.Get(tile)
+	return err == nil
+}
+
+func (s *mbtilesStore) Put(tile Tile, data []byte) error {
+	db, err := s.db(tile.Layer.Project, tile.Layer.Name, &tile.Layer)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)",
+		tile.Z, tile.X, tile.Y, data,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO tiles_updated (zoom_level, tile_column, tile_row, updated) VALUES (?, ?, ?, ?)",
+		tile.Z, tile.X, tile.Y, time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *mbtilesStore) Delete(tile Tile) error {
+	db, err := s.db(tile.Layer.Project, tile.Layer.Name, nil)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, table := range []string{"tiles", "tiles_updated"} {
+		_, err = db.Exec(
+			"DELETE FROM "+table+" WHERE zoom_level=? AND tile_column=? AND tile_row=?",
+			tile.Z, tile.X, tile.Y,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mbtilesStore) Walk(fn func(TileInfo) error) error {
+	files, err := filepath.Glob(filepath.Join(s.root, "*", "tile", "*.mbtiles"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		project := filepath.Base(filepath.Dir(filepath.Dir(f)))
+		layer := strings.TrimSuffix(filepath.Base(f), ".mbtiles")
+		if err := s.walkLayer(project, layer, fn); err != nil {
+			return fmt.Errorf("reading mbtiles file %s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+func (s *mbtilesStore) walkLayer(project, layer string, fn func(TileInfo) error) error {
+	db, err := s.db(project, layer, nil)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	rows, err := db.Query(
+		`SELECT t.zoom_level, t.tile_column, t.tile_row, length(t.tile_data), u.updated FROM tiles t
+		LEFT JOIN tiles_updated u
+		ON t.zoom_level=u.zoom_level AND t.tile_column=u.tile_column AND t.tile_row=u.tile_row`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	// read all rows first, fn can access the database (and only single connection is allowed)
+	var tiles []TileInfo
+	for rows.Next() {
+		t := TileInfo{Project: project, Layer: layer}
+		var updated sql.NullInt64
+		if err := rows.Scan(&t.Z, &t.X, &t.Y, &t.Size, &updated); err != nil {
+			return err
+		}
+		t.Modified = time.Unix(updated.Int64, 0)
+		tiles = append(tiles, t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	for _, t := range tiles {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeFiles closes opened MBTiles files within the directory (or the single file)
+func (s *mbtilesStore) closeFiles(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p, db := range s.dbs {
+		if p == path || strings.HasPrefix(p, path+string(filepath.Separator)) {
+			db.Close()
+			delete(s.dbs, p)
+		}
+	}
+}
+
+func (s *mbtilesStore) Clear(project string) error {
+	dir := filepath.Join(s.root, project, "tile")
+	s.closeFiles(dir)
+	if err := os.RemoveAll(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *mbtilesStore) ClearLayer(project, layer string) error {
+	path := s.dbPath(project, layer)
+	s.closeFiles(path)
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mbtilesStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, db := range s.dbs {
+		if err := db.Close(); err != nil {
+			s.log.Errorw("closing mbtiles file", "path", path, zap.Error(err))
+		}
+	}
+	s.dbs = make(map[string]*sql.DB)
+	return nil
+}
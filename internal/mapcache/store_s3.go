@@ -0,0 +1,90 @@
+package mapcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/infrastructure/s3"
+	"go.uber.org/zap"
+)
+
+// s3Store stores tiles as objects in S3 compatible storage, with the same keys layout
+// as the files in fileStore
+type s3Store struct {
+	log    *zap.SugaredLogger
+	client *s3.Client
+	prefix string
+}
+
+func NewS3Store(log *zap.SugaredLogger, client *s3.Client, prefix string) TileStore {
+	return &s3Store{log: log, client: client, prefix: prefix}
+}
+
+func (s *s3Store) key(parts ...string) string {
+	return path.Join(append([]string{s.prefix}, parts...)...)
+}
+
+func (s *s3Store) tileKey(tile Tile) string {
+	return s.key(filepath.ToSlash(tile.Layer.Path(tile)))
+}
+
+func (s *s3Store) Get(tile Tile) ([]byte, time.Time, error) {
+	r, info, err := s.client.GetObject(context.Background(), s.tileKey(tile))
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			return nil, time.Time{}, ErrTileNotFound
+		}
+		return nil, time.Time{}, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, info.LastModified, nil
+}
+
+func (s *s3Store) Has(tile Tile) bool {
+	_, err := s.client.HeadObject(context.Background(), s.tileKey(tile))
+	return err == nil
+}
+
+func (s *s3Store) Put(tile Tile, data []byte) error {
+	return s.client.PutBytes(context.Background(), s.tileKey(tile), data)
+}
+
+func (s *s3Store) Delete(tile Tile) error {
+	return s.client.DeleteObject(context.Background(), s.tileKey(tile))
+}
+
+func (s *s3Store) Walk(fn func(TileInfo) error) error {
+	prefix := s.key() + "/"
+	return s.client.ListObjects(context.Background(), prefix, func(o s3.ObjectInfo) error {
+		tile, ok := parseTilePath(strings.TrimPrefix(o.Key, prefix))
+		if !ok {
+			return nil
+		}
+		tile.Size = o.Size
+		tile.Modified = o.LastModified
+		return fn(tile)
+	})
+}
+
+// Clear removes all tile objects of the project, tiles are removed before returning, so tiles
+// rendered afterwards are never deleted
+func (s *s3Store) Clear(project string) error {
+	return s.client.DeletePrefix(context.Background(), s.key(project, "tile")+"/")
+}
+
+func (s *s3Store) ClearLayer(project, layer string) error {
+	return s.client.DeletePrefix(context.Background(), s.key(project, "tile", layer)+"/")
+}
+
+func (s *s3Store) Close() error {
+	return nil
+}
@@ -0,0 +1,252 @@
+package mapcache
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache usage is tracked by metatiles (all tiles of a metatile are rendered together,
+// so they are also evicted together)
+type metatileKey struct {
+	project string
+	layer   string
+	z, x, y int
+}
+
+type usageEntry struct {
+	key         metatileKey
+	size        int64
+	lastUsed    time.Time
+	globalElem  *list.Element
+	projectElem *list.Element
+}
+
+type projectUsage struct {
+	Name      string `json:"name,omitempty"`
+	Size      int64  `json:"size"`
+	Tiles     int    `json:"metatiles"`
+	Hits      int64  `json:"hits"`
+	Misses    int64  `json:"misses"`
+	Renders   int64  `json:"renders"`
+	Evictions int64  `json:"evictions"`
+	lru       *list.List
+}
+
+type ProjectStats struct {
+	ID string `json:"id"`
+	projectUsage
+}
+
+type CacheStats struct {
+	Size           int64          `json:"size"`
+	MaxSize        int64          `json:"max_size"`
+	MaxProjectSize int64          `json:"max_project_size"`
+	Hits           int64          `json:"hits"`
+	Misses         int64          `json:"misses"`
+	HitRatio       float64        `json:"hit_ratio"`
+	Projects       []ProjectStats `json:"projects"`
+}
+
+// usageTracker keeps size of the cached data and LRU lists of metatiles (global and per project)
+type usageTracker struct {
+	mu             sync.Mutex
+	maxSize        int64
+	maxProjectSize int64
+	size           int64
+	lru            *list.List
+	entries        map[metatileKey]*usageEntry
+	projects       map[string]*projectUsage
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{
+		maxSize:        -1,
+		maxProjectSize: -1,
+		lru:            list.New(),
+		entries:        make(map[metatileKey]*usageEntry),
+		projects:       make(map[string]*projectUsage),
+	}
+}
+
+func (u *usageTracker) project(hash string) *projectUsage {
+	p, ok := u.projects[hash]
+	if !ok {
+		p = &projectUsage{lru: list.New()}
+		u.projects[hash] = p
+	}
+	return p
+}
+
+// add registers (or updates) newly rendered metatile, returns entries which should be evicted
+// to satisfy size limits
+func (u *usageTracker) add(key metatileKey, size int64, projectName string) []metatileKey {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	p := u.project(key.project)
+	p.Name = projectName
+	if e, ok := u.entries[key]; ok {
+		u.size += size - e.size
+		p.Size += size - e.size
+		e.size = size
+		u.touchEntry(e, time.Now())
+	} else {
+		e := &usageEntry{key: key, size: size, lastUsed: time.Now()}
+		e.globalElem = u.lru.PushFront(e)
+		e.projectElem = p.lru.PushFront(e)
+		u.entries[key] = e
+		u.size += size
+		p.Size += size
+		p.Tiles++
+	}
+	return u.evictions(key.project)
+}
+
+// load registers metatiles found in the tiles storage, they are considered as older
+// than all metatiles used since the start
+func (u *usageTracker) load(entries []*usageEntry) []metatileKey {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.After(entries[j].lastUsed)
+	})
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	projects := make(map[string]bool)
+	for _, e := range entries {
+		if _, exists := u.entries[e.key]; exists {
+			continue
+		}
+		p := u.project(e.key.project)
+		e.globalElem = u.lru.PushBack(e)
+		e.projectElem = p.lru.PushBack(e)
+		u.entries[e.key] = e
+		u.size += e.size
+		p.Size += e.size
+		p.Tiles++
+		projects[e.key.project] = true
+	}
+	var evicted []metatileKey
+	for project := range projects {
+		evicted = append(evicted, u.evictions(project)...)
+	}
+	return evicted
+}
+
+func (u *usageTracker) setLimits(maxSize, maxProjectSize int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.maxSize = maxSize
+	u.maxProjectSize = maxProjectSize
+}
+
+func (u *usageTracker) touchEntry(e *usageEntry, used time.Time) {
+	e.lastUsed = used
+	u.lru.MoveToFront(e.globalElem)
+	u.projects[e.key.project].lru.MoveToFront(e.projectElem)
+}
+
+func (u *usageTracker) touch(key metatileKey) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if e, ok := u.entries[key]; ok {
+		u.touchEntry(e, time.Now())
+	}
+}
+
+func (u *usageTracker) removeEntry(e *usageEntry) {
+	p := u.projects[e.key.project]
+	u.lru.Remove(e.globalElem)
+	p.lru.Remove(e.projectElem)
+	delete(u.entries, e.key)
+	u.size -= e.size
+	p.Size -= e.size
+	p.Tiles--
+}
+
+// evictions selects least recently used entries exceeding project's or global size limit
+func (u *usageTracker) evictions(project string) []metatileKey {
+	var evicted []metatileKey
+	if p := u.projects[project]; p != nil && u.maxProjectSize > 0 {
+		for p.Size > u.maxProjectSize && p.lru.Len() > 1 {
+			e := p.lru.Back().Value.(*usageEntry)
+			u.removeEntry(e)
+			p.Evictions++
+			evicted = append(evicted, e.key)
+		}
+	}
+	if u.maxSize > 0 {
+		for u.size > u.maxSize && u.lru.Len() > 1 {
+			e := u.lru.Back().Value.(*usageEntry)
+			u.removeEntry(e)
+			u.projects[e.key.project].Evictions++
+			evicted = append(evicted, e.key)
+		}
+	}
+	return evicted
+}
+
+// removeProject discards all project's entries (statistics counters are kept)
+func (u *usageTracker) removeProject(project string) {
+	u.removeWhere(project, func(key metatileKey) bool { return true })
+}
+
+func (u *usageTracker) removeLayer(project, layer string) {
+	u.removeWhere(project, func(key metatileKey) bool { return key.layer == layer })
+}
+
+func (u *usageTracker) removeWhere(project string, match func(key metatileKey) bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	p, ok := u.projects[project]
+	if !ok {
+		return
+	}
+	for el := p.lru.Front(); el != nil; {
+		next := el.Next()
+		if e := el.Value.(*usageEntry); match(e.key) {
+			u.removeEntry(e)
+		}
+		el = next
+	}
+}
+
+func (u *usageTracker) count(project, projectName string, hit bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	p := u.project(project)
+	p.Name = projectName
+	if hit {
+		p.Hits++
+	} else {
+		p.Misses++
+	}
+}
+
+func (u *usageTracker) rendered(project string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.project(project).Renders++
+}
+
+func (u *usageTracker) stats() CacheStats {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	stats := CacheStats{
+		Size:           u.size,
+		MaxSize:        u.maxSize,
+		MaxProjectSize: u.maxProjectSize,
+		Projects:       make([]ProjectStats, 0, len(u.projects)),
+	}
+	for hash, p := range u.projects {
+		stats.Hits += p.Hits
+		stats.Misses += p.Misses
+		stats.Projects = append(stats.Projects, ProjectStats{ID: hash, projectUsage: *p})
+	}
+	if stats.Hits+stats.Misses > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+	}
+	sort.Slice(stats.Projects, func(i, j int) bool {
+		return stats.Projects[i].Size > stats.Projects[j].Size
+	})
+	return stats
+}
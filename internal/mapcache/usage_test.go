@@ -0,0 +1,125 @@
+package mapcache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tileKey(project string, x int) metatileKey {
+	return metatileKey{project: project, layer: "layer", z: 10, x: x, y: 0}
+}
+
+func checkEvicted(t *testing.T, evicted []metatileKey, expected ...metatileKey) {
+	t.Helper()
+	if len(evicted) == 0 && len(expected) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(evicted, expected) {
+		t.Errorf("evicted %v, expected %v", evicted, expected)
+	}
+}
+
+func checkSize(t *testing.T, u *usageTracker, size int64, projects map[string]int64) {
+	t.Helper()
+	if u.size != size {
+		t.Errorf("size %d, expected %d", u.size, size)
+	}
+	for project, projectSize := range projects {
+		if p := u.projects[project]; p.Size != projectSize || p.Tiles != p.lru.Len() {
+			t.Errorf("project %s: size %d (%d tiles, %d entries), expected %d", project, p.Size, p.Tiles, p.lru.Len(), projectSize)
+		}
+	}
+}
+
+func TestUsageEvictionOrder(t *testing.T) {
+	u := newUsageTracker()
+	u.setLimits(300, -1)
+	checkEvicted(t, u.add(tileKey("p1", 1), 100, ""))
+	checkEvicted(t, u.add(tileKey("p1", 2), 100, ""))
+	checkEvicted(t, u.add(tileKey("p2", 1), 100, ""))
+	// least recently used metatile is evicted
+	checkEvicted(t, u.add(tileKey("p2", 2), 100, ""), tileKey("p1", 1))
+
+	// used metatile is moved to the front
+	u.touch(tileKey("p1", 2))
+	checkEvicted(t, u.add(tileKey("p2", 3), 100, ""), tileKey("p2", 1))
+
+	// multiple metatiles are evicted to fit the new one
+	checkEvicted(t, u.add(tileKey("p1", 3), 250, ""), tileKey("p2", 2), tileKey("p1", 2), tileKey("p2", 3))
+	checkSize(t, u, 250, map[string]int64{"p1": 250, "p2": 0})
+
+	// metatile exceeding the limit is kept when it's the only one
+	checkEvicted(t, u.add(tileKey("p1", 4), 400, ""), tileKey("p1", 3))
+	checkSize(t, u, 400, map[string]int64{"p1": 400})
+
+	if u.projects["p1"].Evictions != 3 || u.projects["p2"].Evictions != 3 {
+		t.Errorf("evictions: p1 %d, p2 %d", u.projects["p1"].Evictions, u.projects["p2"].Evictions)
+	}
+}
+
+func TestUsageProjectLimit(t *testing.T) {
+	u := newUsageTracker()
+	u.setLimits(1000, 200)
+	u.add(tileKey("p1", 1), 100, "")
+	u.add(tileKey("p2", 1), 100, "")
+	u.add(tileKey("p1", 2), 100, "")
+	// only metatiles of the same project are evicted, even when other projects are used less recently
+	checkEvicted(t, u.add(tileKey("p1", 3), 100, ""), tileKey("p1", 1))
+	u.touch(tileKey("p1", 2))
+	checkEvicted(t, u.add(tileKey("p1", 4), 100, ""), tileKey("p1", 3))
+	checkSize(t, u, 300, map[string]int64{"p1": 200, "p2": 100})
+}
+
+func TestUsageUpdate(t *testing.T) {
+	u := newUsageTracker()
+	u.setLimits(300, -1)
+	u.add(tileKey("p1", 1), 100, "")
+	u.add(tileKey("p1", 2), 100, "")
+	u.add(tileKey("p1", 3), 100, "")
+	// re-rendered metatile updates size and is moved to the front
+	checkEvicted(t, u.add(tileKey("p1", 1), 150, ""), tileKey("p1", 2))
+	checkSize(t, u, 250, map[string]int64{"p1": 250})
+	if u.projects["p1"].Tiles != 2 {
+		t.Errorf("tiles %d, expected 2", u.projects["p1"].Tiles)
+	}
+}
+
+func TestUsageLoad(t *testing.T) {
+	u := newUsageTracker()
+	u.setLimits(400, -1)
+	u.add(tileKey("p1", 1), 100, "")
+
+	now := time.Now()
+	entries := []*usageEntry{
+		{key: tileKey("p1", 2), size: 100, lastUsed: now.Add(-3 * time.Hour)},
+		{key: tileKey("p1", 3), size: 100, lastUsed: now.Add(-1 * time.Hour)},
+		{key: tileKey("p2", 1), size: 100, lastUsed: now.Add(-2 * time.Hour)},
+		// already tracked metatile is not loaded again
+		{key: tileKey("p1", 1), size: 100, lastUsed: now.Add(-4 * time.Hour)},
+		{key: tileKey("p2", 2), size: 100, lastUsed: now.Add(-5 * time.Hour)},
+	}
+	// loaded metatiles are older than the used ones and they are evicted from the oldest
+	checkEvicted(t, u.load(entries), tileKey("p2", 2))
+	checkSize(t, u, 400, map[string]int64{"p1": 300, "p2": 100})
+	checkEvicted(t, u.add(tileKey("p3", 1), 100, ""), tileKey("p1", 2))
+	checkEvicted(t, u.add(tileKey("p3", 2), 100, ""), tileKey("p2", 1))
+	checkEvicted(t, u.add(tileKey("p3", 3), 100, ""), tileKey("p1", 3))
+	checkEvicted(t, u.add(tileKey("p3", 4), 100, ""), tileKey("p1", 1))
+}
+
+func TestUsageRemove(t *testing.T) {
+	u := newUsageTracker()
+	u.add(tileKey("p1", 1), 100, "")
+	u.add(metatileKey{project: "p1", layer: "other", z: 10}, 100, "")
+	u.add(tileKey("p2", 1), 100, "")
+	u.removeLayer("p1", "layer")
+	checkSize(t, u, 200, map[string]int64{"p1": 100, "p2": 100})
+	u.removeProject("p1")
+	checkSize(t, u, 100, map[string]int64{"p1": 0, "p2": 100})
+	u.removeProject("unknown")
+
+	u.setLimits(200, -1)
+	checkEvicted(t, u.add(tileKey("p1", 2), 100, ""))
+	checkEvicted(t, u.add(tileKey("p1", 3), 100, ""), tileKey("p2", 1))
+}
@@ -0,0 +1,214 @@
+package mapcache
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+// standardized rendering pixel size (0.28mm) used for computation of WMTS scale denominators
+const pixelSize = 0.00028
+
+// MetersPerUnit returns size of the projection's map unit in meters
+func MetersPerUnit(proj *domain.Projection) float64 {
+	if proj == nil {
+		return 1
+	}
+	if proj.IsGeografic {
+		return 6378137 * 2 * math.Pi / 360
+	}
+	if strings.Contains(proj.Proj4, "+units=us-ft") {
+		return 1200.0 / 3937.0
+	}
+	if strings.Contains(proj.Proj4, "+units=ft") {
+		return 0.3048
+	}
+	return 1
+}
+
+// MatrixSize returns number of tile columns and rows of the grid on the given zoom level
+func (l Layer) MatrixSize(z int) (int, int) {
+	grid, err := l.Grid(z)
+	if err != nil {
+		return 0, 0
+	}
+	return int(math.Ceil(grid[0])), int(math.Ceil(grid[1]))
+}
+
+// TopOriginTile creates tile from coordinates with the origin in the top left corner
+// of the grid (as used in WMTS and XYZ services), mapcache grid has origin in the bottom left corner
+func (l Layer) TopOriginTile(z, x, y int) Tile {
+	_, rows := l.MatrixSize(z)
+	return Tile{Layer: l, X: x, Y: rows - 1 - y, Z: z}
+}
+
+type TileMatrix struct {
+	Identifier       string  `xml:"ows:Identifier"`
+	ScaleDenominator float64 `xml:"ScaleDenominator"`
+	TopLeftCorner    string  `xml:"TopLeftCorner"`
+	TileWidth        int     `xml:"TileWidth"`
+	TileHeight       int     `xml:"TileHeight"`
+	MatrixWidth      int     `xml:"MatrixWidth"`
+	MatrixHeight     int     `xml:"MatrixHeight"`
+}
+
+// TileMatrices describes the layer's grid as WMTS tile matrices. Geographic coordinates
+// are written in lat/lon order as required by EPSG definition.
+func (l Layer) TileMatrices(metersPerUnit float64, geographic bool) []TileMatrix {
+	matrices := make([]TileMatrix, len(l.Resolutions))
+	for z, res := range l.Resolutions {
+		cols, rows := l.MatrixSize(z)
+		top := l.Extent[1] + float64(rows*l.TileSize)*res
+		corner := fmt.Sprintf("%f %f", l.Extent[0], top)
+		if geographic {
+			corner = fmt.Sprintf("%f %f", top, l.Extent[0])
+		}
+		matrices[z] = TileMatrix{
+			Identifier:       fmt.Sprint(z),
+			ScaleDenominator: res * metersPerUnit / pixelSize,
+			TopLeftCorner:    corner,
+			TileWidth:        l.TileSize,
+			TileHeight:       l.TileSize,
+			MatrixWidth:      cols,
+			MatrixHeight:     rows,
+		}
+	}
+	return matrices
+}
+
+type WMTSLayer struct {
+	Name   string
+	Title  string
+	Extent []float64
+}
+
+// WMTSConfig contains all information needed for generating of WMTS capabilities document
+type WMTSConfig struct {
+	Title         string
+	ServiceURL    string
+	TileURL       string // RESTful template with {Layer}, {TileMatrix}, {TileRow} and {TileCol} variables
+	Projection    string
+	Geographic    bool
+	MetersPerUnit float64
+	Grid          Layer
+	Layers        []WMTSLayer
+}
+
+type owsGet struct {
+	Href     string `xml:"xlink:href,attr"`
+	Encoding string `xml:"ows:Constraint>ows:AllowedValues>ows:Value"`
+}
+
+type owsOperation struct {
+	Name string `xml:"name,attr"`
+	Get  owsGet `xml:"ows:DCP>ows:HTTP>ows:Get"`
+}
+
+type wmtsBoundingBox struct {
+	CRS         string `xml:"crs,attr"`
+	LowerCorner string `xml:"ows:LowerCorner"`
+	UpperCorner string `xml:"ows:UpperCorner"`
+}
+
+type wmtsResourceURL struct {
+	Format       string `xml:"format,attr"`
+	ResourceType string `xml:"resourceType,attr"`
+	Template     string `xml:"template,attr"`
+}
+
+type wmtsLayer struct {
+	Title         string           `xml:"ows:Title"`
+	Identifier    string           `xml:"ows:Identifier"`
+	BoundingBox   *wmtsBoundingBox `xml:"ows:BoundingBox,omitempty"`
+	Style         string           `xml:"Style>ows:Identifier"`
+	Format        string           `xml:"Format"`
+	TileMatrixSet string           `xml:"TileMatrixSetLink>TileMatrixSet"`
+	ResourceURL   wmtsResourceURL  `xml:"ResourceURL"`
+}
+
+type wmtsTileMatrixSet struct {
+	Identifier   string       `xml:"ows:Identifier"`
+	SupportedCRS string       `xml:"ows:SupportedCRS"`
+	TileMatrices []TileMatrix `xml:"TileMatrix"`
+}
+
+type wmtsCapabilities struct {
+	XMLName        xml.Name          `xml:"Capabilities"`
+	Xmlns          string            `xml:"xmlns,attr"`
+	XmlnsOws       string            `xml:"xmlns:ows,attr"`
+	XmlnsXlink     string            `xml:"xmlns:xlink,attr"`
+	Version        string            `xml:"version,attr"`
+	Title          string            `xml:"ows:ServiceIdentification>ows:Title"`
+	ServiceType    string            `xml:"ows:ServiceIdentification>ows:ServiceType"`
+	ServiceVersion string            `xml:"ows:ServiceIdentification>ows:ServiceTypeVersion"`
+	Operations     []owsOperation    `xml:"ows:OperationsMetadata>ows:Operation"`
+	Layers         []wmtsLayer       `xml:"Contents>Layer"`
+	TileMatrixSet  wmtsTileMatrixSet `xml:"Contents>TileMatrixSet"`
+}
+
+// crsURN converts projection code (e.g. EPSG:3857) to OGC URN
+func crsURN(code string) string {
+	parts := strings.SplitN(code, ":", 2)
+	if len(parts) != 2 {
+		return code
+	}
+	return fmt.Sprintf("urn:ogc:def:crs:%s::%s", parts[0], parts[1])
+}
+
+// WMTSCapabilities generates WMTS GetCapabilities document
+func WMTSCapabilities(cfg WMTSConfig) ([]byte, error) {
+	crs := crsURN(cfg.Projection)
+	doc := wmtsCapabilities{
+		Xmlns:          "http://www.opengis.net/wmts/1.0",
+		XmlnsOws:       "http://www.opengis.net/ows/1.1",
+		XmlnsXlink:     "http://www.w3.org/1999/xlink",
+		Version:        "1.0.0",
+		Title:          cfg.Title,
+		ServiceType:    "OGC WMTS",
+		ServiceVersion: "1.0.0",
+		Operations: []owsOperation{
+			{Name: "GetCapabilities", Get: owsGet{Href: cfg.ServiceURL + "?", Encoding: "KVP"}},
+			{Name: "GetTile", Get: owsGet{Href: cfg.ServiceURL + "?", Encoding: "KVP"}},
+		},
+		TileMatrixSet: wmtsTileMatrixSet{
+			Identifier:   cfg.Projection,
+			SupportedCRS: crs,
+			TileMatrices: cfg.Grid.TileMatrices(cfg.MetersPerUnit, cfg.Geographic),
+		},
+	}
+	for _, l := range cfg.Layers {
+		layer := wmtsLayer{
+			Title:         l.Title,
+			Identifier:    l.Name,
+			Style:         "default",
+			Format:        cfg.Grid.Format(),
+			TileMatrixSet: cfg.Projection,
+			ResourceURL: wmtsResourceURL{
+				Format:       cfg.Grid.Format(),
+				ResourceType: "tile",
+				Template:     strings.ReplaceAll(cfg.TileURL, "{Layer}", url.PathEscape(l.Name)),
+			},
+		}
+		if len(l.Extent) == 4 {
+			layer.BoundingBox = &wmtsBoundingBox{
+				CRS:         crs,
+				LowerCorner: fmt.Sprintf("%f %f", l.Extent[0], l.Extent[1]),
+				UpperCorner: fmt.Sprintf("%f %f", l.Extent[2], l.Extent[3]),
+			}
+			if cfg.Geographic {
+				layer.BoundingBox.LowerCorner = fmt.Sprintf("%f %f", l.Extent[1], l.Extent[0])
+				layer.BoundingBox.UpperCorner = fmt.Sprintf("%f %f", l.Extent[3], l.Extent[2])
+			}
+		}
+		doc.Layers = append(doc.Layers, layer)
+	}
+	content, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
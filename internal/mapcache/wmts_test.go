@@ -0,0 +1,179 @@
+package mapcache
+
+import (
+	"encoding/xml"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+)
+
+func testGrid() Layer {
+	return Layer{
+		Extent:      []float64{0, 0, 1000, 600},
+		TileSize:    256,
+		ImageFormat: "jpg",
+		Resolutions: []float64{1, 0.5},
+	}
+}
+
+func TestMetersPerUnit(t *testing.T) {
+	tests := []struct {
+		name string
+		proj *domain.Projection
+		mpu  float64
+	}{
+		{"unknown projection", nil, 1},
+		{"meters", &domain.Projection{Proj4: "+proj=merc +units=m +no_defs"}, 1},
+		{"geographic", &domain.Projection{Proj4: "+proj=longlat +datum=WGS84 +no_defs", IsGeografic: true}, 111319.490793},
+		{"feet", &domain.Projection{Proj4: "+proj=tmerc +units=ft +no_defs"}, 0.3048},
+		{"us feet", &domain.Projection{Proj4: "+proj=lcc +units=us-ft +no_defs"}, 0.304800609601},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mpu := MetersPerUnit(tt.proj); math.Abs(mpu-tt.mpu) > 1e-6 {
+				t.Errorf("meters per unit %f, expected %f", mpu, tt.mpu)
+			}
+		})
+	}
+}
+
+func TestTileMatrices(t *testing.T) {
+	expected := []TileMatrix{
+		{Identifier: "0", ScaleDenominator: 1 / pixelSize, TopLeftCorner: "0.000000 768.000000", TileWidth: 256, TileHeight: 256, MatrixWidth: 4, MatrixHeight: 3},
+		{Identifier: "1", ScaleDenominator: 0.5 / pixelSize, TopLeftCorner: "0.000000 640.000000", TileWidth: 256, TileHeight: 256, MatrixWidth: 8, MatrixHeight: 5},
+	}
+	if matrices := testGrid().TileMatrices(1, false); !reflect.DeepEqual(matrices, expected) {
+		t.Errorf("tile matrices %+v, expected %+v", matrices, expected)
+	}
+
+	// top left corner of geographic grid is in lat/lon order
+	grid := Layer{Extent: []float64{10, 40, 20, 50}, TileSize: 256, Resolutions: []float64{0.05}}
+	matrices := grid.TileMatrices(100000, true)
+	if len(matrices) != 1 {
+		t.Fatalf("%d tile matrices, expected 1", len(matrices))
+	}
+	m := matrices[0]
+	if m.TopLeftCorner != "52.800000 10.000000" || m.MatrixWidth != 1 || m.MatrixHeight != 1 {
+		t.Errorf("unexpected tile matrix %+v", m)
+	}
+	if math.Abs(m.ScaleDenominator-0.05*100000/pixelSize) > 1e-6 {
+		t.Errorf("scale denominator %f", m.ScaleDenominator)
+	}
+}
+
+func TestTopOriginTile(t *testing.T) {
+	grid := testGrid()
+	tests := []struct {
+		z, x, y int
+		tile    [3]int
+	}{
+		{0, 0, 0, [3]int{0, 2, 0}},
+		{0, 3, 2, [3]int{3, 0, 0}},
+		{1, 5, 1, [3]int{5, 3, 1}},
+	}
+	for _, tt := range tests {
+		tile := grid.TopOriginTile(tt.z, tt.x, tt.y)
+		if [3]int{tile.X, tile.Y, tile.Z} != tt.tile {
+			t.Errorf("%d/%d/%d: tile %d/%d/%d, expected %v", tt.z, tt.x, tt.y, tile.X, tile.Y, tile.Z, tt.tile)
+		}
+		if !grid.ContainsTile(tile) {
+			t.Errorf("%d/%d/%d: tile out of grid", tt.z, tt.x, tt.y)
+		}
+	}
+	if grid.ContainsTile(grid.TopOriginTile(0, 0, 3)) {
+		t.Error("tile out of grid was accepted")
+	}
+}
+
+// capabilities document elements are matched by local names
+type testCapabilities struct {
+	Version    string `xml:"version,attr"`
+	Title      string `xml:"ServiceIdentification>Title"`
+	Operations []struct {
+		Name string `xml:"name,attr"`
+		Get  struct {
+			Href string `xml:"href,attr"`
+		} `xml:"DCP>HTTP>Get"`
+	} `xml:"OperationsMetadata>Operation"`
+	Layers []struct {
+		Identifier  string `xml:"Identifier"`
+		Title       string `xml:"Title"`
+		Format      string `xml:"Format"`
+		MatrixSet   string `xml:"TileMatrixSetLink>TileMatrixSet"`
+		BoundingBox struct {
+			CRS         string `xml:"crs,attr"`
+			LowerCorner string `xml:"LowerCorner"`
+			UpperCorner string `xml:"UpperCorner"`
+		} `xml:"BoundingBox"`
+		Resource struct {
+			Template string `xml:"template,attr"`
+		} `xml:"ResourceURL"`
+	} `xml:"Contents>Layer"`
+	MatrixSet struct {
+		Identifier   string `xml:"Identifier"`
+		SupportedCRS string `xml:"SupportedCRS"`
+		TileMatrices []struct {
+			Identifier    string `xml:"Identifier"`
+			TopLeftCorner string `xml:"TopLeftCorner"`
+			MatrixWidth   int    `xml:"MatrixWidth"`
+			MatrixHeight  int    `xml:"MatrixHeight"`
+		} `xml:"TileMatrix"`
+	} `xml:"Contents>TileMatrixSet"`
+}
+
+func TestWMTSCapabilities(t *testing.T) {
+	doc, err := WMTSCapabilities(WMTSConfig{
+		Title:         "Roads & rivers",
+		ServiceURL:    "https://example.com/api/map/wmts/user1/roads",
+		TileURL:       "https://example.com/api/map/wmts/user1/roads/tile/{Layer}/{TileMatrix}/{TileRow}/{TileCol}.jpeg",
+		Projection:    "EPSG:4326",
+		Geographic:    true,
+		MetersPerUnit: 1,
+		Grid:          testGrid(),
+		Layers: []WMTSLayer{
+			{Name: "roads/main", Title: "Main roads", Extent: []float64{10, 40, 20, 50}},
+			{Name: "rivers", Title: "Rivers"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var caps testCapabilities
+	if err := xml.Unmarshal(doc, &caps); err != nil {
+		t.Fatalf("invalid capabilities document: %v", err)
+	}
+	if caps.Version != "1.0.0" || caps.Title != "Roads & rivers" {
+		t.Errorf("unexpected service identification: %s %q", caps.Version, caps.Title)
+	}
+	if len(caps.Operations) != 2 || caps.Operations[1].Name != "GetTile" || caps.Operations[1].Get.Href != "https://example.com/api/map/wmts/user1/roads?" {
+		t.Errorf("unexpected operations: %+v", caps.Operations)
+	}
+	if len(caps.Layers) != 2 {
+		t.Fatalf("%d layers, expected 2", len(caps.Layers))
+	}
+	roads, rivers := caps.Layers[0], caps.Layers[1]
+	if roads.Identifier != "roads/main" || roads.Title != "Main roads" || roads.Format != "image/jpeg" || roads.MatrixSet != "EPSG:4326" {
+		t.Errorf("unexpected layer: %+v", roads)
+	}
+	if roads.Resource.Template != "https://example.com/api/map/wmts/user1/roads/tile/roads%2Fmain/{TileMatrix}/{TileRow}/{TileCol}.jpeg" {
+		t.Errorf("unexpected tile template: %s", roads.Resource.Template)
+	}
+	if box := roads.BoundingBox; box.CRS != "urn:ogc:def:crs:EPSG::4326" || box.LowerCorner != "40.000000 10.000000" || box.UpperCorner != "50.000000 20.000000" {
+		t.Errorf("unexpected bounding box: %+v", box)
+	}
+	if rivers.BoundingBox.CRS != "" {
+		t.Errorf("bounding box of the layer without extent: %+v", rivers.BoundingBox)
+	}
+	if caps.MatrixSet.Identifier != "EPSG:4326" || caps.MatrixSet.SupportedCRS != "urn:ogc:def:crs:EPSG::4326" {
+		t.Errorf("unexpected tile matrix set: %s %s", caps.MatrixSet.Identifier, caps.MatrixSet.SupportedCRS)
+	}
+	matrices := caps.MatrixSet.TileMatrices
+	if len(matrices) != 2 {
+		t.Fatalf("%d tile matrices, expected 2", len(matrices))
+	}
+	if m := matrices[1]; m.Identifier != "1" || m.TopLeftCorner != "640.000000 0.000000" || m.MatrixWidth != 8 || m.MatrixHeight != 5 {
+		t.Errorf("unexpected tile matrix %+v", m)
+	}
+}
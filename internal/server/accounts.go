@@ -230,6 +230,7 @@ func (s *Server) handleChangePassword() func(echo.Context) error {
 func (s *Server) handleGetAccountInfo() func(echo.Context) error {
 	type Payload struct {
 		AccountLimits domain.AccountConfig `json:"limits"`
+		StorageUsage  int64                `json:"storage_usage"`
 	}
 	return func(c echo.Context) error {
 		user, err := s.auth.GetUser(c)
@@ -241,6 +242,10 @@ func (s *Server) handleGetAccountInfo() func(echo.Context) error {
 			s.log.Errorw("getting user account limits", "user", user.Username, zap.Error(err))
 			return fmt.Errorf("Failed to load user account limits")
 		}
-		return c.JSON(http.StatusOK, Payload{AccountLimits: limits})
+		usage, err := s.projects.AccountUsage(user.Username)
+		if err != nil {
+			s.log.Errorw("getting user storage usage", "user", user.Username, zap.Error(err))
+		}
+		return c.JSON(http.StatusOK, Payload{AccountLimits: limits, StorageUsage: usage})
 	}
 }
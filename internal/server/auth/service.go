@@ -21,11 +21,14 @@ var (
 	ErrUserNotFound    = errors.New("User not found")
 	ErrInvalidPassword = errors.New("Password doesn't match")
 	ErrInvalidSession  = errors.New("Invalid session")
+	ErrInvalidToken    = errors.New("Invalid API token")
+	ErrTokenScope      = errors.New("API token doesn't have required scope")
 	AnonymousUser      = domain.User{IsGuest: true}
 )
 
 const (
-	basic = "basic"
+	basic  = "basic"
+	bearer = "bearer"
 )
 
 type SessionInfo struct {
@@ -79,6 +82,8 @@ type AuthService struct {
 	store          SessionStore
 	cache          *ttlcache.Cache[string, domain.User]
 	basicAuthCache *ttlcache.Cache[string, domain.User]
+	tokens         domain.TokensRepository
+	tokenCache     *ttlcache.Cache[string, tokenUser]
 }
 
 func NewAuthService(logger *zap.SugaredLogger, expiration time.Duration, accounts domain.AccountsRepository, store SessionStore) *AuthService {
@@ -113,6 +118,12 @@ func NewAuthService(logger *zap.SugaredLogger, expiration time.Duration, account
 	}
 }
 
+// SetTokens enables authentication with API tokens
+func (s *AuthService) SetTokens(tokens domain.TokensRepository) {
+	s.tokens = tokens
+	s.tokenCache = newTokenCache(s.logger, tokens, s.accounts)
+}
+
 func (s *AuthService) GetSessionInfo(c echo.Context) (*SessionInfo, error) {
 	si, saved := c.Get("session").(SessionInfo)
 	if saved {
@@ -147,7 +158,13 @@ func (s *AuthService) GetUser(c echo.Context) (domain.User, error) {
 		return user, nil
 	}
 	auth := c.Request().Header.Get("Authorization")
-	if auth != "" {
+	if IsTokenAuth(auth) {
+		var err error
+		user, err = s.getTokenUser(c, auth[len(bearer)+1:])
+		if err != nil {
+			return AnonymousUser, err
+		}
+	} else if auth != "" {
 		if item := s.basicAuthCache.Get(auth); item != nil {
 			user = item.Value()
 		} else {
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gofrs/uuid"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// tokenPrefix makes API tokens easily recognizable (e.g. by secret scanners)
+const tokenPrefix = "gqt_"
+
+const tokenScopeKey = "token_scope"
+
+// unknown or disabled tokens are cached for a short period, so invalid tokens don't query
+// the database on every request
+const invalidTokenTTL = 10 * time.Second
+
+// maximal number of cached tokens (including invalid ones)
+const tokenCacheCapacity = 10000
+
+// tokenUser is a cached API token with its user, invalid token has empty ID
+type tokenUser struct {
+	token domain.APIToken
+	user  domain.User
+}
+
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func newTokenCache(logger *zap.SugaredLogger, tokens domain.TokensRepository, accounts domain.AccountsRepository) *ttlcache.Cache[string, tokenUser] {
+	loader := ttlcache.LoaderFunc[string, tokenUser](
+		func(c *ttlcache.Cache[string, tokenUser], hash string) *ttlcache.Item[string, tokenUser] {
+			token, err := tokens.GetByHash(hash)
+			if err != nil {
+				if errors.Is(err, domain.ErrTokenNotExists) {
+					return c.Set(hash, tokenUser{}, invalidTokenTTL)
+				}
+				logger.Errorw("getting API token", zap.Error(err))
+				return nil
+			}
+			account, err := accounts.GetByUsername(token.Username)
+			if err != nil {
+				logger.Errorw("getting account of API token", "username", token.Username, zap.Error(err))
+				return nil
+			}
+			if !account.Active {
+				return c.Set(hash, tokenUser{}, invalidTokenTTL)
+			}
+			// time of the last usage is tracked with precision of the cache's TTL
+			if !token.Expired() {
+				now := time.Now().UTC()
+				if err := tokens.UpdateLastUsed(token.ID, now); err != nil {
+					logger.Warnw("updating time of last API token usage", zap.Error(err))
+				} else {
+					token.LastUsed = &now
+				}
+			}
+			return c.Set(hash, tokenUser{token: token, user: AccountToUser(account)}, ttlcache.DefaultTTL)
+		},
+	)
+	return ttlcache.New(
+		ttlcache.WithTTL[string, tokenUser](45*time.Second),
+		ttlcache.WithCapacity[string, tokenUser](tokenCacheCapacity),
+		ttlcache.WithLoader[string, tokenUser](loader),
+		ttlcache.WithDisableTouchOnHit[string, tokenUser](),
+	)
+}
+
+// IsTokenAuth checks whether the value of Authorization header contains API token
+func IsTokenAuth(auth string) bool {
+	return len(auth) > len(bearer)+1 && strings.EqualFold(auth[:len(bearer)], bearer) && auth[len(bearer)] == ' '
+}
+
+// SetTokenScope sets the scope required from API tokens by the current route, requests
+// with API token on routes without the scope are handled as anonymous
+func SetTokenScope(c echo.Context, scope string) {
+	c.Set(tokenScopeKey, scope)
+}
+
+func (s *AuthService) getTokenUser(c echo.Context, value string) (domain.User, error) {
+	scope, _ := c.Get(tokenScopeKey).(string)
+	if scope == "" || s.tokens == nil {
+		return AnonymousUser, nil
+	}
+	if !strings.HasPrefix(value, tokenPrefix) {
+		return AnonymousUser, ErrInvalidToken
+	}
+	item := s.tokenCache.Get(hashToken(value))
+	if item == nil {
+		return AnonymousUser, ErrInvalidToken
+	}
+	tu := item.Value()
+	if tu.token.ID == "" || tu.token.Expired() {
+		return AnonymousUser, ErrInvalidToken
+	}
+	if !tu.token.HasScope(scope) {
+		return AnonymousUser, ErrTokenScope
+	}
+	return tu.user, nil
+}
+
+// CreateToken creates a new API token of the user. Returned value of the token is not stored
+// anywhere, so it cannot be obtained later.
+func (s *AuthService) CreateToken(username, name string, scopes []string, expires *time.Time) (domain.APIToken, string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return domain.APIToken{}, "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return domain.APIToken{}, "", fmt.Errorf("generating token: %w", err)
+	}
+	value := tokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	token := domain.APIToken{
+		ID:       id.String(),
+		Username: username,
+		Name:     name,
+		Scopes:   scopes,
+		Created:  time.Now().UTC(),
+		Expires:  expires,
+	}
+	if err := s.tokens.Create(token, hashToken(value)); err != nil {
+		return domain.APIToken{}, "", err
+	}
+	return token, value, nil
+}
+
+func (s *AuthService) ListTokens(username string) ([]domain.APIToken, error) {
+	return s.tokens.List(username)
+}
+
+// RevokeToken deletes the user's API token, the token is rejected immediately
+func (s *AuthService) RevokeToken(username, id string) error {
+	if err := s.tokens.Delete(username, id); err != nil {
+		return err
+	}
+	for hash, item := range s.tokenCache.Items() {
+		if item.Value().token.ID == id {
+			s.tokenCache.Delete(hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// testTokens is an in-memory tokens repository
+type testTokens struct {
+	mu     sync.Mutex
+	tokens map[string]domain.APIToken // by hash
+	loads  int
+}
+
+func (r *testTokens) Create(token domain.APIToken, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[hash] = token
+	return nil
+}
+
+func (r *testTokens) GetByHash(hash string) (domain.APIToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loads++
+	token, ok := r.tokens[hash]
+	if !ok {
+		return domain.APIToken{}, domain.ErrTokenNotExists
+	}
+	return token, nil
+}
+
+func (r *testTokens) List(username string) ([]domain.APIToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tokens []domain.APIToken
+	for _, t := range r.tokens {
+		if t.Username == username {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *testTokens) Delete(username, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for hash, t := range r.tokens {
+		if t.Username == username && t.ID == id {
+			delete(r.tokens, hash)
+			return nil
+		}
+	}
+	return domain.ErrTokenNotExists
+}
+
+func (r *testTokens) UpdateLastUsed(id string, t time.Time) error {
+	return nil
+}
+
+// testAccounts is an accounts repository with fixed accounts
+type testAccounts struct {
+	domain.AccountsRepository
+	accounts map[string]domain.Account
+}
+
+func (r *testAccounts) GetByUsername(username string) (domain.Account, error) {
+	account, ok := r.accounts[username]
+	if !ok {
+		return domain.Account{}, ErrUserNotFound
+	}
+	return account, nil
+}
+
+func newTestAuthService(t *testing.T) (*AuthService, *testTokens) {
+	t.Helper()
+	accounts := &testAccounts{accounts: map[string]domain.Account{
+		"user1":    {Username: "user1", Active: true},
+		"inactive": {Username: "inactive"},
+	}}
+	tokens := &testTokens{tokens: make(map[string]domain.APIToken)}
+	s := NewAuthService(zap.NewNop().Sugar(), time.Hour, accounts, nil)
+	s.SetTokens(tokens)
+	return s, tokens
+}
+
+func tokenContext(value, scope string) echo.Context {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+value)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	if scope != "" {
+		SetTokenScope(c, scope)
+	}
+	return c
+}
+
+func TestIsTokenAuth(t *testing.T) {
+	tests := map[string]bool{
+		"Bearer gqt_abc":     true,
+		"bearer gqt_abc":     true,
+		"Bearer ":            false,
+		"Bearer":             false,
+		"Bearergqt_abc":      false,
+		"Basic dXNlcjpwdw==": false,
+		"":                   false,
+	}
+	for auth, expected := range tests {
+		if IsTokenAuth(auth) != expected {
+			t.Errorf("%q: expected %v", auth, expected)
+		}
+	}
+}
+
+func TestCreateToken(t *testing.T) {
+	s, tokens := newTestAuthService(t)
+	token, value, err := s.CreateToken("user1", "ci", []string{domain.ScopeUpload}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, tokenPrefix) || len(value) < len(tokenPrefix)+40 {
+		t.Errorf("invalid token value %q", value)
+	}
+	stored, ok := tokens.tokens[hashToken(value)]
+	if !ok || stored.ID != token.ID {
+		t.Fatal("token isn't stored by its hash")
+	}
+	for hash := range tokens.tokens {
+		if strings.Contains(hash, value[len(tokenPrefix):]) {
+			t.Error("token value is stored")
+		}
+	}
+	_, other, err := s.CreateToken("user1", "ci", []string{domain.ScopeUpload}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == value || hashToken(other) == hashToken(value) {
+		t.Error("tokens are not unique")
+	}
+}
+
+func TestTokenUser(t *testing.T) {
+	s, _ := newTestAuthService(t)
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	_, valid, _ := s.CreateToken("user1", "valid", []string{domain.ScopeUpload, domain.ScopeMap}, &future)
+	_, expired, _ := s.CreateToken("user1", "expired", []string{domain.ScopeUpload}, &past)
+	_, inactive, _ := s.CreateToken("inactive", "inactive", []string{domain.ScopeUpload}, nil)
+
+	tests := []struct {
+		name  string
+		value string
+		scope string
+		user  string
+		err   error
+	}{
+		{"valid token", valid, domain.ScopeUpload, "user1", nil},
+		{"other scope", valid, domain.ScopeMap, "user1", nil},
+		{"missing scope", valid, domain.ScopeAdmin, "", ErrTokenScope},
+		{"route without scope", valid, "", "", nil},
+		{"expired token", expired, domain.ScopeUpload, "", ErrInvalidToken},
+		{"inactive account", inactive, domain.ScopeUpload, "", ErrInvalidToken},
+		{"unknown token", tokenPrefix + "unknown", domain.ScopeUpload, "", ErrInvalidToken},
+		{"invalid prefix", "abc", domain.ScopeUpload, "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := s.GetUser(tokenContext(tt.value, tt.scope))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if user.Username != tt.user || user.IsAuthenticated != (tt.user != "") {
+				t.Errorf("unexpected user %+v", user)
+			}
+		})
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	s, tokens := newTestAuthService(t)
+	token, value, err := s.CreateToken("user1", "ci", []string{domain.ScopeUpload}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cached token
+	for i := 0; i < 2; i++ {
+		if _, err := s.GetUser(tokenContext(value, domain.ScopeUpload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tokens.loads != 1 {
+		t.Errorf("token was loaded %d times", tokens.loads)
+	}
+	if err := s.RevokeToken("user2", token.ID); !errors.Is(err, domain.ErrTokenNotExists) {
+		t.Errorf("revoked token of other user: %v", err)
+	}
+	if err := s.RevokeToken("user1", token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUser(tokenContext(value, domain.ScopeUpload)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("revoked token was accepted: %v", err)
+	}
+	if list, _ := s.ListTokens("user1"); len(list) != 0 {
+		t.Errorf("revoked token is listed: %v", list)
+	}
+}
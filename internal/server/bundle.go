@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func (s *Server) handleExportProject(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	if _, err := s.projects.GetProjectInfo(projectName); err != nil {
+		if errors.Is(err, domain.ErrProjectNotExists) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+		}
+		return fmt.Errorf("[handleExportProject] reading project info: %w", err)
+	}
+	c.Response().Header().Set("Content-Type", "application/zip")
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", path.Base(projectName)))
+	c.Response().WriteHeader(http.StatusOK)
+	if err := s.projects.Export(projectName, c.Response()); err != nil {
+		// response is already committed, error can be only logged
+		s.log.Errorw("exporting project", "project", projectName, zap.Error(err))
+	}
+	return nil
+}
+
+func (s *Server) handleImportProject(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	username := c.Param("user")
+	exists, err := s.accountsService.Repository.UsernameExists(username)
+	if err != nil {
+		return fmt.Errorf("[handleImportProject] checking target account: %w", err)
+	}
+	if !exists {
+		return echo.NewHTTPError(http.StatusBadRequest, "Target account does not exists")
+	}
+	req := c.Request()
+	if s.Config.MaxProjectSize > 0 {
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, s.Config.MaxProjectSize)
+	}
+	defer req.Body.Close()
+
+	// zip archive requires random access, so the bundle is stored into temporary file
+	f, err := os.CreateTemp("", "gisquick-import-*.zip")
+	if err != nil {
+		return fmt.Errorf("[handleImportProject] creating temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := io.Copy(f, req.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
+		}
+		return fmt.Errorf("[handleImportProject] receiving project bundle: %w", err)
+	}
+
+	info, err := s.projects.Import(projectName, f, size)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidBundle) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, domain.ErrInvalidProjectName) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid project name")
+		}
+		if errors.Is(err, domain.ErrProjectAlreadyExists) {
+			return echo.NewHTTPError(http.StatusConflict, "Project already exists")
+		}
+		if errors.Is(err, application.ErrAccountProjectsLimit) {
+			return echo.NewHTTPError(http.StatusConflict, "Projects limit was reached")
+		}
+		if errors.Is(err, application.ErrAccountStorageLimit) || errors.Is(err, application.ErrProjectSizeLimit) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		return fmt.Errorf("[handleImportProject] importing project: %w", err)
+	}
+	s.log.Infow("Imported project", "project", projectName)
+	return c.JSON(http.StatusOK, info)
+}
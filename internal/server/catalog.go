@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// handleSearchCatalog searches projects accessible by the current user (?q=text&limit=20&offset=0)
+func (s *Server) handleSearchCatalog() func(echo.Context) error {
+	type queryParams struct {
+		Query  string `query:"q"`
+		Limit  int    `query:"limit"`
+		Offset int    `query:"offset"`
+	}
+	return func(c echo.Context) error {
+		params := queryParams{Limit: 20}
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, &params); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameters")
+		}
+		params.Query = strings.TrimSpace(params.Query)
+		if params.Query == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing search query")
+		}
+		if params.Limit < 0 || params.Offset < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid pagination parameters")
+		}
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		results, total, err := s.projects.SearchCatalog(user, params.Query, params.Limit, params.Offset)
+		if err != nil {
+			return fmt.Errorf("[handleSearchCatalog] searching projects: %w", err)
+		}
+		c.Response().Header().Set(HeaderTotalCount, strconv.Itoa(total))
+		return c.JSON(http.StatusOK, results)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// Max age of the cached content of public projects. Content of other projects can be stored
+// only in the private (browser's) cache and must be always revalidated, as access permissions
+// can change at any time.
+var PublicContentMaxAge = time.Hour
+
+const restrictedCacheControl = "private, no-cache"
+
+func cacheControl(pInfo domain.ProjectInfo) string {
+	if pInfo.Authentication == "public" {
+		return fmt.Sprintf("public, max-age=%d", int(PublicContentMaxAge.Seconds()))
+	}
+	return restrictedCacheControl
+}
+
+// projectCacheControl returns Cache-Control header value by the project's access policy
+func (s *Server) projectCacheControl(projectName string) string {
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return restrictedCacheControl
+	}
+	return cacheControl(pInfo)
+}
+
+// modTimeETag creates weak entity tag from the file's size and modification time
+func modTimeETag(size int64, mtime time.Time) string {
+	return fmt.Sprintf(`W/"%x-%x"`, size, mtime.UnixNano())
+}
+
+func dataETag(data []byte) string {
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf(`"%x"`, h.Sum64())
+}
+
+// projectFileETag returns entity tag based on the file's hash from the files index (when it's
+// up to date), otherwise based on the file's modification time
+func (s *Server) projectFileETag(projectName, path string, finfo os.FileInfo) string {
+	fi, err := s.projects.GetFileInfo(projectName, path)
+	if err == nil && fi.Hash != "" && fi.Size == finfo.Size() && fi.Mtime == finfo.ModTime().Unix() {
+		return fmt.Sprintf(`"%s"`, fi.Hash)
+	}
+	return modTimeETag(finfo.Size(), finfo.ModTime())
+}
+
+func setCacheHeaders(c echo.Context, etag, cacheControl string) {
+	h := c.Response().Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", cacheControl)
+}
+
+// serveFile sends the file with caching headers. Conditional requests (If-None-Match,
+// If-Modified-Since) are handled by http.ServeContent. When etag is empty, it's derived
+// from the file's modification time.
+func serveFile(c echo.Context, path, etag, cacheControl string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	defer f.Close()
+	finfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if finfo.IsDir() {
+		return echo.ErrNotFound
+	}
+	if etag == "" {
+		etag = modTimeETag(finfo.Size(), finfo.ModTime())
+	}
+	setCacheHeaders(c, etag, cacheControl)
+	http.ServeContent(c.Response(), c.Request(), finfo.Name(), finfo.ModTime(), f)
+	return nil
+}
+
+// serveData sends in-memory content with caching headers and handling of conditional requests
+func serveData(c echo.Context, contentType string, data []byte, mtime time.Time, cacheControl string) error {
+	setCacheHeaders(c, dataETag(data), cacheControl)
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	http.ServeContent(c.Response(), c.Request(), "", mtime, bytes.NewReader(data))
+	return nil
+}
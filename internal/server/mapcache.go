@@ -0,0 +1,272 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/mapcache"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// project's data needed for serving of cached map tiles
+type mapcacheProject struct {
+	info     domain.ProjectInfo
+	settings domain.ProjectSettings
+	meta     domain.QgisMeta
+	perms    *domain.UserRolesPermissions
+}
+
+// layerVisible checks whether the layer is published and the user has permission to view it
+func (p mapcacheProject) layerVisible(id string) bool {
+	if p.settings.Layers[id].Flags.Has("excluded") {
+		return false
+	}
+	return p.perms == nil || p.perms.LayerFlags(id).Has("view")
+}
+
+// Loads project's data, when the project has enabled mapcache
+func (s *Server) getMapcacheProject(c echo.Context) (mapcacheProject, error) {
+	projectName := c.Get("project").(string)
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		if errors.Is(err, domain.ErrProjectNotExists) {
+			return mapcacheProject{}, echo.ErrNotFound
+		}
+		return mapcacheProject{}, fmt.Errorf("reading project info: %w", err)
+	}
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return mapcacheProject{}, fmt.Errorf("getting project settings: %w", err)
+	}
+	if !settings.MapCache || len(settings.TileResolutions) == 0 || len(settings.Extent) != 4 {
+		return mapcacheProject{}, echo.NewHTTPError(http.StatusBadRequest, "Mapcache is not enabled")
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		return mapcacheProject{}, fmt.Errorf("parsing qgis meta: %w", err)
+	}
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return mapcacheProject{}, err
+	}
+	return mapcacheProject{
+		info:     pInfo,
+		settings: settings,
+		meta:     meta,
+		perms:    domain.NewUserRolesPermissions(user, settings.Auth),
+	}, nil
+}
+
+// Creates mapcache layer for requested WMS layers, when the project has enabled mapcache
+// and the user has permission to view all of the layers
+func (s *Server) getMapcacheLayer(c echo.Context, layers string) (mapcache.Layer, error) {
+	if layers == "" {
+		return mapcache.Layer{}, echo.NewHTTPError(http.StatusBadRequest, "Missing layers parameter")
+	}
+	p, err := s.getMapcacheProject(c)
+	if err != nil {
+		return mapcache.Layer{}, err
+	}
+	nameToID := make(map[string]string, len(p.meta.Layers))
+	for id, layer := range p.meta.Layers {
+		nameToID[layer.Name] = id
+	}
+	for _, lname := range strings.Split(layers, ",") {
+		id, ok := nameToID[lname]
+		if !ok {
+			return mapcache.Layer{}, echo.NewHTTPError(http.StatusBadRequest, "Unknown layer")
+		}
+		if !p.layerVisible(id) {
+			return mapcache.Layer{}, echo.ErrForbidden
+		}
+	}
+	return s.mapcache.GetLayer(p.info, p.meta, p.settings, layers), nil
+}
+
+func parseTileCoord(value string) (int, error) {
+	// tile's y coordinate can be with file extension
+	if i := strings.IndexByte(value, '.'); i != -1 {
+		value = value[:i]
+	}
+	return strconv.Atoi(value)
+}
+
+// serveMapcacheTile sends cached tile image, tile is rendered when it's not in the cache yet
+func (s *Server) serveMapcacheTile(c echo.Context, tile mapcache.Tile) error {
+	projectName := c.Get("project").(string)
+	if !tile.Layer.ContainsTile(tile) {
+		return echo.NewHTTPError(http.StatusNotFound, "Tile out of grid")
+	}
+	data, mtime, err := s.mapcache.GetTile(projectName, tile)
+	if err != nil {
+		if errors.Is(err, mapcache.ErrMapServer) {
+			return echo.NewHTTPError(http.StatusBadGateway, "Failed to render map tile")
+		}
+		return err
+	}
+	return serveData(c, tile.Layer.Format(), data, mtime, s.projectCacheControl(projectName))
+}
+
+func (s *Server) handleMapcacheTile() func(c echo.Context) error {
+	return func(c echo.Context) error {
+		z, errZ := parseTileCoord(c.Param("z"))
+		x, errX := parseTileCoord(c.Param("x"))
+		y, errY := parseTileCoord(c.Param("y"))
+		if errZ != nil || errX != nil || errY != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid tile coordinates")
+		}
+		layer, err := s.getMapcacheLayer(c, c.QueryParam("LAYERS"))
+		if err != nil {
+			return err
+		}
+		return s.serveMapcacheTile(c, mapcache.Tile{Layer: layer, X: x, Y: y, Z: z})
+	}
+}
+
+func (s *Server) handleMapcacheLegend() func(c echo.Context) error {
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		layer, err := s.getMapcacheLayer(c, c.Param("layer"))
+		if err != nil {
+			return err
+		}
+		legendPath, err := s.mapcache.GetLegendFile(projectName, layer, c.QueryParams())
+		if err != nil {
+			if errors.Is(err, mapcache.ErrMapServer) {
+				return echo.NewHTTPError(http.StatusBadGateway, "Failed to render legend image")
+			}
+			return err
+		}
+		return serveFile(c, legendPath, "", s.projectCacheControl(projectName))
+	}
+}
+
+// invalidateMapcache removes cached data affected by the project change
+func (s *Server) invalidateMapcache(e domain.ProjectEvent) {
+	var err error
+	removed := e.Type == domain.ProjectDeletedEvent || e.Type == domain.ProjectRenamedEvent
+	if removed && s.seeder != nil {
+		if err := s.seeder.RemoveProjectJobs(e.Project); err != nil {
+			s.log.Errorw("removing project seed jobs", "project", e.Project, zap.Error(err))
+		}
+	}
+	if e.Type == domain.FilesChangedEvent {
+		err = s.clearChangedLayers(e.Project, e.Files)
+	} else {
+		err = s.mapcache.Clear(e.Project)
+	}
+	if err != nil {
+		s.log.Errorw("invalidating mapcache", "project", e.Project, "event", e.Type, zap.Error(err))
+	}
+}
+
+// clearChangedLayers removes cached data of layers using any of the changed files,
+// or the whole project cache when the qgis project file was changed
+func (s *Server) clearChangedLayers(projectName string, files []string) error {
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return fmt.Errorf("reading project info: %w", err)
+	}
+	for _, f := range files {
+		if f == pInfo.QgisFile {
+			return s.mapcache.Clear(projectName)
+		}
+	}
+	var meta domain.QgisMeta
+	if err := s.projects.GetQgisMetadata(projectName, &meta); err != nil {
+		if errors.Is(err, domain.ErrProjectNotExists) {
+			return nil
+		}
+		return fmt.Errorf("parsing qgis meta: %w", err)
+	}
+	var layers []string
+	for _, layer := range meta.Layers {
+		for _, f := range files {
+			if layer.UsesFile(projectName, f) {
+				layers = append(layers, layer.Name)
+				break
+			}
+		}
+	}
+	if len(layers) == 0 {
+		return nil
+	}
+	return s.mapcache.ClearLayers(projectName, layers)
+}
+
+func (s *Server) handleClearProjectMapcache(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	var err error
+	if layers := c.QueryParam("layers"); layers != "" {
+		err = s.mapcache.ClearLayers(projectName, strings.Split(layers, ","))
+	} else {
+		err = s.mapcache.Clear(projectName)
+	}
+	if err != nil {
+		return fmt.Errorf("clearing mapcache: %w", err)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (s *Server) handleGetMapcacheStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.mapcache.Stats())
+}
+
+func (s *Server) notifySeedProgress(job mapcache.SeedJob) {
+	owner := strings.Split(job.Project, "/")[0]
+	if err := s.sws.AppChannel().Send(owner, "SeedProgress", job); err != nil {
+		s.log.Errorw("sending seed progress", "project", job.Project, zap.Error(err))
+	}
+}
+
+func (s *Server) handleGetSeedJobs(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	return c.JSON(http.StatusOK, s.seeder.Jobs(projectName))
+}
+
+func (s *Server) handleGetAllSeedJobs(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.seeder.Jobs(""))
+}
+
+func (s *Server) handleCreateSeedJob() func(c echo.Context) error {
+	type seedForm struct {
+		Layers string `json:"layers"`
+		mapcache.SeedParams
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		form := new(seedForm)
+		if err := (&echo.DefaultBinder{}).BindBody(c, form); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid data")
+		}
+		layer, err := s.getMapcacheLayer(c, form.Layers)
+		if err != nil {
+			return err
+		}
+		job, err := s.seeder.Seed(projectName, layer, form.SeedParams)
+		if err != nil {
+			if errors.Is(err, mapcache.ErrInvalidSeedArea) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid zoom range or extent")
+			}
+			return fmt.Errorf("creating seed job: %w", err)
+		}
+		return c.JSON(http.StatusOK, job)
+	}
+}
+
+func (s *Server) handleDeleteSeedJob(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	job, err := s.seeder.GetJob(c.Param("id"))
+	if err != nil || job.Project != projectName {
+		return echo.ErrNotFound
+	}
+	if err := s.seeder.Remove(job.ID); err != nil {
+		return fmt.Errorf("removing seed job: %w", err)
+	}
+	return c.NoContent(http.StatusOK)
+}
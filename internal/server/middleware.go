@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strings"
 
 	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/domain"
@@ -17,6 +18,17 @@ import (
 func LoginRequiredMiddlewareWithConfig(a *auth.AuthService) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if auth.IsTokenAuth(c.Request().Header.Get("Authorization")) {
+				// API tokens are accepted only on routes with token scope
+				user, err := a.GetUser(c)
+				if err != nil {
+					return fmt.Errorf("login required middleware: %w", err)
+				}
+				if !user.IsAuthenticated {
+					return echo.ErrUnauthorized
+				}
+				return next(c)
+			}
 			si, err := a.GetSessionInfo(c)
 			if err != nil {
 				return fmt.Errorf("login required middleware: %w", err)
@@ -91,6 +103,29 @@ func ProjectAdminAccessMiddleware(a *auth.AuthService, ps application.ProjectSer
 	}
 }
 
+// TokenScopeMiddleware allows access with API tokens which have the given scope, it should
+// precede other access middlewares of the route
+func TokenScopeMiddleware(a *auth.AuthService, scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !auth.IsTokenAuth(c.Request().Header.Get("Authorization")) {
+				return next(c)
+			}
+			auth.SetTokenScope(c, scope)
+			if _, err := a.GetUser(c); err != nil {
+				if errors.Is(err, auth.ErrInvalidToken) {
+					return echo.NewHTTPError(http.StatusUnauthorized, "Invalid API token")
+				}
+				if errors.Is(err, auth.ErrTokenScope) {
+					return echo.NewHTTPError(http.StatusForbidden, "API token doesn't have required scope")
+				}
+				return fmt.Errorf("[TokenScopeMiddleware] getting user: %w", err)
+			}
+			return next(c)
+		}
+	}
+}
+
 func MiddlewareErrorHandler(middleware echo.MiddlewareFunc, cb func(e error, c echo.Context) error) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -182,3 +217,27 @@ func getSessionId(c echo.Context) string {
 	}
 	return sessionid
 }
+
+// ProjectRedirectMiddleware redirects requests to renamed projects to the current project's URL
+func ProjectRedirectMiddleware(ps application.ProjectService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			username := c.Param("user")
+			name := c.Param("name")
+			projectName := filepath.Join(username, name)
+			if _, err := ps.GetProjectInfo(projectName); err == nil {
+				return next(c)
+			}
+			newName, err := ps.GetRedirect(projectName)
+			if err != nil {
+				return next(c)
+			}
+			// replace project's name in the request path, by the position of parameters in the route
+			prefix := c.Path()[:strings.Index(c.Path(), ":user")]
+			u := *c.Request().URL
+			u.Path = prefix + newName + strings.TrimPrefix(u.Path, prefix+projectName)
+			u.RawPath = ""
+			return c.Redirect(http.StatusPermanentRedirect, u.String())
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/server/auth"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// testTokens is a tokens repository with a single token
+type testTokens struct {
+	domain.TokensRepository
+	hash  string
+	token domain.APIToken
+}
+
+func (r *testTokens) Create(token domain.APIToken, hash string) error {
+	r.token, r.hash = token, hash
+	return nil
+}
+
+func (r *testTokens) GetByHash(hash string) (domain.APIToken, error) {
+	if hash != r.hash {
+		return domain.APIToken{}, domain.ErrTokenNotExists
+	}
+	return r.token, nil
+}
+
+func (r *testTokens) UpdateLastUsed(id string, t time.Time) error {
+	return nil
+}
+
+type testAccounts struct {
+	domain.AccountsRepository
+}
+
+func (r *testAccounts) GetByUsername(username string) (domain.Account, error) {
+	return domain.Account{Username: username, Active: true}, nil
+}
+
+func TestTokenScopeMiddleware(t *testing.T) {
+	a := auth.NewAuthService(zap.NewNop().Sugar(), time.Hour, &testAccounts{}, nil)
+	a.SetTokens(&testTokens{})
+	_, token, err := a.CreateToken("user1", "ci", []string{domain.ScopeUpload}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	handler := func(c echo.Context) error {
+		user, err := a.GetUser(c)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, user.Username)
+	}
+	e.GET("/upload", handler, TokenScopeMiddleware(a, domain.ScopeUpload))
+	e.GET("/admin", handler, TokenScopeMiddleware(a, domain.ScopeAdmin))
+	e.GET("/other", handler)
+
+	tests := []struct {
+		name   string
+		path   string
+		auth   string
+		status int
+		user   string
+	}{
+		{"token with scope", "/upload", "Bearer " + token, http.StatusOK, "user1"},
+		{"token without scope", "/admin", "Bearer " + token, http.StatusForbidden, ""},
+		{"invalid token", "/upload", "Bearer gqt_invalid", http.StatusUnauthorized, ""},
+		{"route without token access", "/other", "Bearer " + token, http.StatusOK, ""},
+		{"without token", "/upload", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, expected %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.user {
+				t.Errorf("user %q, expected %q", rec.Body.String(), tt.user)
+			}
+		})
+	}
+}
+
+// redirectsTestProjects is a projects service with existing projects and redirects of renamed projects
+type redirectsTestProjects struct {
+	application.ProjectService
+	projects  []string
+	redirects map[string]string
+}
+
+func (s *redirectsTestProjects) GetProjectInfo(projectName string) (domain.ProjectInfo, error) {
+	if !domain.StringArray(s.projects).Has(projectName) {
+		return domain.ProjectInfo{}, domain.ErrProjectNotExists
+	}
+	return domain.ProjectInfo{Name: projectName}, nil
+}
+
+func (s *redirectsTestProjects) GetRedirect(projectName string) (string, error) {
+	newName, ok := s.redirects[projectName]
+	if !ok {
+		return "", domain.ErrProjectNotExists
+	}
+	return newName, nil
+}
+
+func TestProjectRedirectMiddleware(t *testing.T) {
+	ps := &redirectsTestProjects{
+		projects:  []string{"user1/project", "user2/moved"},
+		redirects: map[string]string{"user1/old": "user2/moved", "user1/project": "user1/other"},
+	}
+	e := echo.New()
+	handler := func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Param("user")+"/"+c.Param("name"))
+	}
+	redirect := ProjectRedirectMiddleware(ps)
+	e.GET("/api/map/project/:user/:name", handler, redirect)
+	e.GET("/api/map/ows/:user/:name", handler, redirect)
+	e.GET("/api/project/media/:user/:name/*", handler, redirect)
+
+	tests := []struct {
+		name     string
+		url      string
+		status   int
+		location string
+	}{
+		{"existing project", "/api/map/project/user1/project", http.StatusOK, ""},
+		{"renamed project", "/api/map/project/user1/old", http.StatusPermanentRedirect, "/api/map/project/user2/moved"},
+		{"query parameters", "/api/map/ows/user1/old?SERVICE=WMS&REQUEST=GetMap", http.StatusPermanentRedirect, "/api/map/ows/user2/moved?SERVICE=WMS&REQUEST=GetMap"},
+		{"path after project name", "/api/project/media/user1/old/web/img.png", http.StatusPermanentRedirect, "/api/project/media/user2/moved/web/img.png"},
+		{"unknown project", "/api/map/project/user1/unknown", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, expected %d", rec.Code, tt.status)
+			}
+			if location := rec.Header().Get("Location"); location != tt.location {
+				t.Errorf("location %q, expected %q", location, tt.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderTotalCount contains total number of items of the paginated listing
+const HeaderTotalCount = "X-Total-Count"
+
+func splitParam(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// bindProjectsQuery parses filtering, sorting and pagination parameters of projects listings
+// (?limit=20&offset=40&sort=-last_update&state=published&auth=public,users&projection=EPSG:3857&template=true&q=title)
+func bindProjectsQuery(c echo.Context) (domain.ProjectsQuery, error) {
+	type queryParams struct {
+		Limit      int    `query:"limit"`
+		Offset     int    `query:"offset"`
+		Sort       string `query:"sort"`
+		State      string `query:"state"`
+		Auth       string `query:"auth"`
+		Projection string `query:"projection"`
+		Template   bool   `query:"template"`
+		Search     string `query:"q"`
+	}
+	var params queryParams
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &params); err != nil {
+		return domain.ProjectsQuery{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameters")
+	}
+	query := domain.ProjectsQuery{
+		State:          splitParam(params.State),
+		Authentication: splitParam(params.Auth),
+		Projection:     splitParam(params.Projection),
+		Template:       params.Template,
+		Search:         strings.TrimSpace(params.Search),
+		Sort:           params.Sort,
+		Limit:          params.Limit,
+		Offset:         params.Offset,
+	}
+	if err := query.Validate(); err != nil {
+		return query, echo.NewHTTPError(http.StatusBadRequest, "Invalid sort or pagination parameters")
+	}
+	return query, nil
+}
+
+func projectsPage(c echo.Context, projects []domain.ProjectInfo, total int) error {
+	c.Response().Header().Set(HeaderTotalCount, strconv.Itoa(total))
+	return c.JSON(http.StatusOK, projects)
+}
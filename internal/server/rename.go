@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func (s *Server) handleRenameProject() func(echo.Context) error {
+	type RenameRequest struct {
+		Name string `json:"name"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		var req RenameRequest
+		if err := (&echo.DefaultBinder{}).BindBody(c, &req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if err := domain.ValidateProjectName(req.Name); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid project name")
+		}
+		owner := strings.Split(projectName, "/")[0]
+		username := strings.Split(req.Name, "/")[0]
+		if username != owner {
+			user, err := s.auth.GetUser(c)
+			if err != nil {
+				return err
+			}
+			// only superuser can transfer projects between accounts
+			if !user.IsSuperuser {
+				return echo.NewHTTPError(http.StatusForbidden, "Project can be transferred only by superuser")
+			}
+			exists, err := s.accountsService.Repository.UsernameExists(username)
+			if err != nil {
+				return fmt.Errorf("[handleRenameProject] checking target account: %w", err)
+			}
+			if !exists {
+				return echo.NewHTTPError(http.StatusBadRequest, "Target account does not exists")
+			}
+		}
+		if err := s.projects.Rename(projectName, req.Name); err != nil {
+			if errors.Is(err, domain.ErrProjectNotExists) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+			}
+			if errors.Is(err, domain.ErrProjectAlreadyExists) {
+				return echo.NewHTTPError(http.StatusConflict, "Project already exists")
+			}
+			if errors.Is(err, application.ErrAccountProjectsLimit) {
+				return echo.NewHTTPError(http.StatusConflict, "Projects limit was reached")
+			}
+			if errors.Is(err, application.ErrAccountStorageLimit) || errors.Is(err, application.ErrProjectSizeLimit) {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+			}
+			return fmt.Errorf("[handleRenameProject] renaming project: %w", err)
+		}
+		s.log.Infow("Renamed project", "project", projectName, "new_name", req.Name)
+		info, err := s.projects.GetProjectInfo(req.Name)
+		if err != nil {
+			return fmt.Errorf("[handleRenameProject] reading project info: %w", err)
+		}
+		return c.JSON(http.StatusOK, info)
+	}
+}
+
+// invalidateProjectSessions aborts uploads into removed or renamed projects and notifies
+// owners of renamed projects
+func (s *Server) invalidateProjectSessions(e domain.ProjectEvent) {
+	if e.Type != domain.ProjectDeletedEvent && e.Type != domain.ProjectRenamedEvent {
+		return
+	}
+	if count := s.uploads.AbortProjectUploads(e.Project); count > 0 {
+		s.log.Infow("aborted project uploads", "project", e.Project, "count", count)
+	}
+	if e.Type == domain.ProjectRenamedEvent {
+		type projectRenamed struct {
+			Project string `json:"project"`
+			NewName string `json:"new_name"`
+		}
+		msg := projectRenamed{e.Project, e.NewName}
+		users := []string{strings.Split(e.Project, "/")[0]}
+		if newOwner := strings.Split(e.NewName, "/")[0]; newOwner != users[0] {
+			users = append(users, newOwner)
+		}
+		for _, username := range users {
+			if err := s.sws.AppChannel().Send(username, "ProjectRenamed", msg); err != nil {
+				s.log.Errorw("sending project renamed notification", "user", username, zap.Error(err))
+			}
+		}
+	}
+}
@@ -18,6 +18,14 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	ProjectSuperuserAccess := ProjectSuperuserAccessMiddleware(s.auth, s.projects)
 	ProjectAccess := ProjectAccessMiddleware(s.auth, s.projects, "")
 	ProjectAccessOWS := ProjectAccessMiddleware(s.auth, s.projects, "basic realm=Restricted")
+	ProjectRedirect := ProjectRedirectMiddleware(s.projects)
+
+	// routes accessible with API tokens (scope middleware must precede access middlewares)
+	MapScope := TokenScopeMiddleware(s.auth, domain.ScopeMap)
+	OWSScope := TokenScopeMiddleware(s.auth, domain.ScopeOWS)
+	UploadScope := TokenScopeMiddleware(s.auth, domain.ScopeUpload)
+	SettingsScope := TokenScopeMiddleware(s.auth, domain.ScopeSettings)
+	AdminScope := TokenScopeMiddleware(s.auth, domain.ScopeAdmin)
 
 	e.POST("/api/auth/login", s.handleLogin())
 	e.POST("/api/auth/logout", s.handleLogout)
@@ -25,18 +33,18 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 
 	e.GET("/api/users", s.handleGetUsers, LoginRequired)
 
-	e.GET("/api/admin/config", s.handleAdminConfig, SuperuserRequired)
-	e.GET("/api/admin/users", s.handleGetAllUsers, SuperuserRequired)
-	e.GET("/api/admin/users/:user", s.handleGetUser, SuperuserRequired)
-	e.PUT("/api/admin/users/:user", s.handleUpdateUser(), SuperuserRequired)
-	e.DELETE("/api/admin/users/:user", s.handleDeleteUser, SuperuserRequired)
-	e.POST("/api/admin/user", s.handleCreateUser(), SuperuserRequired)
-	e.POST("/api/admin/email_preview", s.handleGetEmailPreview(), SuperuserRequired)
-	e.POST("/api/admin/email", s.handleSendEmail(), SuperuserRequired)
-	e.POST("/api/admin/send_activation_email", s.handleSendActivationEmail(), SuperuserRequired)
-	e.GET("/api/admin/notifications", s.handleGetNotifications, SuperuserRequired)
-	e.POST("/api/admin/notification", s.handleSaveNotification, SuperuserRequired)
-	e.DELETE("/api/admin/notification/:id", s.handleDeleteNotification, SuperuserRequired)
+	e.GET("/api/admin/config", s.handleAdminConfig, AdminScope, SuperuserRequired)
+	e.GET("/api/admin/users", s.handleGetAllUsers, AdminScope, SuperuserRequired)
+	e.GET("/api/admin/users/:user", s.handleGetUser, AdminScope, SuperuserRequired)
+	e.PUT("/api/admin/users/:user", s.handleUpdateUser(), AdminScope, SuperuserRequired)
+	e.DELETE("/api/admin/users/:user", s.handleDeleteUser, AdminScope, SuperuserRequired)
+	e.POST("/api/admin/user", s.handleCreateUser(), AdminScope, SuperuserRequired)
+	e.POST("/api/admin/email_preview", s.handleGetEmailPreview(), AdminScope, SuperuserRequired)
+	e.POST("/api/admin/email", s.handleSendEmail(), AdminScope, SuperuserRequired)
+	e.POST("/api/admin/send_activation_email", s.handleSendActivationEmail(), AdminScope, SuperuserRequired)
+	e.GET("/api/admin/notifications", s.handleGetNotifications, AdminScope, SuperuserRequired)
+	e.POST("/api/admin/notification", s.handleSaveNotification, AdminScope, SuperuserRequired)
+	e.DELETE("/api/admin/notification/:id", s.handleDeleteNotification, AdminScope, SuperuserRequired)
 
 	if s.Config.SignupAPI {
 		e.POST("/api/accounts/signup", s.handleSignUp())
@@ -48,6 +56,9 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	e.POST("/api/accounts/new_password", s.handleNewPassword())
 	e.POST("/api/accounts/change_password", s.handleChangePassword(), LoginRequired)
 	e.GET("/api/account", s.handleGetAccountInfo(), LoginRequired)
+	e.GET("/api/account/tokens", s.handleGetTokens, LoginRequired)
+	e.POST("/api/account/tokens", s.handleCreateToken(), LoginRequired)
+	e.DELETE("/api/account/tokens/:id", s.handleDeleteToken, LoginRequired)
 	e.GET("/api/auth/user", s.handleGetSessionUser)
 	e.GET("/api/auth/is_authenticated", s.handleGetSessionUser, LoginRequired)
 	e.GET("/api/auth/is_superuser", s.handleGetSessionUser, SuperuserRequired)
@@ -56,37 +67,57 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 
 	// e.POST("/api/map/project/*", s.handleUpdateProject)
 
-	e.POST("/api/project/:user/:name", s.handleCreateProject(), LoginRequired)
-	e.DELETE("/api/project/:user/:name", s.handleDeleteProject, ProjectSuperuserAccess)
-	e.GET("/api/projects", s.handleGetProjects())
-	e.GET("/api/projects/:user", s.handleGetUserProjects, SuperuserRequired)
-	e.POST("/api/project/upload/:user/:name", s.handleUpload(), ProjectAdminAccess)
-
-	e.GET("/api/project/ows/:user/:name", s.handleProjectOws(), ProjectAdminAccess)
-	e.POST("/api/project/ows/:user/:name", s.handleProjectOws(), ProjectAdminAccess)
-	e.GET("/api/project/files/:user/:name", s.handleGetProjectFiles(), ProjectAdminAccess)
-	e.DELETE("/api/project/files/:user/:name", s.handleDeleteProjectFiles(), ProjectAdminAccess)
-	e.GET("/api/project/info/:user/:name", s.handleGetProjectInfo, ProjectAdminAccess)
-	e.GET("/api/project/full-info/:user/:name", s.handleGetProjectFullInfo(), ProjectAdminAccess)
-
-	e.GET("/api/project/media/:user/:name/*", s.mediaFileHandler("/tmp/thumbnails"), ProjectAccess)
+	e.POST("/api/project/:user/:name", s.handleCreateProject(), UploadScope, LoginRequired)
+	e.DELETE("/api/project/:user/:name", s.handleDeleteProject, AdminScope, ProjectSuperuserAccess)
+	e.POST("/api/project/rename/:user/:name", s.handleRenameProject(), AdminScope, ProjectSuperuserAccess)
+	e.POST("/api/project/clone/:user/:name", s.handleCloneProject(), UploadScope, ProjectAccess)
+	e.POST("/api/project/template/:user/:name", s.handleSetProjectTemplate(), AdminScope, ProjectSuperuserAccess)
+	e.GET("/api/project/export/:user/:name", s.handleExportProject, AdminScope, ProjectAdminAccess)
+	e.POST("/api/project/import/:user/:name", s.handleImportProject, AdminScope, ProjectSuperuserAccess)
+	e.GET("/api/projects", s.handleGetProjects(), MapScope)
+	e.GET("/api/projects/templates", s.handleGetTemplates, UploadScope, LoginRequired)
+	e.GET("/api/projects/:user", s.handleGetUserProjects, AdminScope, SuperuserRequired)
+	e.GET("/api/trash", s.handleGetTrash, AdminScope, LoginRequired)
+	e.DELETE("/api/trash", s.handlePurgeTrash, AdminScope, LoginRequired)
+	e.POST("/api/trash/:id/restore", s.handleRestoreTrash, AdminScope, LoginRequired)
+	e.DELETE("/api/trash/:id", s.handlePurgeTrash, AdminScope, LoginRequired)
+	e.GET("/api/catalog", s.handleSearchCatalog(), MapScope)
+	e.POST("/api/project/upload/:user/:name", s.handleUpload(), UploadScope, ProjectAdminAccess)
+	e.POST("/api/project/uploads/:user/:name", s.handleCreateUpload(), UploadScope, ProjectAdminAccess)
+	e.GET("/api/project/uploads/:user/:name/:id", s.handleGetUpload, UploadScope, ProjectAdminAccess)
+	e.DELETE("/api/project/uploads/:user/:name/:id", s.handleAbortUpload, UploadScope, ProjectAdminAccess)
+	e.POST("/api/project/uploads/:user/:name/:id/finalize", s.handleFinalizeUpload, UploadScope, ProjectAdminAccess)
+	e.HEAD("/api/project/uploads/:user/:name/:id/*", s.handleGetUploadFileOffset, UploadScope, ProjectAdminAccess)
+	e.PATCH("/api/project/uploads/:user/:name/:id/*", s.handleUploadChunk, UploadScope, ProjectAdminAccess)
+	e.POST("/api/project/sync/:user/:name", s.handleSyncPlan(), UploadScope, ProjectAdminAccess)
+	e.GET("/api/project/sync/:user/:name/signature/*", s.handleGetFileSignature(), UploadScope, ProjectAdminAccess)
+	e.POST("/api/project/sync/:user/:name/delta/*", s.handleUploadDelta(), UploadScope, ProjectAdminAccess)
+
+	e.GET("/api/project/ows/:user/:name", s.handleProjectOws(), SettingsScope, ProjectAdminAccess)
+	e.POST("/api/project/ows/:user/:name", s.handleProjectOws(), SettingsScope, ProjectAdminAccess)
+	e.GET("/api/project/files/:user/:name", s.handleGetProjectFiles(), UploadScope, ProjectAdminAccess)
+	e.DELETE("/api/project/files/:user/:name", s.handleDeleteProjectFiles(), UploadScope, ProjectAdminAccess)
+	e.GET("/api/project/info/:user/:name", s.handleGetProjectInfo, SettingsScope, ProjectAdminAccess)
+	e.GET("/api/project/full-info/:user/:name", s.handleGetProjectFullInfo(), SettingsScope, ProjectAdminAccess)
+
+	e.GET("/api/project/media/:user/:name/*", s.mediaFileHandler("/tmp/thumbnails"), MapScope, ProjectAccess)
 	e.GET("/api/project/media/:user/:name/web/app/*", s.appMediaFileHandler)
-	e.POST("/api/project/media/:user/:name/*", s.handleUploadMediaFile, ProjectAccess)
-	e.DELETE("/api/project/media/:user/:name/*", s.handleDeleteMediaFile, ProjectAccess)
-	e.POST("/api/project/script/:user/:name", s.handleScriptUpload(), ProjectAdminAccess)
-	e.DELETE("/api/project/script/:user/:name", s.handleDeleteScript(), ProjectAdminAccess)
-
-	e.GET("/api/project/file/:user/:name/*", s.handleProjectFile, ProjectAdminAccess)
-	e.GET("/api/project/download/:user/:name", s.handleDownloadProjectFiles, ProjectAdminAccess)
-	e.GET("/api/project/download/:user/:name/*", s.handleDownloadProjectFiles, ProjectAdminAccess)
-	e.GET("/api/project/inline/:user/:name/*", s.handleInlineProjectFile, ProjectAdminAccess)
-
-	e.POST("/api/project/meta/:user/:name", s.handleUpdateProjectMeta(), ProjectAdminAccess)
-
-	e.POST("/api/project/settings/:user/:name", s.handleSaveProjectSettings, ProjectAdminAccess)
-	e.POST("/api/project/thumbnail/:user/:name", s.handleUploadThumbnail, ProjectAdminAccess)
-	e.GET("/api/project/thumbnail/:user/:name", s.handleGetThumbnail)
-	e.GET("/api/map/project/:user/:name", s.handleGetProject(), MiddlewareErrorHandler(ProjectAccess, func(e error, c echo.Context) error {
+	e.POST("/api/project/media/:user/:name/*", s.handleUploadMediaFile, UploadScope, ProjectAccess)
+	e.DELETE("/api/project/media/:user/:name/*", s.handleDeleteMediaFile, UploadScope, ProjectAccess)
+	e.POST("/api/project/script/:user/:name", s.handleScriptUpload(), SettingsScope, ProjectAdminAccess)
+	e.DELETE("/api/project/script/:user/:name", s.handleDeleteScript(), SettingsScope, ProjectAdminAccess)
+
+	e.GET("/api/project/file/:user/:name/*", s.handleProjectFile, UploadScope, ProjectAdminAccess)
+	e.GET("/api/project/download/:user/:name", s.handleDownloadProjectFiles, UploadScope, ProjectAdminAccess)
+	e.GET("/api/project/download/:user/:name/*", s.handleDownloadProjectFiles, UploadScope, ProjectAdminAccess)
+	e.GET("/api/project/inline/:user/:name/*", s.handleInlineProjectFile, UploadScope, ProjectAdminAccess)
+
+	e.POST("/api/project/meta/:user/:name", s.handleUpdateProjectMeta(), UploadScope, ProjectAdminAccess)
+
+	e.POST("/api/project/settings/:user/:name", s.handleSaveProjectSettings, SettingsScope, ProjectAdminAccess)
+	e.POST("/api/project/thumbnail/:user/:name", s.handleUploadThumbnail, SettingsScope, ProjectAdminAccess)
+	e.GET("/api/project/thumbnail/:user/:name", s.handleGetThumbnail, ProjectRedirect)
+	e.GET("/api/map/project/:user/:name", s.handleGetProject(), MapScope, ProjectRedirect, MiddlewareErrorHandler(ProjectAccess, func(e error, c echo.Context) error {
 		if he, ok := e.(*echo.HTTPError); ok {
 			if he.Code == 401 {
 				projectName := c.Get("project").(string)
@@ -123,12 +154,14 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	}))
 
 	owsHandler := s.handleMapOws()
-	e.GET("/api/map/ows/:user/:name", owsHandler, ProjectAccessOWS)
-	e.POST("/api/map/ows/:user/:name", owsHandler, ProjectAccessOWS)
-	e.GET("/api/map/capabilities/:user/:name", s.handleGetLayerCapabilities(), ProjectAccess)
-	e.GET("/api/map/search/:user/:name/*", s.handleSearch(), ProjectAccess)
+	e.GET("/api/map/ows/:user/:name", owsHandler, OWSScope, ProjectRedirect, ProjectAccessOWS)
+	e.POST("/api/map/ows/:user/:name", owsHandler, OWSScope, ProjectRedirect, ProjectAccessOWS)
+	e.GET("/api/map/capabilities/:user/:name", s.handleGetLayerCapabilities(), MapScope, ProjectRedirect, ProjectAccess)
+	e.GET("/api/map/search/:user/:name/*", s.handleSearch(), MapScope, ProjectAccess)
 
-	e.POST("/api/project/reload/:user/:name", s.handleProjectReload, ProjectAdminAccess)
+	e.POST("/api/project/reload/:user/:name", s.handleProjectReload, SettingsScope, ProjectAdminAccess)
+	e.GET("/api/project/versions/:user/:name", s.handleGetProjectVersions, SettingsScope, ProjectAdminAccess)
+	e.POST("/api/project/versions/:user/:name/:id/rollback", s.handleRollbackProjectVersion, AdminScope, ProjectAdminAccess)
 
 	e.GET("/ws/app", s.handleWebAppWS, LoginRequired)
 	e.GET("/ws/plugin", s.handlePluginWS, LoginRequired)
@@ -143,7 +176,21 @@ func (s *Server) AddRoutes(e *echo.Echo) {
 	// e.GET("/api/map/ows", owsHandler)
 	// e.POST("/api/map/ows", owsHandler)
 
-	// // Mapcache
-	// e.GET("/api/map/tile/:project_hash/tile/:layers_hash/:z/:x/:y", s.handleMapcacheTile())
-	// e.GET("/api/map/tile/:project_hash/legend/:layers_hash/:filename", s.handleMapcacheLegend())
+	// Mapcache
+	if s.mapcache != nil {
+		e.GET("/api/map/tile/:user/:name/tile/:z/:x/:y", s.handleMapcacheTile(), MapScope, ProjectAccess)
+		e.GET("/api/map/tile/:user/:name/legend/:layer", s.handleMapcacheLegend(), MapScope, ProjectAccess)
+		e.DELETE("/api/project/mapcache/:user/:name", s.handleClearProjectMapcache, SettingsScope, ProjectAdminAccess)
+		e.GET("/api/admin/mapcache/stats", s.handleGetMapcacheStats, AdminScope, SuperuserRequired)
+		e.GET("/api/map/wmts/:user/:name", s.handleWMTS(), OWSScope, ProjectAccessOWS)
+		e.GET("/api/map/wmts/:user/:name/tile/:layer/:z/:row/:col", s.handleWMTSTile, OWSScope, ProjectAccessOWS)
+		e.GET("/api/map/xyz/:user/:name", s.handleXYZInfo(), MapScope, ProjectAccess)
+		e.GET("/api/map/xyz/:user/:name/:layers/:z/:x/:y", s.handleXYZTile, OWSScope, ProjectAccessOWS)
+		if s.seeder != nil {
+			e.GET("/api/project/mapcache/seed/:user/:name", s.handleGetSeedJobs, SettingsScope, ProjectAdminAccess)
+			e.POST("/api/project/mapcache/seed/:user/:name", s.handleCreateSeedJob(), SettingsScope, ProjectAdminAccess)
+			e.DELETE("/api/project/mapcache/seed/:user/:name/:id", s.handleDeleteSeedJob, SettingsScope, ProjectAdminAccess)
+			e.GET("/api/admin/mapcache/seed", s.handleGetAllSeedJobs, AdminScope, SuperuserRequired)
+		}
+	}
 }
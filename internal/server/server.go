@@ -10,6 +10,7 @@ import (
 	"github.com/gisquick/gisquick-server/internal/application"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/project"
 	"github.com/gisquick/gisquick-server/internal/infrastructure/ws"
+	"github.com/gisquick/gisquick-server/internal/mapcache"
 	"github.com/gisquick/gisquick-server/internal/server/auth"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	jsoniter "github.com/json-iterator/go"
@@ -49,6 +50,9 @@ type Server struct {
 	notifications   *project.RedisNotificationStore
 	sws             *ws.SettingsWS
 	limiter         application.AccountsLimiter
+	mapcache        *mapcache.Cache
+	seeder          *mapcache.Seeder
+	uploads         *application.UploadsService
 }
 
 type JSONSerializer struct{}
@@ -80,7 +84,7 @@ func (d JSONSerializer) Deserialize(c echo.Context, i interface{}) error {
 
 func NewServer(log *zap.SugaredLogger, cfg Config,
 	as *auth.AuthService, signUpService *application.AccountsService, projects application.ProjectService,
-	sws *ws.SettingsWS, limiter application.AccountsLimiter, notifications *project.RedisNotificationStore) *Server {
+	sws *ws.SettingsWS, limiter application.AccountsLimiter, notifications *project.RedisNotificationStore, mc *mapcache.Cache, seeder *mapcache.Seeder, uploads *application.UploadsService) *Server {
 	e := echo.New()
 	e.HideBanner = true
 
@@ -128,8 +132,18 @@ func NewServer(log *zap.SugaredLogger, cfg Config,
 		sws:             sws,
 		limiter:         limiter,
 		notifications:   notifications,
+		mapcache:        mc,
+		seeder:          seeder,
+		uploads:         uploads,
 	}
 
+	projects.OnChange(s.invalidateProjectSessions)
+	if mc != nil {
+		projects.OnChange(s.invalidateMapcache)
+	}
+	if seeder != nil {
+		seeder.OnProgress = s.notifySeedProgress
+	}
 	// e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 	s.AddRoutes(e)
 	return s
@@ -140,6 +154,13 @@ func (s *Server) ListenAndServe(addr string) error {
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.seeder != nil {
+		s.seeder.Close()
+	}
+	if s.mapcache != nil {
+		s.mapcache.Close()
+	}
+	s.uploads.Close()
 	s.projects.Close()
 	return s.echo.Shutdown(ctx)
 }
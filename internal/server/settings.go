@@ -3,6 +3,7 @@ package server
 import (
 	"archive/zip"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -40,11 +41,28 @@ func (s *Server) handleGetProjectFiles() func(echo.Context) error {
 	}
 	return func(c echo.Context) error {
 		projectName := c.Get("project").(string)
-		files, tmpFiles, err := s.projects.ListProjectFiles(projectName, true)
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		lastNotification := time.Now()
+		progress := func(p domain.ChecksumProgress) {
+			now := time.Now()
+			if p.Files == p.Total || now.Sub(lastNotification).Seconds() > 0.5 {
+				s.sws.AppChannel().Send(user.Username, "ChecksumProgress", p)
+				lastNotification = now
+			}
+		}
+		files, tmpFiles, err := s.projects.ListProjectFilesContext(c.Request().Context(), projectName, true, progress)
 		if err != nil {
 			if errors.Is(err, domain.ErrProjectNotExists) {
 				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
 			}
+			if errors.Is(err, context.Canceled) {
+				// request was cancelled by the client
+				s.log.Infow("listing project files cancelled", "project", projectName)
+				return nil
+			}
 			return fmt.Errorf("handleGetProjectFiles: %w", err)
 		}
 		return c.JSON(http.StatusOK, ProjectFiles{files, tmpFiles})
@@ -67,6 +85,10 @@ func (s *Server) handleGetProjects() func(echo.Context) error {
 		if err := (&echo.DefaultBinder{}).BindQueryParams(c, queryParams); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameters")
 		}
+		query, err := bindProjectsQuery(c)
+		if err != nil {
+			return err
+		}
 		if queryParams.Projects != "" {
 			projectsNames = strings.Split(queryParams.Projects, ",")
 		} else {
@@ -99,30 +121,35 @@ func (s *Server) handleGetProjects() func(echo.Context) error {
 					data = append(data, p)
 				}
 			}
-			return c.JSON(http.StatusOK, data)
+			page, total := query.Apply(data)
+			return projectsPage(c, page, total)
 		}
 		if strings.EqualFold(queryParams.Filter, "accessible") {
-			data, err := s.projects.AccessibleProjects(user.Username, true)
+			data, total, err := s.projects.AccessibleProjects(user.Username, query, true)
 			if err != nil {
 				return fmt.Errorf("getting list of user accessible projects: %w", err)
 			}
-			return c.JSON(http.StatusOK, data)
+			return projectsPage(c, data, total)
 		}
-		data, err := s.projects.GetUserProjects(user.Username)
+		data, total, err := s.projects.GetUserProjects(user.Username, query)
 		if err != nil {
 			return err
 		}
-		return c.JSON(http.StatusOK, data)
+		return projectsPage(c, data, total)
 	}
 }
 
 func (s *Server) handleGetUserProjects(c echo.Context) error {
 	username := c.Param("user")
-	data, err := s.projects.GetUserProjects(username)
+	query, err := bindProjectsQuery(c)
+	if err != nil {
+		return err
+	}
+	data, total, err := s.projects.GetUserProjects(username, query)
 	if err != nil {
 		return err
 	}
-	return c.JSON(http.StatusOK, data)
+	return projectsPage(c, data, total)
 }
 
 func (s *Server) handleDeleteProject(c echo.Context) error {
@@ -550,7 +577,7 @@ func (s *Server) handleGetThumbnail(c echo.Context) error {
 	username := c.Param("user")
 	name := c.Param("name")
 	projectName := filepath.Join(username, name)
-	return c.File(s.projects.GetThumbnailPath(projectName))
+	return serveFile(c, s.projects.GetThumbnailPath(projectName), "", s.projectCacheControl(projectName))
 }
 
 func (s *Server) handleScriptUpload() func(echo.Context) error {
@@ -653,7 +680,7 @@ func (s *Server) handleDeleteScript() func(echo.Context) error {
 func (s *Server) handleProjectFile(c echo.Context) error {
 	projectName := c.Get("project").(string)
 	filePath := c.Param("*")
-	return c.File(filepath.Join(s.Config.ProjectsRoot, projectName, filePath))
+	return c.File(s.projects.GetFilePath(projectName, filePath))
 }
 
 func CopyFile(dest io.Writer, path string) error {
@@ -669,7 +696,7 @@ func CopyFile(dest io.Writer, path string) error {
 func (s *Server) handleDownloadProjectFiles(c echo.Context) error {
 	projectName := c.Get("project").(string)
 	filePath := c.Param("*")
-	fullPath := filepath.Join(s.Config.ProjectsRoot, projectName, filePath)
+	fullPath := s.projects.GetFilePath(projectName, filePath)
 
 	name := filepath.Base(fullPath)
 
@@ -710,7 +737,7 @@ func (s *Server) handleInlineProjectFile(c echo.Context) error {
 	projectName := c.Get("project").(string)
 	filePath := c.Param("*")
 	name := filepath.Base(filePath)
-	return c.Inline(filepath.Join(s.Config.ProjectsRoot, projectName, filePath), name)
+	return c.Inline(s.projects.GetFilePath(projectName, filePath), name)
 }
 
 func (s *Server) handleProjectReload(c echo.Context) error {
@@ -809,14 +836,18 @@ func (s *Server) mediaFileHandler(cacheDir string) func(echo.Context) error {
 			return echo.ErrNotFound
 		}
 
-		absPath := filepath.Join(s.Config.ProjectsRoot, projectName, filePath)
+		absPath := s.projects.GetFilePath(projectName, filePath)
+		srcFinfo, err := os.Stat(absPath)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return echo.ErrNotFound
+			}
+			return err
+		}
+		etag := s.projectFileETag(projectName, filePath, srcFinfo)
 		if cacheDir != "" && strings.EqualFold(c.Request().URL.Query().Get("thumbnail"), "true") {
 			key := filepath.Join(projectName, filePath)
 			val, err, _ := lock.Do(key, func() (interface{}, error) {
-				srcFinfo, err := os.Stat(absPath)
-				if err != nil {
-					return "", err
-				}
 				thumbAbsPath := filepath.Join(cacheDir, key)
 				finfo, err := os.Stat(thumbAbsPath)
 				if err == nil {
@@ -857,10 +888,10 @@ func (s *Server) mediaFileHandler(cacheDir string) func(echo.Context) error {
 				return err
 			}
 			absPath = val.(string)
+			// thumbnail is derived from the source image, so it has the same validity
+			etag = strings.TrimSuffix(etag, `"`) + `-thumb"`
 		}
-		// maybe when media folders permissions will be implemented
-		// c.Response().Header().Set("Cache-Control", "private, must-revalidate")
-		return c.File(absPath)
+		return serveFile(c, absPath, etag, s.projectCacheControl(projectName))
 	}
 }
 
@@ -869,8 +900,8 @@ func (s *Server) appMediaFileHandler(c echo.Context) error {
 	name := c.Param("name")
 	projectName := filepath.Join(username, name)
 	filePath := c.Param("*")
-	absPath := filepath.Join(s.Config.ProjectsRoot, projectName, "web", "app", filePath)
-	return c.File(absPath)
+	absPath := s.projects.GetFilePath(projectName, filepath.Join("web", "app", filePath))
+	return serveFile(c, absPath, "", s.projectCacheControl(projectName))
 }
 
 type MediaFile struct {
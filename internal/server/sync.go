@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gisquick/gisquick-server/internal/infrastructure/delta"
+	"github.com/labstack/echo/v4"
+)
+
+// Files larger than this size are recommended to be uploaded as block deltas
+var DeltaSyncMinSize int64 = 8 * MB
+
+func (s *Server) handleSyncPlan() func(echo.Context) error {
+	type syncRequest struct {
+		Files []domain.ProjectFile `json:"files"`
+		Keep  []string             `json:"keep"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		var req syncRequest
+		if err := (&echo.DefaultBinder{}).BindBody(c, &req); err != nil {
+			return err
+		}
+		files, _, err := s.projects.ListProjectFiles(projectName, false)
+		if err != nil {
+			if errors.Is(err, domain.ErrProjectNotExists) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+			}
+			return fmt.Errorf("[handleSyncPlan] listing project files: %w", err)
+		}
+		return c.JSON(http.StatusOK, domain.PlanSync(files, req.Files, req.Keep, DeltaSyncMinSize))
+	}
+}
+
+// handleGetFileSignature returns blocks signature of the project file for the delta upload
+func (s *Server) handleGetFileSignature() func(echo.Context) error {
+	type queryParams struct {
+		BlockSize int `query:"block_size"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		path := c.Param("*")
+		if !filepath.IsLocal(path) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid file path")
+		}
+		params := queryParams{BlockSize: delta.DefaultBlockSize}
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, &params); err != nil {
+			return err
+		}
+		f, err := os.Open(s.projects.GetFilePath(projectName, path))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return echo.NewHTTPError(http.StatusNotFound, "File does not exists")
+			}
+			return err
+		}
+		defer f.Close()
+		sig, err := delta.NewSignature(f, params.BlockSize)
+		if err != nil {
+			return fmt.Errorf("[handleGetFileSignature] computing signature: %w", err)
+		}
+		return c.JSON(http.StatusOK, sig)
+	}
+}
+
+// handleUploadDelta reconstructs the new version of the project file from the uploaded block delta
+func (s *Server) handleUploadDelta() func(echo.Context) error {
+	type queryParams struct {
+		BlockSize int    `query:"block_size"`
+		Size      int64  `query:"size"`
+		Mtime     int64  `query:"mtime"`
+		Hash      string `query:"hash"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		path := c.Param("*")
+		if !filepath.IsLocal(path) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid file path")
+		}
+		params := queryParams{BlockSize: delta.DefaultBlockSize}
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, &params); err != nil {
+			return err
+		}
+		if params.Hash == "" || params.Size < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Missing or invalid file size and hash")
+		}
+		if s.Config.MaxProjectSize > 0 && params.Size > s.Config.MaxProjectSize {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
+		}
+		if params.BlockSize < delta.MinBlockSize || params.BlockSize > delta.MaxBlockSize {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid block size")
+		}
+		req := c.Request()
+		if s.Config.MaxProjectSize > 0 {
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, s.Config.MaxProjectSize)
+		}
+		finfo := domain.ProjectFile{Path: path, Size: params.Size, Mtime: params.Mtime, Hash: params.Hash}
+		files, err := s.projects.UpdateFileDelta(projectName, finfo, params.BlockSize, req.Body)
+		if err != nil {
+			if errors.Is(err, domain.ErrFileNotExists) {
+				return echo.NewHTTPError(http.StatusNotFound, "File does not exists")
+			}
+			if errors.Is(err, delta.ErrInvalidDelta) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			if errors.Is(err, domain.ErrFileHashMismatch) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Reconstructed file doesn't match declared hash")
+			}
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
+			}
+			return limitError(fmt.Errorf("[handleUploadDelta] updating project file: %w", err))
+		}
+		return c.JSON(http.StatusOK, files)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// canCloneProject checks whether the user can copy the project, templates can be cloned by
+// any user with access to the project, other projects only by their administrators
+func (s *Server) canCloneProject(user domain.User, projectName string) (bool, error) {
+	if user.IsSuperuser || strings.HasPrefix(projectName, user.Username+"/") {
+		return true, nil
+	}
+	pInfo, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return false, err
+	}
+	if pInfo.Template {
+		return true, nil
+	}
+	settings, err := s.projects.GetSettings(projectName)
+	if err != nil {
+		return false, err
+	}
+	return domain.StringArray(settings.SettingsAuth.AdminUsers).Has(user.Username), nil
+}
+
+func (s *Server) handleCloneProject() func(echo.Context) error {
+	type CloneRequest struct {
+		Name string `json:"name"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		if !user.IsAuthenticated {
+			return echo.ErrUnauthorized
+		}
+		var req CloneRequest
+		if err := (&echo.DefaultBinder{}).BindBody(c, &req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if err := domain.ValidateProjectName(req.Name); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid project name")
+		}
+		allowed, err := s.canCloneProject(user, projectName)
+		if err != nil {
+			return fmt.Errorf("[handleCloneProject] checking permissions: %w", err)
+		}
+		if !allowed {
+			return echo.ErrForbidden
+		}
+		username := strings.Split(req.Name, "/")[0]
+		if username != user.Username {
+			// only superuser can create projects for other users
+			if !user.IsSuperuser {
+				return echo.NewHTTPError(http.StatusForbidden, "Project can be created only in your account")
+			}
+			exists, err := s.accountsService.Repository.UsernameExists(username)
+			if err != nil {
+				return fmt.Errorf("[handleCloneProject] checking target account: %w", err)
+			}
+			if !exists {
+				return echo.NewHTTPError(http.StatusBadRequest, "Target account does not exists")
+			}
+		}
+		info, err := s.projects.Clone(projectName, req.Name)
+		if err != nil {
+			if errors.Is(err, domain.ErrProjectNotExists) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+			}
+			if errors.Is(err, domain.ErrProjectAlreadyExists) {
+				return echo.NewHTTPError(http.StatusConflict, "Project already exists")
+			}
+			if errors.Is(err, application.ErrAccountProjectsLimit) {
+				return echo.NewHTTPError(http.StatusConflict, "Projects limit was reached")
+			}
+			if errors.Is(err, application.ErrAccountStorageLimit) || errors.Is(err, application.ErrProjectSizeLimit) {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+			}
+			return fmt.Errorf("[handleCloneProject] cloning project: %w", err)
+		}
+		s.log.Infow("Cloned project", "project", projectName, "new_name", req.Name)
+		return c.JSON(http.StatusOK, info)
+	}
+}
+
+func (s *Server) handleSetProjectTemplate() func(echo.Context) error {
+	type TemplateRequest struct {
+		Template bool `json:"template"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		var req TemplateRequest
+		if err := (&echo.DefaultBinder{}).BindBody(c, &req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request data")
+		}
+		if err := s.projects.SetTemplate(projectName, req.Template); err != nil {
+			if errors.Is(err, domain.ErrProjectNotExists) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+			}
+			return fmt.Errorf("[handleSetProjectTemplate] %w", err)
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+func (s *Server) handleGetTemplates(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return err
+	}
+	templates, err := s.projects.Templates(user.Username)
+	if err != nil {
+		return fmt.Errorf("[handleGetTemplates] %w", err)
+	}
+	return c.JSON(http.StatusOK, templates)
+}
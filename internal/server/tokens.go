@@ -0,0 +1,93 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/gofrs/uuid"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func (s *Server) handleGetTokens(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return fmt.Errorf("[handleGetTokens] %w", err)
+	}
+	tokens, err := s.auth.ListTokens(user.Username)
+	if err != nil {
+		return fmt.Errorf("[handleGetTokens] %w", err)
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+func (s *Server) handleCreateToken() func(echo.Context) error {
+	type Params struct {
+		Name    string     `json:"name"`
+		Scopes  []string   `json:"scopes"`
+		Expires *time.Time `json:"expires"`
+	}
+	type Token struct {
+		domain.APIToken
+		Token string `json:"token"`
+	}
+	return func(c echo.Context) error {
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return fmt.Errorf("[handleCreateToken] %w", err)
+		}
+		params := new(Params)
+		if err := (&echo.DefaultBinder{}).BindBody(c, &params); err != nil {
+			return err
+		}
+		params.Name = strings.TrimSpace(params.Name)
+		if params.Name == "" || len(params.Name) > 100 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid token name")
+		}
+		if len(params.Scopes) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Token scopes are required")
+		}
+		scopes := domain.StringArray{}
+		for _, scope := range params.Scopes {
+			if !domain.TokenScopes.Has(scope) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid token scope: %s", scope))
+			}
+			if !scopes.Has(scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+		if params.Expires != nil && !params.Expires.After(time.Now()) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Token expiration must be in the future")
+		}
+		token, value, err := s.auth.CreateToken(user.Username, params.Name, scopes, params.Expires)
+		if err != nil {
+			s.log.Errorw("creating API token", "user", user.Username, zap.Error(err))
+			return fmt.Errorf("Failed to create API token")
+		}
+		s.log.Infow("Created API token", "user", user.Username, "id", token.ID, "scopes", token.Scopes)
+		return c.JSON(http.StatusOK, Token{APIToken: token, Token: value})
+	}
+}
+
+func (s *Server) handleDeleteToken(c echo.Context) error {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return fmt.Errorf("[handleDeleteToken] %w", err)
+	}
+	id := c.Param("id")
+	if _, err := uuid.FromString(id); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Token does not exists")
+	}
+	if err := s.auth.RevokeToken(user.Username, id); err != nil {
+		if errors.Is(err, domain.ErrTokenNotExists) {
+			return echo.NewHTTPError(http.StatusNotFound, "Token does not exists")
+		}
+		return fmt.Errorf("[handleDeleteToken] %w", err)
+	}
+	s.log.Infow("Revoked API token", "user", user.Username, "id", id)
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// trashOwner returns the account of the managed trash, superusers can manage trash of other
+// users with the 'user' query parameter
+func (s *Server) trashOwner(c echo.Context) (string, error) {
+	user, err := s.auth.GetUser(c)
+	if err != nil {
+		return "", err
+	}
+	if username := c.QueryParam("user"); username != "" && username != user.Username {
+		if !user.IsSuperuser {
+			return "", echo.ErrForbidden
+		}
+		return username, nil
+	}
+	return user.Username, nil
+}
+
+func (s *Server) handleGetTrash(c echo.Context) error {
+	username, err := s.trashOwner(c)
+	if err != nil {
+		return err
+	}
+	items, err := s.projects.ListTrash(username)
+	if err != nil {
+		return fmt.Errorf("[handleGetTrash] %w", err)
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+func (s *Server) handleRestoreTrash(c echo.Context) error {
+	username, err := s.trashOwner(c)
+	if err != nil {
+		return err
+	}
+	item, err := s.projects.RestoreTrash(username, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrTrashItemNotExists) {
+			return echo.NewHTTPError(http.StatusNotFound, "Trash item does not exists")
+		}
+		if errors.Is(err, domain.ErrProjectNotExists) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+		}
+		if errors.Is(err, domain.ErrProjectAlreadyExists) {
+			return echo.NewHTTPError(http.StatusConflict, "Project already exists")
+		}
+		if errors.Is(err, domain.ErrTrashConflict) {
+			return echo.NewHTTPError(http.StatusConflict, "Restored files already exists")
+		}
+		if errors.Is(err, application.ErrAccountProjectsLimit) {
+			return echo.NewHTTPError(http.StatusConflict, "Projects limit was reached")
+		}
+		if errors.Is(err, application.ErrAccountStorageLimit) || errors.Is(err, application.ErrProjectSizeLimit) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		return fmt.Errorf("[handleRestoreTrash] %w", err)
+	}
+	s.log.Infow("Restored from trash", "project", item.Project, "type", item.Type, "id", item.ID)
+	return c.JSON(http.StatusOK, item)
+}
+
+func (s *Server) handlePurgeTrash(c echo.Context) error {
+	username, err := s.trashOwner(c)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	if id := c.Param("id"); id != "" {
+		ids = append(ids, id)
+	}
+	if err := s.projects.PurgeTrash(username, ids...); err != nil {
+		if errors.Is(err, domain.ErrTrashItemNotExists) {
+			return echo.NewHTTPError(http.StatusNotFound, "Trash item does not exists")
+		}
+		return fmt.Errorf("[handlePurgeTrash] %w", err)
+	}
+	return c.NoContent(http.StatusOK)
+}
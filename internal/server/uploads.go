@@ -0,0 +1,163 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gisquick/gisquick-server/internal/application"
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// Resumable uploads (tus-like protocol):
+//  1. POST   /api/project/uploads/:user/:name               declare uploaded files (and removed files)
+//  2. PATCH  /api/project/uploads/:user/:name/:id/<path>    send file's chunk at Upload-Offset
+//  3. HEAD   /api/project/uploads/:user/:name/:id/<path>    get current offset (when resuming)
+//  4. POST   /api/project/uploads/:user/:name/:id/finalize  apply changes to the project
+
+const (
+	HeaderUploadOffset = "Upload-Offset"
+	HeaderUploadLength = "Upload-Length"
+)
+
+func uploadError(err error) error {
+	switch {
+	case errors.Is(err, application.ErrUploadNotExists):
+		return echo.NewHTTPError(http.StatusNotFound, "Upload does not exists")
+	case errors.Is(err, application.ErrUploadFileNotExists):
+		return echo.NewHTTPError(http.StatusNotFound, "File is not declared in the upload")
+	case errors.Is(err, application.ErrUploadOffsetMismatch):
+		return echo.NewHTTPError(http.StatusConflict, "Upload offset doesn't match")
+	case errors.Is(err, application.ErrUploadLocked):
+		return echo.NewHTTPError(http.StatusLocked, "Upload is in progress")
+	case errors.Is(err, application.ErrUploadIncomplete):
+		return echo.NewHTTPError(http.StatusBadRequest, "Upload is not complete")
+	case errors.Is(err, application.ErrUploadSizeExceeded):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Upload exceeds declared file size")
+	}
+	return limitError(err)
+}
+
+// limitError maps errors of exceeded account limits to HTTP errors
+func limitError(err error) error {
+	switch {
+	case errors.Is(err, application.ErrAccountStorageLimit):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached account storage limit")
+	case errors.Is(err, application.ErrProjectSizeLimit):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Reached project size limit.")
+	}
+	return err
+}
+
+// getUpload returns the upload, when it belongs to the project
+func (s *Server) getUpload(c echo.Context) (application.Upload, error) {
+	projectName := c.Get("project").(string)
+	upload, err := s.uploads.Get(c.Param("id"))
+	if err != nil {
+		return upload, uploadError(err)
+	}
+	if upload.Project != projectName {
+		return upload, echo.NewHTTPError(http.StatusNotFound, "Upload does not exists")
+	}
+	return upload, nil
+}
+
+func (s *Server) handleCreateUpload() func(echo.Context) error {
+	type uploadInfo struct {
+		Files   []domain.ProjectFile `json:"files"`
+		Removes []string             `json:"removes"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		user, err := s.auth.GetUser(c)
+		if err != nil {
+			return err
+		}
+		var info uploadInfo
+		if err := (&echo.DefaultBinder{}).BindBody(c, &info); err != nil {
+			return err
+		}
+		if len(info.Files) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "No files specified")
+		}
+		changes := domain.FilesChanges{Updates: info.Files, Removes: info.Removes}
+		upload, err := s.uploads.Create(user.Username, projectName, changes)
+		if err != nil {
+			return uploadError(err)
+		}
+		c.Response().Header().Set(echo.HeaderLocation, c.Request().URL.Path+"/"+upload.ID)
+		return c.JSON(http.StatusCreated, upload)
+	}
+}
+
+func (s *Server) handleGetUpload(c echo.Context) error {
+	upload, err := s.getUpload(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, upload)
+}
+
+func (s *Server) handleGetUploadFileOffset(c echo.Context) error {
+	upload, err := s.getUpload(c)
+	if err != nil {
+		return err
+	}
+	path := c.Param("*")
+	for _, f := range upload.Files {
+		if f.Path == path {
+			h := c.Response().Header()
+			h.Set(HeaderUploadOffset, strconv.FormatInt(upload.Offsets[path], 10))
+			h.Set(HeaderUploadLength, strconv.FormatInt(f.Size, 10))
+			h.Set("Cache-Control", "no-store")
+			return c.NoContent(http.StatusOK)
+		}
+	}
+	return echo.NewHTTPError(http.StatusNotFound, "File is not declared in the upload")
+}
+
+func (s *Server) handleUploadChunk(c echo.Context) error {
+	if _, err := s.getUpload(c); err != nil {
+		return err
+	}
+	offset, err := strconv.ParseInt(c.Request().Header.Get(HeaderUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid Upload-Offset header")
+	}
+	req := c.Request()
+	defer req.Body.Close()
+	newOffset, err := s.uploads.WriteChunk(c.Param("id"), c.Param("*"), offset, req.Body)
+	c.Response().Header().Set(HeaderUploadOffset, strconv.FormatInt(newOffset, 10))
+	if err != nil {
+		return uploadError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) handleFinalizeUpload(c echo.Context) error {
+	upload, err := s.getUpload(c)
+	if err != nil {
+		return err
+	}
+	files, err := s.uploads.Finalize(upload.ID)
+	if err != nil {
+		if he := uploadError(err); he != err {
+			return he
+		}
+		return fmt.Errorf("[handleFinalizeUpload] updating project files: %w", err)
+	}
+	return c.JSON(http.StatusOK, files)
+}
+
+func (s *Server) handleAbortUpload(c echo.Context) error {
+	upload, err := s.getUpload(c)
+	if err != nil {
+		return err
+	}
+	if err := s.uploads.Abort(upload.ID); err != nil {
+		return uploadError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
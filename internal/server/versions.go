@@ -0,0 +1,42 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gisquick/gisquick-server/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) handleGetProjectVersions(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	versions, err := s.projects.ListVersions(projectName)
+	if err != nil {
+		if errors.Is(err, domain.ErrProjectNotExists) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Project does not exists")
+		}
+		return fmt.Errorf("[handleGetProjectVersions] listing versions: %w", err)
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+func (s *Server) handleRollbackProjectVersion(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid version")
+	}
+	if err := s.projects.RestoreVersion(projectName, id); err != nil {
+		if errors.Is(err, domain.ErrVersionNotExists) {
+			return echo.NewHTTPError(http.StatusNotFound, "Version does not exists")
+		}
+		return fmt.Errorf("[handleRollbackProjectVersion] restoring version: %w", err)
+	}
+	info, err := s.projects.GetProjectInfo(projectName)
+	if err != nil {
+		return fmt.Errorf("[handleRollbackProjectVersion] reading project info: %w", err)
+	}
+	return c.JSON(http.StatusOK, info)
+}
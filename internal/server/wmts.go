@@ -0,0 +1,194 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gisquick/gisquick-server/internal/mapcache"
+	"github.com/labstack/echo/v4"
+)
+
+// caseInsensitiveParams returns query parameters with upper-cased names (OGC services
+// parameters names are case insensitive)
+func caseInsensitiveParams(c echo.Context) map[string]string {
+	params := make(map[string]string)
+	for name, values := range c.QueryParams() {
+		if len(values) > 0 {
+			params[strings.ToUpper(name)] = values[0]
+		}
+	}
+	return params
+}
+
+// publishedLayers returns list of layers visible to the user, in the project's layers order
+func (p mapcacheProject) publishedLayers() []mapcache.WMTSLayer {
+	order := p.meta.LayersOrder
+	if len(order) == 0 {
+		for id := range p.meta.Layers {
+			order = append(order, id)
+		}
+		sort.Strings(order)
+	}
+	layers := make([]mapcache.WMTSLayer, 0, len(order))
+	for _, id := range order {
+		lmeta, ok := p.meta.Layers[id]
+		if !ok || len(lmeta.Extent) != 4 || !p.layerVisible(id) {
+			continue
+		}
+		title := lmeta.Title
+		if title == "" {
+			title = lmeta.Name
+		}
+		layers = append(layers, mapcache.WMTSLayer{Name: lmeta.Name, Title: title, Extent: lmeta.Extent})
+	}
+	return layers
+}
+
+// projection returns code of the project's map projection
+func (p mapcacheProject) projection() string {
+	if p.meta.Projection != "" {
+		return p.meta.Projection
+	}
+	return p.info.Projection
+}
+
+func (s *Server) mapServiceURL(service, projectName string) string {
+	return fmt.Sprintf("%s/api/map/%s/%s", strings.TrimRight(s.Config.SiteURL, "/"), service, projectName)
+}
+
+func (s *Server) handleWMTS() func(c echo.Context) error {
+	return func(c echo.Context) error {
+		params := caseInsensitiveParams(c)
+		if service := params["SERVICE"]; service != "" && !strings.EqualFold(service, "WMTS") {
+			return echo.NewHTTPError(http.StatusBadRequest, "Unsupported service")
+		}
+		switch strings.ToLower(params["REQUEST"]) {
+		case "getcapabilities":
+			return s.handleWMTSCapabilities(c)
+		case "gettile":
+			return s.serveTopOriginTile(c, params["LAYER"], params["TILEMATRIX"], params["TILECOL"], params["TILEROW"])
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, "Unsupported request")
+		}
+	}
+}
+
+func (s *Server) handleWMTSCapabilities(c echo.Context) error {
+	projectName := c.Get("project").(string)
+	p, err := s.getMapcacheProject(c)
+	if err != nil {
+		return err
+	}
+	projection := p.projection()
+	title := p.info.Title
+	if title == "" {
+		title = projectName
+	}
+	serviceURL := s.mapServiceURL("wmts", projectName)
+	grid := s.mapcache.GetLayer(p.info, p.meta, p.settings, "")
+	doc, err := mapcache.WMTSCapabilities(mapcache.WMTSConfig{
+		Title:         title,
+		ServiceURL:    serviceURL,
+		TileURL:       serviceURL + "/tile/{Layer}/{TileMatrix}/{TileRow}/{TileCol}." + strings.TrimPrefix(grid.Format(), "image/"),
+		Projection:    projection,
+		Geographic:    p.meta.Projections[projection] != nil && p.meta.Projections[projection].IsGeografic,
+		MetersPerUnit: mapcache.MetersPerUnit(p.meta.Projections[projection]),
+		Grid:          grid,
+		Layers:        p.publishedLayers(),
+	})
+	if err != nil {
+		return fmt.Errorf("generating wmts capabilities: %w", err)
+	}
+	return c.Blob(http.StatusOK, "application/xml", doc)
+}
+
+// serveTopOriginTile serves tile addressed by coordinates with origin in the top left corner
+func (s *Server) serveTopOriginTile(c echo.Context, layers, z, x, y string) error {
+	zoom, errZ := parseTileCoord(z)
+	col, errX := parseTileCoord(x)
+	row, errY := parseTileCoord(y)
+	if errZ != nil || errX != nil || errY != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid tile coordinates")
+	}
+	layer, err := s.getMapcacheLayer(c, layers)
+	if err != nil {
+		return err
+	}
+	if zoom < 0 || zoom >= len(layer.Resolutions) {
+		return echo.NewHTTPError(http.StatusNotFound, "Tile out of grid")
+	}
+	return s.serveMapcacheTile(c, layer.TopOriginTile(zoom, col, row))
+}
+
+func (s *Server) handleWMTSTile(c echo.Context) error {
+	layer, err := url.PathUnescape(c.Param("layer"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid layer name")
+	}
+	return s.serveTopOriginTile(c, layer, c.Param("z"), c.Param("col"), c.Param("row"))
+}
+
+func (s *Server) handleXYZTile(c echo.Context) error {
+	layers, err := url.PathUnescape(c.Param("layers"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid layers")
+	}
+	return s.serveTopOriginTile(c, layers, c.Param("z"), c.Param("x"), c.Param("y"))
+}
+
+// handleXYZInfo returns XYZ URL templates of the project's layers with the grid definition,
+// which is needed for clients to set up the tile grid (e.g. OpenLayers TileGrid)
+func (s *Server) handleXYZInfo() func(c echo.Context) error {
+	type layerInfo struct {
+		Name  string `json:"name"`
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	}
+	type xyzInfo struct {
+		Projection  string      `json:"projection"`
+		Extent      []float64   `json:"extent"`
+		Origins     [][]float64 `json:"origins"`
+		Resolutions []float64   `json:"resolutions"`
+		TileSize    int         `json:"tile_size"`
+		MinZoom     int         `json:"min_zoom"`
+		MaxZoom     int         `json:"max_zoom"`
+		Layers      []layerInfo `json:"layers"`
+	}
+	return func(c echo.Context) error {
+		projectName := c.Get("project").(string)
+		p, err := s.getMapcacheProject(c)
+		if err != nil {
+			return err
+		}
+		grid := s.mapcache.GetLayer(p.info, p.meta, p.settings, "")
+		// top left origins of the grid differs on zoom levels, because the mapcache grid
+		// is aligned to the bottom left corner of the extent
+		origins := make([][]float64, len(grid.Resolutions))
+		for z, res := range grid.Resolutions {
+			_, rows := grid.MatrixSize(z)
+			origins[z] = []float64{grid.Extent[0], grid.Extent[1] + float64(rows*grid.TileSize)*res}
+		}
+		data := xyzInfo{
+			Projection:  p.projection(),
+			Extent:      grid.Extent,
+			Origins:     origins,
+			Resolutions: grid.Resolutions,
+			TileSize:    grid.TileSize,
+			MinZoom:     0,
+			MaxZoom:     len(grid.Resolutions) - 1,
+			Layers:      []layerInfo{},
+		}
+		baseURL := s.mapServiceURL("xyz", projectName)
+		for _, l := range p.publishedLayers() {
+			data.Layers = append(data.Layers, layerInfo{
+				Name:  l.Name,
+				Title: l.Title,
+				URL:   fmt.Sprintf("%s/%s/{z}/{x}/{y}.png", baseURL, url.PathEscape(l.Name)),
+			})
+		}
+		return c.JSON(http.StatusOK, data)
+	}
+}
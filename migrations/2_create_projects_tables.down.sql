@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS project_users;
+DROP TABLE IF EXISTS projects;
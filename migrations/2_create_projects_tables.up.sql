@@ -0,0 +1,25 @@
+CREATE TABLE projects (
+	"name" varchar(255) PRIMARY KEY,
+	"username" varchar(30) NOT NULL,
+	"title" text NOT NULL,
+	"qgis_file" text NOT NULL,
+	"projection" varchar(50) NOT NULL,
+	"authentication" varchar(30) NOT NULL,
+	"state" varchar(30) NOT NULL,
+	"size" bigint NOT NULL,
+	"thumbnail" bool NOT NULL,
+	"mapcache" bool NOT NULL,
+	"created_at" timestamptz NULL,
+	"last_update" timestamptz NULL
+);
+
+CREATE INDEX projects_username_idx ON projects USING btree (username);
+CREATE INDEX projects_authentication_idx ON projects USING btree (authentication);
+
+CREATE TABLE project_users (
+	"project" varchar(255) NOT NULL REFERENCES projects (name) ON DELETE CASCADE ON UPDATE CASCADE,
+	"username" varchar(30) NOT NULL,
+	PRIMARY KEY (project, username)
+);
+
+CREATE INDEX project_users_username_idx ON project_users USING btree (username);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS projects_search_idx;
+ALTER TABLE projects DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE projects DROP COLUMN IF EXISTS catalog_text;
+ALTER TABLE projects DROP COLUMN IF EXISTS catalog_layers;
@@ -0,0 +1,9 @@
+ALTER TABLE projects ADD COLUMN "catalog_layers" text NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN "catalog_text" text NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN "search_vector" tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('simple', catalog_layers), 'B') ||
+	setweight(to_tsvector('simple', catalog_text), 'C')
+) STORED;
+
+CREATE INDEX projects_search_idx ON projects USING gin (search_vector);
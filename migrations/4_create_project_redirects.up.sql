@@ -0,0 +1,7 @@
+CREATE TABLE project_redirects (
+	"old_name" varchar(255) PRIMARY KEY,
+	"new_name" varchar(255) NOT NULL,
+	"created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX project_redirects_new_name_idx ON project_redirects USING btree (new_name);
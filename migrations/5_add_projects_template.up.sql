@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN "template" bool NOT NULL DEFAULT false;
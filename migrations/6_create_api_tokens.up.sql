@@ -0,0 +1,12 @@
+CREATE TABLE api_tokens (
+	"id" uuid PRIMARY KEY,
+	"username" varchar(30) NOT NULL REFERENCES users (username) ON DELETE CASCADE ON UPDATE CASCADE,
+	"name" varchar(100) NOT NULL,
+	"token_hash" varchar(64) NOT NULL UNIQUE,
+	"scopes" varchar(255) NOT NULL,
+	"created_at" timestamptz NOT NULL DEFAULT now(),
+	"expires_at" timestamptz NULL,
+	"last_used_at" timestamptz NULL
+);
+
+CREATE INDEX api_tokens_username_idx ON api_tokens USING btree (username);